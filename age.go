@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"authinator/pkg/auther"
+)
+
+// ageIdentityPaths returns the files to read age identities from:
+// --age-identity, then AUTHER_AGE_IDENTITY (a list separated like PATH), then
+// whichever of the default SSH keys exist.
+func ageIdentityPaths() []string {
+	if len(options.ageIdentities) > 0 {
+		return options.ageIdentities
+	}
+	if env := os.Getenv("AUTHER_AGE_IDENTITY"); env != "" {
+		return filepath.SplitList(env)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, name := range []string{"id_ed25519", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// loadAgeIdentities is the auther.AgeIdentitiesFunc for the data file and
+// imported files.
+func loadAgeIdentities() ([]auther.AgeIdentityFile, error) {
+	paths := ageIdentityPaths()
+	if len(paths) == 0 {
+		return nil, errors.New("no identity files; pass --age-identity or set AUTHER_AGE_IDENTITY")
+	}
+	var files []auther.AgeIdentityFile
+	for _, path := range paths {
+		file, err := auther.ReadAgeIdentityFile(path, func() ([]byte, error) {
+			return readPassword(fmt.Sprintf("Passphrase for %s: ", path))
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ageRecipientsFlag registers --age-recipient, which encrypt and export use to
+// encrypt with age.
+func ageRecipientsFlag(fs *flag.FlagSet) *stringList {
+	var recipients stringList
+	fs.Var(&recipients, "age-recipient", "encrypt with age to this recipient, an age1... key or an SSH public key (repeatable)")
+	return &recipients
+}
+
+// mustParseAgeRecipients checks recipients given with --age-recipient,
+// exiting with status 2 if any of them is invalid.
+func mustParseAgeRecipients(recipients []string) {
+	if _, err := auther.ParseAgeRecipients(recipients); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// dataAgeRecipients returns the age recipients the data file is encrypted to,
+// or nil if it isn't encrypted with age or hasn't been loaded.
+func dataAgeRecipients() []string {
+	if dataFileBackend == nil {
+		return nil
+	}
+	return dataFileBackend.AgeRecipients()
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// The agent keeps the key of a passphrase-encrypted data file in memory after
+// authinator unlock, so that other commands don't ask for the passphrase
+// until it has gone unused for the unlock timeout or authinator lock is run.
+// It holds the key derived from the passphrase, never the passphrase itself,
+// and nothing it holds is written to disk. It runs as a detached copy of this
+// binary and listens on a unix socket in a directory only the user can
+// enter; both ends of every connection check that the other runs as the same
+// user before anything else is said.
+
+// agentCommand is the hidden command that runs the agent.
+const agentCommand = "__agent"
+
+// agentGreeting is the first line the agent writes on a connection, once it
+// has checked who is on the other end.
+const agentGreeting = "authinator-agent 1"
+
+const (
+	defaultUnlockTimeout = 15 * time.Minute
+	// agentStartTimeout is how long a new agent waits for a key before
+	// exiting, in case the unlock that started it never sends one.
+	agentStartTimeout = 10 * time.Second
+	agentIOTimeout    = 5 * time.Second
+)
+
+// errNoAgent is returned when no agent is running.
+var errNoAgent = errors.New("no agent is running")
+
+// agentRequest is what a command sends the agent. Op is "ping", "put" (store
+// Key for the data file at Path for Timeout, or for as long as the key it
+// replaces if Timeout is zero), "get" (return the key for Path if it has the
+// salt Salt) or "lock" (forget every key and exit).
+type agentRequest struct {
+	Op      string        `json:"op"`
+	Path    string        `json:"path,omitempty"`
+	Salt    []byte        `json:"salt,omitempty"`
+	Key     []byte        `json:"key,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type agentResponse struct {
+	Key   []byte `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// runtimeDir returns the directory of the files that only matter while
+// authinator runs, such as the agent's socket and serve's PID file:
+// $XDG_RUNTIME_DIR/authinator, or authinator-<uid> in the temporary
+// directory, which on Windows is the user's own.
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "authinator")
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.TempDir(), "authinator")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("authinator-%d", os.Getuid()))
+}
+
+func agentSocketPath() string {
+	return filepath.Join(runtimeDir(), "agent.sock")
+}
+
+// makeRuntimeDir creates the runtime directory if needed and checks that only
+// the user can enter it, since in a shared temporary directory someone else
+// may have created it first.
+func makeRuntimeDir() error {
+	dir := runtimeDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || !privateDir(info) {
+		return fmt.Errorf("%s must be a directory that only you own and can access (mode 0700)", dir)
+	}
+	return nil
+}
+
+// checkPeer checks that the process on the other end of conn runs as the
+// same user.
+func checkPeer(conn *net.UnixConn) error {
+	uid, err := peerUID(conn)
+	if err != nil {
+		return err
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("the process on %s runs as another user (uid %d)", conn.RemoteAddr(), uid)
+	}
+	return nil
+}
+
+// agentCall sends req to the agent and returns its answer, or errNoAgent if
+// none is running.
+func agentCall(req agentRequest) (agentResponse, error) {
+	var resp agentResponse
+	c, err := net.DialTimeout("unix", agentSocketPath(), agentIOTimeout)
+	if err != nil {
+		return resp, errNoAgent
+	}
+	defer c.Close()
+	conn := c.(*net.UnixConn)
+	conn.SetDeadline(time.Now().Add(agentIOTimeout))
+	// The agent is checked too, so the key is never handed to a process of
+	// another user that took over the socket.
+	if err := checkPeer(conn); err != nil {
+		return resp, fmt.Errorf("refusing to talk to the agent: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	greeting, err := r.ReadString('\n')
+	if err != nil || strings.TrimSpace(greeting) != agentGreeting {
+		return resp, errors.New("the agent didn't answer as expected")
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("reading the agent's answer: %w", err)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// agentPath is the data file at path as the agent knows it, so that one
+// agent can hold the keys of several data files.
+func agentPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// agentKey is the auther.FileBackend CachedKey of the data file: the key a
+// running agent holds for it, or nil, in which case the passphrase is asked
+// for as usual.
+func agentKey(salt []byte) *auther.Key {
+	return agentKeyFor(dataPath, salt)
+}
+
+// agentKeyFor returns the key the agent holds for the data file at path, if
+// it has the given salt.
+func agentKeyFor(path string, salt []byte) *auther.Key {
+	if !agentSupported {
+		return nil
+	}
+	resp, err := agentCall(agentRequest{Op: "get", Path: agentPath(path), Salt: salt})
+	if err != nil || resp.Key == nil {
+		return nil
+	}
+	var key auther.Key
+	if err := key.UnmarshalBinary(resp.Key); err != nil {
+		return nil
+	}
+	return &key
+}
+
+// startAgent starts the agent, unless one is running already, and waits
+// until it answers.
+func startAgent() error {
+	_, err := agentCall(agentRequest{Op: "ping"})
+	if err == nil || !errors.Is(err, errNoAgent) {
+		return err
+	}
+	if err := makeRuntimeDir(); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, agentCommand)
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	deadline := time.Now().Add(agentIOTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("the agent exited right away (%v)", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if _, err := agentCall(agentRequest{Op: "ping"}); !errors.Is(err, errNoAgent) {
+			return err
+		}
+	}
+	return errors.New("the agent didn't start in time")
+}
+
+// unlockCommand reads the data file, asking for its passphrase unless the
+// agent already has the key, and hands the key to the agent.
+func unlockCommand(args []string) {
+	const usage = "unlock [--timeout 15m]"
+	fs := newFlagSet("unlock", usage)
+	timeout := fs.Duration("timeout", defaultUnlockTimeout, "forget the key after it has gone unused this long")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 || *timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+	if !agentSupported {
+		fmt.Fprintln(os.Stderr, "unlock isn't supported on this platform.")
+		os.Exit(1)
+	}
+
+	mustOpenBackend()
+	if dataFileBackend == nil {
+		fmt.Fprintf(os.Stderr, "The %s backend doesn't support encryption, so there is nothing to unlock.\n", backendName())
+		os.Exit(1)
+	}
+	data := mustLoadData()
+	key := dataFileBackend.Key()
+	if key == nil {
+		fmt.Fprintln(os.Stderr, "The data file isn't encrypted with a passphrase, so there is nothing to unlock.")
+		os.Exit(1)
+	}
+	// A file in the old format derives its key differently, so it is saved
+	// in the current one for the agent's key to open it.
+	if content, err := os.ReadFile(dataPath); err == nil && auther.FileSalt(content) == nil {
+		mustSaveData(data)
+	}
+
+	if err := startAgent(); err != nil {
+		fatal(fmt.Errorf("starting the agent: %w", err))
+	}
+	b, _ := key.MarshalBinary()
+	if _, err := agentCall(agentRequest{Op: "put", Path: agentPath(dataPath), Key: b, Timeout: *timeout}); err != nil {
+		fatal(fmt.Errorf("handing the key to the agent: %w", err))
+	}
+	fmt.Printf("Unlocked until the data file goes unused for %s, or authinator lock.\n", shortDuration(*timeout))
+}
+
+// lockCommand makes the agent forget every key it holds and exit.
+func lockCommand(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator lock")
+		os.Exit(2)
+	}
+	_, err := agentCall(agentRequest{Op: "lock"})
+	if errors.Is(err, errNoAgent) {
+		fmt.Println("Nothing to lock; no agent is running.")
+		return
+	}
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println("Locked. The agent has forgotten the key.")
+}
+
+// replaceAgentKey hands the agent newKey in place of oldKey, if it holds
+// oldKey, keeping its timeout.
+func replaceAgentKey(oldKey, newKey *auther.Key) {
+	if agentKeyFor(dataPath, oldKey.Salt()) == nil {
+		return
+	}
+	b, _ := newKey.MarshalBinary()
+	if _, err := agentCall(agentRequest{Op: "put", Path: agentPath(dataPath), Key: b}); err != nil {
+		slog.Warn("couldn't hand the new key to the agent", "err", err)
+	}
+}
+
+// shortDuration formats d without the zero minutes or seconds that
+// time.Duration.String adds, such as 15m rather than 15m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// agentEntry is a key the agent holds, and the timer that forgets it.
+type agentEntry struct {
+	key     *auther.Key
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+type agent struct {
+	mu       sync.Mutex
+	keys     map[string]*agentEntry
+	listener *net.UnixListener
+}
+
+// runAgent is the agent process. It exits once it holds no keys: when the
+// last one times out, on lock, or if no key arrives soon after it starts.
+func runAgent(args []string) {
+	if len(args) != 0 || !agentSupported {
+		os.Exit(2)
+	}
+	if err := makeRuntimeDir(); err != nil {
+		os.Exit(1)
+	}
+	path := agentSocketPath()
+	// A socket that answers belongs to an agent that is already running;
+	// one that doesn't was left behind by one that died.
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		os.Exit(0)
+	}
+	os.Remove(path)
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		os.Exit(1)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		os.Exit(1)
+	}
+
+	a := &agent{keys: map[string]*agentEntry{}, listener: l}
+	time.AfterFunc(agentStartTimeout, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if len(a.keys) == 0 {
+			a.listener.Close()
+		}
+	})
+	for {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return
+		}
+		go a.serve(conn)
+	}
+}
+
+// serve answers one request. Connections from other users are closed
+// without a word.
+func (a *agent) serve(conn *net.UnixConn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentIOTimeout))
+	if err := checkPeer(conn); err != nil {
+		return
+	}
+	fmt.Fprintln(conn, agentGreeting)
+
+	var req agentRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	json.NewEncoder(conn).Encode(a.handle(req))
+	if req.Op == "lock" {
+		a.listener.Close()
+	}
+}
+
+func (a *agent) handle(req agentRequest) agentResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch req.Op {
+	case "ping":
+		return agentResponse{}
+	case "put":
+		var key auther.Key
+		err := key.UnmarshalBinary(req.Key)
+		auther.Wipe(req.Key)
+		if err != nil {
+			return agentResponse{Error: err.Error()}
+		}
+		timeout := req.Timeout
+		old := a.keys[req.Path]
+		if old != nil && timeout == 0 {
+			timeout = old.timeout
+		}
+		if req.Path == "" || timeout <= 0 {
+			return agentResponse{Error: "put needs a path and a timeout"}
+		}
+		if old != nil {
+			old.timer.Stop()
+			old.key.Wipe()
+		}
+		entry := &agentEntry{key: &key, timeout: timeout}
+		entry.timer = time.AfterFunc(timeout, func() { a.forget(req.Path, entry) })
+		a.keys[req.Path] = entry
+		return agentResponse{}
+	case "get":
+		entry := a.keys[req.Path]
+		if entry == nil || !bytes.Equal(entry.key.Salt(), req.Salt) {
+			return agentResponse{}
+		}
+		entry.timer.Reset(entry.timeout)
+		b, _ := entry.key.MarshalBinary()
+		return agentResponse{Key: b}
+	case "lock":
+		for path, entry := range a.keys {
+			entry.timer.Stop()
+			entry.key.Wipe()
+			delete(a.keys, path)
+		}
+		return agentResponse{}
+	default:
+		return agentResponse{Error: fmt.Sprintf("unknown request %q", req.Op)}
+	}
+}
+
+// forget drops entry, the key for path, once it has gone unused for its
+// timeout, and stops the agent if that was the last key.
+func (a *agent) forget(path string, entry *agentEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.keys[path] != entry {
+		return
+	}
+	entry.key.Wipe()
+	delete(a.keys, path)
+	if len(a.keys) == 0 {
+		a.listener.Close()
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// The agent needs to know who is on the other end of its socket, which is
+// only implemented for Linux and macOS.
+const agentSupported = false
+
+func peerUID(conn *net.UnixConn) (int, error) {
+	return 0, errors.New("checking the peer of a socket isn't supported on this platform")
+}
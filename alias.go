@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"authinator/pkg/auther"
+)
+
+const aliasUsage = "Usage: authinator alias add [alias] [name] | alias remove [alias] | alias list [name]"
+
+func aliasCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, aliasUsage)
+		os.Exit(2)
+	}
+	action, args := args[0], args[1:]
+
+	switch {
+	case action == "add" && len(args) == 2:
+		addAlias(args[0], args[1])
+	case action == "remove" && len(args) == 1:
+		removeAlias(args[0])
+	case action == "list" && len(args) <= 1:
+		listAliases(args)
+	default:
+		fmt.Fprintln(os.Stderr, aliasUsage)
+		os.Exit(2)
+	}
+}
+
+func addAlias(alias, name string) {
+	var target string
+	err := mustOpenStore().Update(func(v *TOTPData) error {
+		if err := v.AddAlias(name, alias); err != nil {
+			return err
+		}
+		target = v.Entries[v.Index(name)].Name
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, auther.ErrNotFound):
+		reportErrorf("No entry found with the name: %s", name)
+		os.Exit(exitNotFound)
+	case errors.Is(err, auther.ErrExists):
+		reportErrorf("%s", conflictMessage(err, alias))
+		os.Exit(1)
+	default:
+		fatal(err)
+	}
+
+	if options.json {
+		printJSON(map[string]any{"alias": alias, "name": target})
+		return
+	}
+	fmt.Printf("'%s' is now an alias of '%s'.\n", alias, target)
+}
+
+func removeAlias(alias string) {
+	var target string
+	err := mustOpenStore().Update(func(v *TOTPData) error {
+		var err error
+		target, err = v.RemoveAlias(alias)
+		return err
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, auther.ErrAliasNotFound):
+		reportErrorf("No entry has the alias: %s", alias)
+		os.Exit(exitNotFound)
+	default:
+		fatal(err)
+	}
+
+	if options.json {
+		printJSON(map[string]any{"alias": alias, "name": target, "removed": true})
+		return
+	}
+	fmt.Printf("Removed the alias '%s' of '%s'.\n", alias, target)
+}
+
+// listAliases lists every alias, or those of the entry named in args.
+func listAliases(args []string) {
+	entries := mustLoadData().Entries
+	if len(args) == 1 {
+		entries = []TOTPEntry{mustFindEntry(args[0])}
+	}
+
+	type aliasView struct {
+		Alias string `json:"alias"`
+		Name  string `json:"name"`
+	}
+	aliases := []aliasView{}
+	for _, entry := range entries {
+		for _, alias := range entry.Aliases {
+			aliases = append(aliases, aliasView{alias, entry.Name})
+		}
+	}
+
+	if options.json {
+		printJSON(aliases)
+		return
+	}
+	if len(aliases) == 0 {
+		fmt.Println("No aliases found.")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALIAS\tNAME")
+	for _, a := range aliases {
+		fmt.Fprintf(tw, "%s\t%s\n", a.Alias, a.Name)
+	}
+	tw.Flush()
+}
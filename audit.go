@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// The audit log records what was done with the entries, from the command
+// line and over HTTP, one JSON object per line in audit.log in the config
+// directory: creating, editing, renaming, removing, importing and exporting
+// entries, generating codes, verifying them, and API requests turned away
+// for lack of a valid token. It never records a secret or a code. Once the
+// log reaches auditMaxSize it is renamed to audit.log.1, pushing older ones
+// back to audit.log.<auditKeep>, and a new one is started.
+const (
+	auditFile    = "audit.log"
+	auditMaxSize = 5 << 20
+	auditKeep    = 3
+)
+
+// Audit sources and outcomes.
+const (
+	auditCLI  = "cli"
+	auditHTTP = "http"
+
+	auditOK           = "ok"
+	auditFailed       = "failed"
+	auditNotFound     = "not_found"
+	auditValid        = "valid"
+	auditInvalid      = "invalid"
+	auditUnauthorized = "unauthorized"
+	auditRateLimited  = "rate_limited"
+	auditReadOnly     = "read_only"
+	auditForbidden    = "forbidden"
+)
+
+// auditEvent is one line of the audit log. Remote is the client address of
+// an HTTP request and User the user who sent it, if it was authenticated as
+// one rather than with a token, and Detail says more about what was done,
+// such as the new name of a renamed entry.
+type auditEvent struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Remote  string    `json:"remote,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Action  string    `json:"action"`
+	Entry   string    `json:"entry,omitempty"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+var (
+	// auditDisabled turns the audit log off, for serve --audit off.
+	auditDisabled bool
+
+	auditMu   sync.Mutex
+	auditWarn sync.Once
+)
+
+func auditPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, auditFile), nil
+}
+
+// recordAudit appends e to the audit log. The log never stops a command or
+// a request; failing to write it only gets a warning, once.
+func recordAudit(e auditEvent) {
+	if auditDisabled {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := appendAudit(e); err != nil {
+		auditWarn.Do(func() {
+			slog.Warn("couldn't write the audit log", "err", err)
+		})
+	}
+}
+
+// logAudit records what a command did with entry. Commands run against a
+// server with --remote are recorded by the server instead.
+func logAudit(action, entry, outcome string) {
+	if remoteAddress() != "" {
+		return
+	}
+	recordAudit(auditEvent{Source: auditCLI, Action: action, Entry: entry, Outcome: outcome})
+}
+
+// logAuditDetail is logAudit with a detail.
+func logAuditDetail(action, entry, outcome, detail string) {
+	if remoteAddress() != "" {
+		return
+	}
+	recordAudit(auditEvent{Source: auditCLI, Action: action, Entry: entry, Outcome: outcome, Detail: detail})
+}
+
+// logRemoved records that the entry name was moved to the trash, or deleted
+// for good if purge is set.
+func logRemoved(name string, purge bool) {
+	detail := ""
+	if purge {
+		detail = "purged"
+	}
+	logAuditDetail("remove", name, auditOK, detail)
+}
+
+func appendAudit(e auditEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	path, err := auditPath()
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil && info.Size()+int64(len(line)) > auditMaxSize {
+		rotateAudit(path)
+	}
+	// Each line goes out in a single write to a file opened for appending,
+	// so lines from the CLI and a server running at the same time don't
+	// interleave.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotateAudit moves audit.log to audit.log.1 and the older logs back one,
+// dropping the oldest.
+func rotateAudit(path string) {
+	os.Remove(fmt.Sprintf("%s.%d", path, auditKeep))
+	for i := auditKeep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	os.Rename(path, path+".1")
+}
+
+// auditNote is what a handler adds to the audit event of its request: the
+// entry, when it isn't in the path, an outcome or detail that the status
+// doesn't tell, and the user requireAuth authenticated.
+type auditNote struct {
+	entry, outcome, detail, user string
+}
+
+type auditNoteKey struct{}
+
+// noteAudit returns the audit note of r, which handlers fill in. Requests
+// that aren't audited get one that is thrown away.
+func noteAudit(r *http.Request) *auditNote {
+	if note, ok := r.Context().Value(auditNoteKey{}).(*auditNote); ok {
+		return note
+	}
+	return &auditNote{}
+}
+
+// auditRequests records every API request in the audit log, including those
+// requireAuth turns away, with the client address as clientIP gives it.
+func auditRequests(trustProxy bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, entry := auditAction(r)
+		note := &auditNote{entry: entry}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), auditNoteKey{}, note)))
+		if action == "" {
+			return
+		}
+
+		outcome := note.outcome
+		switch {
+		case outcome != "":
+		case rec.status == 0 || rec.status < 300:
+			outcome = auditOK
+		case rec.status == http.StatusUnauthorized:
+			outcome = auditUnauthorized
+		case rec.status == http.StatusNotFound:
+			outcome = auditNotFound
+		case rec.status == http.StatusTooManyRequests:
+			outcome = auditRateLimited
+		default:
+			outcome = auditFailed
+		}
+		recordAudit(auditEvent{
+			Source:  auditHTTP,
+			Remote:  clientIP(r, trustProxy),
+			User:    note.user,
+			Action:  action,
+			Entry:   note.entry,
+			Outcome: outcome,
+			Detail:  note.detail,
+		})
+	})
+}
+
+// auditAction names what an API request does, as its audit action, going by
+// the route it matched, and the entry in its path. Requests that don't do anything, such as ones with an
+// unsupported method, have no action.
+func auditAction(r *http.Request) (action, entry string) {
+	route, ok := matchedRoute(r)
+	if !ok {
+		return "", ""
+	}
+	if route.action != "list" {
+		return route.action, r.PathValue("name")
+	}
+	switch {
+	case wantsEventStream(r):
+		return "stream", ""
+	case r.URL.Query().Get("codes") == "true":
+		return "code", ""
+	case r.URL.Query().Get("include_secrets") == "true":
+		return "export", ""
+	default:
+		return "list", ""
+	}
+}
+
+// auditCommand prints the newest events of the audit log, rotated logs
+// included: audit tail [-n count] [--since time].
+func auditCommand(args []string) {
+	const usage = "audit tail [-n count] [--since time|duration]"
+	if len(args) == 0 || args[0] != "tail" {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+	fs := newFlagSet("audit tail", usage)
+	n := fs.Int("n", 50, "how many events to print, newest last (0 for every one)")
+	since := fs.String("since", "", "only print events from this time on: RFC3339, a date such as 2024-06-01, or a duration such as 24h ago")
+	rest, err := parseFlags(fs, args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(rest) != 0 || *n < 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+	var from time.Time
+	if *since != "" {
+		if from, err = parseSince(*since, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	events, err := readAudit(from)
+	if err != nil {
+		fatal(err)
+	}
+	if *n > 0 && len(events) > *n {
+		events = events[len(events)-*n:]
+	}
+	if options.json {
+		if events == nil {
+			events = []auditEvent{}
+		}
+		printJSON(events)
+		return
+	}
+	if len(events) == 0 {
+		fmt.Println("No audit events found.")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSOURCE\tACTION\tENTRY\tOUTCOME\tDETAIL")
+	for _, e := range events {
+		source := e.Source
+		if e.Remote != "" {
+			source += " " + e.Remote
+		}
+		if e.User != "" {
+			source += " (" + e.User + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04:05"), source, e.Action, e.Entry, e.Outcome, e.Detail)
+	}
+	tw.Flush()
+}
+
+// parseSince parses --since: an RFC3339 time, a date, or a duration before
+// now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(strings.TrimSuffix(strings.TrimSpace(s), " ago")); err == nil {
+		return now.Add(-d), nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use RFC3339, e.g. 2024-06-01T12:00:00Z, a date such as 2024-06-01, or a duration such as 24h or 7d", s)
+}
+
+// readAudit reads the events of the audit log and its rotated copies from
+// from on, oldest first. Lines that don't parse are skipped.
+func readAudit(from time.Time) ([]auditEvent, error) {
+	path, err := auditPath()
+	if err != nil {
+		return nil, err
+	}
+	var events []auditEvent
+	for i := auditKeep; i >= 0; i-- {
+		name := path
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", path, i)
+		}
+		f, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var e auditEvent
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Time.Before(from) {
+				continue
+			}
+			events = append(events, e)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const tokenFile = "token"
+
+// serverToken returns the API token for serve: the --token flag, then
+// AUTHER_TOKEN, then the token saved in the config directory. If none exists
+// yet a new one is generated and saved, and generated is true.
+func serverToken(flagValue string) (token string, generated bool, err error) {
+	if flagValue != "" {
+		return flagValue, false, nil
+	}
+	if env := os.Getenv("AUTHER_TOKEN"); env != "" {
+		return env, false, nil
+	}
+	return savedSecret(tokenFile)
+}
+
+// savedSecret returns the random secret saved as file in the config
+// directory, generating and saving one if none exists yet, in which case
+// generated is true.
+func savedSecret(file string) (secret string, generated bool, err error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", false, err
+	}
+	secret, err = readSavedSecret(dir, file)
+	if err == nil {
+		return secret, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	secret = hex.EncodeToString(b)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", false, err
+	}
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", false, fmt.Errorf("saving %s: %w", path, err)
+	}
+	return secret, true, nil
+}
+
+// readSavedToken reads the token serve saved in dir. An empty file counts as
+// missing.
+func readSavedToken(dir string) (string, error) {
+	return readSavedSecret(dir, tokenFile)
+}
+
+// readSavedSecret reads the secret saved as file in dir. An empty file counts
+// as missing.
+func readSavedSecret(dir, file string) (string, error) {
+	path := filepath.Join(dir, file)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", os.ErrNotExist
+	}
+	return secret, nil
+}
+
+// serveAuthHelp ends serve --help with how the ways of authenticating go
+// together.
+const serveAuthHelp = `
+Authentication:
+  Unless --no-auth is given, every API request needs one of:
+  1. the --trust-auth-header header, if set; a request carrying it is taken
+     to come from the user it names, whatever else it carries, so only the
+     reverse proxy must be able to reach the server.
+  2. 'Authorization: Bearer <token>' with the serve token (--token,
+     AUTHER_TOKEN or the saved one) or a named token from token create.
+  3. 'Authorization: Basic' with a user and password of --basic-auth.
+  A wrong token or password gets 401 even if another way is set up. Users of
+  --basic-auth and --trust-auth-header may do anything, like the serve token,
+  and are recorded in the audit log.
+`
+
+// apiAuth is how serve tells who sent a request: by its token, by the users
+// of --basic-auth, and by the header of --trust-auth-header, in which a
+// reverse proxy in front of it names the user it already authenticated.
+type apiAuth struct {
+	token       string
+	basic       []basicAuthUser
+	trustHeader string
+
+	// checked caches the SHA-256 of the Basic credentials that matched,
+	// with their user, as bcrypt is meant to be slow.
+	checked sync.Map
+}
+
+// basicAuthUser is a user of --basic-auth, with the bcrypt hash of their
+// password.
+type basicAuthUser struct {
+	name string
+	hash []byte
+}
+
+// parseBasicAuth parses the user:bcrypt-hash values of --basic-auth, as
+// htpasswd -nB prints them.
+func parseBasicAuth(values []string) ([]basicAuthUser, error) {
+	var users []basicAuthUser
+	for _, v := range values {
+		name, hash, ok := strings.Cut(v, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --basic-auth %q: use user:bcrypt-hash, as htpasswd -nB prints it", v)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid --basic-auth for %s: the password must be a bcrypt hash, as htpasswd -nB prints it: %v", name, err)
+		}
+		if slices.ContainsFunc(users, func(u basicAuthUser) bool { return u.name == name }) {
+			return nil, fmt.Errorf("--basic-auth is given twice for %s", name)
+		}
+		users = append(users, basicAuthUser{name: name, hash: []byte(hash)})
+	}
+	return users, nil
+}
+
+// basicUser returns the user the Basic credentials user and password are, if
+// they match one. Every user's hash is compared, whether its name matches or
+// not, so the time taken doesn't tell which users exist.
+func (a *apiAuth) basicUser(user, password string) (string, bool) {
+	key := sha256.Sum256([]byte(user + ":" + password))
+	if name, ok := a.checked.Load(key); ok {
+		return name.(string), true
+	}
+	found := false
+	for _, u := range a.basic {
+		match := bcrypt.CompareHashAndPassword(u.hash, []byte(password)) == nil
+		if subtle.ConstantTimeCompare([]byte(user), []byte(u.name)) == 1 && match {
+			found = true
+		}
+	}
+	if found {
+		a.checked.Store(key, user)
+	}
+	return user, found
+}
+
+// requireAuth rejects requests it can't tell the sender of with 401
+// Unauthorized. If --trust-auth-header is set, a request carrying that header
+// is taken to come from the user it names, whatever else it carries. Other
+// requests must have an Authorization header: "Bearer <token>" with the
+// serve token, which may do anything, or a named one from token create, or
+// "Basic" with a user and password of --basic-auth, which may do anything
+// too. A named token whose role doesn't allow the request gets 403 Forbidden.
+func requireAuth(auth *apiAuth, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var named apiToken
+		header := r.Header.Get("Authorization")
+		given, bearer := strings.CutPrefix(header, "Bearer ")
+		user, password, basic := r.BasicAuth()
+		switch {
+		case auth.trustHeader != "" && r.Header.Get(auth.trustHeader) != "":
+			named.Role = roleAdmin
+			noteAudit(r).user = r.Header.Get(auth.trustHeader)
+		case bearer && subtle.ConstantTimeCompare([]byte(given), []byte(auth.token)) == 1:
+			named.Role = roleAdmin
+		case bearer:
+			named, _ = findAPIToken(given)
+		case basic && len(auth.basic) > 0:
+			if name, ok := auth.basicUser(user, password); ok {
+				named.Role = roleAdmin
+				noteAudit(r).user = name
+			}
+		}
+		if named.Role == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="authinator"`)
+			if len(auth.basic) > 0 {
+				w.Header().Add("WWW-Authenticate", `Basic realm="authinator", charset="UTF-8"`)
+			}
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		if needed := requiredRole(r); !roleAllows(named.Role, needed) {
+			noteAudit(r).outcome = auditForbidden
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("the token %s has the %s role, but this request needs %s", named.Name, named.Role, needed))
+			return
+		}
+		if len(named.Tags) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, named))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredRole returns the role a token needs for r, going by what it does
+// as auditAction names it. Codes of every entry, or every entry with a tag,
+// tell which entries there are, so they need a token that may list them.
+func requiredRole(r *http.Request) string {
+	action, entry := auditAction(r)
+	switch action {
+	case "list":
+		return roleRead
+	case "code", "stream":
+		if entry == "" && len(r.URL.Query()["names"]) == 0 {
+			return roleRead
+		}
+		return roleCodes
+	case "verify", "":
+		// Requests that do nothing are left for the handlers to turn
+		// away.
+		return roleCodes
+	default:
+		return roleAdmin
+	}
+}
+
+// serverReadOnly records whether serve was started with --read-only. The
+// server then doesn't save anything, not even when a code was last used.
+var serverReadOnly bool
+
+// rejectWrites answers requests that would change entries with 403
+// Forbidden and a "read_only" error, for serve --read-only. Listing entries,
+// getting codes and verifying codes keep working.
+func rejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+		case "POST":
+			if route, ok := matchedRoute(r); ok && route.action == "verify" {
+				break
+			}
+			fallthrough
+		default:
+			noteAudit(r).outcome = auditReadOnly
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error":   "read_only",
+				"message": "the server is read-only; it was started with --read-only and doesn't accept changes",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
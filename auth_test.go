@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routePath is the path of route under /v1, for the entry github.
+func routePath(route apiRoute) string {
+	return apiV1 + strings.ReplaceAll(route.path, "{name}", "github")
+}
+
+func TestRequireAuthOnEveryRoute(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "github"})
+	tests := []struct {
+		name, header string
+		status       int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "Bearer wrong-token", http.StatusUnauthorized},
+		{"not bearer", "Token " + testToken, http.StatusUnauthorized},
+		{"prefix", "Bearer " + testToken[:len(testToken)-1], http.StatusUnauthorized},
+		{"valid", "Bearer " + testToken, 0},
+	}
+	for _, route := range v1Routes() {
+		for _, tt := range tests {
+			r := newRequest(route.method, routePath(route), "")
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := serve(h, r)
+			switch {
+			case tt.status != 0 && w.Code != tt.status:
+				t.Errorf("%s %s, %s token: status %d, want %d", route.method, route.path, tt.name, w.Code, tt.status)
+			case tt.status == 0 && (w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden):
+				t.Errorf("%s %s, %s token: status %d", route.method, route.path, tt.name, w.Code)
+			case w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer"):
+				t.Errorf("%s %s, %s token: WWW-Authenticate %q", route.method, route.path, tt.name, w.Header().Get("WWW-Authenticate"))
+			}
+		}
+	}
+}
+
+func TestHealthChecksNeedNoToken(t *testing.T) {
+	h := newTestAPI(t)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if w := request(h, "GET", path, "", ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s without a token: status %d: %s", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestServerToken(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AUTHER_TOKEN", "")
+
+	saved, generated, err := serverToken("")
+	if err != nil || !generated || len(saved) != 64 {
+		t.Fatalf("first start: token %q, generated %v, error %v", saved, generated, err)
+	}
+	again, generated, err := serverToken("")
+	if err != nil || generated || again != saved {
+		t.Errorf("second start: token %q, generated %v, error %v; want the saved %q", again, generated, err, saved)
+	}
+
+	t.Setenv("AUTHER_TOKEN", "from-env")
+	if token, _, _ := serverToken(""); token != "from-env" {
+		t.Errorf("with AUTHER_TOKEN: token %q", token)
+	}
+	if token, _, _ := serverToken("from-flag"); token != "from-flag" {
+		t.Errorf("with --token: token %q", token)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	serverReadOnly = true
+	h := newTestAPI(t, TOTPEntry{Name: "github"})
+	entry, _ := serverStore.Get("github")
+	code, err := entry.Code(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range v1Routes() {
+		body := `{"name": "new", "secret": "` + testSecret + `"}`
+		if route.action == "verify" {
+			body = `{"code": "` + code + `"}`
+		}
+		r := newRequest(route.method, routePath(route), body)
+		r.Header.Set("Authorization", "Bearer "+testToken)
+		if route.action == "stream" {
+			// The entry stays, so the stream only ends with the request.
+			ctx, cancel := context.WithCancel(r.Context())
+			cancel()
+			r = r.WithContext(ctx)
+		}
+		w := serve(h, r)
+		if route.method == "GET" || route.action == "verify" {
+			if w.Code == http.StatusForbidden {
+				t.Errorf("%s %s: status 403 on a read-only server", route.method, route.path)
+			}
+			continue
+		}
+		var resp struct{ Error string }
+		decodeBody(t, w, &resp)
+		if w.Code != http.StatusForbidden || resp.Error != "read_only" {
+			t.Errorf("%s %s: status %d, error %q; want 403 read_only", route.method, route.path, w.Code, resp.Error)
+		}
+	}
+	if entries := serverStore.List(); len(entries) != 1 || entries[0].Name != "github" {
+		t.Errorf("entries changed on a read-only server: %+v", entries)
+	}
+}
+
+// TestRemoteReadOnly checks the error --remote gives for a read-only server.
+func TestRemoteReadOnly(t *testing.T) {
+	serverReadOnly = true
+	srv := httptest.NewServer(newTestAPI(t, TOTPEntry{Name: "github"}))
+	defer srv.Close()
+	t.Setenv("AUTHER_TOKEN", testToken)
+	c, err := newRemoteClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, err := c.Entries(""); err != nil || len(entries) != 1 {
+		t.Errorf("listing entries: %v, %v", entries, err)
+	}
+	changes := map[string]func() error{
+		"add":    func() error { return c.Add(TOTPEntry{Name: "new", Secret: testSecret}) },
+		"trash":  func() error { return c.MoveToTrash("github") },
+		"remove": func() error { return c.Remove("github") },
+	}
+	for name, change := range changes {
+		err := change()
+		if err == nil || !strings.Contains(err.Error(), "server is read-only") {
+			t.Errorf("%s: error %v, want one saying the server is read-only", name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"authinator/pkg/auther"
+	"authinator/pkg/auther/keyring"
+	"authinator/pkg/auther/sqlite"
+)
+
+// Storage backends selectable with --backend.
+const (
+	backendJSON    = "json"
+	backendSQLite  = "sqlite"
+	backendKeyring = "keyring"
+)
+
+// backendName returns the storage backend to use: --backend, then
+// AUTHER_BACKEND, then the JSON data file.
+func backendName() string {
+	if options.backend != "" {
+		return options.backend
+	}
+	if env := os.Getenv("AUTHER_BACKEND"); env != "" {
+		return env
+	}
+	return backendJSON
+}
+
+func checkBackend() error {
+	switch backendName() {
+	case backendJSON, backendSQLite, backendKeyring:
+		return nil
+	default:
+		return fmt.Errorf("unknown backend %q (use json, sqlite or keyring)", backendName())
+	}
+}
+
+// defaultDataFile is the name of the data file in the config directory.
+func defaultDataFile() string {
+	if backendName() == backendSQLite {
+		return "totp.db"
+	}
+	return dataFile
+}
+
+// dataBackend is the backend for the data file, wrapped to take automatic
+// snapshots.
+var dataBackend *snapshotBackend
+
+// dataFileBackend is the JSON data file behind dataBackend, unless the SQLite
+// backend is used.
+var dataFileBackend *auther.FileBackend
+
+// openBackend returns the backend for the data file, opening it on first use.
+func openBackend() (auther.Backend, error) {
+	if dataBackend != nil {
+		return dataBackend, nil
+	}
+	if _, err := os.Stat(dataPath); err == nil {
+		checkPermissions(dataPath)
+	}
+	var b auther.Backend
+	switch backendName() {
+	case backendSQLite:
+		db, err := sqlite.Open(dataPath)
+		if err != nil {
+			return nil, err
+		}
+		b = db
+	case backendKeyring:
+		dataFileBackend = newFileBackend()
+		b = keyring.New(dataFileBackend, keyring.DefaultService)
+	default:
+		dataFileBackend = newFileBackend()
+		b = dataFileBackend
+	}
+	dataBackend = &snapshotBackend{Backend: b}
+	return dataBackend, nil
+}
+
+// newFileBackend returns the backend for the JSON data file, which gets its
+// key from the agent or asks for its passphrase, reads age identities, or
+// runs gpg, when it turns out to be encrypted.
+func newFileBackend() *auther.FileBackend {
+	b := auther.NewFileBackend(dataPath, unlockPassphrase)
+	b.CachedKey = agentKey
+	b.FIDO2, b.FIDO2Fallback = newFIDO2(), fido2Fallback
+	b.AgeIdentities = loadAgeIdentities
+	b.GPG = newGPG()
+	return b
+}
+
+// mustOpenBackend opens the backend for a CLI command, exiting if it can't be
+// opened.
+func mustOpenBackend() auther.Backend {
+	b, err := openBackend()
+	if err != nil {
+		fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// Backups are vault files in the backups directory named
+// backup-<timestamp>.json, with the time in UTC.
+const (
+	backupPrefix    = "backup-"
+	backupExt       = ".json"
+	backupTimestamp = "20060102-150405"
+)
+
+// backupDir returns the directory backups are written to.
+func backupDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups"), nil
+}
+
+// backupFile is a backup in the backups directory.
+type backupFile struct {
+	Timestamp string    `json:"timestamp"`
+	Created   time.Time `json:"created"`
+	Path      string    `json:"path"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// listBackups returns the backups with the given prefix, oldest first.
+func listBackups(prefix string) ([]backupFile, error) {
+	dir, err := backupDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"*"+backupExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, path := range paths {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), backupExt)
+		if len(stamp) < len(backupTimestamp) {
+			continue
+		}
+		created, err := time.ParseInLocation(backupTimestamp, stamp[:len(backupTimestamp)], time.UTC)
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backupFile{Timestamp: stamp, Created: created, Path: path, Encrypted: isEncryptedFile(content)})
+	}
+
+	// Backups written in the same second get a numeric suffix.
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.Before(backups[j].Created)
+		}
+		return len(backups[i].Timestamp) < len(backups[j].Timestamp) ||
+			len(backups[i].Timestamp) == len(backups[j].Timestamp) && backups[i].Timestamp < backups[j].Timestamp
+	})
+	return backups, nil
+}
+
+// writeBackup saves v as a new backup with the given prefix, encrypted with
+// key unless it is nil, and returns its path. Without a key, the backup of a
+// data file encrypted with age or GnuPG is encrypted to the same recipients.
+func writeBackup(prefix string, v TOTPData, key *auther.Key) (string, error) {
+	dir, err := backupDir()
+	if err != nil {
+		return "", err
+	}
+	stamp := time.Now().UTC().Format(backupTimestamp)
+	path := filepath.Join(dir, prefix+stamp+backupExt)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s%s.%d%s", prefix, stamp, n, backupExt))
+	}
+	switch {
+	case key == nil && dataAgeRecipients() != nil:
+		err = auther.WriteAgeFile(path, v, dataAgeRecipients())
+	case key == nil && dataGPGRecipients() != nil:
+		err = auther.WriteGPGFile(path, v, dataGPGRecipients(), dataFileBackend.GPG)
+	default:
+		err = auther.WriteFileWithKey(path, v, key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("writing backup: %w", err)
+	}
+	return path, nil
+}
+
+// pruneBackups removes all but the newest keep backups with the given prefix
+// and returns how many it removed.
+func pruneBackups(prefix string, keep int) (int, error) {
+	backups, err := listBackups(prefix)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for len(backups)-removed > keep {
+		if err := os.Remove(backups[removed].Path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// mustLoadVaultForBackup loads every entry and the trash, secrets included,
+// for writing to a backup.
+func mustLoadVaultForBackup() TOTPData {
+	data := mustLoadData()
+	if err := loadVaultSecrets(data); err != nil {
+		fatal(err)
+	}
+	return data
+}
+
+func backupCommand(args []string) {
+	fs := newFlagSet("backup", "backup [--encrypt] [--keep n] | backup --list")
+	list := fs.Bool("list", false, "list the existing backups instead of writing one")
+	encrypt := fs.Bool("encrypt", false, "encrypt the backup with a passphrase")
+	keep := fs.Int("keep", 0, "remove all but the newest n backups afterwards")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 || *keep < 0 || (*list && flagsGiven(fs, "encrypt", "keep")) {
+		fmt.Fprintln(os.Stderr, "Usage: authinator backup [--encrypt] [--keep n] | backup --list")
+		os.Exit(2)
+	}
+
+	if *list {
+		listBackupsCommand()
+		return
+	}
+
+	data := mustLoadVaultForBackup()
+
+	// A backup of an encrypted vault is encrypted with the same key, so it
+	// never holds the secrets in the clear.
+	key := dataKey()
+	if key == nil && *encrypt {
+		p, err := readPassphrase("Backup passphrase: ")
+		if err != nil {
+			fatal(fmt.Errorf("reading passphrase: %w", err))
+		}
+		if len(p) == 0 {
+			fmt.Fprintln(os.Stderr, "Passphrase must not be empty.")
+			os.Exit(1)
+		}
+		if os.Getenv("AUTHER_PASSPHRASE") == "" {
+			confirm, err := readPassphrase("Confirm passphrase: ")
+			if err != nil {
+				fatal(fmt.Errorf("reading passphrase: %w", err))
+			}
+			if !bytes.Equal(p, confirm) {
+				fmt.Fprintln(os.Stderr, "Passphrases do not match.")
+				os.Exit(1)
+			}
+		}
+		if key, err = auther.NewKey(p); err != nil {
+			fatal(err)
+		}
+	}
+
+	path, err := writeBackup(backupPrefix, data, key)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Backed up %d entries to %s\n", len(data.Entries), path)
+
+	if *keep > 0 {
+		removed, err := pruneBackups(backupPrefix, *keep)
+		if err != nil {
+			fatal(fmt.Errorf("removing old backups: %w", err))
+		}
+		if removed > 0 {
+			fmt.Printf("Removed %d old backups.\n", removed)
+		}
+	}
+}
+
+func listBackupsCommand() {
+	backups, err := listBackups(backupPrefix)
+	if err != nil {
+		fatal(err)
+	}
+	if options.json {
+		if backups == nil {
+			backups = []backupFile{}
+		}
+		printJSON(backups)
+		return
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups found.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIMESTAMP\tCREATED\tENCRYPTED")
+	for _, b := range backups {
+		encrypted := "no"
+		if b.Encrypted {
+			encrypted = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", b.Timestamp, b.Created.Local().Format("2006-01-02 15:04:05"), encrypted)
+	}
+	tw.Flush()
+}
+
+// resolveBackup finds the backup named by a timestamp from backup --list,
+// or by a path.
+func resolveBackup(arg string) (string, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, nil
+	}
+	dir, err := backupDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix+arg+backupExt)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("no backup %q (see authinator backup --list)", arg)
+	}
+	return path, nil
+}
+
+// readBackup reads and checks a backup. An encrypted backup is first tried
+// with the vault's own key, which opens the backups written since the
+// passphrase was last set, and then with its passphrase, if it was asked for.
+func readBackup(path string) (TOTPData, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return TOTPData{}, err
+	}
+	ask := func() ([]byte, error) { return readPassphrase("Backup passphrase: ") }
+	wrong := func(err error) bool {
+		return errors.Is(err, auther.ErrWrongPassphrase) || errors.Is(err, auther.ErrDecryptionFailed)
+	}
+
+	var data TOTPData
+	err = auther.ErrWrongPassphrase
+	if key := dataKey(); key != nil && auther.IsEncrypted(content) {
+		data, err = auther.DecodeWithKey(path, content, key)
+	}
+	if wrong(err) && passphrase != nil {
+		data, err = decodeDataFile(path, content, func() ([]byte, error) { return passphrase, nil })
+	}
+	if wrong(err) {
+		data, err = decodeDataFile(path, content, ask)
+	}
+	if err != nil {
+		return TOTPData{}, err
+	}
+
+	if len(data.Entries) == 0 {
+		return TOTPData{}, errors.New("the backup holds no entries")
+	}
+	seen := map[string]bool{}
+	for i := range data.Entries {
+		entry := &data.Entries[i]
+		if err := entry.Validate(); err != nil {
+			return TOTPData{}, fmt.Errorf("entry %q: %w", entry.Name, err)
+		}
+		if entry.Name == "" || seen[entry.Name] {
+			return TOTPData{}, fmt.Errorf("the backup has an empty or duplicate name %q", entry.Name)
+		}
+		seen[entry.Name] = true
+	}
+	return data, nil
+}
+
+func restoreCommand(args []string) {
+	fs := newFlagSet("restore", "restore [timestamp|file] [--yes]")
+	yes := fs.Bool("yes", false, "restore without asking for confirmation")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator restore [timestamp|file] [--yes]")
+		os.Exit(2)
+	}
+	if !*yes && !isTerminal(os.Stdin) {
+		reportErrorf("Refusing to restore without confirmation because stdin is not a terminal. Use --yes to skip the prompt.")
+		os.Exit(1)
+	}
+
+	path, err := resolveBackup(args[0])
+	if err != nil {
+		fatal(err)
+	}
+	current := mustLoadVaultForBackup()
+	restored, err := readBackup(path)
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", path, err))
+	}
+
+	question := fmt.Sprintf("Replace the %d current entries with the %d entries in %s?", len(current.Entries), len(restored.Entries), filepath.Base(path))
+	if !*yes && !confirm(question) {
+		fmt.Println("Nothing was restored.")
+		return
+	}
+
+	if len(current.Entries) > 0 {
+		stash, err := writeBackup(backupPrefix, current, dataKey())
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Saved the current %d entries to %s\n", len(current.Entries), stash)
+	}
+	mustSaveData(restored)
+	fmt.Printf("Restored %d entries from %s\n", len(restored.Entries), path)
+}
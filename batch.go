@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// POST /totps/batch creates many entries in one request, for provisioning a
+// machine. Every entry is checked before any is added, and those that pass
+// are added in a single save, with taken names resolved as import resolves
+// them. With on_conflict fail the batch is all or nothing: if any entry is
+// invalid or its name is taken, nothing at all is written.
+
+// What POST /totps/batch did with an entry.
+const (
+	batchCreated     = "created"
+	batchOverwritten = "overwritten"
+	batchSkipped     = "skipped"
+	batchError       = "error"
+)
+
+// batchResult is what happened to one entry of a batch. An entry added under
+// another name, as on_conflict rename does, was created as CreatedAs.
+type batchResult struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	CreatedAs string `json:"created_as,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type batchSummary struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+	Errors      int `json:"errors"`
+}
+
+// errBatchAborted and errBatchUnchanged keep the store from saving a batch
+// that on_conflict fail stopped, or that changes nothing.
+var (
+	errBatchAborted   = errors.New("batch aborted")
+	errBatchUnchanged = errors.New("batch changes nothing")
+)
+
+// batchCreateHTTP handles POST /totps/batch, taking
+// {"entries": [...], "on_conflict": "skip"}. It answers 201 Created if every
+// entry was created or overwritten, 409 Conflict if on_conflict fail stopped
+// the batch, and 207 Multi-Status otherwise, each with the result of every
+// entry, in the order they were sent, and a summary.
+func batchCreateHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Entries    []TOTPEntry `json:"entries"`
+		OnConflict string      `json:"on_conflict"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	switch body.OnConflict {
+	case "":
+		body.OnConflict = conflictSkip
+	case conflictSkip, conflictOverwrite, conflictRename, conflictFail:
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid on_conflict %q: use skip, overwrite, rename or fail", body.OnConflict))
+		return
+	}
+	if len(body.Entries) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "entries is required")
+		return
+	}
+
+	results := make([]batchResult, len(body.Entries))
+	var valid []TOTPEntry
+	var positions []int // of valid in results
+	for i, entry := range body.Entries {
+		results[i] = batchResult{Name: entry.Name}
+		err := entry.Validate()
+		if entry.Name == "" || entry.Secret == "" {
+			err = errors.New("name and secret are required")
+		}
+		if err != nil {
+			results[i].Status, results[i].Reason = batchError, err.Error()
+			continue
+		}
+		if !inScope(r, entry) {
+			results[i].Status, results[i].Reason = batchError, outOfScopeMessage(r)
+			continue
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = time.Now()
+		}
+		valid = append(valid, entry)
+		positions = append(positions, i)
+	}
+	invalid := len(body.Entries) - len(valid)
+
+	// A name taken by an entry the token of r may not use is an error,
+	// whatever on_conflict says, so such a token can't overwrite it.
+	var merged []mergeResult
+	var blocked []bool // of valid
+	err := serverStore.Update(func(v *TOTPData) error {
+		blocked = make([]bool, len(valid))
+		var merging []TOTPEntry
+		for k, entry := range valid {
+			if i, _ := v.Owner(entry.Name); i >= 0 && !inScope(r, v.Entries[i]) {
+				blocked[k] = true
+				continue
+			}
+			merging = append(merging, entry)
+		}
+		merged = mergeEntries(v, merging, body.OnConflict)
+		changed := false
+		for _, m := range merged {
+			switch m.Action {
+			case mergeConflict:
+				return errBatchAborted
+			case mergeAdded, mergeRenamed, mergeOverwritten:
+				changed = true
+			}
+		}
+		switch {
+		case body.OnConflict == conflictFail && (invalid > 0 || slices.Contains(blocked, true)):
+			return errBatchAborted
+		case !changed:
+			return errBatchUnchanged
+		}
+		return nil
+	})
+	aborted := errors.Is(err, errBatchAborted)
+	if err != nil && !aborted && !errors.Is(err, errBatchUnchanged) {
+		writeServerError(w, err)
+		return
+	}
+
+	var applied []TOTPEntry // of merged
+	for k, entry := range valid {
+		if blocked[k] {
+			results[positions[k]].Status, results[positions[k]].Reason = batchError, outOfScopeMessage(r)
+			continue
+		}
+		m := merged[len(applied)]
+		applied = append(applied, entry)
+		result := &results[positions[k]]
+		taken := m.Existing + " already exists"
+		if m.Alias {
+			taken = "the name is an alias of " + m.Existing
+		}
+		switch {
+		case m.Action == mergeConflict:
+			result.Status, result.Reason = batchError, taken
+		case aborted:
+			result.Status, result.Reason = batchSkipped, "nothing was written, as on_conflict is fail and another entry is invalid or taken"
+		case m.Action == mergeAdded:
+			result.Status = batchCreated
+		case m.Action == mergeRenamed:
+			result.Status, result.CreatedAs, result.Reason = batchCreated, m.NewName, taken
+		case m.Action == mergeOverwritten:
+			result.Status = batchOverwritten
+		default:
+			result.Status, result.Reason = batchSkipped, taken
+		}
+	}
+
+	var summary batchSummary
+	for _, result := range results {
+		switch result.Status {
+		case batchCreated:
+			summary.Created++
+		case batchOverwritten:
+			summary.Overwritten++
+		case batchSkipped:
+			summary.Skipped++
+		default:
+			summary.Errors++
+		}
+	}
+	noteAudit(r).detail = fmt.Sprintf("%d created, %d overwritten, %d skipped, %d errors", summary.Created, summary.Overwritten, summary.Skipped, summary.Errors)
+
+	if !aborted {
+		for k, m := range merged {
+			entry := applied[k]
+			switch m.Action {
+			case mergeAdded:
+				notifyWebhooks(webhookCreated, webhookEntry(entry))
+			case mergeRenamed:
+				entry.Name = m.NewName
+				notifyWebhooks(webhookCreated, webhookEntry(entry))
+			case mergeOverwritten:
+				notifyWebhooks(webhookUpdated, webhookEntry(entry))
+			}
+		}
+	}
+
+	status := http.StatusMultiStatus
+	switch {
+	case aborted:
+		status = http.StatusConflict
+	case summary.Created+summary.Overwritten == len(results):
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, struct {
+		Applied bool          `json:"applied"`
+		Results []batchResult `json:"results"`
+		Summary batchSummary  `json:"summary"`
+	}{!aborted, results, summary})
+}
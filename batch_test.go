@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBatchCreate(t *testing.T) {
+	entry := func(name string) string {
+		return `{"name": "` + name + `", "secret": "` + importSecret + `"}`
+	}
+	invalid := `{"name": "broken", "secret": "not base32!"}`
+	brokenEntry := TOTPEntry{Name: "broken", Secret: "not base32!"}
+	broken := brokenEntry.Validate()
+	if broken == nil {
+		t.Fatal("the invalid entry is valid")
+	}
+	skipped := "nothing was written, as on_conflict is fail and another entry is invalid or taken"
+
+	tests := []struct {
+		name       string
+		onConflict string
+		entries    []string
+		status     int
+		applied    bool
+		results    []batchResult
+		// entries lists the entries afterwards, as describeEntries does.
+		after []string
+	}{
+		{
+			name:    "all created",
+			entries: []string{entry("new"), entry("next")},
+			status:  http.StatusCreated,
+			applied: true,
+			results: []batchResult{{Name: "new", Status: batchCreated}, {Name: "next", Status: batchCreated}},
+			after:   []string{"github old [] 0", "new new [] 0", "next new [] 0"},
+		},
+		{
+			name:    "skip by default",
+			entries: []string{entry("GitHub"), entry("new")},
+			status:  http.StatusMultiStatus,
+			applied: true,
+			results: []batchResult{
+				{Name: "GitHub", Status: batchSkipped, Reason: "github already exists"},
+				{Name: "new", Status: batchCreated},
+			},
+			after: []string{"github old [] 0", "new new [] 0"},
+		},
+		{
+			name:       "overwrite",
+			onConflict: conflictOverwrite,
+			entries:    []string{entry("github"), entry("new")},
+			status:     http.StatusCreated,
+			applied:    true,
+			results:    []batchResult{{Name: "github", Status: batchOverwritten}, {Name: "new", Status: batchCreated}},
+			after:      []string{"github new [] 0", "new new [] 0"},
+		},
+		{
+			name:       "rename",
+			onConflict: conflictRename,
+			entries:    []string{entry("github"), entry("github")},
+			status:     http.StatusCreated,
+			applied:    true,
+			results: []batchResult{
+				{Name: "github", Status: batchCreated, CreatedAs: "github (2)", Reason: "github already exists"},
+				{Name: "github", Status: batchCreated, CreatedAs: "github (3)", Reason: "github already exists"},
+			},
+			after: []string{"github old [] 0", "github (2) new [] 0", "github (3) new [] 0"},
+		},
+		{
+			name:       "invalid entries with skip",
+			onConflict: conflictSkip,
+			entries:    []string{invalid, entry("new")},
+			status:     http.StatusMultiStatus,
+			applied:    true,
+			results:    []batchResult{{Name: "broken", Status: batchError, Reason: broken.Error()}, {Name: "new", Status: batchCreated}},
+			after:      []string{"github old [] 0", "new new [] 0"},
+		},
+		{
+			name:       "fail on a taken name",
+			onConflict: conflictFail,
+			entries:    []string{entry("new"), entry("github"), entry("next")},
+			status:     http.StatusConflict,
+			results: []batchResult{
+				{Name: "new", Status: batchSkipped, Reason: skipped},
+				{Name: "github", Status: batchError, Reason: "github already exists"},
+				{Name: "next", Status: batchSkipped, Reason: skipped},
+			},
+			after: []string{"github old [] 0"},
+		},
+		{
+			name:       "fail on an invalid entry",
+			onConflict: conflictFail,
+			entries:    []string{entry("new"), invalid},
+			status:     http.StatusConflict,
+			results:    []batchResult{{Name: "new", Status: batchSkipped, Reason: skipped}, {Name: "broken", Status: batchError, Reason: broken.Error()}},
+			after:      []string{"github old [] 0"},
+		},
+		{
+			name:       "nothing to change",
+			onConflict: conflictSkip,
+			entries:    []string{entry("github")},
+			status:     http.StatusMultiStatus,
+			applied:    true,
+			results:    []batchResult{{Name: "github", Status: batchSkipped, Reason: "github already exists"}},
+			after:      []string{"github old [] 0"},
+		},
+	}
+	for _, tt := range tests {
+		h := newTestAPI(t, TOTPEntry{Name: "github"})
+		before, err := os.ReadFile(dataPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := `{"on_conflict": "` + tt.onConflict + `", "entries": [`
+		for i, e := range tt.entries {
+			if i > 0 {
+				body += ", "
+			}
+			body += e
+		}
+		body += `]}`
+
+		w := request(h, "POST", "/v1/totps/batch", testToken, body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		var resp struct {
+			Applied bool
+			Results []batchResult
+			Summary batchSummary
+		}
+		decodeBody(t, w, &resp)
+		if resp.Applied != tt.applied {
+			t.Errorf("%s: applied %v, want %v", tt.name, resp.Applied, tt.applied)
+		}
+		if !reflect.DeepEqual(resp.Results, tt.results) {
+			t.Errorf("%s: results\n%+v\nwant\n%+v", tt.name, resp.Results, tt.results)
+		}
+		var summary batchSummary
+		for _, res := range resp.Results {
+			switch res.Status {
+			case batchCreated:
+				summary.Created++
+			case batchOverwritten:
+				summary.Overwritten++
+			case batchSkipped:
+				summary.Skipped++
+			case batchError:
+				summary.Errors++
+			}
+		}
+		if resp.Summary != summary {
+			t.Errorf("%s: summary %+v, want %+v", tt.name, resp.Summary, summary)
+		}
+		if got := describeEntries(serverStore.List()); !reflect.DeepEqual(got, tt.after) {
+			t.Errorf("%s: entries %q, want %q", tt.name, got, tt.after)
+		}
+		if !tt.applied || summary.Created+summary.Overwritten == 0 {
+			if after, _ := os.ReadFile(dataPath); !bytes.Equal(after, before) {
+				t.Errorf("%s: the data file was written", tt.name)
+			}
+		}
+	}
+}
+
+func TestBatchCreateBadRequests(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "github"})
+	for _, body := range []string{
+		`{"on_conflict": "merge", "entries": [{"name": "new", "secret": "` + testSecret + `"}]}`,
+		`{"on_conflict": "skip", "entries": []}`,
+		`{}`,
+		`{"entries": {"name": "new"}}`,
+		`not JSON`,
+	} {
+		if w := request(h, "POST", "/v1/totps/batch", testToken, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if entries := serverStore.List(); len(entries) != 1 {
+		t.Errorf("bad requests changed the entries: %+v", entries)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// clearClipboardCommand is the hidden command run in a detached process to
+// clear the clipboard after a timeout.
+const clearClipboardCommand = "__clear-clipboard"
+
+var (
+	errClipboardDisabled    = errors.New("clipboard disabled")
+	errClipboardUnavailable = errors.New("clipboard is not available")
+)
+
+// Ways a code can end up on the clipboard.
+const (
+	copiedNative = "clipboard"
+	copiedOSC52  = "terminal clipboard (OSC 52)"
+)
+
+func clipboardDisabled() bool {
+	return options.noClipboard || os.Getenv("AUTHER_NO_CLIPBOARD") != ""
+}
+
+// copyToClipboard copies code to the system clipboard and, unless disabled,
+// schedules it to be cleared after options.clipboardTimeout seconds. When no
+// system clipboard is available but stdout is a terminal, the code is sent
+// with an OSC 52 escape sequence instead, which lets terminals copy it even
+// over SSH. It returns where the code went.
+func copyToClipboard(code string) (string, error) {
+	if clipboardDisabled() {
+		return "", errClipboardDisabled
+	}
+
+	if err := nativeCopy(code); err != nil {
+		slog.Debug("couldn't use the system clipboard", "err", err)
+		if !isTerminal(os.Stdout) {
+			return "", err
+		}
+		fmt.Fprintf(os.Stdout, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(code)))
+		return copiedOSC52, nil
+	}
+
+	if !options.noClear && options.clipboardTimeout > 0 {
+		if err := scheduleClipboardClear(code, options.clipboardTimeout); err != nil {
+			slog.Warn("couldn't schedule clearing the clipboard", "err", err)
+		}
+	}
+	return copiedNative, nil
+}
+
+// reportCopy prints a one-line note about the outcome of copyToClipboard.
+func reportCopy(how string, err error) {
+	switch {
+	case err == errClipboardDisabled:
+	case err != nil:
+		slog.Warn("clipboard not available, so the code was not copied", "err", err)
+	case how == copiedOSC52:
+		fmt.Println("Current code sent to your terminal clipboard.")
+	case options.noClear || options.clipboardTimeout <= 0:
+		fmt.Println("Current code copied to clipboard.")
+	default:
+		fmt.Printf("Current code copied to clipboard (cleared in %d seconds).\n", options.clipboardTimeout)
+	}
+}
+
+// scheduleClipboardClear starts a detached copy of this binary that outlives
+// the current command. The code is handed over on stdin so it never shows up
+// in the process table. It is written to a pipe before returning, rather than
+// copied by os/exec in the background, as the command exits right after and
+// would take the copying with it.
+func scheduleClipboardClear(code string, seconds int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, clearClipboardCommand, strconv.Itoa(seconds))
+	cmd.Stdin = r
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return err
+	}
+	// A code is far smaller than the pipe's buffer, so this doesn't wait
+	// for the child to read it.
+	_, err = io.WriteString(w, code)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := cmd.Process.Release(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// clearClipboardLater waits and then clears the clipboard, but only if it
+// still holds the code we put there, so anything copied since is left alone.
+func clearClipboardLater(args []string) {
+	if len(args) != 1 {
+		os.Exit(2)
+	}
+	seconds, err := strconv.Atoi(args[0])
+	if err != nil {
+		os.Exit(2)
+	}
+	code, err := io.ReadAll(os.Stdin)
+	if err != nil || len(code) == 0 {
+		os.Exit(1)
+	}
+
+	time.Sleep(time.Duration(seconds) * time.Second)
+
+	current, err := nativeRead()
+	if err != nil {
+		os.Exit(1)
+	}
+	if bytes.Equal(current, code) {
+		nativeCopy("")
+	}
+}
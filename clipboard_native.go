@@ -0,0 +1,42 @@
+//go:build !noclipboard && (cgo || windows)
+
+package main
+
+import (
+	"fmt"
+
+	"golang.design/x/clipboard"
+)
+
+// nativeCopy writes text to the system clipboard. The clipboard package is
+// only initialized here, on first use, so commands that never copy work on
+// machines without a display.
+func nativeCopy(text string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errClipboardUnavailable, r)
+		}
+	}()
+
+	if err := clipboard.Init(); err != nil {
+		return errClipboardUnavailable
+	}
+	// Write returns a nil channel when the copy failed.
+	if clipboard.Write(clipboard.FmtText, []byte(text)) == nil {
+		return errClipboardUnavailable
+	}
+	return nil
+}
+
+func nativeRead() (buf []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errClipboardUnavailable, r)
+		}
+	}()
+
+	if err := clipboard.Init(); err != nil {
+		return nil, errClipboardUnavailable
+	}
+	return clipboard.Read(clipboard.FmtText), nil
+}
@@ -0,0 +1,15 @@
+//go:build noclipboard || (!cgo && !windows)
+
+package main
+
+// Builds with the noclipboard tag, or without cgo where the clipboard package
+// can't work, have no system clipboard. Codes are still printed and can be
+// copied through the OSC 52 fallback.
+
+func nativeCopy(text string) error {
+	return errClipboardUnavailable
+}
+
+func nativeRead() ([]byte, error) {
+	return nil, errClipboardUnavailable
+}
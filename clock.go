@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Codes are computed from the clock, so a skewed clock makes every code
+// wrong in a way that is hard to tell from a wrong secret. Before generating
+// codes, the clock is compared with an NTP server and a warning is printed
+// if it is off. The measurement is cached for clockCheckInterval, in a file
+// for the CLI, so most runs don't touch the network.
+
+// Clock offsets that get a warning, and beyond which doctor fails as codes
+// are rejected by every service.
+const (
+	clockWarnOffset = 5 * time.Second
+	clockFailOffset = 30 * time.Second
+)
+
+// clockCheckInterval is how long a clock measurement, or a failure to make
+// one, is reused.
+const clockCheckInterval = time.Hour
+
+// clockCheckTimeout bounds how long generating a code can wait for the NTP
+// server.
+const clockCheckTimeout = 2 * time.Second
+
+// clockMeasurement is the outcome of asking Server for the time, as cached in
+// clock.json.
+type clockMeasurement struct {
+	Server    string        `json:"server"`
+	Offset    time.Duration `json:"offset"`
+	Error     string        `json:"error,omitempty"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// fresh reports whether m was measured against server recently enough to be
+// reused.
+func (m clockMeasurement) fresh(server string) bool {
+	return m.Server == server && time.Since(m.CheckedAt) < clockCheckInterval
+}
+
+var clockState struct {
+	sync.Mutex
+	measurement clockMeasurement
+}
+
+// ntpServer returns the NTP server to compare the clock with.
+func ntpServer() string {
+	if options.ntpServer != "" {
+		return options.ntpServer
+	}
+	if env := os.Getenv("AUTHER_NTP_SERVER"); env != "" {
+		return env
+	}
+	return defaultNTPServer
+}
+
+// ntpDisabled reports whether --no-ntp or AUTHER_NO_NTP turned NTP off.
+func ntpDisabled() bool {
+	return options.noNTP || os.Getenv("AUTHER_NO_NTP") != ""
+}
+
+// clockNow returns the time to generate current codes for: the local time,
+// or the NTP server's with --use-ntp-time. Unless NTP is turned off, it also
+// warns when the local clock is off.
+func clockNow() time.Time {
+	now := time.Now()
+	if ntpDisabled() {
+		return now
+	}
+	offset, ok := clockOffset()
+	if ok && options.useNTPTime {
+		return now.Add(offset)
+	}
+	return now
+}
+
+// clockOffset returns how far the NTP server's clock is ahead of the local
+// one, measuring it again once the last measurement is too old. Each new
+// measurement is checked for skew, so the CLI warns once per run and serve
+// once per interval. ok is false if the server couldn't be reached, which
+// is expected on offline machines and not reported unless --use-ntp-time
+// asked for the server's time.
+func clockOffset() (offset time.Duration, ok bool) {
+	server := ntpServer()
+	clockState.Lock()
+	m := clockState.measurement
+	clockState.Unlock()
+	if m.fresh(server) {
+		return m.Offset, m.Error == ""
+	}
+
+	// The query can take up to clockCheckTimeout, so it is made without the
+	// lock, which would hold up every other code in the meantime.
+	if cached, err := loadClockMeasurement(); err == nil && cached.fresh(server) {
+		m = cached
+		slog.Debug("reused clock measurement", "server", server, "offset", m.Offset, "checked_at", m.CheckedAt.Format(time.RFC3339))
+	} else {
+		m = clockMeasurement{Server: server, CheckedAt: time.Now()}
+		if m.Offset, err = queryClockOffset(server, clockCheckTimeout); err != nil {
+			m.Error = err.Error()
+		}
+		slog.Debug("measured clock offset", "server", server, "offset", m.Offset, "took", time.Since(m.CheckedAt), "error", m.Error)
+		saveClockMeasurement(m)
+	}
+
+	clockState.Lock()
+	// A measurement stored by another caller in the meantime has been
+	// checked for skew already.
+	if current := clockState.measurement; current.fresh(server) {
+		clockState.Unlock()
+		return current.Offset, current.Error == ""
+	}
+	clockState.measurement = m
+	clockState.Unlock()
+
+	switch {
+	case m.Error != "" && options.useNTPTime:
+		slog.Warn(fmt.Sprintf("couldn't ask %s for the time (%s); codes are generated from the local clock", server, m.Error))
+	case m.Error == "" && m.Offset.Abs() > clockWarnOffset && !options.useNTPTime:
+		slog.Warn(fmt.Sprintf("the system clock is %s; codes are generated from the clock, so services may reject them. Sync the clock, or pass --use-ntp-time to generate codes from the server's time", describeClockOffset(m.Offset, server)))
+	}
+	return m.Offset, m.Error == ""
+}
+
+// describeClockOffset puts offset, as returned by queryClockOffset, in
+// words.
+func describeClockOffset(offset time.Duration, server string) string {
+	direction := "behind"
+	if offset < 0 {
+		direction = "ahead of"
+	}
+	return fmt.Sprintf("%.1fs %s %s", offset.Abs().Seconds(), direction, server)
+}
+
+func clockCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auther", "clock.json"), nil
+}
+
+func loadClockMeasurement() (clockMeasurement, error) {
+	var m clockMeasurement
+	path, err := clockCachePath()
+	if err != nil {
+		return m, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(b, &m)
+}
+
+// saveClockMeasurement caches m for later runs. The cache is only an
+// optimization, so failing to write it is ignored.
+func saveClockMeasurement(m clockMeasurement) {
+	path, err := clockCachePath()
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	os.WriteFile(path, b, 0600)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClockOffsetQueriesUnlocked holds the NTP server's answer back and
+// checks that the clock state can be used meanwhile, so a slow server only
+// holds up the code that asked.
+func TestClockOffsetQueriesUnlocked(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", dir)
+	log := captureLog(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	oldServer, oldMeasurement := options.ntpServer, clockState.measurement
+	t.Cleanup(func() { options.ntpServer, clockState.measurement = oldServer, oldMeasurement })
+	options.ntpServer = pc.LocalAddr().String()
+	clockState.measurement = clockMeasurement{}
+
+	type result struct {
+		offset time.Duration
+		ok     bool
+	}
+	done := make(chan result)
+	go func() {
+		offset, ok := clockOffset()
+		done <- result{offset, ok}
+	}()
+
+	req := make([]byte, 48)
+	_, client, err := pc.ReadFrom(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		clockState.Lock()
+		clockState.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("the clock state stays locked while the NTP server is asked")
+	}
+
+	// Answer as a server whose clock is a minute ahead.
+	resp := make([]byte, 48)
+	resp[0], resp[1] = 0x24, 1 // version 4, server mode, stratum 1
+	copy(resp[24:32], req[40:48])
+	now := time.Now().Add(time.Minute)
+	putNTPTime(resp[32:], now)
+	putNTPTime(resp[40:], now)
+	if _, err := pc.WriteTo(resp, client); err != nil {
+		t.Fatal(err)
+	}
+	r := <-done
+	if !r.ok || (r.offset-time.Minute).Abs() > time.Second {
+		t.Errorf("offset %v, %v; want a minute", r.offset, r.ok)
+	}
+	if m := clockState.measurement; m.Server != options.ntpServer || m.Offset != r.offset {
+		t.Errorf("stored measurement %+v", m)
+	}
+	if !strings.Contains(log.String(), "60.0s behind") {
+		t.Errorf("no warning about the skew: %s", log)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// oneOffCodeCommand prints a code for a secret given on the command line,
+// without reading or writing the data file.
+func oneOffCodeCommand(args []string) {
+	fs := newFlagSet("code", "code --secret secret|- [--digits n] [--period n] [--algorithm name] [--at time | --offset duration]")
+	secret := fs.String("secret", "", "base32 secret, or - to read it from the first line of stdin")
+	digits := fs.Int("digits", 0, "number of digits in each code (6-8, default 6)")
+	period := fs.Int("period", 0, "seconds each code is valid for (default 30)")
+	algorithm := fs.String("algorithm", "", "HMAC algorithm: sha1, sha256 or sha512 (default sha1)")
+	when := addTimeFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 || *secret == "" {
+		fmt.Fprintln(os.Stderr, "Usage: authinator code --secret secret|- [--digits n] [--period n] [--algorithm name] [--at time | --offset duration]")
+		os.Exit(2)
+	}
+	t, shifted, err := when.time()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *secret == "-" {
+		if *secret, err = readSecretLine(); err != nil {
+			fatal(err)
+		}
+	}
+	entry := auther.Entry{Secret: *secret, Digits: *digits, Period: *period, Algorithm: *algorithm}
+	if err := entry.Validate(); err != nil {
+		fail(exitCodeGen, err)
+	}
+
+	q := codeQuery{}
+	if shifted {
+		q.at = t
+	}
+	result, err := generateCodes(entry, q)
+	if err != nil {
+		fail(exitCodeGen, err)
+	}
+	switch {
+	case options.json:
+		printJSON(result)
+	case shifted:
+		printCodeAt(result, t)
+	default:
+		fmt.Printf("Your current TOTP code is: %s (Time remaining: %d seconds)\n", displayCode(result.Code), result.ExpiresIn)
+		fmt.Printf("After this, the next TOTP code will be: %s\n", displayCode(result.NextCode))
+	}
+}
+
+// maxUpcoming caps --next and ?next=.
+const maxUpcoming = 20
+
+// maxMinValidity caps --min-validity and ?min_validity=, which bounds how
+// long a request can wait for a fresh code.
+const maxMinValidity = 20
+
+// codeQuery describes the codes to generate for an entry, as chosen by the
+// flags of [name] or the query parameters of GET /totps/{name}.
+type codeQuery struct {
+	at   time.Time // zero for now
+	next int       // upcoming codes to list after the current one
+
+	// minValidity is the number of seconds the current code must still be
+	// valid for; otherwise the caller waits for the next one.
+	minValidity int
+
+	// peek leaves the entry's last use alone, for callers such as list that
+	// show codes without anyone asking for one.
+	peek bool
+}
+
+// check rejects out of range values.
+func (q codeQuery) check() error {
+	if q.next < 0 || q.next > maxUpcoming {
+		return fmt.Errorf("the number of upcoming codes must be between 0 and %d", maxUpcoming)
+	}
+	if q.minValidity < 0 || q.minValidity > maxMinValidity {
+		return fmt.Errorf("the minimum validity must be between 0 and %d seconds", maxMinValidity)
+	}
+	if q.minValidity > 0 && !q.at.IsZero() {
+		return errors.New("a minimum validity only applies to the current code, not one at another time")
+	}
+	return nil
+}
+
+// freshWait returns how long to wait for a code that stays valid for
+// q.minValidity seconds, given that the current one expires in expiresIn.
+func (q codeQuery) freshWait(expiresIn int64) time.Duration {
+	if expiresIn >= int64(q.minValidity) {
+		return 0
+	}
+	return time.Duration(expiresIn) * time.Second
+}
+
+// parseCodeQuery reads a codeQuery from the ?at=, ?next=, ?min_validity= and
+// ?peek= parameters.
+func parseCodeQuery(v url.Values) (codeQuery, error) {
+	var q codeQuery
+	var err error
+	if at := v.Get("at"); at != "" {
+		if q.at, err = parseCodeTime(at); err != nil {
+			return q, err
+		}
+	}
+	if next := v.Get("next"); next != "" {
+		if q.next, err = strconv.Atoi(next); err != nil {
+			return q, fmt.Errorf("invalid next %q", next)
+		}
+	}
+	if s := v.Get("min_validity"); s != "" {
+		if q.minValidity, err = strconv.Atoi(s); err != nil {
+			return q, fmt.Errorf("invalid min_validity %q", s)
+		}
+	}
+	q.peek = v.Get("peek") == "true"
+	return q, q.check()
+}
+
+// values encodes q as the query parameters parseCodeQuery reads. The
+// minimum validity is left out, as the client waits itself so it can tell the
+// user why.
+func (q codeQuery) values() url.Values {
+	v := url.Values{}
+	if !q.at.IsZero() {
+		v.Set("at", q.at.Format(time.RFC3339))
+	}
+	if q.next > 0 {
+		v.Set("next", strconv.Itoa(q.next))
+	}
+	if q.peek {
+		v.Set("peek", "true")
+	}
+	return v
+}
+
+// upcomingCode is one of the codes listed by --next, with the window it is
+// valid in.
+type upcomingCode struct {
+	Code       string    `json:"code"`
+	ValidFrom  time.Time `json:"valid_from"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// generateCodes generates the codes described by q. The upcoming codes follow
+// the entry's own period.
+func generateCodes(entry TOTPEntry, q codeQuery) (codeResult, error) {
+	t := q.at
+	if t.IsZero() {
+		t = clockNow()
+	}
+	result, err := entryCodes(entry, t)
+	if err != nil {
+		return result, err
+	}
+	if !q.at.IsZero() {
+		result.setWindow(entry, t)
+	}
+
+	start := entry.NextPeriod(t).In(t.Location())
+	for i := 0; i < q.next; i++ {
+		code, err := entry.Code(start)
+		if err != nil {
+			return result, fmt.Errorf("generating upcoming TOTP code: %w", err)
+		}
+		end := start.Add(time.Duration(entry.CodePeriod()) * time.Second)
+		result.Upcoming = append(result.Upcoming, upcomingCode{Code: code, ValidFrom: start, ValidUntil: end})
+		start = end
+	}
+	return result, nil
+}
+
+// printUpcoming lists the codes generated for --next.
+func printUpcoming(upcoming []upcomingCode) {
+	if len(upcoming) == 0 {
+		return
+	}
+	fmt.Println("Upcoming codes:")
+	for _, u := range upcoming {
+		fmt.Printf("  %s  %s - %s\n", displayCode(u.Code), u.ValidFrom.Format(time.TimeOnly), u.ValidUntil.Format(time.TimeOnly))
+	}
+}
+
+// timeFlags are the --at and --offset flags of commands that generate codes.
+type timeFlags struct {
+	at     *string
+	offset *time.Duration
+}
+
+func addTimeFlags(fs *flag.FlagSet) *timeFlags {
+	return &timeFlags{
+		at:     fs.String("at", "", "generate the code for this time (RFC3339 or unix seconds) instead of now"),
+		offset: fs.Duration("offset", 0, "generate the code for now plus this duration, e.g. -30s"),
+	}
+}
+
+// time returns the time to generate codes for, and whether the flags moved it
+// away from now. Now is the NTP server's with --use-ntp-time.
+func (f *timeFlags) time() (time.Time, bool, error) {
+	switch {
+	case *f.at != "" && *f.offset != 0:
+		return time.Time{}, false, errors.New("--at and --offset can't be combined")
+	case *f.at != "":
+		t, err := parseCodeTime(*f.at)
+		return t, true, err
+	case *f.offset != 0:
+		return clockNow().Add(*f.offset), true, nil
+	}
+	return clockNow(), false, nil
+}
+
+// parseCodeTime parses an RFC3339 time or a unix timestamp in seconds.
+func parseCodeTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339, e.g. 2024-06-01T12:00:00Z, or unix seconds", s)
+	}
+	return t, nil
+}
+
+// setWindow records the period containing t, which the code was generated
+// for.
+func (r *codeResult) setWindow(entry TOTPEntry, t time.Time) {
+	until := entry.NextPeriod(t).In(t.Location())
+	from := until.Add(-time.Duration(entry.CodePeriod()) * time.Second)
+	r.ValidFrom = from.Format(time.RFC3339)
+	r.ValidUntil = until.Format(time.RFC3339)
+}
+
+// printCodeAt prints a code generated for a time other than now, along with
+// the window it is valid in.
+func printCodeAt(result codeResult, t time.Time) {
+	fmt.Printf("Your TOTP code at %s is: %s\n", t.Format(time.RFC3339), displayCode(result.Code))
+	fmt.Printf("It is valid from %s until %s.\n", result.ValidFrom, result.ValidUntil)
+	fmt.Printf("After this, the next TOTP code will be: %s\n", displayCode(result.NextCode))
+}
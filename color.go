@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI styles for terminal output.
+const (
+	styleDim    = "\x1b[2m"
+	styleRed    = "\x1b[31m"
+	styleGreen  = "\x1b[32m"
+	styleYellow = "\x1b[33m"
+	styleReset  = "\x1b[0m"
+)
+
+// useColor reports whether output to stdout may be styled: only on a
+// terminal, and not with --no-color or the NO_COLOR environment variable.
+func useColor() bool {
+	return !options.noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// colorize wraps s in style when output is styled.
+func colorize(s, style string) string {
+	if style == "" || !useColor() {
+		return s
+	}
+	return style + s + styleReset
+}
+
+// padRight pads s with spaces to width characters. Padding is done before
+// styling so escape sequences never count towards a column's width.
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"authinator/pkg/auther"
+	"authinator/pkg/auther/sqlite"
+)
+
+// completeNamesCommand is the hidden command the completion scripts run to
+// list entry names.
+const completeNamesCommand = "__complete-names"
+
+func completionCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator completion [bash|zsh|fish]")
+		os.Exit(2)
+	}
+
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported shell: %s (use bash, zsh or fish)\n", args[0])
+		os.Exit(2)
+	}
+	os.Stdout.WriteString(script)
+}
+
+// completeNames prints every entry name, one per line. It runs on every
+// <TAB>, so it never prompts, never migrates files and stays silent when the
+// data file is missing or unreadable. An encrypted vault is only listed when
+// the agent holds its key (see authinator unlock) or AUTHER_PASSPHRASE is set.
+func completeNames() {
+	path, err := locateDataPath()
+	if err != nil {
+		return
+	}
+	if backendName() == backendSQLite {
+		completeSQLiteNames(path)
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if salt := auther.FileSalt(content); salt != nil {
+		if key := agentKeyFor(path, salt); key != nil {
+			if data, err := auther.DecodeWithKey(path, content, key); err == nil {
+				printNames(data.Entries)
+				return
+			}
+		}
+	}
+	data, _, err := auther.Decode(path, content, func() ([]byte, error) {
+		env := os.Getenv("AUTHER_PASSPHRASE")
+		if env == "" {
+			return nil, errors.New("AUTHER_PASSPHRASE is not set")
+		}
+		return []byte(env), nil
+	})
+	if err != nil {
+		return
+	}
+	printNames(data.Entries)
+}
+
+// printNames prints the names and aliases of entries for completion.
+func printNames(entries []TOTPEntry) {
+	for _, entry := range entries {
+		fmt.Println(entry.Name)
+	}
+	for _, entry := range entries {
+		for _, alias := range entry.Aliases {
+			fmt.Println(alias)
+		}
+	}
+}
+
+// completeSQLiteNames is completeNames for the sqlite backend, which must not
+// create a database that isn't there.
+func completeSQLiteNames(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	b, err := sqlite.Open(path)
+	if err != nil {
+		return
+	}
+	defer b.Close()
+	data, err := b.Load()
+	if err != nil {
+		return
+	}
+	printNames(data.Entries)
+}
+
+const bashCompletion = `# bash completion for authinator
+# Load with: source <(authinator completion bash)
+
+_authinator_names() {
+    local name prefix=${cur//\\/}
+    prefix=${prefix#[\"\']}
+    while IFS= read -r name; do
+        if [[ $name == "$prefix"* ]]; then
+            COMPREPLY+=("$(printf '%q' "$name")")
+        fi
+    done < <(authinator "${file[@]}" __complete-names 2>/dev/null)
+}
+
+_authinator() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local commands="create code add-uri list tags edit rename alias pin unpin dedupe remove trash note recovery tui exec copy get generate search verify serve unlock lock passwd key encrypt migrate-to-keyring backup restore undo export import qr doctor audit token config version completion"
+    local value_flags="--file --backend --remote --remote-ca --remote-fingerprint --clipboard-timeout --bind --port --token --digits --period --algorithm --issuer --account --tag --untag --output --png --size --on-conflict --tls-cert --tls-key --skew --verify-skew --socket --log-file --log-format --cors-origin --rate-limit-read --rate-limit-write --rate-limit-verify --secret --at --offset --next --min-validity --keep --as --sort --set --format --bits --skip --ntp-server --glob --regex --age-recipient --age-identity --gpg-recipient --timeout --name --since -n --audit --webhook --webhook-secret --systemd-scope --role --basic-auth --trust-auth-header"
+    local cmd="" positional=0 i word
+    local -a file=()
+    COMPREPLY=()
+
+    case $prev in
+        --file|--output|--png|--tls-cert|--tls-key|--log-file|--socket|--remote-ca|--age-identity)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return ;;
+        --log-format)
+            COMPREPLY=($(compgen -W "text json" -- "$cur"))
+            return ;;
+        --systemd-scope)
+            COMPREPLY=($(compgen -W "user system" -- "$cur"))
+            return ;;
+        --role)
+            COMPREPLY=($(compgen -W "admin read codes-only" -- "$cur"))
+            return ;;
+        --backend)
+            COMPREPLY=($(compgen -W "json sqlite keyring" -- "$cur"))
+            return ;;
+        --algorithm)
+            COMPREPLY=($(compgen -W "sha1 sha256 sha512" -- "$cur"))
+            return ;;
+        --on-conflict)
+            COMPREPLY=($(compgen -W "skip overwrite rename fail" -- "$cur"))
+            return ;;
+        --sort)
+            COMPREPLY=($(compgen -W "name recent issuer" -- "$cur"))
+            return ;;
+        --skip)
+            COMPREPLY=($(compgen -W "data permissions secrets clock clipboard port" -- "$cur"))
+            return ;;
+    esac
+    [[ " $value_flags " == *" $prev "* ]] && return
+
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word=${COMP_WORDS[i]}
+        case $word in
+            --file|--backend) file+=("$word" "${COMP_WORDS[i+1]}"); ((i++)) ;;
+            --file=*|--backend=*) file+=("$word") ;;
+            -*) [[ " $value_flags " == *" $word "* ]] && ((i++)) ;;
+            *) if [[ -z $cmd ]]; then cmd=$word; else ((positional++)); fi ;;
+        esac
+    done
+
+    if [[ $cur == -* ]]; then
+        local flags="--file --backend --clipboard-timeout --no-clear --no-clipboard --no-group --no-color --json --fix-permissions --no-ntp --use-ntp-time --ntp-server --age-identity --remote --remote-ca --remote-fingerprint --remote-insecure --verbose -v"
+        case $cmd in
+            create) flags+=" --digits --period --algorithm --issuer --account --tag --secret-stdin --steam" ;;
+            generate) flags+=" --digits --period --algorithm --issuer --account --tag --bits" ;;
+            edit) flags+=" --digits --period --algorithm --issuer --account --tag --untag" ;;
+            list) flags+=" --tag --pinned --glob --regex --long -l --sort --format --copy" ;;
+            copy) flags+=" --exact" ;;
+            remove) flags+=" --yes -f --purge --glob --regex" ;;
+            trash) flags+=" --as --yes" ;;
+            note) flags+=" --set --clear" ;;
+            exec) flags+=" --stdin --exact --min-validity" ;;
+            rename) flags+=" --force" ;;
+            dedupe) flags+=" --list" ;;
+            export) flags+=" --format --encrypt --age-recipient --output --include-secrets --no-secrets" ;;
+            import) flags+=" --on-conflict --dry-run --strict" ;;
+            qr) flags+=" --png --size" ;;
+            doctor) flags+=" --skip" ;;
+            version) flags+=" --check" ;;
+            audit) flags+=" -n --since" ;;
+            token) flags+=" --name --role --tag" ;;
+            config) flags+=" --all" ;;
+            serve) flags+=" --bind --port --socket --token --no-auth --basic-auth --trust-auth-header --tls-cert --tls-key --tls-self-signed --verify-skew --log-file --log-format --log-json --cors-origin --rate-limit-read --rate-limit-write --rate-limit-verify --trust-proxy --audit --webhook --webhook-secret --watch --read-only --legacy-routes --install-systemd --systemd-scope --daemon --status --stop" ;;
+            verify) flags+=" --skew" ;;
+            code) flags+=" --secret --digits --period --algorithm --at --offset" ;;
+            backup) flags+=" --list --encrypt --keep" ;;
+            unlock) flags+=" --timeout" ;;
+            passwd) flags+=" --from-stdin" ;;
+            key) flags+=" --name" ;;
+            encrypt) flags+=" --age-recipient --gpg-recipient" ;;
+            restore|undo) flags+=" --yes" ;;
+            add-uri|tags|search|lock|migrate-to-keyring|recovery|alias|pin|unpin|get|tui|completion) ;;
+            *) flags+=" --exact --quiet -q --format --copy --at --offset --next --min-validity" ;;
+        esac
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+        return
+    fi
+
+    case $cmd in
+        "")
+            COMPREPLY=($(compgen -W "$commands" -- "$cur"))
+            _authinator_names ;;
+        remove|get)
+            _authinator_names ;;
+        edit|rename|qr|verify|note|exec|copy|pin|unpin)
+            ((positional == 0)) && _authinator_names ;;
+        recovery)
+            if ((positional == 0)); then
+                _authinator_names
+            elif ((positional == 1)); then
+                COMPREPLY=($(compgen -W "add list use" -- "$cur"))
+            fi ;;
+        alias)
+            if ((positional == 0)); then
+                COMPREPLY=($(compgen -W "add remove list" -- "$cur"))
+            elif [[ ${COMP_WORDS[*]} == *" add "* && positional == 2 ]] || [[ ${COMP_WORDS[*]} == *" list "* && positional == 1 ]]; then
+                _authinator_names
+            fi ;;
+        trash)
+            ((positional == 0)) && COMPREPLY=($(compgen -W "list restore empty" -- "$cur")) ;;
+        key)
+            ((positional == 0)) && COMPREPLY=($(compgen -W "list enroll remove" -- "$cur")) ;;
+        audit)
+            ((positional == 0)) && COMPREPLY=($(compgen -W "tail" -- "$cur")) ;;
+        token)
+            ((positional == 0)) && COMPREPLY=($(compgen -W "create list revoke" -- "$cur")) ;;
+        config)
+            if ((positional == 0)); then
+                COMPREPLY=($(compgen -W "path list get set unset" -- "$cur"))
+            elif ((positional == 1)) && [[ ${COMP_WORDS[*]} == *" get "* || ${COMP_WORDS[*]} == *" set "* || ${COMP_WORDS[*]} == *" unset "* ]]; then
+                COMPREPLY=($(compgen -W "file backend clipboard clipboard-timeout clear-clipboard color group-digits ntp ntp-server use-ntp-time age-identity remote remote-ca remote-fingerprint remote-insecure verbose serve.bind serve.port serve.socket serve.token serve.auth serve.basic-auth serve.trust-auth-header serve.tls-cert serve.tls-key serve.tls-self-signed serve.verify-skew serve.log-file serve.log-format serve.cors-origin serve.rate-limit-read serve.rate-limit-write serve.rate-limit-verify serve.trust-proxy serve.audit serve.webhook serve.webhook-created serve.webhook-updated serve.webhook-deleted serve.webhook-secret serve.watch serve.read-only serve.legacy-routes" -- "$cur"))
+            fi ;;
+        export)
+            ((positional == 0)) && COMPREPLY=($(compgen -W "csv" -- "$cur")) ;;
+        import)
+            if ((positional == 0)); then
+                COMPREPLY=($(compgen -W "json uris google-migration aegis andotp freeotp 2fas csv" -- "$cur"))
+            else
+                COMPREPLY=($(compgen -f -- "$cur"))
+            fi ;;
+        completion)
+            ((positional == 0)) && COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+    esac
+}
+
+complete -F _authinator authinator
+`
+
+const zshCompletion = `#compdef authinator
+# zsh completion for authinator
+# Load with: source <(authinator completion zsh)
+
+_authinator_names() {
+    local -a names
+    names=("${(@f)$(authinator $file __complete-names 2>/dev/null)}")
+    names=(${names:#})
+    compadd -a names
+}
+
+_authinator() {
+    local -a commands value_flags flags file
+    local cmd="" word prev=$words[CURRENT-1]
+    local -i i positional=0
+    commands=(
+        'create:create a new entry'
+        'generate:create an entry with a new random secret'
+        'add-uri:add an entry from an otpauth:// URI'
+        'list:list entries with their current codes'
+        'tags:list tags'
+        'edit:change an entry'
+        'rename:rename an entry'
+        'alias:add, remove or list aliases of entries'
+        'pin:mark an entry as a favorite'
+        'unpin:make a pinned entry an ordinary one again'
+        'dedupe:find and resolve duplicate entries'
+        'remove:remove entries'
+        'trash:list, restore or purge removed entries'
+        'note:show or change the note of an entry'
+        'recovery:store, list or use recovery codes'
+        'code:print a code for a secret without storing it'
+        'exec:run a command with a code in its environment'
+        'copy:copy a code without printing it'
+        'get:print the codes of several entries'
+        'tui:browse entries full-screen'
+        'search:search entries'
+        'verify:check a code'
+        'serve:start the HTTP server'
+        'unlock:keep the data file's key in the agent'
+        'lock:make the agent forget the key'
+        'passwd:change the passphrase'
+        'key:manage the security keys that unlock the data file'
+        'encrypt:encrypt the data file'
+        'migrate-to-keyring:move secrets into the OS keyring'
+        'backup:save a copy of every entry'
+        'restore:replace every entry with a backup'
+        'undo:undo the last change that removed or changed entries'
+        'export:export entries'
+        'import:import entries from another app'
+        'qr:show an entry as a QR code'
+        'doctor:check the data file, clock, clipboard and secrets'
+        'audit:show the audit log'
+        'token:manage named API tokens'
+        'config:read or change the config file'
+        'version:print the version and build details'
+        'completion:print a shell completion script'
+    )
+    value_flags=(--file --backend --remote --remote-ca --remote-fingerprint --clipboard-timeout --bind --port --token --digits --period --algorithm --issuer --account --tag --untag --output --png --size --on-conflict --tls-cert --tls-key --skew --verify-skew --socket --log-file --log-format --cors-origin --rate-limit-read --rate-limit-write --rate-limit-verify --secret --at --offset --next --min-validity --keep --as --sort --set --format --bits --skip --ntp-server --glob --regex --age-recipient --age-identity --gpg-recipient --timeout --name --since -n --audit --webhook --webhook-secret --systemd-scope --role --basic-auth --trust-auth-header)
+
+    case $prev in
+        --file|--output|--png|--tls-cert|--tls-key|--log-file|--socket|--remote-ca|--age-identity) _files; return ;;
+        --log-format) compadd text json; return ;;
+        --systemd-scope) compadd user system; return ;;
+        --role) compadd admin read codes-only; return ;;
+        --backend) compadd json sqlite keyring; return ;;
+        --algorithm) compadd sha1 sha256 sha512; return ;;
+        --on-conflict) compadd skip overwrite rename fail; return ;;
+        --sort) compadd name recent issuer; return ;;
+        --skip) compadd data permissions secrets clock clipboard port; return ;;
+    esac
+    (( ${value_flags[(Ie)$prev]} )) && return
+
+    for ((i = 2; i < CURRENT; i++)); do
+        word=$words[i]
+        if [[ $word == --file || $word == --backend ]]; then
+            file+=($word $words[i+1])
+            ((i++))
+        elif [[ $word == --file=* || $word == --backend=* ]]; then
+            file+=($word)
+        elif [[ $word == -* ]]; then
+            (( ${value_flags[(Ie)$word]} )) && ((i++))
+        elif [[ -z $cmd ]]; then
+            cmd=$word
+        else
+            ((positional++))
+        fi
+    done
+
+    if [[ $PREFIX == -* ]]; then
+        flags=(--file --backend --clipboard-timeout --no-clear --no-clipboard --no-group --no-color --json --fix-permissions --no-ntp --use-ntp-time --ntp-server --age-identity --remote --remote-ca --remote-fingerprint --remote-insecure --verbose -v)
+        case $cmd in
+            create) flags+=(--digits --period --algorithm --issuer --account --tag --secret-stdin --steam) ;;
+            generate) flags+=(--digits --period --algorithm --issuer --account --tag --bits) ;;
+            edit) flags+=(--digits --period --algorithm --issuer --account --tag --untag) ;;
+            list) flags+=(--tag --pinned --glob --regex --long -l --sort --format --copy) ;;
+            copy) flags+=(--exact) ;;
+            remove) flags+=(--yes -f --purge --glob --regex) ;;
+            trash) flags+=(--as --yes) ;;
+            note) flags+=(--set --clear) ;;
+            exec) flags+=(--stdin --exact --min-validity) ;;
+            rename) flags+=(--force) ;;
+            dedupe) flags+=(--list) ;;
+            export) flags+=(--format --encrypt --age-recipient --output --include-secrets --no-secrets) ;;
+            import) flags+=(--on-conflict --dry-run --strict) ;;
+            qr) flags+=(--png --size) ;;
+            doctor) flags+=(--skip) ;;
+            version) flags+=(--check) ;;
+            audit) flags+=(-n --since) ;;
+            token) flags+=(--name --role --tag) ;;
+            config) flags+=(--all) ;;
+            serve) flags+=(--bind --port --socket --token --no-auth --basic-auth --trust-auth-header --tls-cert --tls-key --tls-self-signed --verify-skew --log-file --log-format --log-json --cors-origin --rate-limit-read --rate-limit-write --rate-limit-verify --trust-proxy --audit --webhook --webhook-secret --watch --read-only --legacy-routes --install-systemd --systemd-scope --daemon --status --stop) ;;
+            verify) flags+=(--skew) ;;
+            code) flags+=(--secret --digits --period --algorithm --at --offset) ;;
+            backup) flags+=(--list --encrypt --keep) ;;
+            unlock) flags+=(--timeout) ;;
+            passwd) flags+=(--from-stdin) ;;
+            key) flags+=(--name) ;;
+            encrypt) flags+=(--age-recipient --gpg-recipient) ;;
+            restore|undo) flags+=(--yes) ;;
+            add-uri|tags|search|lock|migrate-to-keyring|recovery|alias|pin|unpin|get|tui|completion) ;;
+            *) flags+=(--exact --quiet -q --format --copy --at --offset --next --min-validity) ;;
+        esac
+        compadd -a flags
+        return
+    fi
+
+    case $cmd in
+        "")
+            _describe -t commands command commands
+            _authinator_names ;;
+        remove|get)
+            _authinator_names ;;
+        edit|rename|qr|verify|note|exec|copy|pin|unpin)
+            ((positional == 0)) && _authinator_names ;;
+        recovery)
+            if ((positional == 0)); then
+                _authinator_names
+            elif ((positional == 1)); then
+                compadd add list use
+            fi ;;
+        alias)
+            if ((positional == 0)); then
+                compadd add remove list
+            elif [[ ${words[(I)add]} -gt 0 && positional -eq 2 ]] || [[ ${words[(I)list]} -gt 0 && positional -eq 1 ]]; then
+                _authinator_names
+            fi ;;
+        trash)
+            ((positional == 0)) && compadd list restore empty ;;
+        key)
+            ((positional == 0)) && compadd list enroll remove ;;
+        audit)
+            ((positional == 0)) && compadd tail ;;
+        token)
+            ((positional == 0)) && compadd create list revoke ;;
+        config)
+            if ((positional == 0)); then
+                compadd path list get set unset
+            elif ((positional == 1)) && [[ ${words[(I)get]} -gt 0 || ${words[(I)set]} -gt 0 || ${words[(I)unset]} -gt 0 ]]; then
+                compadd file backend clipboard clipboard-timeout clear-clipboard color group-digits ntp ntp-server use-ntp-time age-identity remote remote-ca remote-fingerprint remote-insecure verbose serve.bind serve.port serve.socket serve.token serve.auth serve.basic-auth serve.trust-auth-header serve.tls-cert serve.tls-key serve.tls-self-signed serve.verify-skew serve.log-file serve.log-format serve.cors-origin serve.rate-limit-read serve.rate-limit-write serve.rate-limit-verify serve.trust-proxy serve.audit serve.webhook serve.webhook-created serve.webhook-updated serve.webhook-deleted serve.webhook-secret serve.watch serve.read-only serve.legacy-routes
+            fi ;;
+        export)
+            ((positional == 0)) && compadd csv ;;
+        import)
+            if ((positional == 0)); then
+                compadd json uris google-migration aegis andotp freeotp 2fas csv
+            else
+                _files
+            fi ;;
+        completion)
+            ((positional == 0)) && compadd bash zsh fish ;;
+    esac
+}
+
+if [[ $funcstack[1] == _authinator ]]; then
+    _authinator "$@"
+else
+    compdef _authinator authinator
+fi
+`
+
+const fishCompletion = `# fish completion for authinator
+# Load with: authinator completion fish | source
+
+function __authinator_names
+    set -l tokens (commandline -opc)
+    set -l file
+    for flag in --file --backend
+        if set -l i (contains -i -- $flag $tokens); and test $i -lt (count $tokens)
+            set -a file $flag $tokens[(math $i + 1)]
+        end
+    end
+    authinator $file __complete-names 2>/dev/null
+end
+
+function __authinator_no_command
+    not __fish_seen_subcommand_from create code add-uri list tags edit rename alias pin unpin dedupe remove trash note recovery tui exec copy get generate search verify serve unlock lock passwd key encrypt migrate-to-keyring backup restore undo export import qr doctor audit token config version completion
+end
+
+function __authinator_first_arg
+    set -l tokens (commandline -opc)
+    set -l args
+    for token in $tokens[3..-1]
+        string match -q -- '-*' $token; or set -a args $token
+    end
+    test (count $args) -eq 0
+end
+
+complete -c authinator -f
+
+complete -c authinator -n __fish_use_subcommand -a create -d 'Create a new entry'
+complete -c authinator -n __fish_use_subcommand -a generate -d 'Create an entry with a new random secret'
+complete -c authinator -n __fish_use_subcommand -a add-uri -d 'Add an entry from an otpauth:// URI'
+complete -c authinator -n __fish_use_subcommand -a list -d 'List entries with their current codes'
+complete -c authinator -n __fish_use_subcommand -a tags -d 'List tags'
+complete -c authinator -n __fish_use_subcommand -a edit -d 'Change an entry'
+complete -c authinator -n __fish_use_subcommand -a rename -d 'Rename an entry'
+complete -c authinator -n __fish_use_subcommand -a alias -d 'Add, remove or list aliases of entries'
+complete -c authinator -n __fish_use_subcommand -a pin -d 'Mark an entry as a favorite'
+complete -c authinator -n __fish_use_subcommand -a unpin -d 'Make a pinned entry an ordinary one again'
+complete -c authinator -n __fish_use_subcommand -a dedupe -d 'Find and resolve duplicate entries'
+complete -c authinator -n __fish_use_subcommand -a remove -d 'Remove entries'
+complete -c authinator -n __fish_use_subcommand -a trash -d 'List, restore or purge removed entries'
+complete -c authinator -n __fish_use_subcommand -a note -d 'Show or change the note of an entry'
+complete -c authinator -n __fish_use_subcommand -a recovery -d 'Store, list or use recovery codes'
+complete -c authinator -n __fish_use_subcommand -a code -d 'Print a code for a secret without storing it'
+complete -c authinator -n __fish_use_subcommand -a exec -d 'Run a command with a code in its environment'
+complete -c authinator -n __fish_use_subcommand -a copy -d 'Copy a code without printing it'
+complete -c authinator -n __fish_use_subcommand -a get -d 'Print the codes of several entries'
+complete -c authinator -n __fish_use_subcommand -a tui -d 'Browse entries full-screen'
+complete -c authinator -n __fish_use_subcommand -a search -d 'Search entries'
+complete -c authinator -n __fish_use_subcommand -a verify -d 'Check a code'
+complete -c authinator -n __fish_use_subcommand -a serve -d 'Start the HTTP server'
+complete -c authinator -n __fish_use_subcommand -a unlock -d "Keep the data file's key in the agent"
+complete -c authinator -n __fish_use_subcommand -a lock -d 'Make the agent forget the key'
+complete -c authinator -n __fish_use_subcommand -a passwd -d 'Change the passphrase'
+complete -c authinator -n __fish_use_subcommand -a key -d 'Manage the security keys that unlock the data file'
+complete -c authinator -n __fish_use_subcommand -a encrypt -d 'Encrypt the data file'
+complete -c authinator -n __fish_use_subcommand -a migrate-to-keyring -d 'Move secrets into the OS keyring'
+complete -c authinator -n __fish_use_subcommand -a backup -d 'Save a copy of every entry'
+complete -c authinator -n __fish_use_subcommand -a restore -d 'Replace every entry with a backup'
+complete -c authinator -n __fish_use_subcommand -a undo -d 'Undo the last change that removed or changed entries'
+complete -c authinator -n __fish_use_subcommand -a export -d 'Export entries'
+complete -c authinator -n __fish_use_subcommand -a import -d 'Import entries from another app'
+complete -c authinator -n __fish_use_subcommand -a qr -d 'Show an entry as a QR code'
+complete -c authinator -n __fish_use_subcommand -a doctor -d 'Check the data file, clock, clipboard and secrets'
+complete -c authinator -n __fish_use_subcommand -a audit -d 'Show the audit log'
+complete -c authinator -n __fish_use_subcommand -a token -d 'Manage named API tokens'
+complete -c authinator -n __fish_use_subcommand -a config -d 'Read or change the config file'
+complete -c authinator -n __fish_use_subcommand -a version -d 'Print the version and build details'
+complete -c authinator -n __fish_use_subcommand -a completion -d 'Print a shell completion script'
+complete -c authinator -n __fish_use_subcommand -a '(__authinator_names)' -d Entry
+
+complete -c authinator -n '__fish_seen_subcommand_from remove get' -a '(__authinator_names)'
+complete -c authinator -n '__fish_seen_subcommand_from edit rename qr verify note recovery exec copy pin unpin; and __authinator_first_arg' -a '(__authinator_names)'
+complete -c authinator -n '__fish_seen_subcommand_from recovery; and not __authinator_first_arg; and not __fish_seen_subcommand_from add list use' -a 'add list use'
+complete -c authinator -n '__fish_seen_subcommand_from note' -l set -x -d 'Replace the note'
+complete -c authinator -n '__fish_seen_subcommand_from note' -l clear -d 'Remove the note'
+
+complete -c authinator -l file -r -F -d 'Path to the data file'
+complete -c authinator -l backend -x -a 'json sqlite keyring' -d 'Storage backend'
+complete -c authinator -l clipboard-timeout -x -d 'Seconds before a copied code is cleared'
+complete -c authinator -l no-clear -d 'Leave copied codes on the clipboard'
+complete -c authinator -l no-clipboard -d 'Never copy codes to the clipboard'
+complete -c authinator -l no-group -d 'Print codes without grouping their digits'
+complete -c authinator -l no-color -d 'Print without colors'
+complete -c authinator -l json -d 'Print machine-readable JSON'
+complete -c authinator -l fix-permissions -d 'Restrict the data file to its owner'
+complete -c authinator -l no-ntp -d "Don't compare the clock with an NTP server"
+complete -c authinator -l use-ntp-time -d "Generate codes from the NTP server's time"
+complete -c authinator -l ntp-server -x -d 'NTP server to compare the clock with'
+complete -c authinator -l age-identity -r -F -d 'age identity or SSH key to decrypt with'
+complete -c authinator -l remote -x -d 'Use an authinator server instead of the local file'
+complete -c authinator -l remote-ca -r -F -d 'Certificate authorities trusted for --remote'
+complete -c authinator -l remote-fingerprint -x -d 'SHA-256 fingerprint of the --remote certificate'
+complete -c authinator -l remote-insecure -d "Don't verify the --remote certificate"
+complete -c authinator -s v -l verbose -d 'Log debug messages to stderr'
+
+complete -c authinator -n '__authinator_no_command; or __fish_seen_subcommand_from exec copy' -l exact -d 'Only accept an exact name match'
+complete -c authinator -n __authinator_no_command -s q -l quiet -d 'Print only the code'
+complete -c authinator -n '__authinator_no_command; or __fish_seen_subcommand_from list' -l format -x -d 'Print with a Go template'
+complete -c authinator -n __authinator_no_command -l copy -d 'Copy the code even with --quiet or --format'
+complete -c authinator -n __authinator_no_command -l next -x -d 'Also print this many upcoming codes'
+complete -c authinator -n '__authinator_no_command; or __fish_seen_subcommand_from exec' -l min-validity -x -d 'Wait for a code valid this many seconds'
+complete -c authinator -n '__fish_seen_subcommand_from exec' -l stdin -d "Write the code to the command's stdin"
+
+complete -c authinator -n '__fish_seen_subcommand_from create edit code generate' -l digits -x -d 'Number of digits in each code'
+complete -c authinator -n '__fish_seen_subcommand_from create edit code generate' -l period -x -d 'Seconds each code is valid for'
+complete -c authinator -n '__fish_seen_subcommand_from create edit code generate' -l algorithm -x -a 'sha1 sha256 sha512' -d 'HMAC algorithm'
+complete -c authinator -n '__fish_seen_subcommand_from create edit generate' -l issuer -x -d 'Provider the entry belongs to'
+complete -c authinator -n '__fish_seen_subcommand_from create edit generate' -l account -x -d 'Account name at the provider'
+complete -c authinator -n '__fish_seen_subcommand_from create edit list generate token' -l tag -x -d 'Tag'
+complete -c authinator -n '__fish_seen_subcommand_from list' -s l -l long -d 'Show when entries were added and last used'
+complete -c authinator -n '__fish_seen_subcommand_from list' -l pinned -d 'Only list pinned entries'
+complete -c authinator -n '__fish_seen_subcommand_from list' -l copy -x -d 'Copy the code of this entry'
+complete -c authinator -n '__fish_seen_subcommand_from list' -l sort -x -a 'name recent issuer' -d 'Sort by name, last use or issuer'
+complete -c authinator -n '__fish_seen_subcommand_from edit' -l untag -x -d 'Remove a tag'
+complete -c authinator -n '__fish_seen_subcommand_from create' -l secret-stdin -d 'Read the secret from stdin'
+complete -c authinator -n '__fish_seen_subcommand_from create' -l steam -d 'Generate Steam Guard codes'
+complete -c authinator -n '__fish_seen_subcommand_from generate' -l bits -x -d 'Size of the secret in bits'
+complete -c authinator -n '__fish_seen_subcommand_from code' -l secret -x -d 'Secret, or - to read it from stdin'
+complete -c authinator -n '__authinator_no_command; or __fish_seen_subcommand_from code' -l at -x -d 'Generate the code for this time'
+complete -c authinator -n '__authinator_no_command; or __fish_seen_subcommand_from code' -l offset -x -d 'Generate the code for now plus this duration'
+
+complete -c authinator -n '__fish_seen_subcommand_from remove' -s f -l yes -d 'Remove without asking'
+complete -c authinator -n '__fish_seen_subcommand_from remove' -l purge -d 'Delete for good instead of moving to the trash'
+complete -c authinator -n '__fish_seen_subcommand_from list remove' -l glob -x -d 'Only entries whose name matches this glob'
+complete -c authinator -n '__fish_seen_subcommand_from list remove' -l regex -x -d 'Only entries whose name matches this regular expression'
+complete -c authinator -n '__fish_seen_subcommand_from trash; and __authinator_first_arg' -a 'list restore empty'
+complete -c authinator -n '__fish_seen_subcommand_from alias; and __authinator_first_arg' -a 'add remove list'
+complete -c authinator -n '__fish_seen_subcommand_from alias; and __fish_seen_subcommand_from add list; and not __authinator_first_arg' -a '(__authinator_names)'
+complete -c authinator -n '__fish_seen_subcommand_from trash' -l as -x -d 'Restore the entry under this name'
+complete -c authinator -n '__fish_seen_subcommand_from trash' -l yes -d 'Empty the trash without asking'
+complete -c authinator -n '__fish_seen_subcommand_from rename' -l force -d 'Replace an existing entry'
+complete -c authinator -n '__fish_seen_subcommand_from dedupe' -l list -d 'Only list duplicates'
+
+complete -c authinator -n '__fish_seen_subcommand_from backup' -l list -d 'List the existing backups'
+complete -c authinator -n '__fish_seen_subcommand_from backup' -l encrypt -d 'Encrypt the backup with a passphrase'
+complete -c authinator -n '__fish_seen_subcommand_from backup' -l keep -x -d 'Keep only the newest n backups'
+complete -c authinator -n '__fish_seen_subcommand_from unlock' -l timeout -x -d 'Forget the key after this long unused'
+complete -c authinator -n '__fish_seen_subcommand_from passwd' -l from-stdin -d 'Read both passphrases from stdin'
+complete -c authinator -n '__fish_seen_subcommand_from key; and __authinator_first_arg' -a 'list enroll remove'
+complete -c authinator -n '__fish_seen_subcommand_from key; and __fish_seen_subcommand_from enroll' -l name -x -d 'A name for the security key'
+complete -c authinator -n '__fish_seen_subcommand_from encrypt' -l age-recipient -x -d 'Encrypt with age to this key'
+complete -c authinator -n '__fish_seen_subcommand_from encrypt' -l gpg-recipient -x -d 'Encrypt with GnuPG to this key'
+complete -c authinator -n '__fish_seen_subcommand_from restore undo' -l yes -d 'Skip the confirmation'
+complete -c authinator -n '__fish_seen_subcommand_from restore' -F
+
+complete -c authinator -n '__fish_seen_subcommand_from export; and __authinator_first_arg' -a csv
+complete -c authinator -n '__fish_seen_subcommand_from export' -l format -x -a 'uri json csv aegis andotp freeotp' -d 'Export format'
+complete -c authinator -n '__fish_seen_subcommand_from export' -l encrypt -d 'Write a passphrase-encrypted bundle'
+complete -c authinator -n '__fish_seen_subcommand_from export' -l age-recipient -x -d 'Encrypt the bundle with age to this key'
+complete -c authinator -n '__fish_seen_subcommand_from export' -l output -r -F -d 'Write the export to a file'
+complete -c authinator -n '__fish_seen_subcommand_from export' -l include-secrets -d 'Skip the confirmation prompt'
+complete -c authinator -n '__fish_seen_subcommand_from export' -l no-secrets -d 'Leave secrets out of a CSV export'
+
+complete -c authinator -n '__fish_seen_subcommand_from import; and __authinator_first_arg' -a 'json uris google-migration aegis andotp freeotp 2fas csv'
+complete -c authinator -n '__fish_seen_subcommand_from import; and not __authinator_first_arg' -F
+complete -c authinator -n '__fish_seen_subcommand_from import' -l on-conflict -x -a 'skip overwrite rename fail' -d 'What to do with existing names'
+complete -c authinator -n '__fish_seen_subcommand_from import' -l dry-run -d 'Show what would be imported'
+complete -c authinator -n '__fish_seen_subcommand_from import' -l strict -d 'Abort if any CSV row is invalid'
+
+complete -c authinator -n '__fish_seen_subcommand_from qr' -l png -r -F -d 'Write a PNG image'
+complete -c authinator -n '__fish_seen_subcommand_from qr' -l size -x -d 'PNG size in pixels'
+
+complete -c authinator -n '__fish_seen_subcommand_from doctor' -l skip -x -a 'data permissions secrets clock clipboard port' -d 'Leave out a check'
+complete -c authinator -n '__fish_seen_subcommand_from version' -l check -d 'Ask GitHub whether a newer release exists'
+complete -c authinator -n '__fish_seen_subcommand_from audit; and __authinator_first_arg' -a tail
+complete -c authinator -n '__fish_seen_subcommand_from audit' -s n -x -d 'How many events to show'
+complete -c authinator -n '__fish_seen_subcommand_from audit' -l since -x -d 'Only show events from this time on'
+complete -c authinator -n '__fish_seen_subcommand_from token; and __authinator_first_arg' -a 'create list revoke'
+complete -c authinator -n '__fish_seen_subcommand_from token' -l name -x -d 'Name of the token'
+complete -c authinator -n '__fish_seen_subcommand_from token' -l role -x -a 'admin read codes-only' -d 'What the token may do'
+complete -c authinator -n '__fish_seen_subcommand_from config; and __authinator_first_arg' -a 'path list get set unset'
+complete -c authinator -n '__fish_seen_subcommand_from config; and __fish_seen_subcommand_from get set unset' -a 'file backend clipboard clipboard-timeout clear-clipboard color group-digits ntp ntp-server use-ntp-time age-identity remote remote-ca remote-fingerprint remote-insecure verbose serve.bind serve.port serve.socket serve.token serve.auth serve.basic-auth serve.trust-auth-header serve.tls-cert serve.tls-key serve.tls-self-signed serve.verify-skew serve.log-file serve.log-format serve.cors-origin serve.rate-limit-read serve.rate-limit-write serve.rate-limit-verify serve.trust-proxy serve.audit serve.webhook serve.webhook-created serve.webhook-updated serve.webhook-deleted serve.webhook-secret serve.watch serve.read-only serve.legacy-routes'
+complete -c authinator -n '__fish_seen_subcommand_from config' -l all -d 'List every setting'
+
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l bind -x -d 'Address to listen on'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l port -x -d 'Port to listen on'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l token -x -d 'API token clients must send'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l no-auth -d 'Accept requests without a token'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l basic-auth -x -d 'Also accept HTTP Basic auth as user:bcrypt-hash'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l trust-auth-header -x -d 'Header a reverse proxy names the user in'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l tls-cert -r -F -d 'PEM certificate for HTTPS'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l tls-key -r -F -d 'PEM private key for HTTPS'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l tls-self-signed -d 'Serve HTTPS with a self-signed certificate'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l verify-skew -x -d 'Periods accepted either side of now'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l log-file -r -F -d 'Write the access log to a file'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l socket -r -F -d 'Listen on a unix domain socket'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l log-format -x -a 'text json' -d 'Log format'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l log-json -d 'Log JSON objects, one per line'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l cors-origin -x -d 'Allow browser scripts from this origin'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l rate-limit-read -x -d 'Reads allowed per client per minute'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l rate-limit-write -x -d 'Writes allowed per client per minute'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l rate-limit-verify -x -d 'Verifications allowed per client per minute'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l trust-proxy -d 'Rate limit by X-Forwarded-For'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l audit -x -a 'on off' -d 'Record requests in the audit log'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l webhook -x -d 'POST entry events to this URL'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l webhook-secret -x -d 'Sign webhook payloads with this secret'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l watch -d 'Reload the data file when it changes'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l read-only -d 'Reject requests that would change entries'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l legacy-routes -d 'Also serve the API at its deprecated paths without /v1'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l install-systemd -d 'Write a systemd unit that runs serve'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l systemd-scope -x -a 'user system' -d 'Install the unit for the user or the system'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l daemon -d 'Run in the background'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l status -d 'Show whether a server is running'
+complete -c authinator -n '__fish_seen_subcommand_from serve' -l stop -d 'Stop the running server'
+complete -c authinator -n '__fish_seen_subcommand_from verify' -l skew -x -d 'Periods accepted either side of now'
+
+complete -c authinator -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+`
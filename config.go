@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configFile is the name of the config file in the config directory.
+// AUTHER_CONFIG names another file.
+const configFile = "config.toml"
+
+// Kinds of config values, as error messages name them.
+const (
+	configString = "a string"
+	configInt    = "an integer"
+	configBool   = "true or false"
+	configList   = "a list of strings"
+)
+
+// configKey is a setting of the config file. Most stand for a flag, of every
+// command for keys without a section and of serve for those in [serve], and
+// are only used when the flag isn't given, nor env if it is set: flags win
+// over the environment, which wins over the config file, which wins over the
+// defaults. invert is set for a flag that is the opposite of its key, as
+// --no-color is of color.
+type configKey struct {
+	name   string
+	kind   string
+	flag   string
+	invert bool
+	env    string
+	help   string
+}
+
+// configKeys are the settings the config file may have, in the order config
+// list --all prints them.
+var configKeys = []configKey{
+	{name: "file", kind: configString, flag: "file", env: "AUTHER_DATA_FILE", help: "path to the data file"},
+	{name: "backend", kind: configString, flag: "backend", env: "AUTHER_BACKEND", help: "storage backend: json, sqlite or keyring"},
+	{name: "clipboard", kind: configBool, flag: "no-clipboard", invert: true, env: "AUTHER_NO_CLIPBOARD", help: "copy codes to the clipboard"},
+	{name: "clipboard-timeout", kind: configInt, flag: "clipboard-timeout", help: "seconds before a copied code is cleared from the clipboard"},
+	{name: "clear-clipboard", kind: configBool, flag: "no-clear", invert: true, help: "clear copied codes from the clipboard"},
+	{name: "color", kind: configBool, flag: "no-color", invert: true, env: "NO_COLOR", help: "print with colors in a terminal"},
+	{name: "group-digits", kind: configBool, flag: "no-group", invert: true, help: "print codes with their digits grouped"},
+	{name: "ntp", kind: configBool, flag: "no-ntp", invert: true, env: "AUTHER_NO_NTP", help: "compare the clock with an NTP server"},
+	{name: "ntp-server", kind: configString, flag: "ntp-server", env: "AUTHER_NTP_SERVER", help: "NTP server to compare the clock with"},
+	{name: "use-ntp-time", kind: configBool, flag: "use-ntp-time", help: "generate codes from the NTP server's time"},
+	{name: "age-identity", kind: configList, flag: "age-identity", env: "AUTHER_AGE_IDENTITY", help: "age identity files to decrypt with"},
+	{name: "remote", kind: configString, flag: "remote", env: "AUTHER_REMOTE", help: "authinator server to use instead of the local data file"},
+	{name: "remote-ca", kind: configString, flag: "remote-ca", help: "PEM file of certificate authorities trusted for remote"},
+	{name: "remote-fingerprint", kind: configString, flag: "remote-fingerprint", help: "SHA-256 fingerprint the remote server's certificate must have"},
+	{name: "remote-insecure", kind: configBool, flag: "remote-insecure", help: "don't verify the remote server's certificate"},
+	{name: "verbose", kind: configBool, flag: "verbose", help: "log debug messages to stderr"},
+
+	{name: "serve.bind", kind: configString, flag: "bind", env: "AUTHER_ADDR", help: "address serve listens on"},
+	{name: "serve.port", kind: configInt, flag: "port", env: "AUTHER_ADDR", help: "port serve listens on"},
+	{name: "serve.socket", kind: configString, flag: "socket", help: "unix domain socket serve listens on instead of a port"},
+	{name: "serve.token", kind: configString, flag: "token", env: "AUTHER_TOKEN", help: "API token clients must send"},
+	{name: "serve.auth", kind: configBool, flag: "no-auth", invert: true, help: "require the API token"},
+	{name: "serve.basic-auth", kind: configList, flag: "basic-auth", help: "user:bcrypt-hash pairs also accepted as HTTP Basic auth"},
+	{name: "serve.trust-auth-header", kind: configString, flag: "trust-auth-header", help: "header in which a reverse proxy names the user it authenticated"},
+	{name: "serve.tls-cert", kind: configString, flag: "tls-cert", help: "PEM certificate to serve HTTPS with"},
+	{name: "serve.tls-key", kind: configString, flag: "tls-key", help: "PEM private key for tls-cert"},
+	{name: "serve.tls-self-signed", kind: configBool, flag: "tls-self-signed", help: "serve HTTPS with a generated self-signed certificate"},
+	{name: "serve.verify-skew", kind: configInt, flag: "verify-skew", help: "periods either side of now accepted by the verify endpoint"},
+	{name: "serve.log-file", kind: configString, flag: "log-file", help: "file to append the log to"},
+	{name: "serve.log-format", kind: configString, flag: "log-format", help: "log format: text or json"},
+	{name: "serve.cors-origin", kind: configList, flag: "cors-origin", help: "origins allowed to call the API from browsers"},
+	{name: "serve.rate-limit-read", kind: configInt, flag: "rate-limit-read", help: "read requests allowed per client per minute"},
+	{name: "serve.rate-limit-write", kind: configInt, flag: "rate-limit-write", help: "write requests allowed per client per minute"},
+	{name: "serve.rate-limit-verify", kind: configInt, flag: "rate-limit-verify", help: "verify requests allowed per client per minute"},
+	{name: "serve.trust-proxy", kind: configBool, flag: "trust-proxy", help: "rate limit by the X-Forwarded-For address"},
+	{name: "serve.audit", kind: configString, flag: "audit", help: "record requests in the audit log: on or off"},
+	{name: "serve.webhook", kind: configList, flag: "webhook", help: "URLs sent every entry event"},
+	{name: "serve.webhook-created", kind: configList, help: "URLs sent entry.created events"},
+	{name: "serve.webhook-updated", kind: configList, help: "URLs sent entry.updated events"},
+	{name: "serve.webhook-deleted", kind: configList, help: "URLs sent entry.deleted events"},
+	{name: "serve.webhook-secret", kind: configString, flag: "webhook-secret", env: "AUTHER_WEBHOOK_SECRET", help: "secret webhook payloads are signed with"},
+	{name: "serve.watch", kind: configBool, flag: "watch", help: "reload the data file whenever another program changes it"},
+	{name: "serve.read-only", kind: configBool, flag: "read-only", help: "reject requests that would change entries"},
+	{name: "serve.legacy-routes", kind: configBool, flag: "legacy-routes", help: "also serve the API at its deprecated paths without /v1"},
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+// config holds the settings of the config file by key, as loadConfig read
+// them. Strings are strings, integers int64, booleans bool and lists
+// []string.
+var config map[string]any
+
+// configPath returns where the config file is: AUTHER_CONFIG, or else
+// config.toml in the config directory.
+func configPath() (string, error) {
+	if env := os.Getenv("AUTHER_CONFIG"); env != "" {
+		return env, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFile), nil
+}
+
+// loadConfig reads the config file into config. A missing file is no error.
+// Settings this version doesn't know, such as ones added by a newer version,
+// are left out and returned as warnings, but a known one with a value of the
+// wrong kind is an error.
+func loadConfig() (warnings []string, err error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	flat := flattenConfig(raw, "")
+	names := make([]string, 0, len(flat))
+	for name := range flat {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config = map[string]any{}
+	for _, name := range names {
+		key, ok := findConfigKey(name)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("ignoring unknown setting %s in %s.", name, path))
+			continue
+		}
+		v, err := configValue(key, flat[name])
+		if err != nil {
+			return warnings, fmt.Errorf("invalid %s in %s: %v", name, path, err)
+		}
+		config[name] = v
+	}
+	return warnings, nil
+}
+
+// mustLoadConfig loads the config file for a config command, exiting if it
+// can't be read.
+func mustLoadConfig() {
+	warnings, err := loadConfig()
+	for _, warning := range warnings {
+		slog.Warn(warning)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// readConfigFile parses the config file at path as it is, tables and all.
+func readConfigFile(path string) (map[string]any, error) {
+	raw := map[string]any{}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return raw, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := toml.Decode(string(content), &raw); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return raw, nil
+}
+
+// flattenConfig turns the tables of raw into dotted keys, such as
+// serve.port.
+func flattenConfig(raw map[string]any, prefix string) map[string]any {
+	flat := map[string]any{}
+	for name, value := range raw {
+		if table, ok := value.(map[string]any); ok {
+			for k, v := range flattenConfig(table, prefix+name+".") {
+				flat[k] = v
+			}
+			continue
+		}
+		flat[prefix+name] = value
+	}
+	return flat
+}
+
+// configValue checks that value, as decoded from TOML, is of the kind key
+// needs. A single string is taken as a list of one.
+func configValue(key configKey, value any) (any, error) {
+	switch key.kind {
+	case configString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case configInt:
+		if n, ok := value.(int64); ok {
+			return n, nil
+		}
+	case configBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case configList:
+		switch v := value.(type) {
+		case string:
+			return []string{v}, nil
+		case []any:
+			list := []string{}
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("must be %s", key.kind)
+				}
+				list = append(list, s)
+			}
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("must be %s", key.kind)
+}
+
+// applyConfig sets the flags of fs, those of every command for the section
+// "" and those of serve for "serve", from the config file, leaving those
+// given on the command line or overridden by the environment alone.
+func applyConfig(fs *flag.FlagSet, section string) error {
+	for _, key := range configKeys {
+		keySection := ""
+		if s, _, ok := strings.Cut(key.name, "."); ok {
+			keySection = s
+		}
+		value, ok := config[key.name]
+		if !ok || key.flag == "" || keySection != section || flagsGiven(fs, key.flag) {
+			continue
+		}
+		if key.env != "" && os.Getenv(key.env) != "" {
+			continue
+		}
+
+		// Setting the flag's value directly, rather than with fs.Set,
+		// leaves it out of flagsGiven.
+		f := fs.Lookup(key.flag)
+		var err error
+		switch v := value.(type) {
+		case string:
+			err = f.Value.Set(v)
+		case int64:
+			err = f.Value.Set(strconv.FormatInt(v, 10))
+		case bool:
+			err = f.Value.Set(strconv.FormatBool(v != key.invert))
+		case []string:
+			for _, s := range v {
+				if err = f.Value.Set(s); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s in the config file: %v", key.name, err)
+		}
+	}
+	return nil
+}
+
+// configStrings returns the list set for a key of the config file that isn't
+// a flag.
+func configStrings(name string) []string {
+	list, _ := config[name].([]string)
+	return list
+}
+
+// configCommand reads and changes the config file: config path, config list
+// [--all], config get key, config set key value... and config unset key.
+func configCommand(args []string) {
+	const usage = "config path | config list [--all] | config get key | config set key value... | config unset key"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+	path, err := configPath()
+	if err != nil {
+		fatal(err)
+	}
+
+	switch args[0] {
+	case "path":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: authinator config path")
+			os.Exit(2)
+		}
+		fmt.Println(path)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintln(os.Stderr, "(It doesn't exist yet; authinator config set creates it.)")
+		}
+	case "list":
+		configListCommand(args[1:])
+	case "get":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: authinator config get key")
+			os.Exit(2)
+		}
+		configGetCommand(args[1])
+	case "set":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: authinator config set key value...")
+			os.Exit(2)
+		}
+		configSetCommand(path, args[1], args[2:])
+	case "unset":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: authinator config unset key")
+			os.Exit(2)
+		}
+		configSetCommand(path, args[1], nil)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+}
+
+// configListCommand prints the settings of the config file, or with --all
+// every setting there is.
+func configListCommand(args []string) {
+	fs := newFlagSet("config list", "config list [--all]")
+	all := fs.Bool("all", false, "list every setting, with what it does, including those not set")
+	if rest, err := parseFlags(fs, args); err != nil || len(rest) != 0 {
+		if err == nil {
+			fmt.Fprintln(os.Stderr, "Usage: authinator config list [--all]")
+		}
+		os.Exit(2)
+	}
+	mustLoadConfig()
+	if options.json {
+		printJSON(config)
+		return
+	}
+	if *all {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tDESCRIPTION")
+		for _, key := range configKeys {
+			value := "-"
+			if v, ok := config[key.name]; ok {
+				value = tomlValue(v)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key.name, value, key.help)
+		}
+		w.Flush()
+		return
+	}
+	if len(config) == 0 {
+		fmt.Println("Nothing is set in the config file (see authinator config list --all).")
+		return
+	}
+	for _, key := range configKeys {
+		if v, ok := config[key.name]; ok {
+			fmt.Printf("%s = %s\n", key.name, tomlValue(v))
+		}
+	}
+}
+
+// configGetCommand prints the value of a setting, a list one item per line.
+// Like git config, it exits with status 1 when the setting isn't set.
+func configGetCommand(name string) {
+	if _, ok := findConfigKey(name); !ok {
+		fmt.Fprintf(os.Stderr, "Unknown setting %s (see authinator config list --all).\n", name)
+		os.Exit(2)
+	}
+	mustLoadConfig()
+	value, ok := config[name]
+	if !ok {
+		os.Exit(1)
+	}
+	if options.json {
+		printJSON(value)
+		return
+	}
+	switch v := value.(type) {
+	case []string:
+		for _, s := range v {
+			fmt.Println(s)
+		}
+	default:
+		fmt.Println(v)
+	}
+}
+
+// configSetCommand sets a setting to values, or removes it if values is nil,
+// and saves the config file. The file is rewritten as a whole, through a
+// temporary file, so it is never left half written; settings this version
+// doesn't know are kept, but comments are not.
+func configSetCommand(path, name string, values []string) {
+	key, ok := findConfigKey(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown setting %s (see authinator config list --all).\n", name)
+		os.Exit(2)
+	}
+	var value any
+	if values != nil {
+		var err error
+		if value, err = parseConfigValue(key, values); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid %s: %v\n", name, err)
+			os.Exit(2)
+		}
+	}
+
+	raw, err := readConfigFile(path)
+	if err != nil {
+		fatal(fmt.Errorf("%v; fix it by hand first", err))
+	}
+	table, last := raw, name
+	if section, rest, ok := strings.Cut(name, "."); ok {
+		next, ok := raw[section].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			raw[section] = next
+		}
+		table, last = next, rest
+	}
+	if value == nil {
+		delete(table, last)
+	} else {
+		table[last] = value
+	}
+	for section, v := range raw {
+		if t, ok := v.(map[string]any); ok && len(t) == 0 {
+			delete(raw, section)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(raw); err != nil {
+		fatal(err)
+	}
+	if err := writeConfigFile(path, buf.Bytes()); err != nil {
+		fatal(fmt.Errorf("saving %s: %w", path, err))
+	}
+}
+
+// parseConfigValue parses the values given to config set for key.
+func parseConfigValue(key configKey, values []string) (any, error) {
+	if key.kind == configList {
+		return values, nil
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("takes a single value, %s", key.kind)
+	}
+	switch key.kind {
+	case configInt:
+		n, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't an integer", values[0])
+		}
+		return n, nil
+	case configBool:
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't true or false", values[0])
+		}
+		return b, nil
+	}
+	return values[0], nil
+}
+
+// writeConfigFile replaces the config file at path with content, readable
+// only by the user, by renaming a temporary file over it.
+func writeConfigFile(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// tomlValue formats a setting's value as it is written in the config file.
+func tomlValue(v any) string {
+	var buf bytes.Buffer
+	toml.NewEncoder(&buf).Encode(map[string]any{"v": v})
+	return strings.TrimSpace(strings.TrimPrefix(buf.String(), "v = "))
+}
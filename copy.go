@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// copyCommand copies an entry's current code without ever printing it, for
+// when someone might be looking at the screen.
+func copyCommand(args []string) {
+	fs := newFlagSet("copy", "copy [name] [--exact]")
+	exact := fs.Bool("exact", false, "only accept an exact name match")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator copy [name] [--exact]")
+		os.Exit(2)
+	}
+
+	data := loadCodeData()
+	matches := resolveEntry(data, args[0], *exact)
+	if len(matches) == 0 {
+		reportErrorf("No entry found with that name.")
+		os.Exit(exitNotFound)
+	}
+	entry := matches[0]
+	if len(matches) > 1 {
+		if options.json || !isTerminal(os.Stdin) {
+			printCandidates(args[0], matches)
+			os.Exit(exitNotFound)
+		}
+		fmt.Printf("'%s' matches several entries:\n", args[0])
+		entry = mustPickEntry(matches)
+	}
+
+	how := mustCopyCode(data, entry)
+	if options.json {
+		printJSON(map[string]any{"name": entry.Name, "copied": true, "to": how})
+		return
+	}
+	reportCopiedEntry(entry.Name, how)
+}
+
+// mustCopyCode copies a fresh code of entry, one of data's entries, to the
+// clipboard and returns where it went. Unlike [name], it fails with
+// exitNoClipboard when there is no clipboard to copy to, as copying is all
+// it is asked to do.
+func mustCopyCode(data TOTPData, entry TOTPEntry) string {
+	result := mustFreshCodes(data, entry, codeQuery{})
+	how, err := copyToClipboard(result.Code)
+	switch {
+	case err == errClipboardDisabled:
+		fail(exitNoClipboard, errors.New("copying to the clipboard is turned off by --no-clipboard or AUTHER_NO_CLIPBOARD"))
+	case err != nil:
+		fail(exitNoClipboard, fmt.Errorf("could not copy the code: %w", err))
+	}
+	return how
+}
+
+// reportCopiedEntry prints the one-line confirmation of copy and list --copy,
+// which never includes the code.
+func reportCopiedEntry(name, how string) {
+	switch {
+	case how == copiedOSC52:
+		fmt.Printf("The code of '%s' was sent to your terminal clipboard.\n", name)
+	case options.noClear || options.clipboardTimeout <= 0:
+		fmt.Printf("The code of '%s' was copied to the clipboard.\n", name)
+	default:
+		fmt.Printf("The code of '%s' was copied to the clipboard (cleared in %d seconds).\n", name, options.clipboardTimeout)
+	}
+}
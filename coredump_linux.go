@@ -0,0 +1,12 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// disableCoreDumps keeps the process's memory, and so the secrets and keys
+// in it, out of core dumps, and stops other processes of the user from
+// reading it through ptrace or /proc. Commands that exec runs are dumpable
+// again, as execve resets that, but inherit the core size limit of zero.
+func disableCoreDumps() {
+	unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+	unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{})
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// disableCoreDumps keeps the process's memory, and so the secrets and keys
+// in it, out of core dumps. Other processes of the user can still attach a
+// debugger where the system allows it.
+func disableCoreDumps() {
+	unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{})
+}
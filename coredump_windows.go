@@ -0,0 +1,7 @@
+//go:build windows
+
+package main
+
+// Windows has no core size limit to lower; crash dumps are up to Windows
+// Error Reporting.
+func disableCoreDumps() {}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"authinator/pkg/auther"
+)
+
+// passphrase holds the passphrase for the currently open vault. It is nil
+// while the vault is stored as plaintext.
+var passphrase []byte
+
+// readPassphrase reads the vault passphrase. AUTHER_PASSPHRASE takes
+// precedence so scripts and serve mode can unlock the vault non-interactively.
+func readPassphrase(prompt string) ([]byte, error) {
+	if env := os.Getenv("AUTHER_PASSPHRASE"); env != "" {
+		return []byte(env), nil
+	}
+	return readPassword(prompt)
+}
+
+// readPassword prompts on stderr and reads a line without echoing it,
+// falling back to a plain read when stdin isn't a terminal.
+func readPassword(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	return readHiddenLine()
+}
+
+// readHiddenLine reads a line without echoing it when stdin is a terminal,
+// and a plain line otherwise so input can still be piped. The line ending is
+// dropped, including the carriage return of Windows line endings.
+func readHiddenLine() ([]byte, error) {
+	if isTerminal(os.Stdin) {
+		p, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return p, err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// unlock prompts for the vault passphrase once per process.
+func unlock() error {
+	if passphrase != nil {
+		return nil
+	}
+	p, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return err
+	}
+	passphrase = p
+	return nil
+}
+
+// unlockPassphrase is the auther.PassphraseFunc for the data file.
+func unlockPassphrase() ([]byte, error) {
+	if err := unlock(); err != nil {
+		return nil, err
+	}
+	return passphrase, nil
+}
+
+// dataKey returns the key the data file is encrypted with, or nil if it isn't
+// encrypted with a passphrase or hasn't been loaded.
+func dataKey() *auther.Key {
+	if dataFileBackend == nil {
+		return nil
+	}
+	return dataFileBackend.Key()
+}
+
+// readNewPassphrase asks for a new passphrase with prompt, and a second time
+// with confirmPrompt unless it comes from AUTHER_PASSPHRASE. It returns nil,
+// after saying why on stderr, if the passphrase is empty or the two don't
+// match.
+func readNewPassphrase(prompt, confirmPrompt string) []byte {
+	p, err := readPassphrase(prompt)
+	if err != nil {
+		fatal(fmt.Errorf("reading passphrase: %w", err))
+	}
+	if len(p) == 0 {
+		fmt.Fprintln(os.Stderr, "Passphrase must not be empty.")
+		return nil
+	}
+	if os.Getenv("AUTHER_PASSPHRASE") == "" {
+		confirm, err := readPassphrase(confirmPrompt)
+		if err != nil {
+			fatal(fmt.Errorf("reading passphrase: %w", err))
+		}
+		if !bytes.Equal(p, confirm) {
+			fmt.Fprintln(os.Stderr, "Passphrases do not match.")
+			return nil
+		}
+	}
+	return p
+}
+
+// decodeDataFile decrypts, if needed, and parses an authinator data file
+// other than the one in use, such as a backup or an imported file. ask is
+// called for its passphrase.
+func decodeDataFile(path string, content []byte, ask auther.PassphraseFunc) (TOTPData, error) {
+	var data TOTPData
+	var err error
+	switch {
+	case auther.IsAgeEncrypted(content):
+		data, _, err = auther.DecodeAge(path, content, loadAgeIdentities)
+	case auther.IsGPGEncrypted(content):
+		data, _, err = auther.DecodeGPG(path, content, newGPG())
+	default:
+		data, _, err = auther.Decode(path, content, ask)
+	}
+	return data, err
+}
+
+// isEncryptedFile reports whether content is a data file encrypted in any
+// of the ways authinator supports.
+func isEncryptedFile(content []byte) bool {
+	return auther.IsEncrypted(content) || auther.IsAgeEncrypted(content) || auther.IsGPGEncrypted(content)
+}
+
+// encryptVault encrypts the data file with a passphrase or, with
+// --age-recipient or --gpg-recipient, with age or GnuPG. A data file already
+// encrypted can be switched to age or GnuPG, or to other recipients, but not
+// back to a passphrase.
+func encryptVault(args []string) {
+	const usage = "encrypt [--age-recipient key... | --gpg-recipient key...]"
+	fs := newFlagSet("encrypt", usage)
+	ageRecipients := ageRecipientsFlag(fs)
+	gpgRecipients := gpgRecipientsFlag(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 || (len(*ageRecipients) > 0 && len(*gpgRecipients) > 0) {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+	if len(*ageRecipients) > 0 {
+		mustParseAgeRecipients(*ageRecipients)
+	}
+	if len(*gpgRecipients) > 0 {
+		mustCheckGPGRecipients(*gpgRecipients)
+	}
+
+	mustOpenBackend()
+	file, ok := dataBackend.Backend.(*auther.FileBackend)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "The %s backend doesn't support encryption.\n", backendName())
+		os.Exit(1)
+	}
+	data := mustLoadData()
+	var with string
+	var recipients []string
+	switch {
+	case len(*ageRecipients) > 0:
+		with, recipients = "age", *ageRecipients
+		file.SetAgeRecipients(recipients)
+	case len(*gpgRecipients) > 0:
+		with, recipients = "GnuPG", *gpgRecipients
+		file.SetGPGRecipients(recipients)
+	}
+	if recipients != nil {
+		mustSaveData(data)
+		if len(recipients) == 1 {
+			fmt.Printf("Data file encrypted with %s to 1 recipient.\n", with)
+		} else {
+			fmt.Printf("Data file encrypted with %s to %d recipients.\n", with, len(recipients))
+		}
+		return
+	}
+	if file.Encrypted() {
+		fmt.Println("Data file is already encrypted.")
+		return
+	}
+
+	p := readNewPassphrase("New passphrase: ", "Confirm passphrase: ")
+	if p == nil {
+		return
+	}
+	key, err := auther.NewKey(p)
+	if err != nil {
+		fatal(err)
+	}
+	file.SetKey(key)
+	mustSaveData(data)
+	fmt.Println("Data file encrypted successfully!")
+}
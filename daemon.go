@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// serve --daemon starts the server again as a process of its own, detached
+// from the terminal (in a session of its own, or on Windows without a
+// console), and exits once it listens. The server is the same as in the
+// foreground: it records itself for --status and --stop, and shuts down
+// gracefully on SIGTERM.
+
+const (
+	// daemonLogFile is where the server's output and access log go unless
+	// --log-file says otherwise, in the config directory.
+	daemonLogFile = "serve.log"
+
+	// daemonStartTimeout is how long serve --daemon waits for the server
+	// to listen.
+	daemonStartTimeout = 15 * time.Second
+)
+
+// startDaemon starts serve in the background with args, the command line
+// without --daemon, and returns once it listens, saying where. logFile is
+// the --log-file flag.
+func startDaemon(args []string, logFile string) error {
+	if inst, running, err := runningServe(); err != nil {
+		return err
+	} else if running {
+		return serveRunningError{inst}
+	}
+	if logFile == "" {
+		dir, err := configDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		logFile = filepath.Join(dir, daemonLogFile)
+		args = append(args, "--log-file", logFile)
+	}
+	// What serve prints besides its log, such as where it listens or a
+	// newly generated token, goes to the log file too.
+	out, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("opening the log file: %w", err)
+	}
+	defer out.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting the server in the background: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// The server writes its PID file once it listens. It is read without
+	// taking the lock, which the server may be about to take.
+	base, err := serveInstanceBase()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(daemonStartTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("the server exited right away (%v); see %s", err, logFile)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if inst, err := readServeInstance(base + ".pid"); err == nil && inst.PID == cmd.Process.Pid {
+			fmt.Printf("Started authinator serve in the background (pid %d, listening on %s).\n", inst.PID, inst.Address)
+			fmt.Printf("It logs to %s. Stop it with: authinator serve --stop\n", logFile)
+			return nil
+		}
+	}
+	return fmt.Errorf("the server (pid %d) didn't start listening within %s; see %s", cmd.Process.Pid, daemonStartTimeout, logFile)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// duplicateGroup is a set of entries that dedupe considers the same, either
+// because their names only differ in case or because they share a secret.
+type duplicateGroup struct {
+	Reason  string      `json:"reason"` // "name" or "secret"
+	Entries []TOTPEntry `json:"-"`
+	Names   []string    `json:"names"`
+}
+
+// findDuplicates groups entries whose names are the same apart from case,
+// then entries with the same secret that aren't already grouped together by
+// name. Secrets must have been loaded.
+func findDuplicates(entries []TOTPEntry) []duplicateGroup {
+	var groups []duplicateGroup
+	group := func(reason string, key func(TOTPEntry) string) {
+		byKey := map[string][]TOTPEntry{}
+		var keys []string
+		for _, entry := range entries {
+			k := key(entry)
+			if k == "" {
+				continue
+			}
+			if byKey[k] == nil {
+				keys = append(keys, k)
+			}
+			byKey[k] = append(byKey[k], entry)
+		}
+		for _, k := range keys {
+			members := byKey[k]
+			if len(members) < 2 {
+				continue
+			}
+			if reason == "secret" && slices.ContainsFunc(groups, func(g duplicateGroup) bool { return sameMembers(g.Entries, members) }) {
+				continue
+			}
+			g := duplicateGroup{Reason: reason, Entries: members}
+			for _, entry := range members {
+				g.Names = append(g.Names, entry.Name)
+			}
+			groups = append(groups, g)
+		}
+	}
+	group("name", func(e TOTPEntry) string { return strings.ToLower(e.Name) })
+	group("secret", func(e TOTPEntry) string { return auther.NormalizeSecret(e.Secret) })
+	return groups
+}
+
+// sameMembers reports whether b holds only entries that are also in a.
+func sameMembers(a, b []TOTPEntry) bool {
+	for _, entry := range b {
+		if !slices.ContainsFunc(a, func(e TOTPEntry) bool { return e.Name == entry.Name }) {
+			return false
+		}
+	}
+	return true
+}
+
+// exactIndex returns the position of the entry called exactly name, or -1.
+// Lookups by name ignore case, which can't tell duplicates apart.
+func exactIndex(v TOTPData, name string) int {
+	return slices.IndexFunc(v.Entries, func(e TOTPEntry) bool { return e.Name == name })
+}
+
+func dedupeCommand(args []string) {
+	fs := newFlagSet("dedupe", "dedupe [--list]")
+	list := fs.Bool("list", false, "only list duplicates, without resolving them")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator dedupe [--list]")
+		os.Exit(2)
+	}
+
+	store := mustOpenStore()
+	entries := store.List()
+	for i := range entries {
+		if err := entries[i].LoadSecret(); err != nil {
+			fatal(fmt.Errorf("loading the secret of %s: %w", entries[i].Name, err))
+		}
+	}
+	groups := findDuplicates(entries)
+
+	if options.json {
+		if groups == nil {
+			groups = []duplicateGroup{}
+		}
+		printJSON(groups)
+		return
+	}
+	if len(groups) == 0 {
+		fmt.Println("No duplicate entries found.")
+		return
+	}
+	if *list || !isTerminal(os.Stdin) {
+		for _, g := range groups {
+			fmt.Printf("%s: %s\n", duplicateReason(g), strings.Join(g.Names, ", "))
+		}
+		return
+	}
+
+	for _, g := range groups {
+		resolveDuplicates(store, g)
+	}
+}
+
+func duplicateReason(g duplicateGroup) string {
+	if g.Reason == "name" {
+		return "Same name apart from case"
+	}
+	return "Same secret"
+}
+
+// resolveDuplicates asks which entry of g to keep and moves the others to
+// the trash, or, for names that only differ in case, renames them.
+func resolveDuplicates(store *auther.Store, g duplicateGroup) {
+	// Earlier answers may have removed or renamed some of the entries.
+	current := store.List()
+	var entries []TOTPEntry
+	for _, entry := range g.Entries {
+		if exactIndex(TOTPData{Entries: current}, entry.Name) >= 0 {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) < 2 {
+		return
+	}
+
+	fmt.Printf("\n%s:\n", duplicateReason(g))
+	labels := make([]string, len(entries))
+	width := 0
+	for i, entry := range entries {
+		labels[i] = entry.Name + describe(entry) + tagLabel(entry)
+		width = max(width, len(labels[i]))
+	}
+	for i, entry := range entries {
+		fmt.Printf("%3d) %s  added %s, last used %s\n", i+1, padRight(labels[i], width),
+			formatStamp(entry.CreatedAt, "unknown"), formatStamp(entry.LastUsedAt, "never"))
+	}
+	choices := fmt.Sprintf("1-%d to keep one and trash the others, s to skip", len(entries))
+	if g.Reason == "name" {
+		choices = fmt.Sprintf("1-%d to keep one and trash the others, r to rename, s to skip", len(entries))
+	}
+
+	for {
+		promptf("Resolve [%s]: ", choices)
+		answer, err := stdin.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		switch n, convErr := strconv.Atoi(answer); {
+		case answer == "s" || (answer == "" && err == io.EOF):
+			if err == io.EOF {
+				fmt.Println()
+			}
+			fmt.Println("Skipped.")
+			return
+		case g.Reason == "name" && answer == "r":
+			renameDuplicates(store, entries)
+			return
+		case convErr == nil && n >= 1 && n <= len(entries):
+			trashDuplicates(store, entries, entries[n-1])
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Enter %s.\n", choices)
+	}
+}
+
+// trashDuplicates moves every entry but keep to the trash.
+func trashDuplicates(store *auther.Store, entries []TOTPEntry, keep TOTPEntry) {
+	err := store.Update(func(v *TOTPData) error {
+		now := time.Now()
+		for _, entry := range entries {
+			i := exactIndex(*v, entry.Name)
+			if entry.Name == keep.Name || i < 0 {
+				continue
+			}
+			v.Trash = append(v.Trash, auther.TrashedEntry{Entry: v.Entries[i], DeletedAt: now})
+			v.Entries = slices.Delete(v.Entries, i, i+1)
+		}
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Kept '%s' and moved the others to the trash.\n", keep.Name)
+}
+
+// renameDuplicates asks for a new name for every entry but the first.
+func renameDuplicates(store *auther.Store, entries []TOTPEntry) {
+	for _, entry := range entries[1:] {
+		for {
+			promptf("New name for '%s': ", entry.Name)
+			name, err := stdin.ReadString('\n')
+			name = strings.TrimSpace(name)
+			if name == "" {
+				if err == io.EOF {
+					fmt.Println()
+				}
+				fmt.Printf("Left '%s' as it is.\n", entry.Name)
+				break
+			}
+			err = store.Update(func(v *TOTPData) error {
+				if j := v.Index(name); j >= 0 {
+					return auther.ConflictError{Name: name, Existing: v.Entries[j].Name}
+				}
+				if i := exactIndex(*v, entry.Name); i >= 0 {
+					v.Entries[i].Name = name
+				}
+				return nil
+			})
+			if err == nil {
+				fmt.Printf("Renamed '%s' to '%s'.\n", entry.Name, name)
+				break
+			}
+			if !errors.Is(err, auther.ErrExists) {
+				fatal(err)
+			}
+			fmt.Fprintln(os.Stderr, conflictMessage(err, name))
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// Outcomes of a doctor check.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorChecks are the checks doctor runs, in order, by the names --skip
+// takes.
+var doctorChecks = []string{"data", "permissions", "secrets", "clock", "clipboard", "port"}
+
+// checkResult is the outcome of one doctor check.
+type checkResult struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// doctorCommand checks the things outside authinator that can break it, and
+// exits 1 if any check fails.
+func doctorCommand(args []string) {
+	fs := newFlagSet("doctor", "doctor [--skip check]")
+	var skip stringList
+	fs.Var(&skip, "skip", "skip a check: "+strings.Join(doctorChecks, ", ")+" (repeatable)")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator doctor [--skip check]")
+		os.Exit(2)
+	}
+	for _, name := range skip {
+		if !slices.Contains(doctorChecks, name) {
+			fmt.Fprintf(os.Stderr, "Unknown check %q. Checks are %s.\n", name, strings.Join(doctorChecks, ", "))
+			os.Exit(2)
+		}
+	}
+	run := func(name string) bool { return !slices.Contains(skip, name) }
+
+	var results []checkResult
+	report := func(check, status, format string, args ...any) {
+		results = append(results, checkResult{check, status, fmt.Sprintf(format, args...)})
+	}
+
+	var data *TOTPData
+	if run("data") || run("secrets") {
+		data = checkDataFile(report, run("data"))
+	}
+	if run("permissions") {
+		checkDataPermissions(report)
+	}
+	if run("secrets") && data != nil {
+		checkSecrets(report, *data)
+	}
+	if run("clock") && !ntpDisabled() {
+		checkClock(report, ntpServer())
+	}
+	if run("clipboard") {
+		checkClipboard(report)
+	}
+	if run("port") {
+		checkServePort(report)
+	}
+
+	failed := slices.ContainsFunc(results, func(r checkResult) bool { return r.Status == checkFail })
+	if options.json {
+		printJSON(results)
+	} else {
+		printCheckResults(results)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printCheckResults(results []checkResult) {
+	styles := map[string]string{checkPass: styleGreen, checkWarn: styleYellow, checkFail: styleRed}
+	width := 0
+	for _, r := range results {
+		width = max(width, len(r.Check))
+	}
+	for _, r := range results {
+		fmt.Printf("%s  %s  %s\n", colorize(strings.ToUpper(r.Status), styles[r.Status]), padRight(r.Check, width), r.Message)
+	}
+}
+
+// checkDataFile loads the data file, reporting the outcome if report is
+// set, and returns its entries if it could be read.
+func checkDataFile(report func(check, status, format string, args ...any), show bool) *TOTPData {
+	if !show {
+		report = func(string, string, string, ...any) {}
+	}
+	if _, err := os.Stat(dataPath); errors.Is(err, os.ErrNotExist) {
+		report("data", checkWarn, "%s doesn't exist yet; it is created with the first entry", dataPath)
+		return nil
+	}
+	b, err := openBackend()
+	if err != nil {
+		report("data", checkFail, "%s can't be opened: %v", dataPath, err)
+		return nil
+	}
+	data, err := b.Load()
+	if err != nil {
+		report("data", checkFail, "%s can't be read: %v", dataPath, err)
+		return nil
+	}
+	report("data", checkPass, "%s can be read (%s backend, entries: %d)", dataPath, backendName(), len(data.Entries))
+	return &data
+}
+
+func checkDataPermissions(report func(check, status, format string, args ...any)) {
+	switch mode, open := tooOpen(dataPath); {
+	case runtime.GOOS == "windows":
+		report("permissions", checkPass, "not checked on Windows, where the profile directory's ACLs protect the data file")
+	case open:
+		report("permissions", checkWarn, "%s is accessible by other users (mode %04o); run authinator --fix-permissions list or chmod 600 it", dataPath, mode)
+	case mode == 0:
+		report("permissions", checkPass, "there is no data file yet")
+	default:
+		report("permissions", checkPass, "%s is only accessible by its owner (mode %04o)", dataPath, mode)
+	}
+}
+
+// checkSecrets makes sure every secret decodes and generates a code, which
+// also finds secrets missing from the OS keyring.
+func checkSecrets(report func(check, status, format string, args ...any), data TOTPData) {
+	var broken []string
+	now := time.Now()
+	for _, entry := range data.Entries {
+		err := entry.LoadSecret()
+		if err == nil && !entry.IsSteam() {
+			_, err = auther.DecodeSecret(entry.Secret)
+		}
+		if err == nil {
+			_, err = entry.Code(now)
+		}
+		if err != nil {
+			broken = append(broken, fmt.Sprintf("%s (%v)", entry.Name, err))
+		}
+	}
+	if len(broken) > 0 {
+		report("secrets", checkFail, "entries that can't generate codes: %s", strings.Join(broken, "; "))
+		return
+	}
+	report("secrets", checkPass, "every secret is valid base32 and generates codes")
+}
+
+func checkClock(report func(check, status, format string, args ...any), server string) {
+	offset, err := queryClockOffset(server, 5*time.Second)
+	if err != nil {
+		report("clock", checkWarn, "couldn't ask %s for the time: %v (use --skip clock on offline machines)", server, err)
+		return
+	}
+
+	status := checkPass
+	switch abs := offset.Abs(); {
+	case abs >= clockFailOffset:
+		status = checkFail
+	case abs > clockWarnOffset:
+		status = checkWarn
+	}
+	message := "the clock is " + describeClockOffset(offset, server)
+	if status != checkPass {
+		message += "; codes are generated from the clock, so services may reject them. Sync the clock, e.g. by enabling NTP"
+	}
+	report("clock", status, "%s", message)
+}
+
+func checkClipboard(report func(check, status, format string, args ...any)) {
+	if clipboardDisabled() {
+		report("clipboard", checkWarn, "copying is turned off by --no-clipboard or AUTHER_NO_CLIPBOARD")
+		return
+	}
+	if _, err := nativeRead(); err != nil {
+		report("clipboard", checkWarn, "no system clipboard (%v); codes are only sent with OSC 52 to terminals that support it", err)
+		return
+	}
+	report("clipboard", checkPass, "the system clipboard is available")
+}
+
+// checkServePort checks that serve can listen on its default address, or
+// that the program there already is an authinator serve.
+func checkServePort(report func(check, status, format string, args ...any)) {
+	addr := os.Getenv("AUTHER_ADDR")
+	if addr == "" {
+		addr = net.JoinHostPort(defaultBind, strconv.Itoa(defaultPort))
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err == nil {
+		ln.Close()
+		report("port", checkPass, "serve can listen on %s", addr)
+		return
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	if resp, err := client.Get("http://" + addr + "/healthz"); err == nil {
+		defer resp.Body.Close()
+		var health healthStatus
+		if json.NewDecoder(resp.Body).Decode(&health) == nil && health.Status != "" {
+			report("port", checkPass, "an authinator serve is already running on %s", addr)
+			return
+		}
+	}
+	report("port", checkWarn, "another program is using %s (%v); run serve with --port to pick another port", addr, err)
+}
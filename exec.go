@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const execUsage = "Usage: authinator exec [name] [--stdin] [--exact] [--min-validity seconds] -- command [arguments...]"
+
+// execCommand runs a command with a fresh code of an entry, in its
+// environment as AUTHER_CODE or written to its stdin, and exits with the
+// command's exit status.
+func execCommand(args []string) {
+	split := slices.Index(args, "--")
+	if split < 0 || split == len(args)-1 {
+		fmt.Fprintln(os.Stderr, execUsage)
+		os.Exit(2)
+	}
+	command := args[split+1:]
+
+	fs := newFlagSet("exec", "exec [name] [--stdin] [--exact] [--min-validity seconds] -- command [arguments...]")
+	toStdin := fs.Bool("stdin", false, "write the code to the command's stdin instead of its environment")
+	exact := fs.Bool("exact", false, "only accept an exact name match")
+	minValidity := fs.Int("min-validity", 5, fmt.Sprintf("wait for the next code if the current one expires in fewer seconds (at most %d)", maxMinValidity))
+	rest, err := parseFlags(fs, args[:split])
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, execUsage)
+		os.Exit(2)
+	}
+	q := codeQuery{minValidity: *minValidity}
+	if err := q.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	data := loadCodeData()
+	matches := resolveEntry(data, rest[0], *exact)
+	switch {
+	case len(matches) == 0:
+		reportErrorf("No entry found with that name.")
+		os.Exit(exitNotFound)
+	case len(matches) > 1:
+		printCandidates(rest[0], matches)
+		os.Exit(exitNotFound)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// The code is generated as late as possible, right before the command
+	// starts, so it has as much of its period left as it can.
+	result := mustFreshCodes(data, matches[0], q)
+	if *toStdin {
+		cmd.Stdin = strings.NewReader(result.Code + "\n")
+	} else {
+		cmd.Env = append(os.Environ(),
+			"AUTHER_CODE="+result.Code,
+			"AUTHER_CODE_EXPIRES_IN="+strconv.FormatInt(result.ExpiresIn, 10))
+	}
+
+	if err := cmd.Start(); err != nil {
+		fail(127, err)
+	}
+	// Ctrl-C reaches the command too, as it shares the terminal; authinator
+	// just waits for it to finish. Other signals are passed on.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig != os.Interrupt {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		os.Exit(exitStatus(exitErr))
+	default:
+		fatal(err)
+	}
+}
+
+// exitStatus returns the status to exit with after a command failed: its
+// own, or 128 plus the signal number, as shells do, if a signal killed it.
+func exitStatus(err *exec.ExitError) int {
+	if status, ok := err.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return err.ExitCode()
+}
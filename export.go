@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+func exportCommand(args []string) {
+	fs := newFlagSet("export", "export [csv] [--format uri|json|csv|aegis|andotp|freeotp] [--encrypt | --age-recipient key...] [flags]")
+	format := fs.String("format", exportURI, "what to export as: uri, json, csv, or a backup for aegis, andotp or freeotp")
+	encrypt := fs.Bool("encrypt", false, "write a passphrase-encrypted bundle of the data file, which import reads back")
+	recipients := ageRecipientsFlag(fs)
+	output := fs.String("output", "", "write the export to a file instead of stdout (- for stdout)")
+	includeSecrets := fs.Bool("include-secrets", false, "skip the confirmation prompt")
+	noSecrets := fs.Bool("no-secrets", false, "leave the secret column out of a CSV export")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	if len(args) > 1 || (len(args) == 1 && args[0] != exportCSV) {
+		fs.Usage()
+		return
+	}
+	// export csv and --json predate --format.
+	switch {
+	case len(args) == 1 || options.json:
+		if flagsGiven(fs, "format") {
+			fmt.Fprintln(os.Stderr, "--format can't be combined with export csv or --json.")
+			os.Exit(2)
+		}
+		*format = exportJSON
+		if len(args) == 1 {
+			*format = exportCSV
+		}
+	case !slices.Contains(exportFormats, *format):
+		fmt.Fprintf(os.Stderr, "Unknown export format %q. Use %s.\n", *format, strings.Join(exportFormats, ", "))
+		os.Exit(2)
+	}
+	if *encrypt && len(*recipients) > 0 {
+		fmt.Fprintln(os.Stderr, "--encrypt and --age-recipient can't be combined.")
+		os.Exit(2)
+	}
+	if len(*recipients) > 0 {
+		mustParseAgeRecipients(*recipients)
+		*encrypt = true
+	}
+	if *encrypt {
+		if *format != exportJSON && (len(args) == 1 || flagsGiven(fs, "format")) {
+			fmt.Fprintln(os.Stderr, "Encrypted exports are bundles of the data file, so --encrypt and --age-recipient can't be combined with another format.")
+			os.Exit(2)
+		}
+		*format = exportJSON
+	}
+	if *output == "-" {
+		*output = ""
+	}
+	if *encrypt && *output == "" && isTerminal(os.Stdout) {
+		fmt.Fprintln(os.Stderr, "An encrypted bundle isn't text; write it to a file with --output, or redirect it.")
+		os.Exit(2)
+	}
+	if *noSecrets && *format != exportCSV {
+		fmt.Fprintln(os.Stderr, "--no-secrets is only supported for CSV exports.")
+		os.Exit(2)
+	}
+
+	withSecrets := !*noSecrets
+	if withSecrets && !*encrypt && !*includeSecrets && !confirm("This export reveals every secret in plaintext. Continue?") {
+		fmt.Println("Export cancelled.")
+		return
+	}
+
+	data := mustLoadData()
+	if withSecrets {
+		mustLoadSecrets(data.Entries)
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case len(*recipients) > 0:
+		data.Trash = nil
+		var bundle []byte
+		if bundle, err = auther.EncodeAge(data, *recipients); err == nil {
+			buf.Write(bundle)
+		}
+	case *encrypt:
+		p := readNewPassphrase("Bundle passphrase: ", "Confirm bundle passphrase: ")
+		if p == nil {
+			os.Exit(1)
+		}
+		data.Trash = nil
+		var bundle []byte
+		if bundle, err = auther.Encode(data, p); err == nil {
+			buf.Write(bundle)
+		}
+	case *format == exportCSV:
+		err = writeCSV(&buf, data.Entries, withSecrets)
+	case *format == exportJSON:
+		data.Version, data.Trash = auther.SchemaVersion, nil
+		err = writeIndentedJSON(&buf, data)
+	case *format == exportAegis:
+		err = writeAegis(&buf, data.Entries)
+	case *format == exportAndOTP:
+		err = writeAndOTP(&buf, data.Entries)
+	case *format == exportFreeOTP:
+		err = writeFreeOTP(&buf, data.Entries)
+	default:
+		for _, entry := range data.Entries {
+			buf.WriteString(entry.URI())
+			buf.WriteByte('\n')
+		}
+	}
+	if err != nil {
+		fatal(fmt.Errorf("encoding the export: %w", err))
+	}
+	detail := *format
+	switch {
+	case len(*recipients) > 0:
+		detail = "age bundle"
+	case *encrypt:
+		detail = "encrypted bundle"
+	case !withSecrets:
+		detail += " without secrets"
+	}
+	logAuditDetail("export", "", auditOK, fmt.Sprintf("%s, %s", countEntries(len(data.Entries)), detail))
+
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0600); err != nil {
+		fatal(fmt.Errorf("writing export: %w", err))
+	}
+	if options.json {
+		printJSON(map[string]any{"exported": len(data.Entries), "output": *output})
+		return
+	}
+	fmt.Printf("Exported %d entries to %s\n", len(data.Entries), *output)
+}
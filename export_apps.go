@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// Formats export can write. uri is the default; csv is also chosen by
+// export csv and json by --json.
+const (
+	exportURI     = "uri"
+	exportJSON    = "json"
+	exportCSV     = "csv"
+	exportAegis   = "aegis"
+	exportAndOTP  = "andotp"
+	exportFreeOTP = "freeotp"
+)
+
+var exportFormats = []string{exportURI, exportJSON, exportCSV, exportAegis, exportAndOTP, exportFreeOTP}
+
+// appLabel returns the issuer and account an authenticator app shows for
+// entry. Apps label entries by issuer and account only, so an entry without
+// an account is exported with its name as the account, and the importers
+// name entries "Issuer - Account" again.
+func appLabel(entry TOTPEntry) (issuer, account string) {
+	account = entry.Account
+	if account == "" {
+		account = entry.Name
+	}
+	return entry.Issuer, account
+}
+
+// writeAegis writes entries as a plain (unencrypted) Aegis vault export,
+// which Aegis imports from Settings > Import & Export. Pinned entries become
+// favorites.
+func writeAegis(w io.Writer, entries []TOTPEntry) error {
+	db := aegisDB{Version: 2, Entries: []aegisEntry{}}
+	for _, entry := range entries {
+		issuer, account := appLabel(entry)
+		e := aegisEntry{Type: "totp", UUID: newUUID(), Name: account, Issuer: issuer, Favorite: entry.Pinned()}
+		if entry.IsSteam() {
+			e.Type = auther.TypeSteam
+		}
+		e.Info.Secret = auther.NormalizeSecret(entry.Secret)
+		e.Info.Algo = entry.CodeAlgorithm()
+		e.Info.Digits = entry.CodeDigits()
+		e.Info.Period = int(entry.CodePeriod())
+		db.Entries = append(db.Entries, e)
+	}
+	content, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	backup := aegisBackup{Version: 1, DB: content}
+	return writeIndentedJSON(w, backup)
+}
+
+// writeAndOTP writes entries as a plain andOTP backup, an array of entries.
+func writeAndOTP(w io.Writer, entries []TOTPEntry) error {
+	backup := []andOTPEntry{}
+	for _, entry := range entries {
+		issuer, account := appLabel(entry)
+		e := andOTPEntry{
+			Secret:        auther.NormalizeSecret(entry.Secret),
+			Issuer:        issuer,
+			Label:         account,
+			Digits:        entry.CodeDigits(),
+			Type:          "TOTP",
+			Algorithm:     entry.CodeAlgorithm(),
+			Period:        int(entry.CodePeriod()),
+			Thumbnail:     "Default",
+			Tags:          entry.Tags,
+			UsedFrequency: entry.Uses,
+		}
+		if !entry.LastUsedAt.IsZero() {
+			e.LastUsed = entry.LastUsedAt.UnixMilli()
+		}
+		if entry.IsSteam() {
+			e.Type = "STEAM"
+		}
+		if e.Tags == nil {
+			e.Tags = []string{}
+		}
+		backup = append(backup, e)
+	}
+	return writeIndentedJSON(w, backup)
+}
+
+// writeFreeOTP writes entries as a FreeOTP+ JSON backup. FreeOTP+ has no
+// Steam Guard support, so Steam entries are left out with a warning.
+func writeFreeOTP(w io.Writer, entries []TOTPEntry) error {
+	backup := freeOTPBackup{Tokens: []freeOTPToken{}, TokenOrder: []string{}}
+	for _, entry := range entries {
+		if entry.IsSteam() {
+			slog.Warn(fmt.Sprintf("left out the Steam Guard entry %s, which FreeOTP+ can't generate codes for.", entry.Name))
+			continue
+		}
+		secret, err := auther.DecodeSecret(entry.Secret)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		issuer, account := appLabel(entry)
+		t := freeOTPToken{
+			Algo:      entry.CodeAlgorithm(),
+			Digits:    entry.CodeDigits(),
+			IssuerExt: issuer,
+			IssuerInt: issuer,
+			Label:     account,
+			Period:    int(entry.CodePeriod()),
+			Secret:    make([]int8, len(secret)),
+			Type:      "TOTP",
+		}
+		for i, b := range secret {
+			t.Secret[i] = int8(b)
+		}
+		backup.Tokens = append(backup.Tokens, t)
+		backup.TokenOrder = append(backup.TokenOrder, strings.TrimPrefix(issuer+":"+account, ":"))
+	}
+	return writeIndentedJSON(w, backup)
+}
+
+func writeIndentedJSON(w io.Writer, v any) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
+
+// newUUID returns a random (version 4) UUID, which Aegis expects every
+// entry to have.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
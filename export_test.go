@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"authinator/pkg/auther"
+)
+
+// TestExportImportRoundTrip exports a vault in every format and imports the
+// export into an empty data file, which must end up with the same entries,
+// as far as the format can hold them.
+func TestExportImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.json")
+	store, err := auther.Open(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []TOTPEntry{
+		{Name: "GitHub - alice", Secret: testSecret, Issuer: "GitHub", Account: "alice", Tags: []string{"dev", "work"}, Aliases: []string{"gh"}, Pin: 1},
+		{Name: "Bank - bob", Secret: importSecret, Issuer: "Bank", Account: "bob", Algorithm: "SHA256", Digits: 8, Period: 60, Tags: []string{"money"}},
+		{Name: "Steam - carol", Secret: "GEZDGNBVGY3TQOJQ", Type: auther.TypeSteam, Issuer: "Steam", Account: "carol"},
+		{Name: "VPN - dave", Secret: "AAAQEAYEAUDAOCAJBIFQYDIOB4IBCEQT", Issuer: "VPN", Account: "dave", Algorithm: "SHA512", Period: 15, Aliases: []string{"vpn"}},
+	}
+	for _, e := range entries {
+		if err := store.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// What each format keeps besides the name, secret, issuer, account, type,
+	// digits, period and algorithm.
+	type kept struct{ tags, aliases, pin, steam bool }
+	tests := []struct {
+		format, importer string
+		kept             kept
+	}{
+		{"json", "json", kept{tags: true, aliases: true, pin: true, steam: true}},
+		{"uri", "uris", kept{steam: true}},
+		{"csv", "csv", kept{pin: true, steam: true}},
+		{"aegis", "aegis", kept{steam: true}},
+		{"andotp", "andotp", kept{steam: true}},
+		// FreeOTP+ can't generate Steam Guard codes.
+		{"freeotp", "freeotp", kept{}},
+	}
+	for _, tt := range tests {
+		out := filepath.Join(dir, "export."+tt.format)
+		if r := runCLI(t, dir, "", "--file", src, "export", "--format", tt.format, "--include-secrets", "--output", out); r.status != 0 {
+			t.Errorf("%s: export: %+v", tt.format, r)
+			continue
+		}
+		dst := filepath.Join(dir, tt.format+".json")
+		if r := runCLI(t, dir, "", "--file", dst, "import", tt.importer, out); r.status != 0 {
+			t.Errorf("%s: import: %+v", tt.format, r)
+			continue
+		}
+		imported, err := auther.Open(dst, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := entries
+		if !tt.kept.steam {
+			want = slices.DeleteFunc(slices.Clone(entries), TOTPEntry.IsSteam)
+		}
+		got := imported.List()
+		if len(got) != len(want) {
+			t.Errorf("%s: imported %d entries, want %d", tt.format, len(got), len(want))
+			continue
+		}
+		for i, want := range want {
+			e := got[i]
+			if err := e.LoadSecret(); err != nil {
+				t.Fatal(err)
+			}
+			e.CreatedAt = want.CreatedAt
+			if !tt.kept.tags {
+				e.Tags = want.Tags
+			}
+			if !tt.kept.aliases {
+				e.Aliases = want.Aliases
+			}
+			if !tt.kept.pin {
+				e.Pin = want.Pin
+			}
+			if !reflect.DeepEqual(e, want) {
+				t.Errorf("%s: entry %d:\ngot  %+v\nwant %+v", tt.format, i, e, want)
+			}
+		}
+	}
+}
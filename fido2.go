@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"authinator/pkg/auther"
+)
+
+// newFIDO2 returns what runs the libfido2 tools for the data file, using the
+// authenticator in AUTHER_FIDO2_DEVICE, if set, or else every one plugged in.
+func newFIDO2() *auther.FIDO2 {
+	return &auther.FIDO2{
+		Device: os.Getenv("AUTHER_FIDO2_DEVICE"),
+		Touch: func(device string) {
+			fmt.Fprintf(os.Stderr, "Touch your security key (%s)...\n", device)
+		},
+	}
+}
+
+// fido2Fallback is the auther.FileBackend FIDO2Fallback of the data file.
+func fido2Fallback(err error) {
+	slog.Warn(fmt.Sprintf("couldn't unlock with a security key: %v. Using the passphrase instead.", err))
+}
+
+// keySlotInfo is a key slot as key list --json prints it.
+type keySlotInfo struct {
+	Type         string `json:"type"`
+	Name         string `json:"name,omitempty"`
+	CredentialID string `json:"credential_id,omitempty"`
+}
+
+// keyCommand manages the FIDO2 authenticators that unlock the data file:
+// key list, key enroll [--name name] and key remove name.
+func keyCommand(args []string) {
+	const usage = "key list | key enroll [--name name] | key remove name"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: authinator key list")
+			os.Exit(2)
+		}
+		keyListCommand()
+	case "enroll":
+		keyEnrollCommand(args[1:])
+	case "remove":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: authinator key remove name")
+			os.Exit(2)
+		}
+		keyRemoveCommand(args[1])
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+}
+
+// keyListCommand prints the key slots of the data file, which are read from
+// its header without unlocking it.
+func keyListCommand() {
+	content, err := os.ReadFile(dataPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatal(err)
+	}
+	slots, err := auther.FileSlots(content)
+	if err != nil {
+		fatal(err)
+	}
+	if slots == nil && auther.IsEncrypted(content) {
+		slots = []auther.KeySlot{{Type: auther.SlotPassphrase}}
+	}
+
+	infos := []keySlotInfo{}
+	for _, slot := range slots {
+		info := keySlotInfo{Type: slot.Type, Name: slot.Name}
+		if slot.CredentialID != nil {
+			info.CredentialID = hex.EncodeToString(slot.CredentialID)
+		}
+		infos = append(infos, info)
+	}
+	if options.json {
+		printJSON(infos)
+		return
+	}
+	if len(infos) == 0 {
+		fmt.Println("The data file isn't encrypted with a passphrase, so no security keys can be enrolled.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tCREDENTIAL")
+	for _, info := range infos {
+		credential := info.CredentialID
+		if len(credential) > 16 {
+			credential = credential[:16] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", info.Type, info.Name, credential)
+	}
+	w.Flush()
+}
+
+// mustLoadSlottedKey loads the data file and returns it with its key,
+// exiting unless it is encrypted with a passphrase.
+func mustLoadSlottedKey() (TOTPData, *auther.Key) {
+	mustOpenBackend()
+	if dataFileBackend == nil {
+		fmt.Fprintf(os.Stderr, "The %s backend doesn't support encryption.\n", backendName())
+		os.Exit(1)
+	}
+	data := mustLoadData()
+	key := dataFileBackend.Key()
+	if key == nil {
+		if dataFileBackend.Encrypted() {
+			fmt.Fprintln(os.Stderr, "Security keys can only be enrolled for a data file encrypted with a passphrase, not with age or GnuPG.")
+		} else {
+			fmt.Fprintln(os.Stderr, "Encrypt the data file with a passphrase first (authinator encrypt); the passphrase stays as a fallback.")
+		}
+		os.Exit(1)
+	}
+	return data, key
+}
+
+// keyEnrollCommand enrolls the authenticator plugged in. The first one
+// enrolled replaces the key derived from the passphrase with a random one, so
+// the passphrase is needed even if the vault was opened another way.
+func keyEnrollCommand(args []string) {
+	const usage = "key enroll [--name name]"
+	fs := newFlagSet("key enroll", usage)
+	name := fs.String("name", "", "a name for the security key, such as yubikey-backup")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+
+	data, key := mustLoadSlottedKey()
+	var names []string
+	for _, slot := range key.Slots() {
+		if slot.Type == auther.SlotFIDO2 {
+			names = append(names, slot.Name)
+		}
+	}
+	if *name == "" {
+		*name = fmt.Sprintf("key-%d", len(names)+1)
+		for n := len(names) + 2; slices.Contains(names, *name); n++ {
+			*name = fmt.Sprintf("key-%d", n)
+		}
+	}
+	if slices.Contains(names, *name) {
+		fmt.Fprintf(os.Stderr, "A security key named %s is already enrolled.\n", *name)
+		os.Exit(1)
+	}
+
+	p := passphrase
+	if key.Slots() == nil && p == nil {
+		if p, err = readPassphrase("Passphrase: "); err != nil {
+			fatal(fmt.Errorf("reading passphrase: %w", err))
+		}
+	}
+	next, err := newFIDO2().Enroll(key, p, *name)
+	if errors.Is(err, auther.ErrWrongPassphrase) {
+		fmt.Fprintln(os.Stderr, "Wrong passphrase; nothing was changed.")
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	dataFileBackend.SetKey(next)
+	mustSaveData(data)
+	replaceAgentKey(key, next)
+	fmt.Printf("Enrolled %s. Touching it now unlocks the data file; the passphrase still works too.\n", *name)
+}
+
+// keyRemoveCommand removes the slot of an enrolled authenticator.
+func keyRemoveCommand(name string) {
+	data, key := mustLoadSlottedKey()
+	next, err := key.WithoutSlot(name)
+	if errors.Is(err, auther.ErrNoSlot) {
+		fmt.Fprintf(os.Stderr, "No security key named %s is enrolled (see authinator key list).\n", name)
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	dataFileBackend.SetKey(next)
+	mustSaveData(data)
+	// The previous version kept next to the data file still has the slot.
+	os.Remove(auther.BackupPath(dataPath))
+	fmt.Printf("Removed %s. Backups made before still open with it; run authinator passwd to change the key itself.\n", name)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// options holds the flags that apply to every command.
+var options struct {
+	file             string
+	backend          string
+	clipboardTimeout int
+	noClear          bool
+	noClipboard      bool
+	noGroup          bool
+	noColor          bool
+	json             bool
+	fixPermissions   bool
+	noNTP            bool
+	useNTPTime       bool
+	ntpServer        string
+	ageIdentities    stringList
+
+	remote            string
+	remoteCA          string
+	remoteFingerprint string
+	remoteInsecure    bool
+
+	verbose bool
+}
+
+var globalFlags = flag.NewFlagSet("authinator", flag.ContinueOnError)
+
+func init() {
+	globalFlags.StringVar(&options.file, "file", "", "path to the data file")
+	globalFlags.StringVar(&options.backend, "backend", "", "storage backend: json, sqlite or keyring")
+	globalFlags.IntVar(&options.clipboardTimeout, "clipboard-timeout", 30, "seconds before a copied code is cleared from the clipboard")
+	globalFlags.BoolVar(&options.noClear, "no-clear", false, "leave copied codes on the clipboard")
+	globalFlags.BoolVar(&options.noClipboard, "no-clipboard", false, "never copy codes to the clipboard")
+	globalFlags.BoolVar(&options.noGroup, "no-group", false, "print codes without grouping their digits")
+	globalFlags.BoolVar(&options.noColor, "no-color", false, "print without colors")
+	globalFlags.BoolVar(&options.json, "json", false, "print machine-readable JSON")
+	globalFlags.BoolVar(&options.fixPermissions, "fix-permissions", false, "restrict the data file to its owner")
+	globalFlags.BoolVar(&options.noNTP, "no-ntp", false, "don't compare the clock with an NTP server")
+	globalFlags.BoolVar(&options.useNTPTime, "use-ntp-time", false, "generate codes from the NTP server's time instead of the local clock")
+	globalFlags.StringVar(&options.ntpServer, "ntp-server", "", "NTP server to compare the clock with (default pool.ntp.org)")
+	globalFlags.Var(&options.ageIdentities, "age-identity", "age identity file or SSH private key to decrypt with (repeatable)")
+	globalFlags.StringVar(&options.remote, "remote", "", "use the authinator server at this URL instead of the local data file")
+	globalFlags.StringVar(&options.remoteCA, "remote-ca", "", "PEM file of certificate authorities trusted for --remote")
+	globalFlags.StringVar(&options.remoteFingerprint, "remote-fingerprint", "", "SHA-256 fingerprint the --remote server's certificate must have")
+	globalFlags.BoolVar(&options.remoteInsecure, "remote-insecure", false, "don't verify the --remote server's certificate")
+	globalFlags.BoolVar(&options.verbose, "verbose", false, "log debug messages to stderr")
+	globalFlags.BoolVar(&options.verbose, "v", false, "shorthand for --verbose")
+}
+
+// extractGlobalFlags removes global flags from args, wherever they appear,
+// and records their values in options. Everything after "--" is left alone.
+func extractGlobalFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := globalFlags.Lookup(name)
+		if !strings.HasPrefix(arg, "-") || f == nil {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && bf.IsBoolFlag() {
+				value = "true"
+			} else {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("flag needs an argument: %s", arg)
+				}
+				i++
+				value = args[i]
+			}
+		}
+
+		if err := globalFlags.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value %q for flag %s: %v", value, arg, err)
+		}
+	}
+	return rest, nil
+}
+
+// newFlagSet returns a flag set for a subcommand whose parse errors are
+// reported to the caller rather than exiting.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: authinator %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs, allowing flags and positional arguments to
+// be interleaved, and returns the positional arguments. Everything after "--"
+// is treated as positional.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// flagsGiven reports whether any of the named flags was set on the command
+// line.
+func flagsGiven(fs *flag.FlagSet, names ...string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			given = given || f.Name == name
+		}
+	})
+	return given
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
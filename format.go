@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// codeOutput is how [name] prints a code.
+type codeOutput struct {
+	quiet  bool               // only the code, without copying it
+	format *template.Template // a --format template, which implies quiet
+	copy   bool               // copy the code even when quiet
+}
+
+// parseFormat parses a --format template, which is executed with a
+// codeResult. \t and \n stand for a tab and a newline, as shells don't make
+// typing them easy. The template is tried on an empty result so that
+// mistakes such as unknown fields are reported before anything is printed.
+func parseFormat(format string) (*template.Template, error) {
+	format = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(format)
+	tmpl, err := template.New("--format").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, codeResult{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// mustParseFormat is parseFormat for a command's flags, exiting with a usage
+// error when the template is invalid.
+func mustParseFormat(format string) *template.Template {
+	tmpl, err := parseFormat(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --format template: %v\n", err)
+		os.Exit(2)
+	}
+	return tmpl
+}
+
+// printFormatted prints result with tmpl, followed by a newline.
+func printFormatted(tmpl *template.Template, result codeResult) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, result); err != nil {
+		fatal(fmt.Errorf("formatting output: %w", err))
+	}
+	fmt.Println(sb.String())
+}
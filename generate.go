@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/boombuler/barcode/qr"
+
+	"authinator/pkg/auther"
+)
+
+// generateCommand creates an entry with a new random secret, for apps that
+// use authinator as the server side of 2FA, and shows the URI and QR code to
+// enroll an authenticator with.
+func generateCommand(args []string) {
+	fs := newFlagSet("generate", "generate [name] [--issuer issuer] [--account account] [--bits n] [flags]")
+	flags := addEntryFlags(fs)
+	bits := fs.Int("bits", auther.DefaultSecretBits, fmt.Sprintf("size of the secret in bits (a multiple of 8 from %d to %d)", auther.MinSecretBits, auther.MaxSecretBits))
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator generate [name] [--issuer issuer] [--account account] [--bits n]")
+		os.Exit(2)
+	}
+	secret, err := auther.GenerateSecret(*bits)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	entry := TOTPEntry{Name: args[0], Secret: secret}
+	flags.apply(&entry)
+	if err := entry.Validate(); err != nil {
+		reportErrorf("Invalid entry: %v", err)
+		os.Exit(1)
+	}
+	switch err := mustOpenStore().Add(entry); {
+	case err == nil:
+		logAuditDetail("create", entry.Name, auditOK, "generated")
+	case errors.Is(err, auther.ErrExists):
+		logAudit("create", entry.Name, auditFailed)
+		reportErrorf("%s", conflictMessage(err, entry.Name))
+		os.Exit(1)
+	default:
+		fatal(err)
+	}
+
+	if options.json {
+		printJSON(map[string]any{"name": entry.Name, "secret": entry.Secret, "uri": entry.URI()})
+		return
+	}
+	fmt.Printf("Entry '%s' has been created with a new secret.\n\n", entry.Name)
+	fmt.Printf("Secret: %s\n", entry.Secret)
+	fmt.Printf("URI:    %s\n\n", entry.URI())
+	code, err := qr.Encode(entry.URI(), qr.M, qr.Auto)
+	if err != nil {
+		fatal(fmt.Errorf("encoding QR code: %w", err))
+	}
+	renderQR(os.Stdout, code)
+}
+
+// generateEntryHTTP handles POST /totps/generate, which is generate for the
+// API. The secret and URI are only ever in this response; afterwards the
+// entry is like any other.
+func generateEntryHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		TOTPEntry
+		Bits int `json:"bits"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	entry := body.TOTPEntry
+	noteAudit(r).entry = entry.Name
+	switch {
+	case entry.Name == "":
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	case entry.Secret != "":
+		writeJSONError(w, http.StatusBadRequest, "the secret is generated; leave it out")
+		return
+	}
+	if body.Bits == 0 {
+		body.Bits = auther.DefaultSecretBits
+	}
+
+	secret, err := auther.GenerateSecret(body.Bits)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entry.Secret = secret
+	if err := entry.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return
+	}
+	switch err := serverStore.Add(entry); {
+	case err == nil:
+	case errors.Is(err, auther.ErrExists):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		writeServerError(w, err)
+		return
+	}
+
+	notifyWebhooks(webhookCreated, webhookEntry(entry))
+	w.Header().Set("Location", entryURL(entry.Name))
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, struct {
+		entryView
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}{newEntryView(entry), entry.Secret, entry.URI()})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// getCommand prints the current code of each named entry on its own line.
+// Names that match no entry are reported and skipped, and make it exit with
+// exitNotFound once every code has been printed.
+func getCommand(args []string) {
+	fs := newFlagSet("get", "get [name...]")
+	names, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator get [name...]")
+		os.Exit(2)
+	}
+
+	var results []codeResult
+	if remoteAddress() != "" {
+		if results, err = mustRemote().BatchCodes(names); err != nil {
+			fatal(err)
+		}
+	} else {
+		data := mustLoadData()
+		results = batchCodes(data, names, clockNow())
+		var used []string
+		for _, result := range results {
+			if result.Error == "" {
+				used = append(used, result.Name)
+			}
+		}
+		markUsed(data, used...)
+	}
+
+	status := 0
+	for _, result := range results {
+		switch {
+		case result.Error == auther.ErrNotFound.Error():
+			status = exitNotFound
+		case result.Error != "" && status == 0:
+			status = exitCodeGen
+		}
+	}
+
+	if options.json {
+		printJSON(results)
+		os.Exit(status)
+	}
+	width := 0
+	for _, result := range results {
+		if result.Error == "" {
+			width = max(width, len(result.Name))
+		}
+	}
+	for _, result := range results {
+		switch {
+		case result.Error == auther.ErrNotFound.Error():
+			reportErrorf("No entry found with the name: %s", result.Name)
+		case result.Error != "":
+			reportErrorf("Error generating TOTP code for %s: %s", result.Name, result.Error)
+		default:
+			fmt.Printf("%s  %s  %ds\n", padRight(result.Name, width), displayCode(result.Code), result.ExpiresIn)
+		}
+	}
+	os.Exit(status)
+}
+
+// batchCodes generates the current code of each named entry, looked up by
+// name or alias without regard to case, in the order given. A name no entry
+// has gets a result with only the name and the ErrNotFound message as its
+// error.
+func batchCodes(data TOTPData, names []string, now time.Time) []codeResult {
+	results := make([]codeResult, 0, len(names))
+	for _, name := range names {
+		i, _ := data.Owner(name)
+		if i < 0 {
+			results = append(results, codeResult{Name: name, Error: auther.ErrNotFound.Error()})
+			continue
+		}
+		entry := data.Entries[i]
+		result := codeResult{Name: entry.Name}
+		if code, err := entry.Code(now); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Code, result.ExpiresIn = code, entry.ExpiresIn(now)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// batchCodesHTTP answers GET /totps?codes=true with the codes of the entries
+// in names, a comma-separated list that may be repeated, or of every entry
+// with the given tag. Like GET /totps/{name}, it counts as a use of each
+// entry unless peek=true is given.
+func batchCodesHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var names []string
+	for _, list := range query["names"] {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	noteAudit(r).detail = strings.Join(names, ", ")
+	// Entries the token may not use are reported as not found.
+	data := TOTPData{Entries: scopeEntries(r, serverStore.List())}
+	if len(names) == 0 {
+		for _, entry := range filterByTag(data.Entries, query.Get("tag")) {
+			names = append(names, entry.Name)
+		}
+	}
+	results := batchCodes(data, names, clockNow())
+
+	if query.Get("peek") != "true" && !serverReadOnly {
+		err := serverStore.Update(func(v *TOTPData) error {
+			for _, result := range results {
+				if result.Error == "" {
+					v.MarkUsed(result.Name, time.Now())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			writeServerError(w, fmt.Errorf("recording the use of entries: %w", err))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"authinator/pkg/auther"
+)
+
+// gpgNonInteractive makes gpg fail rather than ask for the passphrase of a
+// key gpg-agent hasn't unlocked. serve sets it, as nobody is there to answer.
+var gpgNonInteractive bool
+
+// newGPG returns what runs gpg for the data file and imported files: the
+// program in AUTHER_GPG, or else gpg or gpg2 on PATH. GPG_TTY is set to the
+// terminal, if it isn't set already, so gpg-agent can ask for a passphrase
+// there.
+func newGPG() *auther.GPG {
+	if os.Getenv("GPG_TTY") == "" && isTerminal(os.Stdin) {
+		if tty, err := os.Readlink("/proc/self/fd/0"); err == nil {
+			os.Setenv("GPG_TTY", tty)
+		}
+	}
+	return &auther.GPG{Program: os.Getenv("AUTHER_GPG"), NonInteractive: gpgNonInteractive}
+}
+
+// gpgRecipientsFlag registers --gpg-recipient, which encrypt uses to encrypt
+// with GnuPG.
+func gpgRecipientsFlag(fs *flag.FlagSet) *stringList {
+	var recipients stringList
+	fs.Var(&recipients, "gpg-recipient", "encrypt with GnuPG to this key ID, fingerprint or email address (repeatable)")
+	return &recipients
+}
+
+// mustCheckGPGRecipients checks that gpg can encrypt to recipients, exiting
+// with status 1 if it can't.
+func mustCheckGPGRecipients(recipients []string) {
+	if err := newGPG().CheckRecipients(recipients); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// dataGPGRecipients returns the GnuPG recipients the data file is encrypted
+// to, or nil if it isn't encrypted with GnuPG or hasn't been loaded.
+func dataGPGRecipients() []string {
+	if dataFileBackend == nil {
+		return nil
+	}
+	return dataFileBackend.GPGRecipients()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+)
+
+// serverStarted is when serve started, for the uptime health checks report.
+var serverStarted time.Time
+
+type healthStatus struct {
+	Status        string `json:"status"`
+	Entries       int    `json:"entries"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	Error         string `json:"error,omitempty"`
+}
+
+func currentHealth() healthStatus {
+	return healthStatus{
+		Status:        "ok",
+		Entries:       len(serverStore.List()),
+		UptimeSeconds: int64(math.Floor(time.Since(serverStarted).Seconds())),
+	}
+}
+
+// handleHealthz reports that the server is up. It doesn't touch the disk.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+	writeJSON(w, http.StatusOK, currentHealth())
+}
+
+// handleReadyz also reads the data file back, so a file that was corrupted,
+// removed or made unreadable behind the server's back fails the check.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, "GET, HEAD")
+		return
+	}
+	status := currentHealth()
+	if err := serverStore.Check(); err != nil {
+		status.Status = "unavailable"
+		status.Error = err.Error()
+		writeJSON(w, http.StatusServiceUnavailable, status)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+func importCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator import [format] [source] [flags]")
+		fmt.Fprintln(os.Stderr, "Formats: json, uris, google-migration, aegis, andotp, freeotp, 2fas, csv")
+		fmt.Fprintln(os.Stderr, "An encrypted bundle from export --encrypt can be imported without a format.")
+		os.Exit(2)
+	}
+
+	format, args := args[0], args[1:]
+	switch format {
+	case "json":
+		importJSON(args)
+	case "uris":
+		importURIs(args)
+	case "google-migration":
+		importGoogleMigration(args)
+	case "aegis":
+		importAegis(args)
+	case "andotp":
+		importAndOTP(args)
+	case "freeotp":
+		importFreeOTP(args)
+	case "2fas":
+		import2FAS(args)
+	case "csv":
+		importCSV(args)
+	default:
+		// A bundle written by export --encrypt or --age-recipient, or a
+		// backup, is an encrypted data file.
+		if content, err := os.ReadFile(format); err == nil && isEncryptedFile(content) {
+			importJSON(append([]string{format}, args...))
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Unknown import format: %s\n", format)
+		os.Exit(2)
+	}
+}
+
+// Strategies for imported entries whose name is already taken.
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+	conflictFail      = "fail"
+)
+
+// importFlags registers the flags shared by every importer.
+func importFlags(fs *flag.FlagSet) (onConflict *string, dryRun *bool) {
+	onConflict = fs.String("on-conflict", conflictSkip, "what to do when a name already exists: skip, overwrite, rename or fail")
+	dryRun = fs.Bool("dry-run", false, "show what the import would change without writing")
+	return onConflict, dryRun
+}
+
+// importBatch collects the entries read from an import source along with the
+// ones that had to be rejected, so every importer reports the same way.
+type importBatch struct {
+	entries  []TOTPEntry
+	rejected []importResult
+}
+
+type importResult struct {
+	name   string
+	result string
+}
+
+func (b *importBatch) add(entry TOTPEntry) {
+	if err := entry.Validate(); err != nil {
+		b.reject(entry.Name, err)
+		return
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	b.entries = append(b.entries, entry)
+}
+
+func (b *importBatch) reject(name string, err error) {
+	b.rejected = append(b.rejected, importResult{name, "skipped: " + err.Error()})
+}
+
+// mergeAction is what mergeEntries did with one imported entry.
+type mergeAction string
+
+const (
+	mergeAdded       mergeAction = "added"
+	mergeOverwritten mergeAction = "overwritten"
+	mergeRenamed     mergeAction = "renamed"
+	mergeSkipped     mergeAction = "skipped"
+	mergeConflict    mergeAction = "conflict"
+)
+
+// mergeResult records what happened to an imported entry called Name. Name
+// is taken by Existing, as its name or as an alias if Alias is set, unless
+// Action is mergeAdded; a renamed entry was added as NewName.
+type mergeResult struct {
+	Name     string
+	Action   mergeAction
+	Existing string
+	Alias    bool
+	NewName  string
+}
+
+// mergeEntries adds imported entries to data, resolving every name that is
+// already taken, by an entry's name or alias, according to onConflict:
+// conflictSkip leaves the existing entry alone, conflictOverwrite replaces it
+// but keeps its aliases (an alias is never overwritten, so its entry is
+// skipped), conflictRename
+// adds the imported entry with a numeric suffix and conflictFail adds
+// nothing at all if any name is taken. Imported aliases that are taken are
+// dropped, and imported pins follow the entries already pinned. Every
+// importer goes through it, so they all resolve conflicts the same way.
+func mergeEntries(data *TOTPData, entries []TOTPEntry, onConflict string) []mergeResult {
+	pinOffset := data.LastPin()
+	merged := cloneVault(*data)
+	results := make([]mergeResult, 0, len(entries))
+	failed := false
+	for _, entry := range entries {
+		if entry.Pinned() {
+			entry.Pin += pinOffset
+		}
+		result := mergeResult{Name: entry.Name}
+		i, isAlias := merged.Owner(entry.Name)
+		if i >= 0 {
+			result.Existing, result.Alias = merged.Entries[i].Name, isAlias
+		}
+		switch {
+		case i < 0:
+			result.Action = mergeAdded
+		case onConflict == conflictFail:
+			result.Action, failed = mergeConflict, true
+		case onConflict == conflictOverwrite && !isAlias:
+			result.Action = mergeOverwritten
+		case onConflict == conflictRename:
+			result.Action = mergeRenamed
+			entry.Name = uniqueName(merged, entry.Name)
+			result.NewName = entry.Name
+		default:
+			result.Action = mergeSkipped
+		}
+		results = append(results, result)
+
+		switch result.Action {
+		case mergeAdded, mergeRenamed:
+			entry.Aliases = freeAliases(merged, entry, -1)
+			merged.Entries = append(merged.Entries, entry)
+		case mergeOverwritten:
+			entry.Aliases = freeAliases(merged, entry, i)
+			for _, alias := range merged.Entries[i].Aliases {
+				if !entry.HasAlias(alias) && !auther.SameName(alias, entry.Name) {
+					entry.Aliases = append(entry.Aliases, alias)
+				}
+			}
+			merged.Entries[i] = entry
+		}
+	}
+	if !failed {
+		*data = merged
+	}
+	return results
+}
+
+// freeAliases returns the aliases of entry that aren't its own name or taken
+// by an entry of data other than the one at position self.
+func freeAliases(data TOTPData, entry TOTPEntry, self int) []string {
+	var aliases []string
+	for _, alias := range entry.Aliases {
+		j, _ := data.Owner(alias)
+		if (j < 0 || j == self) && !auther.SameName(alias, entry.Name) && !slices.ContainsFunc(aliases, func(a string) bool { return auther.SameName(a, alias) }) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// importEntries merges the batch into the data file with mergeEntries and
+// prints what happened to each entry, then a summary. With dryRun, or when
+// conflictFail finds a name taken, nothing is written.
+func importEntries(batch importBatch, onConflict string, dryRun bool) {
+	switch onConflict {
+	case conflictSkip, conflictOverwrite, conflictRename, conflictFail:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --on-conflict value %q (use skip, overwrite, rename or fail)\n", onConflict)
+		os.Exit(2)
+	}
+
+	data := mustLoadData()
+	merged := mergeEntries(&data, batch.entries, onConflict)
+
+	var results []importResult
+	counts := map[mergeAction]int{}
+	for _, m := range merged {
+		counts[m.Action]++
+		result := string(m.Action)
+		taken := "'" + m.Existing + "' exists"
+		if m.Alias {
+			taken = "alias of '" + m.Existing + "'"
+		}
+		switch m.Action {
+		case mergeOverwritten:
+			result = "conflict: overwrote '" + m.Existing + "'"
+		case mergeRenamed:
+			result = "conflict: added as '" + m.NewName + "'"
+		case mergeSkipped:
+			result = "conflict: skipped, " + taken
+		case mergeConflict:
+			result = "conflict: " + taken
+		}
+		results = append(results, importResult{m.Name, result})
+	}
+	results = append(results, batch.rejected...)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tRESULT")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\n", r.name, r.result)
+	}
+	tw.Flush()
+
+	if counts[mergeConflict] > 0 {
+		reportErrorf("Aborted: %d of the imported names are taken and --on-conflict is fail. Nothing was imported.", counts[mergeConflict])
+		os.Exit(1)
+	}
+	summary := fmt.Sprintf("%d added, %d renamed, %d overwritten, %d skipped as conflicts, %d rejected.",
+		counts[mergeAdded], counts[mergeRenamed], counts[mergeOverwritten], counts[mergeSkipped], len(batch.rejected))
+	if dryRun {
+		fmt.Println("Dry run, nothing written:", summary)
+		return
+	}
+	if counts[mergeAdded]+counts[mergeRenamed]+counts[mergeOverwritten] > 0 {
+		mustSaveData(data)
+	}
+	logAuditDetail("import", "", auditOK, summary)
+	fmt.Println(summary)
+}
+
+// uniqueName appends a numeric suffix to name until it no longer collides.
+func uniqueName(data TOTPData, name string) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if i, _ := data.Owner(candidate); i < 0 {
+			return candidate
+		}
+	}
+}
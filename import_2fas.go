@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// twoFASBackup is a .2fas export. Encrypted exports leave services empty and
+// put the ciphertext in servicesEncrypted instead.
+type twoFASBackup struct {
+	SchemaVersion     int             `json:"schemaVersion"`
+	Services          []twoFASService `json:"services"`
+	ServicesEncrypted string          `json:"servicesEncrypted"`
+}
+
+type twoFASService struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+	OTP    struct {
+		Label     string `json:"label"`
+		Account   string `json:"account"`
+		Issuer    string `json:"issuer"`
+		Digits    int    `json:"digits"`
+		Period    int    `json:"period"`
+		Algorithm string `json:"algorithm"`
+		TokenType string `json:"tokenType"`
+	} `json:"otp"`
+}
+
+func import2FAS(args []string) {
+	fs := newFlagSet("import 2fas", "import 2fas [file.2fas] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		reportErrorf("Error reading backup: %v", err)
+		os.Exit(1)
+	}
+
+	var backup twoFASBackup
+	if err := json.Unmarshal(content, &backup); err != nil {
+		reportErrorf("Error parsing 2FAS backup: %v", err)
+		os.Exit(1)
+	}
+	if backup.ServicesEncrypted != "" {
+		reportErrorf("Encrypted 2FAS backups are not supported yet. Export again from 2FAS without a password and import that file.")
+		os.Exit(1)
+	}
+
+	var batch importBatch
+	for _, service := range backup.Services {
+		entry, err := service.entry()
+		if err != nil {
+			batch.reject(entry.Name, err)
+			continue
+		}
+		batch.add(entry)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
+
+// entry converts the 2FAS service. The returned entry always carries a name
+// so rejections can be reported.
+func (s twoFASService) entry() (TOTPEntry, error) {
+	issuer := s.OTP.Issuer
+	if issuer == "" {
+		issuer = s.Name
+	}
+	account := s.OTP.Account
+	if account == "" {
+		account = s.OTP.Label
+	}
+
+	entry := TOTPEntry{
+		Name:    auther.DefaultName(issuer, account),
+		Secret:  s.Secret,
+		Issuer:  issuer,
+		Account: account,
+	}
+	if strings.EqualFold(s.OTP.TokenType, auther.TypeSteam) {
+		entry.Type = auther.TypeSteam
+		return entry, nil
+	}
+	if s.OTP.TokenType != "" && !strings.EqualFold(s.OTP.TokenType, "totp") {
+		return entry, fmt.Errorf("%s entries are not supported", strings.ToLower(s.OTP.TokenType))
+	}
+
+	if s.OTP.Digits != auther.DefaultDigits {
+		entry.Digits = s.OTP.Digits
+	}
+	if s.OTP.Period != auther.DefaultPeriod {
+		entry.Period = s.OTP.Period
+	}
+	if s.OTP.Algorithm != "" && !strings.EqualFold(s.OTP.Algorithm, auther.DefaultAlgorithm) {
+		entry.Algorithm = s.OTP.Algorithm
+	}
+	if err := entry.ValidateParams(); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
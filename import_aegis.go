@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+
+	"authinator/pkg/auther"
+)
+
+// aegisBackup is the top level of an Aegis vault export. For plain exports
+// db is a JSON object; for encrypted exports it is a base64 string that
+// decrypts to that object.
+type aegisBackup struct {
+	Version int `json:"version"`
+	Header  struct {
+		Slots  []aegisSlot   `json:"slots"`
+		Params *aegisKeyInfo `json:"params"`
+	} `json:"header"`
+	DB json.RawMessage `json:"db"`
+}
+
+type aegisDB struct {
+	Version int          `json:"version"`
+	Entries []aegisEntry `json:"entries"`
+}
+
+type aegisEntry struct {
+	Type     string  `json:"type"`
+	UUID     string  `json:"uuid"`
+	Name     string  `json:"name"`
+	Issuer   string  `json:"issuer"`
+	Note     string  `json:"note"`
+	Favorite bool    `json:"favorite"`
+	Icon     *string `json:"icon"`
+	Info     struct {
+		Secret string `json:"secret"`
+		Algo   string `json:"algo"`
+		Digits int    `json:"digits"`
+		Period int    `json:"period"`
+	} `json:"info"`
+}
+
+// aegisSlot holds the vault's master key encrypted with a key derived from
+// the backup password (type 1) or a biometric key (type 2).
+type aegisSlot struct {
+	Type      int          `json:"type"`
+	Key       string       `json:"key"`
+	KeyParams aegisKeyInfo `json:"key_params"`
+	N         int          `json:"n"`
+	R         int          `json:"r"`
+	P         int          `json:"p"`
+	Salt      string       `json:"salt"`
+}
+
+type aegisKeyInfo struct {
+	Nonce string `json:"nonce"`
+	Tag   string `json:"tag"`
+}
+
+const aegisPasswordSlot = 1
+
+// aegisKeySize is the length of the AES-256 keys Aegis derives with scrypt.
+const aegisKeySize = 32
+
+func importAegis(args []string) {
+	fs := newFlagSet("import aegis", "import aegis [backup.json] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		reportErrorf("Error reading backup: %v", err)
+		os.Exit(1)
+	}
+
+	var backup aegisBackup
+	if err := json.Unmarshal(content, &backup); err != nil {
+		reportErrorf("Error parsing Aegis backup: %v", err)
+		os.Exit(1)
+	}
+
+	db, err := backup.database()
+	if err != nil {
+		reportErrorf("Error reading Aegis backup: %v", err)
+		os.Exit(1)
+	}
+
+	var batch importBatch
+	for _, e := range db.Entries {
+		entry, err := e.entry()
+		if err != nil {
+			batch.reject(auther.DefaultName(e.Issuer, e.Name), err)
+			continue
+		}
+		batch.add(entry)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
+
+// database returns the decoded entry list, decrypting it first if the backup
+// is encrypted.
+func (b aegisBackup) database() (aegisDB, error) {
+	var db aegisDB
+
+	var encoded string
+	if err := json.Unmarshal(b.DB, &encoded); err != nil {
+		// Plain export: db is the object itself.
+		err := json.Unmarshal(b.DB, &db)
+		return db, err
+	}
+
+	if b.Header.Params == nil {
+		return db, errors.New("encrypted backup is missing its parameters")
+	}
+	password, err := readPassword("Aegis backup password: ")
+	if err != nil {
+		return db, err
+	}
+	masterKey, err := b.masterKey(password)
+	if err != nil {
+		return db, err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return db, err
+	}
+	plaintext, err := aegisOpen(masterKey, *b.Header.Params, ciphertext)
+	if err != nil {
+		return db, auther.ErrDecryptionFailed
+	}
+
+	err = json.Unmarshal(plaintext, &db)
+	return db, err
+}
+
+// masterKey tries each password slot until one decrypts the master key.
+func (b aegisBackup) masterKey(password []byte) ([]byte, error) {
+	for _, slot := range b.Header.Slots {
+		if slot.Type != aegisPasswordSlot {
+			continue
+		}
+
+		salt, err := hex.DecodeString(slot.Salt)
+		if err != nil {
+			return nil, err
+		}
+		key, err := scrypt.Key(password, salt, slot.N, slot.R, slot.P, aegisKeySize)
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey, err := hex.DecodeString(slot.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if masterKey, err := aegisOpen(key, slot.KeyParams, encryptedKey); err == nil {
+			return masterKey, nil
+		}
+	}
+	return nil, auther.ErrDecryptionFailed
+}
+
+// aegisOpen decrypts AES-GCM ciphertext whose nonce and tag are stored
+// separately as hex strings.
+func aegisOpen(key []byte, params aegisKeyInfo, ciphertext []byte) ([]byte, error) {
+	nonce, err := hex.DecodeString(params.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := hex.DecodeString(params.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, append(ciphertext, tag...), nil)
+}
+
+func (e aegisEntry) entry() (TOTPEntry, error) {
+	entry := TOTPEntry{
+		Name:    auther.DefaultName(e.Issuer, e.Name),
+		Secret:  e.Info.Secret,
+		Issuer:  e.Issuer,
+		Account: e.Name,
+	}
+	if strings.EqualFold(e.Type, auther.TypeSteam) {
+		entry.Type = auther.TypeSteam
+		return entry, nil
+	}
+	if !strings.EqualFold(e.Type, "totp") {
+		return TOTPEntry{}, fmt.Errorf("%s entries are not supported", e.Type)
+	}
+
+	if e.Info.Digits != auther.DefaultDigits {
+		entry.Digits = e.Info.Digits
+	}
+	if e.Info.Period != auther.DefaultPeriod {
+		entry.Period = e.Info.Period
+	}
+	if e.Info.Algo != "" && !strings.EqualFold(e.Info.Algo, auther.DefaultAlgorithm) {
+		entry.Algorithm = e.Info.Algo
+	}
+	if err := entry.ValidateParams(); err != nil {
+		return TOTPEntry{}, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// andOTPEntry is one element of the array in an unencrypted andOTP backup.
+type andOTPEntry struct {
+	Secret        string   `json:"secret"`
+	Issuer        string   `json:"issuer"`
+	Label         string   `json:"label"`
+	Digits        int      `json:"digits"`
+	Type          string   `json:"type"`
+	Algorithm     string   `json:"algorithm"`
+	Thumbnail     string   `json:"thumbnail"`
+	LastUsed      int64    `json:"last_used"`
+	UsedFrequency int      `json:"used_frequency"`
+	Period        int      `json:"period"`
+	Tags          []string `json:"tags"`
+}
+
+func importAndOTP(args []string) {
+	fs := newFlagSet("import andotp", "import andotp [backup.json] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		reportErrorf("Error reading backup: %v", err)
+		os.Exit(1)
+	}
+
+	var backup []andOTPEntry
+	if err := json.Unmarshal(content, &backup); err != nil {
+		reportErrorf("Error parsing andOTP backup (encrypted backups are not supported): %v", err)
+		os.Exit(1)
+	}
+
+	var batch importBatch
+	for _, e := range backup {
+		entry, err := e.entry()
+		if err != nil {
+			batch.reject(entry.Name, err)
+			continue
+		}
+		batch.add(entry)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
+
+// entry converts the andOTP record. The returned entry always carries a name
+// so rejections can be reported.
+func (e andOTPEntry) entry() (TOTPEntry, error) {
+	// Older andOTP versions had no issuer field and stored "Issuer - account"
+	// or "Issuer:account" in the label.
+	account := e.Label
+	if e.Issuer != "" {
+		account = strings.TrimSpace(strings.TrimPrefix(account, e.Issuer+":"))
+	}
+
+	entry := TOTPEntry{
+		Name:    auther.DefaultName(e.Issuer, account),
+		Secret:  e.Secret,
+		Issuer:  e.Issuer,
+		Account: account,
+	}
+	if strings.EqualFold(e.Type, auther.TypeSteam) {
+		entry.Type = auther.TypeSteam
+		return entry, nil
+	}
+	if !strings.EqualFold(e.Type, "totp") {
+		return entry, fmt.Errorf("%s entries are not supported", strings.ToLower(e.Type))
+	}
+
+	if e.Digits != auther.DefaultDigits {
+		entry.Digits = e.Digits
+	}
+	if e.Period != auther.DefaultPeriod {
+		entry.Period = e.Period
+	}
+	if e.Algorithm != "" && !strings.EqualFold(e.Algorithm, auther.DefaultAlgorithm) {
+		entry.Algorithm = e.Algorithm
+	}
+	if err := entry.ValidateParams(); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
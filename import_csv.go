@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// csvColumns lists the columns understood by the CSV importer and written by
+// the CSV exporter, in export order. pin is empty for entries that aren't
+// pinned, and type for entries that aren't Steam Guard ones.
+var csvColumns = []string{"name", "secret", "issuer", "account", "digits", "period", "algorithm", "pin", "type"}
+
+func importCSV(args []string) {
+	fs := newFlagSet("import csv", "import csv [file.csv] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	strict := fs.Bool("strict", false, "abort without importing anything if any row is invalid")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		reportErrorf("Error reading CSV file: %v", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	batch, err := readCSV(file)
+	if err != nil {
+		reportErrorf("Error reading CSV file: %v", err)
+		os.Exit(1)
+	}
+	if *strict && len(batch.rejected) > 0 {
+		for _, r := range batch.rejected {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", r.name, r.result)
+		}
+		reportErrorf("Aborted: --strict was given and some rows are invalid. Nothing was imported.")
+		os.Exit(1)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
+
+// readCSV reads entries from CSV with a header row. Invalid rows are
+// rejected with their line number rather than failing the whole file.
+func readCSV(r io.Reader) (importBatch, error) {
+	var batch importBatch
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return batch, fmt.Errorf("reading header row: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return batch, errors.New("header row has no name column")
+	}
+	if _, ok := columns["secret"]; !ok {
+		return batch, errors.New("header row has no secret column")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return batch, nil
+		}
+		if err != nil {
+			return batch, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := TOTPEntry{
+			Name:      field("name"),
+			Secret:    field("secret"),
+			Issuer:    field("issuer"),
+			Account:   field("account"),
+			Algorithm: field("algorithm"),
+			Type:      strings.ToLower(field("type")),
+		}
+		digits, period := field("digits"), field("period")
+		// The export lists the digits, period and algorithm of Steam Guard
+		// codes too, which are fixed for the type.
+		if entry.Type == auther.TypeSteam {
+			digits, period, entry.Algorithm = "", "", ""
+		}
+		label := fmt.Sprintf("line %d", line)
+		if entry.Name != "" {
+			label += " (" + entry.Name + ")"
+		}
+
+		if err := parseCSVRow(&entry, digits, period, field("pin")); err != nil {
+			batch.reject(label, err)
+			continue
+		}
+		batch.add(entry)
+	}
+}
+
+func parseCSVRow(entry *TOTPEntry, digits, period, pin string) error {
+	if entry.Name == "" {
+		return errors.New("missing name")
+	}
+	var err error
+	if digits != "" {
+		if entry.Digits, err = strconv.Atoi(digits); err != nil {
+			return fmt.Errorf("invalid digits %q", digits)
+		}
+	}
+	if period != "" {
+		if entry.Period, err = strconv.Atoi(period); err != nil {
+			return fmt.Errorf("invalid period %q", period)
+		}
+	}
+	if pin != "" {
+		if entry.Pin, err = strconv.Atoi(pin); err != nil || entry.Pin < 0 {
+			return fmt.Errorf("invalid pin %q", pin)
+		}
+	}
+	if entry.Digits == auther.DefaultDigits {
+		entry.Digits = 0
+	}
+	if entry.Period == auther.DefaultPeriod {
+		entry.Period = 0
+	}
+	if strings.EqualFold(entry.Algorithm, auther.DefaultAlgorithm) {
+		entry.Algorithm = ""
+	}
+	return entry.Validate()
+}
+
+// writeCSV writes entries with a header row. With secrets false the secret
+// column is left out entirely, producing a sharable inventory.
+func writeCSV(w io.Writer, entries []TOTPEntry, secrets bool) error {
+	writer := csv.NewWriter(w)
+
+	var header []string
+	for _, column := range csvColumns {
+		if column != "secret" || secrets {
+			header = append(header, column)
+		}
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		pin := ""
+		if e.Pinned() {
+			pin = strconv.Itoa(e.Pin)
+		}
+		record := []string{e.Name}
+		if secrets {
+			record = append(record, e.Secret)
+		}
+		record = append(record,
+			e.Issuer,
+			e.Account,
+			strconv.Itoa(e.CodeDigits()),
+			strconv.FormatInt(e.CodePeriod(), 10),
+			e.CodeAlgorithm(),
+			pin,
+			e.Type,
+		)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
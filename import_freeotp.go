@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// freeOTPBackup is a FreeOTP+ JSON backup. Secrets are arrays of signed
+// bytes, as Java serializes them.
+type freeOTPBackup struct {
+	Tokens     []freeOTPToken `json:"tokens"`
+	TokenOrder []string       `json:"tokenOrder"`
+}
+
+type freeOTPToken struct {
+	Algo      string `json:"algo"`
+	Counter   int    `json:"counter"`
+	Digits    int    `json:"digits"`
+	IssuerExt string `json:"issuerExt"`
+	IssuerInt string `json:"issuerInt"`
+	Label     string `json:"label"`
+	Period    int    `json:"period"`
+	Secret    []int8 `json:"secret"`
+	Type      string `json:"type"`
+}
+
+func importFreeOTP(args []string) {
+	fs := newFlagSet("import freeotp", "import freeotp [backup.json] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		reportErrorf("Error reading backup: %v", err)
+		os.Exit(1)
+	}
+
+	var backup freeOTPBackup
+	if err := json.Unmarshal(content, &backup); err != nil {
+		reportErrorf("Error parsing FreeOTP+ backup (only the JSON export of FreeOTP+ is supported): %v", err)
+		os.Exit(1)
+	}
+
+	var batch importBatch
+	for _, t := range backup.Tokens {
+		entry, err := t.entry()
+		if err != nil {
+			batch.reject(entry.Name, err)
+			continue
+		}
+		batch.add(entry)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
+
+// entry converts the FreeOTP+ token. The returned entry always carries a name
+// so rejections can be reported.
+func (t freeOTPToken) entry() (TOTPEntry, error) {
+	issuer := t.IssuerExt
+	if issuer == "" {
+		issuer = t.IssuerInt
+	}
+	secret := make([]byte, len(t.Secret))
+	for i, b := range t.Secret {
+		secret[i] = byte(b)
+	}
+
+	entry := TOTPEntry{
+		Name:    auther.DefaultName(issuer, t.Label),
+		Secret:  base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret),
+		Issuer:  issuer,
+		Account: t.Label,
+	}
+	if !strings.EqualFold(t.Type, "totp") {
+		return entry, fmt.Errorf("%s entries are not supported", strings.ToLower(t.Type))
+	}
+	if t.Digits != auther.DefaultDigits {
+		entry.Digits = t.Digits
+	}
+	if t.Period != auther.DefaultPeriod {
+		entry.Period = t.Period
+	}
+	if t.Algo != "" && !strings.EqualFold(t.Algo, auther.DefaultAlgorithm) {
+		entry.Algorithm = strings.ToUpper(t.Algo)
+	}
+	if err := entry.ValidateParams(); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// Google Authenticator's "Export accounts" QR codes carry an
+// otpauth-migration://offline?data=... URI whose data parameter is a base64
+// encoded MigrationPayload:
+//
+//	message MigrationPayload {
+//	  enum Algorithm { ALGORITHM_UNSPECIFIED = 0; SHA1 = 1; SHA256 = 2; SHA512 = 3; MD5 = 4; }
+//	  enum DigitCount { DIGIT_COUNT_UNSPECIFIED = 0; SIX = 1; EIGHT = 2; }
+//	  enum OtpType { OTP_TYPE_UNSPECIFIED = 0; HOTP = 1; TOTP = 2; }
+//
+//	  message OtpParameters {
+//	    bytes secret = 1;
+//	    string name = 2;
+//	    string issuer = 3;
+//	    Algorithm algorithm = 4;
+//	    DigitCount digits = 5;
+//	    OtpType type = 6;
+//	    int64 counter = 7;
+//	  }
+//
+//	  repeated OtpParameters otp_parameters = 1;
+//	  int32 version = 2;
+//	  int32 batch_size = 3;
+//	  int32 batch_index = 4;
+//	  int32 batch_id = 5;
+//	}
+//
+// The payload is small and fixed, so it is decoded by hand rather than
+// pulling in a protobuf runtime.
+
+type migrationOTP struct {
+	secret    []byte
+	name      string
+	issuer    string
+	algorithm uint64
+	digits    uint64
+	otpType   uint64
+}
+
+const (
+	migrationTypeHOTP = 1
+	migrationTypeTOTP = 2
+)
+
+var migrationAlgorithms = map[uint64]string{1: "SHA1", 2: "SHA256", 3: "SHA512"}
+
+func importGoogleMigration(args []string) {
+	fs := newFlagSet("import google-migration", `import google-migration "otpauth-migration://offline?data=..." [flags]`)
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	accounts, err := parseMigrationURI(args[0])
+	if err != nil {
+		reportErrorf("Invalid migration URI: %v", err)
+		os.Exit(1)
+	}
+
+	var batch importBatch
+	for _, account := range accounts {
+		entry, err := account.entry()
+		if err != nil {
+			batch.reject(auther.DefaultName(account.issuer, account.name), err)
+			continue
+		}
+		batch.add(entry)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
+
+func parseMigrationURI(raw string) ([]migrationOTP, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Scheme, "otpauth-migration") {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	// Query decoding turns unescaped '+' into spaces; undo that before
+	// base64 decoding.
+	encoded := strings.ReplaceAll(u.Query().Get("data"), " ", "+")
+	if encoded == "" {
+		return nil, errors.New("missing data parameter")
+	}
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return nil, fmt.Errorf("invalid base64 data: %v", err)
+		}
+	}
+
+	return decodeMigrationPayload(payload)
+}
+
+func decodeMigrationPayload(payload []byte) ([]migrationOTP, error) {
+	var accounts []migrationOTP
+	r := protoReader{buf: payload}
+	for !r.done() {
+		field, wireType, err := r.key()
+		if err != nil {
+			return nil, err
+		}
+		if field != 1 || wireType != wireBytes {
+			if err := r.skip(wireType); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		msg, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		account, err := decodeMigrationOTP(msg)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func decodeMigrationOTP(msg []byte) (migrationOTP, error) {
+	var account migrationOTP
+	r := protoReader{buf: msg}
+	for !r.done() {
+		field, wireType, err := r.key()
+		if err != nil {
+			return account, err
+		}
+
+		switch {
+		case field <= 3 && wireType == wireBytes:
+			b, err := r.bytes()
+			if err != nil {
+				return account, err
+			}
+			switch field {
+			case 1:
+				account.secret = b
+			case 2:
+				account.name = string(b)
+			case 3:
+				account.issuer = string(b)
+			}
+		case field >= 4 && field <= 6 && wireType == wireVarint:
+			v, err := r.varint()
+			if err != nil {
+				return account, err
+			}
+			switch field {
+			case 4:
+				account.algorithm = v
+			case 5:
+				account.digits = v
+			case 6:
+				account.otpType = v
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return account, err
+			}
+		}
+	}
+	return account, nil
+}
+
+func (m migrationOTP) entry() (TOTPEntry, error) {
+	if m.otpType == migrationTypeHOTP {
+		return TOTPEntry{}, errors.New("HOTP entries are not supported")
+	}
+	if len(m.secret) == 0 {
+		return TOTPEntry{}, errors.New("missing secret")
+	}
+
+	// Google Authenticator stores names as "Issuer:account" when the
+	// account was added from a URI with an issuer prefix.
+	account := m.name
+	if m.issuer != "" {
+		account = strings.TrimSpace(strings.TrimPrefix(account, m.issuer+":"))
+	}
+
+	entry := TOTPEntry{
+		Name:    auther.DefaultName(m.issuer, account),
+		Secret:  base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(m.secret),
+		Issuer:  m.issuer,
+		Account: account,
+	}
+	if m.algorithm != 0 {
+		algorithm, ok := migrationAlgorithms[m.algorithm]
+		if !ok {
+			return TOTPEntry{}, errors.New("unsupported algorithm")
+		}
+		if algorithm != auther.DefaultAlgorithm {
+			entry.Algorithm = algorithm
+		}
+	}
+	if m.digits == 2 {
+		entry.Digits = 8
+	}
+	return entry, nil
+}
+
+// Protobuf wire types used by the migration payload.
+const (
+	wireVarint  = 0
+	wire64Bit   = 1
+	wireBytes   = 2
+	wire32Bit   = 5
+	maxVarintSz = 10
+)
+
+var errTruncated = errors.New("truncated protobuf payload")
+
+// protoReader decodes the subset of the protobuf wire format needed for
+// migration payloads.
+type protoReader struct {
+	buf []byte
+}
+
+func (r *protoReader) done() bool {
+	return len(r.buf) == 0
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	var v uint64
+	for i := 0; i < maxVarintSz && i < len(r.buf); i++ {
+		b := r.buf[i]
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			r.buf = r.buf[i+1:]
+			return v, nil
+		}
+	}
+	return 0, errTruncated
+}
+
+func (r *protoReader) key() (field int, wireType int, err error) {
+	v, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.buf)) {
+		return nil, errTruncated
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *protoReader) skip(wireType int) error {
+	var n int
+	switch wireType {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wire64Bit:
+		n = 8
+	case wire32Bit:
+		n = 4
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+	}
+	if n > len(r.buf) {
+		return errTruncated
+	}
+	r.buf = r.buf[n:]
+	return nil
+}
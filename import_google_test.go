@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/google-migration.txt is an export of three accounts: a TOTP one
+// named "Example:alice@google.com" with the issuer Example, a TOTP one with
+// SHA256 and eight digits and no issuer, and an HOTP one.
+func TestGoogleMigrationFixture(t *testing.T) {
+	data, err := os.ReadFile("testdata/google-migration.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := parseMigrationURI(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 3 {
+		t.Fatalf("got %d accounts, want 3", len(accounts))
+	}
+
+	tests := []struct {
+		want TOTPEntry
+		err  string
+	}{
+		{want: TOTPEntry{Name: "Example - alice@google.com", Secret: "JBSWY3DPEHPK3PXP", Issuer: "Example", Account: "alice@google.com"}},
+		{want: TOTPEntry{Name: "bob@example.com", Secret: "AAAQEAYEAUDAOCAJBIFQYDIOB4IBCEQT", Account: "bob@example.com", Algorithm: "SHA256", Digits: 8}},
+		{err: "HOTP entries are not supported"},
+	}
+	for i, tt := range tests {
+		got, err := accounts[i].entry()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("account %d: error %v, want %q", i, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("account %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("account %d:\ngot  %+v\nwant %+v", i, got, tt.want)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("account %d: %v", i, err)
+		}
+	}
+}
+
+func TestParseMigrationURIErrors(t *testing.T) {
+	tests := []struct {
+		uri, err string
+	}{
+		{"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP", "unsupported scheme"},
+		{"otpauth-migration://offline", "missing data parameter"},
+		{"otpauth-migration://offline?data=!!!!", "invalid base64"},
+		// A field 1 message that claims more bytes than there are.
+		{"otpauth-migration://offline?data=CjUKCkhl", "truncated"},
+	}
+	for _, tt := range tests {
+		_, err := parseMigrationURI(tt.uri)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want one containing %q", tt.uri, err, tt.err)
+		}
+	}
+}
+
+// Query decoding turns an unescaped "+" of the base64 data into a space.
+func TestParseMigrationURIUnescapedPlus(t *testing.T) {
+	// One account whose secret encodes to base64 with a "+" in it.
+	uri := "otpauth-migration://offline?data=Cg0KAgA+EgFhIAEoATAC"
+	accounts, err := parseMigrationURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || string(accounts[0].secret) != "\x00\x3e" || accounts[0].name != "a" {
+		t.Errorf("got %+v", accounts)
+	}
+}
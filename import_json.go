@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"authinator/pkg/auther"
+)
+
+// importJSON imports the entries of another authinator data file, such as
+// one written by export --json, export --encrypt or backup, encrypted or
+// not. Timestamps, tags, aliases, notes and recovery codes come along; the
+// trash doesn't.
+func importJSON(args []string) {
+	fs := newFlagSet("import json", "import json [file.json] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		reportErrorf("Error reading data file: %v", err)
+		os.Exit(1)
+	}
+	data, err := decodeDataFile(args[0], content, func() ([]byte, error) { return readPassphrase("Passphrase of the imported file: ") })
+	switch {
+	case errors.Is(err, auther.ErrWrongPassphrase):
+		reportErrorf("Wrong passphrase for %s.", args[0])
+		os.Exit(1)
+	case errors.Is(err, auther.ErrNoAgeIdentity), errors.Is(err, auther.ErrGPGNoSecretKey), errors.Is(err, auther.ErrGPGKeyLocked), errors.Is(err, auther.ErrGPGMissing):
+		reportErrorf("Can't decrypt %s: %v", args[0], err)
+		os.Exit(1)
+	case errors.Is(err, auther.ErrCorrupted):
+		reportErrorf("%s is corrupted or incomplete, so it can't be decrypted with any passphrase.", args[0])
+		os.Exit(1)
+	case err != nil:
+		reportErrorf("Error reading data file: %v", err)
+		os.Exit(1)
+	}
+
+	var batch importBatch
+	for _, entry := range data.Entries {
+		batch.add(entry)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
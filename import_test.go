@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"authinator/pkg/auther"
+)
+
+// importSecret is the secret of imported entries, to tell them from the
+// entries already there.
+const importSecret = "KRSXG5CTMVRXEZLU"
+
+func TestMergeEntries(t *testing.T) {
+	existing := func() TOTPData {
+		return TOTPData{Version: auther.SchemaVersion, Entries: []TOTPEntry{
+			{Name: "github", Secret: testSecret, Aliases: []string{"gh"}},
+			{Name: "bank", Secret: testSecret, Pin: 1},
+		}}
+	}
+	imported := func(name string, aliases ...string) TOTPEntry {
+		return TOTPEntry{Name: name, Secret: importSecret, Aliases: aliases}
+	}
+
+	tests := []struct {
+		name       string
+		onConflict string
+		entries    []TOTPEntry
+		results    []mergeResult
+		// data lists the entries afterwards as "name secret aliases pin".
+		data []string
+	}{
+		{
+			name:       "skip",
+			onConflict: conflictSkip,
+			entries:    []TOTPEntry{imported("GitHub"), imported("gh"), imported("new")},
+			results: []mergeResult{
+				{Name: "GitHub", Action: mergeSkipped, Existing: "github"},
+				{Name: "gh", Action: mergeSkipped, Existing: "github", Alias: true},
+				{Name: "new", Action: mergeAdded},
+			},
+			data: []string{"github old [gh] 0", "bank old [] 1", "new new [] 0"},
+		},
+		{
+			name:       "overwrite keeps aliases and never overwrites one",
+			onConflict: conflictOverwrite,
+			entries:    []TOTPEntry{imported("github", "hub"), imported("gh"), imported("new")},
+			results: []mergeResult{
+				{Name: "github", Action: mergeOverwritten, Existing: "github"},
+				{Name: "gh", Action: mergeSkipped, Existing: "github", Alias: true},
+				{Name: "new", Action: mergeAdded},
+			},
+			data: []string{"github new [hub gh] 0", "bank old [] 1", "new new [] 0"},
+		},
+		{
+			name:       "rename",
+			onConflict: conflictRename,
+			entries:    []TOTPEntry{imported("github"), imported("github"), imported("gh"), imported("new")},
+			results: []mergeResult{
+				{Name: "github", Action: mergeRenamed, Existing: "github", NewName: "github (2)"},
+				{Name: "github", Action: mergeRenamed, Existing: "github", NewName: "github (3)"},
+				{Name: "gh", Action: mergeRenamed, Existing: "github", Alias: true, NewName: "gh (2)"},
+				{Name: "new", Action: mergeAdded},
+			},
+			data: []string{"github old [gh] 0", "bank old [] 1", "github (2) new [] 0", "github (3) new [] 0", "gh (2) new [] 0", "new new [] 0"},
+		},
+		{
+			name:       "fail adds nothing",
+			onConflict: conflictFail,
+			entries:    []TOTPEntry{imported("new"), imported("bank"), imported("other")},
+			results: []mergeResult{
+				{Name: "new", Action: mergeAdded},
+				{Name: "bank", Action: mergeConflict, Existing: "bank"},
+				{Name: "other", Action: mergeAdded},
+			},
+			data: []string{"github old [gh] 0", "bank old [] 1"},
+		},
+		{
+			name:       "fail without conflicts",
+			onConflict: conflictFail,
+			entries:    []TOTPEntry{imported("new")},
+			results:    []mergeResult{{Name: "new", Action: mergeAdded}},
+			data:       []string{"github old [gh] 0", "bank old [] 1", "new new [] 0"},
+		},
+		{
+			name:       "taken aliases are dropped",
+			onConflict: conflictSkip,
+			entries:    []TOTPEntry{imported("new", "gh", "BANK", "nw", "NW", "new"), imported("next", "nw", "nx")},
+			results:    []mergeResult{{Name: "new", Action: mergeAdded}, {Name: "next", Action: mergeAdded}},
+			data:       []string{"github old [gh] 0", "bank old [] 1", "new new [nw] 0", "next new [nx] 0"},
+		},
+		{
+			name:       "pins follow the pinned entries",
+			onConflict: conflictSkip,
+			entries:    []TOTPEntry{{Name: "second", Secret: importSecret, Pin: 2}, {Name: "first", Secret: importSecret, Pin: 1}},
+			results:    []mergeResult{{Name: "second", Action: mergeAdded}, {Name: "first", Action: mergeAdded}},
+			data:       []string{"github old [gh] 0", "bank old [] 1", "second new [] 3", "first new [] 2"},
+		},
+	}
+	for _, tt := range tests {
+		data := existing()
+		results := mergeEntries(&data, tt.entries, tt.onConflict)
+		if !reflect.DeepEqual(results, tt.results) {
+			t.Errorf("%s: results\n%+v\nwant\n%+v", tt.name, results, tt.results)
+		}
+		if got := describeEntries(data.Entries); !reflect.DeepEqual(got, tt.data) {
+			t.Errorf("%s: entries\n%q\nwant\n%q", tt.name, got, tt.data)
+		}
+		if data.Version != auther.SchemaVersion {
+			t.Errorf("%s: version %d after merging, want %d", tt.name, data.Version, auther.SchemaVersion)
+		}
+	}
+}
+
+// describeEntries sums up entries as "name secret aliases pin", with the
+// secret "old" or "new".
+func describeEntries(entries []TOTPEntry) []string {
+	var described []string
+	for _, e := range entries {
+		secret := "old"
+		if e.Secret == importSecret {
+			secret = "new"
+		}
+		aliases := e.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+		described = append(described, fmt.Sprintf("%s %s %v %d", e.Name, secret, aliases, e.Pin))
+	}
+	return described
+}
+
+// TestImportEntries runs imports against a data file: a dry run writes
+// nothing, and an overwrite leaves an automatic snapshot of the entries as
+// they were.
+func TestImportEntries(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AUTHER_NO_NTP", "1")
+	t.Setenv("AUTHER_BACKEND", "")
+	oldPath, oldBackend, oldStdout := dataPath, dataBackend, os.Stdout
+	t.Cleanup(func() { dataPath, dataBackend, os.Stdout = oldPath, oldBackend, oldStdout })
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+
+	dataPath = filepath.Join(dir, "data.json")
+	dataBackend = nil
+	mustSaveData(TOTPData{Version: auther.SchemaVersion, Entries: []TOTPEntry{{Name: "github", Secret: testSecret}}})
+	snapshots := func() []string {
+		names, _ := filepath.Glob(filepath.Join(dir, "auther", "backups", snapshotPrefix+"*"))
+		return names
+	}
+	batch := importBatch{entries: []TOTPEntry{{Name: "github", Secret: importSecret}, {Name: "new", Secret: importSecret}}}
+
+	before, _ := os.ReadFile(dataPath)
+	importEntries(batch, conflictOverwrite, true)
+	if after, _ := os.ReadFile(dataPath); string(after) != string(before) {
+		t.Error("a dry run changed the data file")
+	}
+	if len(snapshots()) != 0 {
+		t.Errorf("a dry run took snapshots: %v", snapshots())
+	}
+
+	importEntries(batch, conflictOverwrite, false)
+	if got := describeEntries(mustLoadData().Entries); strings.Join(got, ", ") != "github new [] 0, new new [] 0" {
+		t.Errorf("after the import: %q", got)
+	}
+	list := snapshots()
+	if len(list) != 1 {
+		t.Fatalf("snapshots after overwriting: %v", list)
+	}
+	content, err := os.ReadFile(list[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), testSecret) || strings.Contains(string(content), importSecret) {
+		t.Errorf("the snapshot isn't of the entries before the import: %s", content)
+	}
+}
+
+// testdata/andotp.json is an unencrypted andOTP backup with a plain TOTP
+// record, one with SHA256, eight digits and a 60 second period, a Steam one,
+// an HOTP one with a counter and a TOTP one with an algorithm authinator
+// doesn't know.
+func TestAndOTPFixture(t *testing.T) {
+	data, err := os.ReadFile("testdata/andotp.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backup []andOTPEntry
+	if err := json.Unmarshal(data, &backup); err != nil {
+		t.Fatal(err)
+	}
+	if len(backup) != 5 {
+		t.Fatalf("got %d records, want 5", len(backup))
+	}
+
+	tests := []struct {
+		want TOTPEntry
+		err  string
+	}{
+		{want: TOTPEntry{Name: "Example - alice@example.com", Secret: "JBSWY3DPEHPK3PXP", Issuer: "Example", Account: "alice@example.com"}},
+		{want: TOTPEntry{Name: "Bank - bob", Secret: "AAAQEAYEAUDAOCAJBIFQYDIOB4IBCEQT", Issuer: "Bank", Account: "bob", Algorithm: "SHA256", Digits: 8, Period: 60}},
+		{want: TOTPEntry{Name: "Steam - carol", Secret: "KRSXG5CTMVRXEZLU", Type: auther.TypeSteam, Issuer: "Steam", Account: "carol"}},
+		// HOTP entries have no counter to keep here, so they are skipped.
+		{want: TOTPEntry{Name: "Legacy - dave"}, err: "hotp entries are not supported"},
+		{want: TOTPEntry{Name: "Weird - erin"}, err: "MD5"},
+	}
+	for i, tt := range tests {
+		got, err := backup[i].entry()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("record %d: error %v, want %q", i, err, tt.err)
+			}
+			if got.Name != tt.want.Name {
+				t.Errorf("record %d: rejected as %q, want %q", i, got.Name, tt.want.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("record %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("record %d:\ngot  %+v\nwant %+v", i, got, tt.want)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("record %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// importURIs imports a list of otpauth:// URIs, one per line, as written by
+// export. Blank lines and lines starting with # are ignored.
+func importURIs(args []string) {
+	fs := newFlagSet("import uris", "import uris [file|-] [flags]")
+	onConflict, dryRun := importFlags(fs)
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return
+	}
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			reportErrorf("Error reading URI list: %v", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var batch importBatch
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := auther.ParseURI(text)
+		if err != nil {
+			batch.reject(fmt.Sprintf("line %d", line), err)
+			continue
+		}
+		batch.add(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		reportErrorf("Error reading URI list: %v", err)
+		os.Exit(1)
+	}
+	importEntries(batch, *onConflict, *dryRun)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Only one serve runs for each data file. While it runs it holds a lock on
+// serve-<id>.lock in the runtime directory, where id stands for the data
+// file, and says in serve-<id>.pid which process it is and where it
+// listens. Starting a second one fails with that, rather than with a bind
+// error or with two servers saving over each other, and serve --stop finds
+// the process there. The lock goes away with the process however it ends,
+// so a PID file left behind by a server that crashed is recognized as such
+// and removed, even if its PID has been reused since.
+
+// serveInstance is what serve-<id>.pid records.
+type serveInstance struct {
+	PID      int       `json:"pid"`
+	Address  string    `json:"address"`
+	DataFile string    `json:"data_file"`
+	Started  time.Time `json:"started"`
+}
+
+// serveRunningError is returned when a serve is already running for the data
+// file. Its instance is empty while that serve is still starting.
+type serveRunningError struct {
+	instance serveInstance
+}
+
+func (e serveRunningError) Error() string {
+	if e.instance.PID == 0 {
+		return "authinator serve is already running for this data file"
+	}
+	return fmt.Sprintf("authinator serve is already running (pid %d, listening on %s)", e.instance.PID, e.instance.Address)
+}
+
+// serveInstanceBase returns the path of the serve files of the data file,
+// without their extension.
+func serveInstanceBase() (string, error) {
+	path, err := filepath.Abs(dataPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(runtimeDir(), "serve-"+hex.EncodeToString(sum[:6])), nil
+}
+
+// claimServeInstance takes the lock of serve for the data file, failing
+// with a serveRunningError if another serve holds it. Once it listens, the
+// server records itself with writeServeInstance.
+func claimServeInstance() (lock *os.File, err error) {
+	if err := makeRuntimeDir(); err != nil {
+		return nil, err
+	}
+	base, err := serveInstanceBase()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(base+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		inst, _ := readServeInstance(base + ".pid")
+		return nil, serveRunningError{inst}
+	}
+	return f, nil
+}
+
+// writeServeInstance records the running server, listening on addr, in its
+// PID file.
+func writeServeInstance(addr string) error {
+	base, err := serveInstanceBase()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(dataPath)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(serveInstance{PID: os.Getpid(), Address: addr, DataFile: path, Started: time.Now()})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".pid", append(data, '\n'), 0600)
+}
+
+// releaseServeInstance removes the PID file and releases lock, as the server
+// exits.
+func releaseServeInstance(lock *os.File) {
+	if base, err := serveInstanceBase(); err == nil {
+		os.Remove(base + ".pid")
+	}
+	unlockFile(lock)
+	lock.Close()
+}
+
+func readServeInstance(path string) (serveInstance, error) {
+	var inst serveInstance
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return inst, err
+	}
+	err = json.Unmarshal(data, &inst)
+	return inst, err
+}
+
+// runningServe returns the serve running for the data file, if there is
+// one, removing the PID file of one that crashed. The instance is empty if
+// the server is still starting.
+func runningServe() (inst serveInstance, running bool, err error) {
+	base, err := serveInstanceBase()
+	if err != nil {
+		return inst, false, err
+	}
+	f, err := os.OpenFile(base+".lock", os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return inst, false, nil
+	} else if err != nil {
+		return inst, false, err
+	}
+	defer f.Close()
+	locked, err := tryLockFile(f)
+	if err != nil {
+		return inst, false, err
+	}
+	if locked {
+		unlockFile(f)
+		os.Remove(base + ".pid")
+		return inst, false, nil
+	}
+	inst, _ = readServeInstance(base + ".pid")
+	return inst, true, nil
+}
+
+// stopServe asks the serve running for the data file to shut down, as
+// SIGTERM does, and waits until it has. Windows has no SIGTERM, so there it
+// creates the stop file, which the server looks for every second.
+func stopServe() {
+	inst, running, err := runningServe()
+	switch {
+	case err != nil:
+		fatal(fmt.Errorf("looking for a running server: %w", err))
+	case !running:
+		fmt.Fprintf(os.Stderr, "No authinator serve is running for %s.\n", dataPath)
+		os.Exit(1)
+	case inst.PID == 0:
+		fatal(errors.New("authinator serve is still starting; try again in a moment"))
+	}
+
+	if runtime.GOOS == "windows" {
+		err = requestStop()
+	} else {
+		var p *os.Process
+		if p, err = os.FindProcess(inst.PID); err == nil {
+			err = p.Signal(syscall.SIGTERM)
+		}
+	}
+	if err != nil {
+		fatal(fmt.Errorf("stopping authinator serve (pid %d): %w", inst.PID, err))
+	}
+	fmt.Printf("Stopping authinator serve (pid %d, listening on %s)...\n", inst.PID, inst.Address)
+
+	// The server has shutdownTimeout for requests in flight and as long
+	// again for webhooks.
+	wait := 2*shutdownTimeout + 5*time.Second
+	deadline := time.Now().Add(wait)
+	for {
+		time.Sleep(100 * time.Millisecond)
+		if _, running, err := runningServe(); err == nil && !running {
+			fmt.Println("Stopped.")
+			return
+		}
+		if time.Now().After(deadline) {
+			fatal(fmt.Errorf("authinator serve (pid %d) is still running %s after being asked to stop", inst.PID, wait))
+		}
+	}
+}
+
+// stopPollInterval is how often a server on Windows looks for the stop file.
+const stopPollInterval = time.Second
+
+// requestStop creates the stop file of the serve for the data file.
+func requestStop() error {
+	base, err := serveInstanceBase()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".stop", nil, 0600)
+}
+
+// stopRequests returns a channel that receives once serve --stop has created
+// the stop file, on Windows. Elsewhere --stop sends SIGTERM instead, and the
+// channel never receives.
+func stopRequests() <-chan struct{} {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	base, err := serveInstanceBase()
+	if err != nil {
+		return nil
+	}
+	// A stop file left by a --stop the last server didn't get to isn't
+	// meant for this one.
+	os.Remove(base + ".stop")
+	c := make(chan struct{})
+	go func() {
+		for range time.Tick(stopPollInterval) {
+			if _, err := os.Stat(base + ".stop"); err == nil {
+				os.Remove(base + ".stop")
+				close(c)
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// serveStatus is what serve --status prints with --json.
+type serveStatus struct {
+	Running bool `json:"running"`
+	*serveInstance
+}
+
+// serveStatusCommand says whether a serve is running for the data file, and
+// if so which process it is and where it listens. It exits with status 1 if
+// none is.
+func serveStatusCommand() {
+	inst, running, err := runningServe()
+	if err != nil {
+		fatal(fmt.Errorf("looking for a running server: %w", err))
+	}
+	if options.json {
+		status := serveStatus{Running: running}
+		if running && inst.PID != 0 {
+			status.serveInstance = &inst
+		}
+		printJSON(status)
+	} else {
+		switch {
+		case !running:
+			fmt.Printf("No authinator serve is running for %s.\n", dataPath)
+		case inst.PID == 0:
+			fmt.Println("authinator serve is starting.")
+		default:
+			fmt.Printf("authinator serve is running (pid %d, listening on %s).\n", inst.PID, inst.Address)
+			fmt.Printf("Data file: %s\n", inst.DataFile)
+			fmt.Printf("Started:   %s (up %s)\n", inst.Started.Local().Format(time.DateTime), time.Since(inst.Started).Round(time.Second))
+		}
+	}
+	if !running {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"authinator/pkg/auther"
+	"authinator/pkg/auther/keyring"
+)
+
+// migrateToKeyring moves the secrets of the data file into the OS keyring
+// and scrubs them from the file, including its backup.
+func migrateToKeyring(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator migrate-to-keyring")
+		os.Exit(2)
+	}
+	if backendName() == backendSQLite {
+		fmt.Fprintln(os.Stderr, "migrate-to-keyring works on a JSON data file; drop --backend sqlite.")
+		os.Exit(2)
+	}
+
+	if _, err := os.Stat(dataPath); err == nil {
+		checkPermissions(dataPath)
+	}
+	b := keyring.New(newFileBackend(), keyring.DefaultService)
+	data, err := b.Load()
+	if err != nil {
+		fatal(err)
+	}
+	moved := 0
+	for _, entry := range data.Entries {
+		if entry.Secret != "" {
+			moved++
+		}
+	}
+	for _, t := range data.Trash {
+		if t.Secret != "" {
+			moved++
+		}
+	}
+	if moved == 0 {
+		fmt.Println("No secrets left to move; the data file is already using the keyring.")
+		return
+	}
+
+	if err := b.Save(data); err != nil {
+		fatal(err)
+	}
+	if err := os.Remove(auther.BackupPath(dataPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatal(fmt.Errorf("removing %s, which still holds the secrets: %w", auther.BackupPath(dataPath), err))
+	}
+	fmt.Printf("Moved %d secrets to the keyring.\n", moved)
+	fmt.Println("Use --backend keyring (or set AUTHER_BACKEND=keyring) from now on.")
+}
+
+// mustLoadSecrets fills in the secrets of entries kept in the keyring, for
+// commands that show them.
+func mustLoadSecrets(entries []TOTPEntry) {
+	for i := range entries {
+		if err := entries[i].LoadSecret(); err != nil {
+			fatal(fmt.Errorf("%s: %w", entries[i].Name, err))
+		}
+	}
+}
+
+// loadVaultSecrets fills in the secrets of every entry in v, trashed ones
+// included, for copies of the vault such as backups.
+func loadVaultSecrets(v TOTPData) error {
+	for i := range v.Entries {
+		if err := v.Entries[i].LoadSecret(); err != nil {
+			return fmt.Errorf("%s: %w", v.Entries[i].Name, err)
+		}
+	}
+	for i := range v.Trash {
+		if err := v.Trash[i].LoadSecret(); err != nil {
+			return fmt.Errorf("%s (in the trash): %w", v.Trash[i].Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Every save of the data file, and in serve each change from reading the
+// entries to saving them, happens under an advisory lock on a file next to
+// it, so two authinator processes, such as the CLI and serve, never write it
+// at the same time. Readers don't need the lock, as saves replace the file
+// in one rename.
+
+// A process that wants the lock tries again every lockRetry until it has
+// waited lockTimeout.
+const (
+	lockSuffix  = ".lock"
+	lockTimeout = 5 * time.Second
+	lockRetry   = 50 * time.Millisecond
+)
+
+// errDataFileChanged is returned when saving entries read before another
+// process saved its own, which would lose its changes.
+var errDataFileChanged = errors.New("the data file was changed by another program since it was read; run the command again to make the change on top of it")
+
+// Lock takes the lock on the data file, waiting up to lockTimeout for
+// another process to release it. A process that already holds it can take
+// it again; it is released when every unlock has been called.
+func (b *snapshotBackend) Lock() (unlock func(), err error) {
+	b.lockMu.Lock()
+	defer b.lockMu.Unlock()
+	if b.locks == 0 {
+		if b.lockFile, err = lockDataFile(dataPath + lockSuffix); err != nil {
+			return nil, err
+		}
+	}
+	b.locks++
+	return func() {
+		b.lockMu.Lock()
+		defer b.lockMu.Unlock()
+		if b.locks--; b.locks == 0 {
+			unlockFile(b.lockFile)
+			b.lockFile.Close()
+			b.lockFile = nil
+		}
+	}, nil
+}
+
+// lockDataFile opens the lock file at path, creating it if needed, and locks
+// it. The file is left in place afterwards: removing it could let two
+// processes lock different files of the same name.
+func lockDataFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening the lock file: %w", err)
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLockFile(f)
+		switch {
+		case err != nil:
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		case locked:
+			return f, nil
+		case time.Now().After(deadline):
+			f.Close()
+			return nil, fmt.Errorf("another authinator process is holding the lock on the data file (%s); try again once it is done", path)
+		}
+		time.Sleep(lockRetry)
+	}
+}
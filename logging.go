@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Diagnostics go through log/slog to stderr: warnings and errors always, and
+// with --verbose debug messages on what is going on, such as which files are
+// used and how long things take. What a command prints as its result, such as
+// codes and lists, is written to stdout directly and never logged, so piping
+// it keeps working. Prompts and notices that are part of a command, such as
+// where a snapshot was saved, are written to stderr directly as well.
+
+// logLevel is the level of the default logger: warnings, or debug messages
+// too with --verbose.
+var logLevel = new(slog.LevelVar)
+
+func init() {
+	logLevel.Set(slog.LevelWarn)
+	setupLogging(os.Stderr, false, false)
+}
+
+// setupLogging makes the default logger write to out, as JSON objects or as
+// lines for people to read, with the time in front if timestamps is set, as
+// serve does.
+func setupLogging(out io.Writer, json, timestamps bool) {
+	var h slog.Handler
+	if json {
+		h = slog.NewJSONHandler(out, &slog.HandlerOptions{Level: logLevel})
+	} else {
+		h = &textHandler{mu: &sync.Mutex{}, out: out, timestamps: timestamps}
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// textHandler writes records the way authinator has always written its
+// diagnostics: "Warning: message" or "Error: message", then the "err"
+// attribute after a colon and the other attributes as key=value. Values of
+// more than one line, such as a stack trace, follow on lines of their own.
+type textHandler struct {
+	mu         *sync.Mutex
+	out        io.Writer
+	timestamps bool
+	attrs      []slog.Attr
+	group      string
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	if h.timestamps {
+		buf.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	switch {
+	case r.Level >= slog.LevelError:
+		buf.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		buf.WriteString("Warning: ")
+	case r.Level < slog.LevelInfo:
+		buf.WriteString("Debug: ")
+	}
+	buf.WriteString(r.Message)
+
+	attrs := slices.Clone(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.grouped(a))
+		return true
+	})
+	var rest, long []slog.Attr
+	for _, a := range attrs {
+		switch {
+		case a.Key == "err":
+			fmt.Fprintf(&buf, ": %v", a.Value.Any())
+		case a.Value.Kind() == slog.KindString && strings.Contains(a.Value.String(), "\n"):
+			long = append(long, a)
+		case !a.Equal(slog.Attr{}):
+			rest = append(rest, a)
+		}
+	}
+	for _, a := range rest {
+		buf.WriteByte(' ')
+		writeAttr(&buf, "", a)
+	}
+	buf.WriteByte('\n')
+	for _, a := range long {
+		buf.WriteString(strings.TrimSuffix(a.Value.String(), "\n"))
+		buf.WriteByte('\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.out.Write(buf.Bytes())
+	return err
+}
+
+// writeAttr writes a as key=value, quoting values with spaces, and the
+// attributes of a group as group.key=value.
+func writeAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	key := a.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		for i, ga := range v.Group() {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeAttr(buf, key, ga)
+		}
+		return
+	}
+	s := v.String()
+	if v.Kind() == slog.KindDuration {
+		s = v.Duration().Round(time.Microsecond).String()
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
+	}
+	fmt.Fprintf(buf, "%s=%s", key, s)
+}
+
+// grouped puts a in the group of h, if any, by prefixing its key.
+func (h *textHandler) grouped(a slog.Attr) slog.Attr {
+	if h.group != "" {
+		a.Key = h.group + "." + a.Key
+	}
+	return a
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		next.attrs = append(next.attrs, h.grouped(a))
+	}
+	return &next
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	next.group = name
+	return &next
+}
@@ -2,52 +2,488 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
-	"github.com/pquerna/otp/totp"
-	"golang.design/x/clipboard"
-)
+	"golang.org/x/term"
 
-type TOTPEntry struct {
-	Name   string `json:"name"`
-	Secret string `json:"secret"`
-}
+	"authinator/pkg/auther"
+)
 
-type TOTPData struct {
-	Entries []TOTPEntry `json:"entries"`
-}
+// The entry and data file types live in pkg/auther, which the CLI and the
+// server share with other Go programs.
+type (
+	TOTPEntry = auther.Entry
+	TOTPData  = auther.Vault
+)
 
 const dataFile = "totp.json"
 
+// stdin is shared by every interactive prompt so buffered input isn't lost
+// between them.
+var stdin = bufio.NewReader(os.Stdin)
+
 func main() {
-	if len(os.Args) < 2 {
+	disableCoreDumps()
+	args, err := extractGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// config commands read the config file themselves, so a broken one can
+	// still be looked at and fixed.
+	if len(args) == 0 || args[0] != "config" {
+		warnings, err := loadConfig()
+		if len(args) == 0 || args[0] != completeNamesCommand {
+			for _, warning := range warnings {
+				slog.Warn(warning)
+			}
+		}
+		if err == nil {
+			err = applyConfig(globalFlags, "")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if options.verbose {
+		logLevel.Set(slog.LevelDebug)
+	}
+	if path, err := configPath(); err == nil && config != nil {
+		slog.Debug("read config file", "path", path, "settings", len(config))
+	}
+	if err := checkBackend(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if options.useNTPTime && ntpDisabled() {
+		fmt.Fprintln(os.Stderr, "--use-ntp-time can't be combined with --no-ntp or AUTHER_NO_NTP.")
+		os.Exit(2)
+	}
+
+	if len(args) > 0 && args[0] == completeNamesCommand {
+		completeNames()
+		return
+	}
+	// code never uses the data file, so it runs before the data file is
+	// located (and a legacy one migrated).
+	if len(args) > 0 && args[0] == "code" {
+		oneOffCodeCommand(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "config" {
+		configCommand(args[1:])
+		return
+	}
+	if len(args) > 0 && (args[0] == "version" || args[0] == "--version") {
+		versionCommand(args[1:])
+		return
+	}
+
+	dataPath, err = resolveDataPath()
+	if err != nil {
+		fatal(fmt.Errorf("locating the data file: %w", err))
+	}
+	slog.Debug("using data file", "path", dataPath, "backend", backendName())
+
+	if len(args) < 1 && !options.json && isTerminal(os.Stdin) {
+		if data := loadCodeData(); len(data.Entries) > 0 {
+			showCode(data, mustPickEntry(data.Entries), codeOutput{}, codeQuery{})
+			return
+		}
+	}
+	if len(args) < 1 {
 		fmt.Print(`Authinator CLI Help Guide
 
-Usage: authinator [command] [arguments...]
+Usage: authinator [command] [arguments...] [--file path]
+
+Global Flags:
+  --file [path]            Use the given data file instead of the default location.
+                           The AUTHER_DATA_FILE environment variable does the same.
+  --backend [name]         Store entries in a JSON data file (json, the default), an
+                           SQLite database (sqlite, default file totp.db), or the JSON
+                           file with the secrets in the OS keyring (keyring). The
+                           AUTHER_BACKEND environment variable does the same.
+  --clipboard-timeout [n]  Clear a copied code from the clipboard after n seconds
+                           (default 30), unless something else was copied since.
+  --no-clear               Leave copied codes on the clipboard.
+  --no-clipboard           Never copy codes to the clipboard. The AUTHER_NO_CLIPBOARD
+                           environment variable does the same.
+  --no-group               Print codes as 123456 instead of 123 456. Copied codes, --quiet
+                           and --json are never grouped.
+  --no-color               Print without colors. Setting NO_COLOR does the same, and
+                           output that isn't going to a terminal is never colored.
+  --fix-permissions        Restrict the data file to its owner (mode 0600) if other
+                           users can access it, instead of only warning.
+  --no-ntp                 Don't compare the clock with an NTP server before generating
+                           codes. The AUTHER_NO_NTP environment variable does the same.
+                           Otherwise a warning is printed if the clock is more than 5
+                           seconds off; the measurement is reused for an hour.
+  --ntp-server [host]      Compare the clock with this NTP server instead of
+                           pool.ntp.org. The AUTHER_NTP_SERVER environment variable
+                           does the same.
+  --use-ntp-time           Generate codes from the NTP server's time instead of the local
+                           clock, for machines whose clock you can't fix.
+  --json                   Print results of [name], list, create and remove as JSON.
+                           Errors are written to stderr as {"error": "..."}.
+  --age-identity [file]    Decrypt an age-encrypted data file, backup or import with
+                           this age identity file or SSH private key (repeatable). The
+                           AUTHER_AGE_IDENTITY environment variable, a list of files,
+                           does the same; ~/.ssh/id_ed25519 and ~/.ssh/id_rsa are
+                           tried otherwise.
+  --remote [url]           Run [name], list, create, add-uri and remove against a running
+                           authinator serve instead of the local data file. The
+                           AUTHER_REMOTE environment variable does the same. Accepts
+                           http://, https:// or unix:/path/to/socket, and sends the token
+                           from AUTHER_TOKEN (or the one serve saved on this machine).
+  --remote-ca [file]       Trust the certificate authorities in this PEM file for --remote.
+  --remote-fingerprint [sha256]
+                           Accept only a server certificate with this SHA-256
+                           fingerprint, as printed by serve --tls-self-signed.
+  --remote-insecure        Don't verify the --remote server's certificate.
+  --verbose, -v            Log what is going on to stderr, such as the files used, how
+                           long loading and saving take, and HTTP requests. Without it
+                           only warnings and errors are printed there.
+
+Most of these flags, and those of serve, can also be set in the config file
+(see config below). Flags win over environment variables, which win over the
+config file.
 
 Commands:
   create [name] [secret]   Create a new TOTP entry with the given name and secret.
+                           Use --digits, --period and --algorithm for services that don't
+                           use 6-digit, 30-second SHA1 codes.
                            Example: authinator create my_account JBSWY3DPEHPK3PXP
+                           Example: authinator create aws SECRET --digits 8 --period 60 --algorithm sha256
+                           --issuer and --account record who the entry is for, and the
+                           repeatable --tag flag organizes entries.
+                           Example: authinator create gh-work SECRET --issuer GitHub --account me@work.com
+                           --secret-stdin reads the secret from stdin instead, keeping it
+                           out of shell history and the process list. Without a secret
+                           argument, create prompts for it.
+                           Example: echo "$SECRET" | authinator create github --secret-stdin
+                           --steam creates an entry that generates 5-character Steam Guard
+                           codes.
+
+  generate [name]          Create an entry with a new random secret, e.g. for the server side
+                           of 2FA in your own app, and print its otpauth:// URI and QR code
+                           for enrolling. Takes the flags of create; --bits sets the size
+                           of the secret (default 160).
+                           Example: authinator generate myapp --issuer MyApp --account user@example.com
+
+  add-uri [uri] [name]     Create an entry from an otpauth:// URI, keeping its issuer,
+                           digits, period and algorithm. The name defaults to the URI label.
+                           Example: authinator add-uri "otpauth://totp/GitHub:me?secret=JBSWY3DPEHPK3PXP"
 
   list                     List all stored TOTP entries with their current codes and time remaining.
-                           Example: authinator list
+                           --tag limits the list to entries with that tag. --long (or -l)
+                           adds when each entry was added and last used, and --sort recent
+                           puts the most recently used first (--sort name and --sort issuer
+                           sort by name or issuer). On a terminal the countdowns are colored.
+                           --format prints each entry with a template, as for [name].
+                           --copy copies the code of the entry with that name or number.
+                           Pinned entries come first, in the order they were pinned, and
+                           --pinned lists only them. --glob and --regex list only entries
+                           whose name matches.
+                           Example: authinator list --format '{{.Name}}\t{{.Code}}'
+                           Example: authinator list --tag work --sort recent
+
+  edit [name]              Change an entry's issuer, account, digits, period or algorithm,
+                           or add and remove tags with --tag and --untag (both repeatable).
+                           Example: authinator edit github --tag work --untag personal
+
+  tags                     List every tag with the number of entries that carry it.
+                           Example: authinator tags
 
   [name]                   Get the current TOTP code for the entry with the specified name.
                            Also shows the time remaining until the next code.
+                           If no name matches exactly, a unique partial or misspelled
+                           match is used instead; --exact disables this. When several
+                           entries match, you pick one from a numbered list. Running
+                           authinator without arguments does the same for every entry.
+                           With --quiet (-q), prints only the code and skips the clipboard.
+                           --format prints a Go template instead, e.g. '{{.Code}} ({{.ExpiresIn}}s)',
+                           with the fields Name, Issuer, Account, Code, ExpiresIn, Period
+                           and NextCode. --copy copies the code with --quiet or --format.
+                           Exits 1 if no entry matches and 2 if no code can be generated.
+                           --at generates the code for another time (RFC3339 or unix
+                           seconds) and shows its window; --offset -30s shifts from now.
+                           --next n also lists the next n codes (at most 20) with the
+                           times they are valid, e.g. before going offline.
+                           --min-validity n waits for the next code if the current one
+                           expires in fewer than n seconds (at most 20).
                            Example: authinator my_account
-
-  remove [name]            Remove the TOTP entry with the specified name.
-                           Example: authinator remove my_account
-
-  serve                    Start an HTTP server on port 8055 to manage TOTP entries via REST API.
-                           Example: authinator serve
+                           Example: authinator github --at 2024-06-01T12:00:00Z
+
+  copy [name]              Copy the entry's current code without printing it. Exits 3 if
+                           there is no clipboard to copy it to.
+                           Example: authinator copy github
+
+  get [name...]            Print the current code and seconds left of several entries, one
+                           per line, looked up by name or alias. Names without an entry are
+                           reported and skipped, and make it exit 1 at the end.
+                           Example: authinator get vendor-admin vendor-billing vendor-support
+
+  code --secret [secret]   Print the code for a secret without storing it. --secret - reads
+                           the secret from stdin. --digits, --period and --algorithm work
+                           as for create, and --at and --offset as for [name].
+                           Example: authinator code --secret JBSWY3DPEHPK3PXP --at 2024-06-01T12:00:00Z
+
+  tui                      Browse the entries full-screen with live codes and countdowns.
+                           Enter copies the highlighted code, / filters, a adds an entry,
+                           d moves it to the trash and q quits.
+                           Example: authinator tui
+
+  exec [name] -- [command] Run a command with the entry's current code in its environment
+                           as AUTHER_CODE (and AUTHER_CODE_EXPIRES_IN), exiting with the
+                           command's status. --stdin writes the code to the command's
+                           stdin instead. Waits for the next code if the current one
+                           expires in fewer than --min-validity seconds (default 5).
+                           Example: authinator exec github -- terraform login
+
+  search [query]           List entries whose name, issuer or account contains the query.
+                           Example: authinator search git
+
+  verify [name] [code]     Check whether a code is currently valid for the entry. Exits 0 if
+                           it is and 1 if not. --skew n accepts codes up to n periods early
+                           or late (default 1). Steam Guard entries can't be verified.
+                           Example: authinator verify github 123456
+
+  remove [name...]         Move the TOTP entries with the specified names to the trash,
+                           asking for confirmation first. --yes (or -f) skips the prompt,
+                           and --purge deletes them for good instead. --glob or --regex
+                           removes every entry whose name matches, after listing them.
+                           Example: authinator remove my_account old_account
+                           Example: authinator remove --glob 'legacy-*'
+
+  trash list|restore|empty List removed entries, restore one by name (--as picks a new name)
+                           or delete them all for good (--yes skips the prompt). Entries are
+                           purged on their own 30 days after removal.
+                           Example: authinator trash restore my_account
+
+  note [name]              Show the entry's private note, or change it with --set text.
+                           --clear removes it.
+                           Example: authinator note github --set "Recovery email: me@example.com"
+
+  recovery [name] [action]  Store the one-time recovery codes a service gave you (add code...),
+                           show them (list) or mark one as used (use code). Notes and recovery
+                           codes only show up here and in full exports and backups.
+                           Example: authinator recovery github add 1a2b-3c4d 5e6f-7a8b
+
+  alias [action]           Give an entry shorter names to look it up by: add [alias] [name]
+                           adds one, remove [alias] removes it and list [name] shows them.
+                           Aliases can't be the name or alias of another entry, and are
+                           removed along with their entry.
+                           Example: authinator alias add gh github
+
+  pin [name]               Mark an entry as a favorite. Pinned entries are listed first, in
+                           the order they were pinned, in list and the TUI, and the picker
+                           shown by a bare authinator defaults to the most used of them.
+                           Example: authinator pin github
+
+  unpin [name]             Make a pinned entry an ordinary one again.
+                           Example: authinator unpin github
+
+  rename [old] [new]       Rename an entry. Refuses to replace an existing entry unless
+                           --force is given.
+                           Example: authinator rename github github-work
+
+  dedupe                   Find entries whose names only differ in case or that share a
+                           secret, and for each group ask which one to keep (the others
+                           are moved to the trash) or, for names, rename them. --list, or
+                           stdin not being a terminal, only lists them.
+                           Example: authinator dedupe
+
+  serve                    Start an HTTP server on 127.0.0.1:8055 to manage TOTP entries via
+                           REST API. --bind and --port change the address, as does
+                           AUTHER_ADDR (host:port) when neither flag is given.
+                           --socket path listens on a unix domain socket instead.
+                           Requests must send 'Authorization: Bearer <token>'. The token
+                           comes from --token or AUTHER_TOKEN, or is generated on first
+                           start and saved in the config directory. --no-auth turns this off.
+                           --basic-auth user:bcrypt-hash (repeatable) also accepts HTTP Basic
+                           auth; --trust-auth-header X-Remote-User takes requests carrying
+                           that header from a reverse proxy to come from the user it names.
+                           serve --help says which one wins.
+                           --tls-cert and --tls-key serve HTTPS; --tls-self-signed generates
+                           a temporary certificate and prints its fingerprint.
+                           Each request is logged to stderr, or appended to --log-file;
+                           --log-format json (or --log-json) writes one JSON object per line.
+                           GET /healthz and /readyz answer health checks without a token.
+                           Open the address in a browser for a web UI.
+                           --cors-origin (repeatable, or '*') lets scripts on other sites
+                           call the API.
+                           Each client may make 120 reads, 30 writes and 10 verifications a
+                           minute; change this with --rate-limit-read, --rate-limit-write
+                           and --rate-limit-verify (0 for no limit). Behind a reverse proxy,
+                           --trust-proxy limits by the X-Forwarded-For address.
+                           Requests are recorded in the audit log; --audit off stops that.
+                           --read-only rejects requests that would change entries with 403.
+                           The API is under /v1; its old paths without it, such as /totps,
+                           still work but are deprecated. --legacy-routes=false drops them.
+                           --webhook url (repeatable) POSTs entry created, updated and
+                           deleted events there, signed with --webhook-secret,
+                           AUTHER_WEBHOOK_SECRET or a secret saved in the config directory.
+                           --install-systemd writes a systemd unit that runs serve with the
+                           other flags given, for your user or, with --systemd-scope
+                           system, for the whole machine. Under systemd serve reports
+                           readiness, pings the watchdog and takes a socket passed by
+                           socket activation.
+                           SIGHUP reloads the data file after another program changed it;
+                           --watch reloads it on every change.
+                           Only one serve runs per data file; --stop stops the running one.
+                           --daemon runs it in the background, logging to serve.log in the
+                           config directory; --status shows whether it is running.
+                           Example: authinator serve --port 9000
+                           Example: authinator serve --port 9000 --install-systemd
+
+  import [format] [source] Import entries from another authenticator app.
+                           Formats: json (an authinator data file, export --json or backup),
+                           uris (otpauth:// URIs one per line, as written by export),
+                           google-migration (an otpauth-migration:// URI),
+                           aegis (a plain or encrypted Aegis JSON backup),
+                           andotp (a plain andOTP JSON backup),
+                           freeotp (a FreeOTP+ JSON backup),
+                           2fas (an unencrypted .2fas export),
+                           csv (a header row naming name, secret, issuer, account,
+                           digits, period and algorithm columns; --strict aborts on
+                           any bad row).
+                           --on-conflict skip|overwrite|rename|fail handles existing names
+                           (fail imports nothing if any is taken), --dry-run shows what
+                           would be added, renamed, overwritten or skipped without writing.
+                           A bundle from export --encrypt is imported without a format.
+                           Example: authinator import aegis aegis-backup.json --on-conflict rename
+
+  export                   Print every entry as an otpauth:// URI for moving to another app.
+                           --format aegis|andotp|freeotp writes a backup those apps import,
+                           --format json (or --json) dumps the raw data file instead,
+                           --output writes to a file (- for stdout).
+                           --encrypt writes a passphrase-encrypted bundle for off-site
+                           backups, which import reads back; --age-recipient encrypts
+                           it with age instead (repeatable).
+                           Asks for confirmation unless --include-secrets or the
+                           export is encrypted.
+                           Example: authinator export --format aegis --output aegis.json
+                           Example: authinator export --encrypt --output vault.auther
+
+  export csv               Export entries as CSV. --no-secrets leaves out the secret
+                           column for a sharable inventory.
+                           Example: authinator export csv --no-secrets > inventory.csv
+
+  qr [name]                Show a QR code for the entry so another device can scan it.
+                           --png writes an image file instead.
+                           Example: authinator qr github
+
+  encrypt                  Encrypt the data file with a passphrase, with age to each
+                           --age-recipient (an age1... key or an SSH public key), or
+                           with GnuPG to each --gpg-recipient (a key ID, fingerprint or
+                           email address), decrypted through gpg-agent.
+                           Example: authinator encrypt
+                           Example: authinator encrypt --age-recipient age1... --age-recipient age1...
+                           Example: authinator encrypt --gpg-recipient me@example.com
+
+  unlock                   Ask for the passphrase once and keep the key in a background
+                           agent, so other commands don't ask again until it has gone
+                           unused for --timeout (15m by default) or lock is run.
+                           Example: authinator unlock --timeout 1h
+
+  lock                     Make the agent forget the key right away.
+                           Example: authinator lock
+
+  passwd                   Change the passphrase of the data file, and re-encrypt the
+                           backups that use the old one. --from-stdin reads the current
+                           and the new passphrase from stdin, one per line.
+                           Example: authinator passwd
+
+  key                      Manage the FIDO2 security keys, such as YubiKeys, that unlock
+                           the data file with a touch instead of the passphrase, which
+                           still works as a fallback. key list shows them, key enroll
+                           [--name name] adds the one plugged in, key remove name drops one.
+                           Example: authinator key enroll --name yubikey
+
+  migrate-to-keyring       Move the secrets of the data file into the OS keyring and
+                           remove them from the file. Use --backend keyring afterwards.
+                           Example: authinator migrate-to-keyring
+
+  backup                   Save a timestamped copy of every entry to the backups directory
+                           in the config directory. Backups of an encrypted vault use its
+                           passphrase; --encrypt asks for one otherwise. --keep n removes
+                           all but the newest n backups, and --list shows them.
+                           Example: authinator backup --keep 10
+
+  restore [timestamp|file] Replace every entry with a backup, after asking for confirmation
+                           (--yes skips it). The current entries are backed up first.
+                           Example: authinator restore 20240601-120000
+
+  undo                     Go back to the entries as they were before the last change that
+                           removed or changed entries. Such changes save a snapshot first,
+                           and the last 10 snapshots are kept; run undo again to go further.
+                           --yes skips the confirmation.
+                           Example: authinator undo
+
+  doctor                   Check what authinator depends on: that the data file can be read
+                           and only you can access it, that every secret generates codes,
+                           that the clock agrees with an NTP server, that a clipboard is
+                           available and that serve's port is free. Each check passes, warns
+                           or fails; any failure makes doctor exit with status 1. --skip
+                           clock (repeatable) leaves a check out, e.g. on offline machines;
+                           --no-ntp also skips the clock.
+                           Example: authinator doctor --skip clock
+
+  audit tail               Show the newest events of the audit log, which records every
+                           create, edit, rename, remove, import, export, code and verify,
+                           from the CLI and over HTTP, and API requests with a bad token,
+                           never secrets or codes. -n (50 by default, 0 for all) and
+                           --since (a time, a date, or a duration such as 24h) filter it.
+                           Example: authinator audit tail -n 20 --since 24h
+
+  token create|list|revoke Manage named API tokens for serve. create --name name
+                           [--role admin|read|codes-only] prints a new token, once;
+                           read (the default) may list entries and get codes, codes-only
+                           only get and verify codes of entries it names, admin anything.
+                           --tag (repeatable) limits a read or codes-only token to the
+                           entries with one of those tags.
+                           list shows the tokens and revoke name removes one.
+                           Example: authinator token create --role read --name dashboard
+
+  config [path|list|get|set|unset]
+                           Read or change the config file, config.toml in the config
+                           directory or the file in AUTHER_CONFIG. path prints where it
+                           is, list prints what is set (--all lists every setting), get
+                           prints one setting, set key value... sets one (several values
+                           for a list) and unset removes it. Unknown settings only get a
+                           warning.
+                           Example: authinator config set serve.port 9000
+
+  version                  Print the version, git commit, build date and Go version.
+                           --check asks GitHub whether a newer release exists; nothing
+                           is sent anywhere without it.
+                           Example: authinator version --check
+
+  completion [shell]       Print a completion script for bash, zsh or fish. Entry names
+                           are completed for [name], edit, rename, remove, qr and verify.
+                           Example: source <(authinator completion bash)
 
   help                     Display this help guide.
 
@@ -63,6 +499,9 @@ Detailed Guide:
 
    This will create a TOTP entry named 'github' using the secret key provided.
 
+   You can also paste the otpauth:// URI a service shows alongside its QR code:
+   authinator add-uri "otpauth://totp/GitHub:me?secret=JBSWY3DPEHPK3PXP&issuer=GitHub"
+
 2. Listing All TOTP Entries:
    - Use the 'list' command to view all stored TOTP entries.
    - The list will display each entry's current code and the time remaining until the code expires.
@@ -74,24 +513,44 @@ Detailed Guide:
    - Simply run the command with the entry name to get the current TOTP code.
    - The output will include the code and the time remaining until it changes.
    - The code will also be copied to your clipboard automatically.
+   - After 30 seconds the clipboard is cleared again, unless you have copied
+     something else in the meantime. Change this with --clipboard-timeout or
+     disable it with --no-clear.
 
    Example:
    authinator github
 
 4. Removing a TOTP Entry:
    - Use the 'remove' command to delete a TOTP entry by its name.
+   - You will be asked to confirm each removal; pass --yes to skip the prompt in scripts.
 
    Example:
    authinator remove github
 
 5. Serving the Authinator via HTTP:
-   - The 'serve' command starts an HTTP server on port 8055.
+   - The 'serve' command starts an HTTP server on 127.0.0.1:8055, so only this machine
+     can reach it. Use --bind 0.0.0.0 to expose it to the network and --port to change the port.
    - You can interact with your TOTP entries via REST API calls.
-   - The following endpoints are available:
-     - GET /totps: List all TOTP entries.
-     - GET /totps/{name}: Get the current TOTP code for the specified entry.
-     - POST /totps: Create a new TOTP entry by sending a JSON payload.
-     - DELETE /totps/{name}: Delete a TOTP entry.
+   - The following endpoints are available, all under /v1 (the same paths without /v1
+     still work but are deprecated):
+     - GET /v1/totps: List all TOTP entries without their secrets (?tag=work filters by tag,
+       ?include_secrets=true adds the secrets).
+     - GET /v1/totps?codes=true: Get the current codes of the entries in ?names=a,b,c, or of
+       every entry (?tag= filters), in one request.
+     - GET /v1/totps/{name}: Get the current TOTP code for the specified entry
+       (?at= gets the code for another time, ?next=5 adds the upcoming codes,
+       ?min_validity=5 waits for a code that stays valid for 5 seconds, ?peek=true
+       doesn't count as a use of the entry).
+     - POST /v1/totps: Create a new TOTP entry by sending a JSON payload.
+     - POST /v1/totps/generate: Create an entry with a new random secret, returning the
+       secret and otpauth:// URI once.
+     - PUT /v1/totps/{name}: Update an entry's secret, issuer, account, algorithm, digits,
+       period or tags.
+     - POST /v1/totps/{name}/verify: Check a code sent as {"code": "123456"}.
+     - PATCH /v1/totps/{name}: Rename an entry by sending {"name": "newname"}.
+     - DELETE /v1/totps/{name}: Move a TOTP entry to the trash (?purge=true deletes it for good).
+   - Every request needs an 'Authorization: Bearer <token>' header. The token is printed the
+     first time the server starts and saved in the config directory.
 
    Example:
    authinator serve
@@ -99,298 +558,1763 @@ Detailed Guide:
    Then you can use curl or any HTTP client to interact with the service:
    
    - List all entries:
-     curl -X GET http://localhost:8055/totps
+     curl -X GET http://localhost:8055/v1/totps
    
    - Create a new entry:
-     curl -X POST -H "Content-Type: application/json" -d '{"name":"example","secret":"SECRETKEY"}' http://localhost:8055/totps
+     curl -X POST -H "Content-Type: application/json" -d '{"name":"example","secret":"SECRETKEY"}' http://localhost:8055/v1/totps
 
    - Get the TOTP code for an entry:
-     curl -X GET http://localhost:8055/totps/example
+     curl -X GET http://localhost:8055/v1/totps/example
 
    - Delete an entry:
-     curl -X DELETE http://localhost:8055/totps/example
+     curl -X DELETE http://localhost:8055/v1/totps/example
+
+6. Encrypting the Data File:
+   - The 'encrypt' command converts a plaintext data file in place.
+   - Secrets are encrypted with AES-256-GCM using a key derived from your passphrase.
+   - Every command that reads the data file will then prompt for the passphrase,
+     unless 'unlock' has handed its key to the agent.
+   - Set AUTHER_PASSPHRASE to supply it non-interactively (e.g. for 'serve').
+   - With --age-recipient, the file is encrypted with age instead, and
+     decrypted with --age-identity or your SSH key.
+   - With --gpg-recipient, the file is encrypted with GnuPG instead, and
+     decrypted through gpg-agent.
+
+   Example:
+   authinator encrypt
 `)
 		return
 	}
 
-	command := os.Args[1]
+	command := args[0]
+	if command == clearClipboardCommand {
+		clearClipboardLater(args[1:])
+		return
+	}
+	if command == agentCommand {
+		runAgent(args[1:])
+		return
+	}
+	if remoteAddress() != "" && localOnlyCommands[command] {
+		fmt.Fprintf(os.Stderr, "%s isn't available with --remote; run it on the server instead.\n", command)
+		os.Exit(2)
+	}
 
 	switch command {
 	case "create":
-		if len(os.Args) == 4 {
-			createEntry(os.Args[2], os.Args[3])
+		createCommand(args[1:])
+	case "alias":
+		aliasCommand(args[1:])
+	case "get":
+		getCommand(args[1:])
+	case "pin":
+		pinCommand(args[1:], true)
+	case "unpin":
+		pinCommand(args[1:], false)
+	case "dedupe":
+		dedupeCommand(args[1:])
+	case "rename":
+		renameCommand(args[1:])
+	case "add-uri":
+		if len(args) == 2 {
+			addURI(args[1], "")
+		} else if len(args) == 3 {
+			addURI(args[1], args[2])
 		} else {
-			createEntryInteractive()
+			fmt.Fprintln(os.Stderr, "Usage: authinator add-uri [uri] [name]")
 		}
 	case "list":
-		listEntries()
+		listCommand(args[1:])
+	case "tags":
+		listTags()
+	case "edit":
+		editCommand(args[1:])
 	case "remove":
-		if len(os.Args) == 3 {
-			removeEntry(os.Args[2])
-		} else {
-			fmt.Println("Usage: authinator remove [name]")
-		}
+		removeCommand(args[1:])
 	case "serve":
-		startServer()
+		startServer(args[1:])
+	case "unlock":
+		unlockCommand(args[1:])
+	case "lock":
+		lockCommand(args[1:])
+	case "passwd":
+		passwdCommand(args[1:])
+	case "key":
+		keyCommand(args[1:])
+	case "audit":
+		auditCommand(args[1:])
+	case "token":
+		tokenCommand(args[1:])
+	case "encrypt":
+		encryptVault(args[1:])
+	case "migrate-to-keyring":
+		migrateToKeyring(args[1:])
+	case "backup":
+		backupCommand(args[1:])
+	case "restore":
+		restoreCommand(args[1:])
+	case "undo":
+		undoCommand(args[1:])
+	case "trash":
+		trashCommand(args[1:])
+	case "note":
+		noteCommand(args[1:])
+	case "recovery":
+		recoveryCommand(args[1:])
+	case "export":
+		exportCommand(args[1:])
+	case "qr":
+		qrCommand(args[1:])
+	case "import":
+		importCommand(args[1:])
+	case "tui":
+		tuiCommand(args[1:])
+	case "exec":
+		execCommand(args[1:])
+	case "copy":
+		copyCommand(args[1:])
+	case "generate":
+		generateCommand(args[1:])
+	case "search":
+		searchCommand(args[1:])
+	case "verify":
+		verifyCommand(args[1:])
+	case "doctor":
+		doctorCommand(args[1:])
+	case "completion":
+		completionCommand(args[1:])
 	default:
-		if len(os.Args) == 2 {
-			getCode(os.Args[1])
-		} else {
-			fmt.Println("Usage: authinator [command] [arguments...]")
+		codeCommand(args)
+	}
+}
+
+func codeCommand(args []string) {
+	fs := newFlagSet("[name]", "[name] [--exact] [--quiet | --format template] [--copy] [--at time | --offset duration] [--next n] [--min-validity seconds]")
+	exact := fs.Bool("exact", false, "only accept an exact name match")
+	quiet := fs.Bool("quiet", false, "print only the code, without copying it")
+	fs.BoolVar(quiet, "q", false, "shorthand for --quiet")
+	format := fs.String("format", "", "print the code with this Go template instead, like --quiet")
+	copyCode := fs.Bool("copy", false, "copy the code to the clipboard even with --quiet or --format")
+	when := addTimeFlags(fs)
+	next := fs.Int("next", 0, fmt.Sprintf("also print this many upcoming codes (at most %d)", maxUpcoming))
+	minValidity := fs.Int("min-validity", 0, fmt.Sprintf("wait for the next code if the current one expires in fewer seconds (at most %d)", maxMinValidity))
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator [command] [arguments...]")
+		os.Exit(2)
+	}
+	t, shifted, err := when.time()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	q := codeQuery{next: *next, minValidity: *minValidity}
+	if shifted {
+		q.at = t
+	}
+	if err := q.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	out := codeOutput{quiet: *quiet, copy: *copyCode}
+	if flagsGiven(fs, "format") {
+		if options.json {
+			fmt.Fprintln(os.Stderr, "--format can't be combined with --json.")
+			os.Exit(2)
 		}
+		out.format = mustParseFormat(*format)
 	}
+	getCode(args[0], *exact, out, q)
 }
 
-// HTTP Handlers
-func startServer() {
-	http.HandleFunc("/totps", handleTOTPRequests)
-	http.HandleFunc("/totps/", handleTOTPRequestsByID)
+// entryFlags are the entry settings shared by create and edit.
+type entryFlags struct {
+	digits    *int
+	period    *int
+	algorithm *string
+	issuer    *string
+	account   *string
+	tags      stringList
+}
 
-	fmt.Println("Serving on http://0.0.0.0:8055")
-	log.Fatal(http.ListenAndServe("0.0.0.0:8055", nil))
+func addEntryFlags(fs *flag.FlagSet) *entryFlags {
+	f := &entryFlags{
+		digits:    fs.Int("digits", 0, "number of digits in each code (6-8, default 6)"),
+		period:    fs.Int("period", 0, "seconds each code is valid for (default 30)"),
+		algorithm: fs.String("algorithm", "", "HMAC algorithm: sha1, sha256 or sha512 (default sha1)"),
+		issuer:    fs.String("issuer", "", "provider the entry belongs to, e.g. GitHub"),
+		account:   fs.String("account", "", "account name or email at the provider"),
+	}
+	fs.Var(&f.tags, "tag", "add a tag to the entry (repeatable)")
+	return f
 }
 
-func handleTOTPRequests(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		listEntriesHTTP(w, r)
-	case "POST":
-		createEntryHTTP(w, r)
+// apply copies the flags that were set onto the entry.
+func (f *entryFlags) apply(entry *TOTPEntry) {
+	if *f.digits != 0 {
+		entry.Digits = *f.digits
+	}
+	if *f.period != 0 {
+		entry.Period = *f.period
+	}
+	if *f.algorithm != "" {
+		entry.Algorithm = *f.algorithm
+	}
+	if *f.issuer != "" {
+		entry.Issuer = *f.issuer
+	}
+	if *f.account != "" {
+		entry.Account = *f.account
+	}
+	entry.AddTags(f.tags)
+}
+
+func createCommand(args []string) {
+	fs := newFlagSet("create", "create [name] [secret] [flags]")
+	flags := addEntryFlags(fs)
+	secretStdin := fs.Bool("secret-stdin", false, "read the secret from the first line of stdin")
+	steam := fs.Bool("steam", false, "generate Steam Guard codes")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	var entry TOTPEntry
+	switch {
+	case *secretStdin:
+		if len(args) != 1 || auther.IsURI(args[0]) {
+			fmt.Fprintln(os.Stderr, "--secret-stdin takes the name as the only argument: authinator create [name] --secret-stdin")
+			os.Exit(2)
+		}
+		secret, err := readSecretLine()
+		if err != nil {
+			fatal(err)
+		}
+		entry = TOTPEntry{Name: args[0], Secret: secret}
+	case len(args) == 2:
+		if isTerminal(os.Stdin) {
+			slog.Warn("a secret given as an argument is saved in your shell history and visible in the process list. Use --secret-stdin, or leave it out to be prompted.")
+		}
+		entry = TOTPEntry{Name: args[0], Secret: args[1]}
+	case len(args) == 1 && auther.IsURI(args[0]):
+		if entry, err = auther.ParseURI(args[0]); err != nil {
+			reportErrorf("Invalid otpauth URI: %v", err)
+			os.Exit(1)
+		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		entry = readEntryInteractive()
+	}
+
+	// Flags override anything parsed from a URI.
+	flags.apply(&entry)
+	if *steam {
+		entry.Type = auther.TypeSteam
 	}
+	addEntry(entry)
 }
 
-func handleTOTPRequestsByID(w http.ResponseWriter, r *http.Request) {
-	name := strings.TrimPrefix(r.URL.Path, "/totps/")
+func editCommand(args []string) {
+	fs := newFlagSet("edit", "edit [name] [flags]")
+	flags := addEntryFlags(fs)
+	var untag stringList
+	fs.Var(&untag, "untag", "remove a tag from the entry (repeatable)")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator edit [name] [flags]")
+		os.Exit(2)
+	}
 
-	switch r.Method {
-	case "GET":
-		getCodeHTTP(w, r, name)
-	case "DELETE":
-		removeEntryHTTP(w, r, name)
+	entry, err := mustOpenStore().Edit(args[0], func(entry *TOTPEntry) {
+		flags.apply(entry)
+		entry.RemoveTags(untag)
+	})
+	var invalid auther.InvalidEntryError
+	switch {
+	case err == nil:
+		logAudit("edit", args[0], auditOK)
+	case errors.Is(err, auther.ErrNotFound):
+		logAudit("edit", args[0], auditNotFound)
+		reportErrorf("No entry found with the name: %s", args[0])
+		os.Exit(exitNotFound)
+	case errors.As(err, &invalid):
+		logAudit("edit", args[0], auditFailed)
+		reportErrorf("Invalid entry: %v", invalid.Err)
+		os.Exit(1)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		fatal(err)
+	}
+
+	fmt.Printf("Entry '%s' has been updated.\n", entry.Name)
+}
+
+func listCommand(args []string) {
+	fs := newFlagSet("list", "list [--tag tag] [--pinned] [--glob pattern | --regex pattern] [--long | --format template] [--sort name|recent|issuer] [--copy name|number]")
+	tag := fs.String("tag", "", "only list entries with this tag")
+	pinned := fs.Bool("pinned", false, "only list pinned entries")
+	glob, regex := matchFlags(fs)
+	long := fs.Bool("long", false, "also show when each entry was added and last used")
+	fs.BoolVar(long, "l", false, "shorthand for --long")
+	sortBy := fs.String("sort", "", "order entries by name, by issuer, or by last use with the most recent first")
+	format := fs.String("format", "", "print each entry with this Go template")
+	copyTarget := fs.String("copy", "", "copy the code of the entry with this name or number in the list")
+	if _, err := parseFlags(fs, args); err != nil {
+		os.Exit(2)
+	}
+	match := mustNameMatcher(*glob, *regex)
+	if *sortBy != "" && *sortBy != sortName && *sortBy != sortRecent && *sortBy != sortIssuer {
+		fmt.Fprintf(os.Stderr, "Unknown sort order %q. Use name, recent or issuer.\n", *sortBy)
+		os.Exit(2)
+	}
+	var tmpl *template.Template
+	if flagsGiven(fs, "format") {
+		if options.json || *long {
+			fmt.Fprintln(os.Stderr, "--format can't be combined with --json or --long.")
+			os.Exit(2)
+		}
+		tmpl = mustParseFormat(*format)
+	}
+	results := listEntries(listFilter{tag: *tag, pinned: *pinned, match: match}, *long, *sortBy, tmpl)
+	logAuditDetail("list", "", auditOK, countEntries(len(results)))
+	if *copyTarget == "" {
+		return
+	}
+
+	result, ok := findListed(results, *copyTarget)
+	if !ok {
+		reportErrorf("No entry in the list is named or numbered %s.", *copyTarget)
+		os.Exit(exitNotFound)
+	}
+	data := loadCodeData()
+	entry, _ := data.Find(result.Name)
+	how := mustCopyCode(data, entry)
+	if !options.json {
+		fmt.Println()
+		reportCopiedEntry(entry.Name, how)
+	}
+}
+
+// findListed finds the target of list --copy among the listed results: by
+// its number in the list, counting from 1, or by name.
+func findListed(results []codeResult, target string) (codeResult, bool) {
+	if n, err := strconv.Atoi(target); err == nil {
+		if n < 1 || n > len(results) {
+			return codeResult{}, false
+		}
+		return results[n-1], true
+	}
+	for _, exact := range []bool{true, false} {
+		for _, result := range results {
+			if result.Name == target || (!exact && strings.EqualFold(result.Name, target)) {
+				return result, true
+			}
+		}
+	}
+	return codeResult{}, false
+}
+
+// Orders for list --sort. Without one, entries are listed in the order they
+// were added. Either way, pinned entries come first in the order they were
+// pinned.
+const (
+	sortName   = "name"
+	sortRecent = "recent"
+	sortIssuer = "issuer"
+)
+
+// sortResults orders list results by sortBy. Entries never used sort last
+// for recent, in the order they were added.
+func sortResults(results []codeResult, sortBy string) {
+	switch sortBy {
+	case sortName:
+		sort.SliceStable(results, func(i, j int) bool {
+			return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+		})
+	case sortRecent:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].LastUsedAt.After(results[j].LastUsedAt)
+		})
+	case sortIssuer:
+		// Entries without an issuer go last.
+		sort.SliceStable(results, func(i, j int) bool {
+			a, b := strings.ToLower(results[i].Issuer), strings.ToLower(results[j].Issuer)
+			if a != b {
+				return b == "" || (a != "" && a < b)
+			}
+			return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+		})
+	}
+	auther.SortPinned(results, func(r codeResult) int { return r.Pin })
+}
+
+// serverStore is the data file shared by every HTTP request. It is loaded
+// once, which also unlocks the vault up front so handlers never prompt for a
+// passphrase.
+var serverStore *auther.Store
+
+// serverAuth records whether serve checks API tokens. Secrets are only ever
+// returned to authenticated clients.
+var serverAuth bool
+
+// Default listen address for serve. Only local clients can reach it unless
+// --bind says otherwise.
+const (
+	defaultBind = "127.0.0.1"
+	defaultPort = 8055
+)
+
+// HTTP Handlers
+func startServer(args []string) {
+	fs := newFlagSet("serve", "serve [--bind address] [--port port | --socket path] [--token token | --no-auth] [--basic-auth user:bcrypt-hash]... [--trust-auth-header header] [--tls-cert file --tls-key file | --tls-self-signed] [--log-file file] [--log-format text|json | --log-json] [--cors-origin origin]... [--rate-limit-read n] [--rate-limit-write n] [--rate-limit-verify n] [--trust-proxy] [--audit on|off] [--webhook url]... [--webhook-secret secret] [--watch] [--read-only] [--legacy-routes=false] [--install-systemd [--systemd-scope user|system] | --daemon] | serve --status | serve --stop")
+	bind := fs.String("bind", defaultBind, "address to listen on (0.0.0.0 for every interface)")
+	port := fs.Int("port", defaultPort, "port to listen on")
+	tokenFlag := fs.String("token", "", "API token clients must send as a bearer token")
+	noAuth := fs.Bool("no-auth", false, "accept requests without a token")
+	var basicAuth stringList
+	fs.Var(&basicAuth, "basic-auth", "also accept HTTP Basic auth as this user, with the password of this bcrypt hash (repeatable)")
+	trustAuthHeader := fs.String("trust-auth-header", "", "take requests with this header, such as X-Remote-User, to come from the user it names, as authenticated by a reverse proxy")
+	tlsCert := fs.String("tls-cert", "", "serve HTTPS using this PEM certificate")
+	tlsKey := fs.String("tls-key", "", "PEM private key for --tls-cert")
+	tlsSelfSigned := fs.Bool("tls-self-signed", false, "serve HTTPS with a generated self-signed certificate")
+	socket := fs.String("socket", "", "listen on this unix domain socket instead of a TCP port")
+	fs.UintVar(&serverVerifySkew, "verify-skew", defaultVerifySkew, "periods either side of now accepted by the verify endpoint")
+	logFile := fs.String("log-file", "", "append the access log and server errors to this file instead of stderr")
+	logFormat := fs.String("log-format", logFormatText, "log format: text or json")
+	logJSON := fs.Bool("log-json", false, "shorthand for --log-format json")
+	var corsOrigins stringList
+	fs.Var(&corsOrigins, "cors-origin", "allow browser scripts from this origin, or * for any (repeatable)")
+	readRate := fs.Int("rate-limit-read", defaultReadRate, "read requests allowed per client per minute (0 for no limit)")
+	writeRate := fs.Int("rate-limit-write", defaultWriteRate, "write requests allowed per client per minute (0 for no limit)")
+	verifyRate := fs.Int("rate-limit-verify", defaultVerifyRate, "verify requests allowed per client per minute (0 for no limit)")
+	trustProxy := fs.Bool("trust-proxy", false, "rate limit by the client address in X-Forwarded-For, for use behind a reverse proxy")
+	auditMode := fs.String("audit", "on", "record requests in the audit log: on or off")
+	var webhookURLs stringList
+	fs.Var(&webhookURLs, "webhook", "POST entry created, updated and deleted events to this URL (repeatable)")
+	webhookSecretFlag := fs.String("webhook-secret", "", "sign webhook payloads with this secret")
+	watch := fs.Bool("watch", false, "reload the data file whenever another program changes it")
+	fs.BoolVar(&serverReadOnly, "read-only", false, "reject requests that would change entries with 403 Forbidden")
+	legacyRoutes := fs.Bool("legacy-routes", true, "also serve the API at its deprecated paths without /v1, such as /totps")
+	installSystemd := fs.Bool("install-systemd", false, "write a systemd unit that runs serve with the other flags given, then exit")
+	systemdScope := fs.String("systemd-scope", systemdUser, "where --install-systemd installs the unit: user or system")
+	daemon := fs.Bool("daemon", false, "run in the background, logging to serve.log in the config directory unless --log-file is given")
+	status := fs.Bool("status", false, "show whether a serve is running for the data file, then exit")
+	stop := fs.Bool("stop", false, "stop the serve running for the data file, then exit")
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		fmt.Fprint(fs.Output(), serveAuthHelp)
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		os.Exit(2)
+	}
+	if err := applyConfig(fs, "serve"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	switch {
+	case *status:
+		serveStatusCommand()
+		return
+	case *stop:
+		stopServe()
+		return
+	}
+	switch *auditMode {
+	case "on":
+	case "off":
+		auditDisabled = true
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown --audit %q. Use on or off.\n", *auditMode)
+		os.Exit(2)
+	}
+	if *systemdScope != systemdUser && *systemdScope != systemdSystem {
+		fmt.Fprintf(os.Stderr, "Unknown --systemd-scope %q. Use user or system.\n", *systemdScope)
+		os.Exit(2)
+	}
+	if *installSystemd && *daemon {
+		fmt.Fprintln(os.Stderr, "--install-systemd and --daemon can't be used together; systemd runs the server in the background itself.")
+		os.Exit(2)
+	}
+	if *installSystemd && flagsGiven(fs, "token", "webhook-secret") {
+		fmt.Fprintln(os.Stderr, "--token and --webhook-secret would be readable by anyone in the unit file. Leave them out to use the saved ones, or set them in the config file.")
+		os.Exit(2)
+	}
+	if *noAuth && *tokenFlag != "" {
+		fmt.Fprintln(os.Stderr, "--token and --no-auth can't be used together.")
+		os.Exit(2)
+	}
+	if *noAuth && (len(basicAuth) > 0 || *trustAuthHeader != "") {
+		fmt.Fprintln(os.Stderr, "--basic-auth and --trust-auth-header can't be used with --no-auth, which accepts every request.")
+		os.Exit(2)
+	}
+	basicUsers, err := parseBasicAuth(basicAuth)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *trustAuthHeader != "" && strings.EqualFold(*trustAuthHeader, "Authorization") {
+		fmt.Fprintln(os.Stderr, "--trust-auth-header can't be Authorization; name the header the proxy sets the user in, such as X-Remote-User.")
+		os.Exit(2)
+	}
+	if *logJSON {
+		*logFormat = logFormatJSON
+	}
+	if *logFormat != logFormatText && *logFormat != logFormatJSON {
+		fmt.Fprintf(os.Stderr, "Unknown log format %q. Use text or json.\n", *logFormat)
+		os.Exit(2)
+	}
+	if err := checkCORSOrigins(corsOrigins); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	eventWebhooks := map[string][]string{
+		webhookCreated: configStrings("serve.webhook-created"),
+		webhookUpdated: configStrings("serve.webhook-updated"),
+		webhookDeleted: configStrings("serve.webhook-deleted"),
+	}
+	allWebhooks := slices.Clone(webhookURLs)
+	for _, urls := range eventWebhooks {
+		allWebhooks = append(allWebhooks, urls...)
+	}
+	for _, u := range allWebhooks {
+		if err := checkWebhookURL(u); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	limits := rateLimits{
+		read:       newRateLimiter(*readRate),
+		write:      newRateLimiter(*writeRate),
+		verify:     newRateLimiter(*verifyRate),
+		trustProxy: *trustProxy,
+	}
+
+	var addr string
+	if *socket != "" {
+		if flagsGiven(fs, "bind", "port") {
+			fmt.Fprintln(os.Stderr, "--socket can't be combined with --bind or --port; choose a unix socket or a TCP address.")
+			os.Exit(2)
+		}
+	} else if addr, err = listenAddr(fs, *bind, *port); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *installSystemd {
+		unitArgs := withoutFlags(args, []string{"install-systemd"}, []string{"systemd-scope"})
+		if err := installSystemdUnit(*systemdScope, unitArgs, *logFile, *socket); err != nil {
+			fatal(fmt.Errorf("installing the systemd unit: %w", err))
+		}
+		return
+	}
+
+	if *daemon {
+		if err := startDaemon(withoutFlags(os.Args[1:], []string{"daemon"}, nil), *logFile); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// A second server for the same data file is turned away before it
+	// tries to listen, with where the first one is.
+	instanceLock, err := claimServeInstance()
+	var running serveRunningError
+	if errors.As(err, &running) {
+		fatal(err)
+	} else if err != nil {
+		fatal(fmt.Errorf("taking the serve lock in %s: %w", runtimeDir(), err))
+	}
+	defer releaseServeInstance(instanceLock)
+
+	host, _, _ := net.SplitHostPort(addr)
+	tlsConfig, err := serverTLSConfig(*tlsCert, *tlsKey, *tlsSelfSigned, host)
+	if err != nil {
+		fatal(fmt.Errorf("setting up TLS: %w", err))
+	}
+
+	// A GnuPG-encrypted data file can only be served if gpg-agent already
+	// has the key unlocked.
+	gpgNonInteractive = true
+	if serverStore, err = openStore(); errors.Is(err, auther.ErrGPGKeyLocked) {
+		fatal(fmt.Errorf("%w. serve can't ask for the key's passphrase; unlock it in gpg-agent first, for example by running authinator list", err))
+	} else if err != nil {
+		fatal(err)
+	}
+
+	// Every route of the API goes through the same middleware, from the
+	// inside out: --read-only, authentication, the audit log and the rate
+	// limits.
+	var middleware []func(http.Handler) http.Handler
+	if serverReadOnly {
+		middleware = append(middleware, rejectWrites)
+	}
+	if !*noAuth {
+		token, generated, err := serverToken(*tokenFlag)
+		if err != nil {
+			fatal(fmt.Errorf("setting up the API token: %w", err))
+		}
+		if generated {
+			fmt.Printf("Generated a new API token: %s\n", token)
+			fmt.Println("Send it as 'Authorization: Bearer <token>'. It is saved in the config directory and reused next time.")
+		}
+		auth := &apiAuth{token: token, basic: basicUsers, trustHeader: *trustAuthHeader}
+		middleware = append(middleware, func(next http.Handler) http.Handler { return requireAuth(auth, next) })
+		serverAuth = true
+	}
+	if len(allWebhooks) > 0 {
+		secret, generated, err := webhookSecret(*webhookSecretFlag)
+		if err != nil {
+			fatal(fmt.Errorf("setting up the webhook secret: %w", err))
+		}
+		if generated {
+			fmt.Printf("Generated a new webhook secret: %s\n", secret)
+			fmt.Println("Webhooks are signed with it in the X-Auther-Signature header. It is saved in the config directory and reused next time.")
+		}
+		startWebhooks(webhookURLs, eventWebhooks, secret)
+	}
+
+	// Health checks and the web UI's static files stay outside authentication,
+	// so probes and browsers can load them without the token.
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", handleHealthz)
+	root.HandleFunc("/readyz", handleReadyz)
+	middleware = append(middleware,
+		func(next http.Handler) http.Handler { return auditRequests(*trustProxy, next) },
+		func(next http.Handler) http.Handler { return limitRate(limits, next) })
+	api := apiMux{mux: root, middleware: func(h http.Handler) http.Handler {
+		for _, m := range middleware {
+			h = m(h)
+		}
+		return h
+	}}
+	api.register(apiV1, v1Routes(), nil)
+	root.HandleFunc(apiV1+"/", unknownAPIPath)
+	if *legacyRoutes {
+		api.register("", v1Routes(), deprecatedRoute)
+	}
+	root.Handle("/", webUI())
+
+	var logOut io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			fatal(fmt.Errorf("opening the log file: %w", err))
+		}
+		defer f.Close()
+		logOut = f
+	}
+	// From here on warnings and errors go with the access log, with the
+	// time in front.
+	setupLogging(logOut, *logFormat == logFormatJSON, true)
+	if !options.verbose {
+		// Reloads of the data file are logged too.
+		logLevel.Set(slog.LevelInfo)
+	}
+	if ip := net.ParseIP(host); *trustAuthHeader != "" && *socket == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		slog.Warn("--trust-auth-header lets anyone who can reach the server claim to be any user; make sure only the reverse proxy can", "address", addr, "header", *trustAuthHeader)
+	}
+	reloadOnSIGHUP()
+	if *watch {
+		if err := watchDataFile(); err != nil {
+			fatal(fmt.Errorf("watching the data file: %w", err))
+		}
+	}
+	// The clock is checked right away, so a skewed clock is logged at
+	// startup rather than with the first code.
+	go clockNow()
+
+	ln, err := systemdListener()
+	switch {
+	case err != nil:
+		fatal(fmt.Errorf("using the socket systemd passed: %w", err))
+	case ln != nil:
+		// Socket activation: the socket unit decides where serve listens.
+		if ln.Addr().Network() == "unix" {
+			*socket = ln.Addr().String()
+		} else {
+			addr = ln.Addr().String()
+		}
+		slog.Debug("using the socket systemd passed", "address", ln.Addr())
+	case *socket != "":
+		if ln, err = listenUnix(*socket); err != nil {
+			fatal(fmt.Errorf("can't listen on %s: %w", *socket, err))
+		}
+	default:
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			if errors.Is(err, syscall.EADDRINUSE) {
+				fatal(fmt.Errorf("can't listen on %s because the address is already in use; choose another port with --port", addr))
+			}
+			fatal(fmt.Errorf("can't listen on %s: %w", addr, err))
+		}
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+		ln = tls.NewListener(ln, tlsConfig)
+		if *tlsSelfSigned {
+			fmt.Printf("Using a self-signed certificate with SHA-256 fingerprint %s\n", certFingerprint(tlsConfig.Certificates[0]))
+		}
+	}
+
+	if *socket != "" {
+		fmt.Printf("Serving %s on unix socket %s\n", scheme, *socket)
+	} else {
+		if !isLoopback(addr) {
+			slog.Warn(fmt.Sprintf("listening on %s, which other machines on the network can reach.", addr))
+			if *noAuth {
+				slog.Warn("authentication is off, so anyone who can connect can read every TOTP secret.")
+			}
+			if tlsConfig == nil {
+				slog.Warn("TLS is off, so tokens and secrets cross the network in plain text.")
+			}
+		}
+		fmt.Printf("Serving on %s://%s (open it in a browser for the web UI)\n", scheme, addr)
+	}
+	listening := addr
+	if *socket != "" {
+		listening = "unix:" + *socket
+	}
+	if err := writeServeInstance(listening); err != nil {
+		fatal(fmt.Errorf("writing the PID file: %w", err))
+	}
+	serverStarted = time.Now()
+
+	server := &http.Server{
+		Handler:           logRequests(logOut, *logFormat, recoverPanics(allowCORS(corsOrigins, limitRequestBody(root)))),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	server.RegisterOnShutdown(endStreams)
+	// The listener is bound, so requests are taken from here on.
+	notifySystemd("READY=1\nSTATUS=Serving on " + ln.Addr().String())
+	startWatchdog()
+	serveUntilSignal(server, ln)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	stopWebhooks(ctx)
+}
+
+// Server limits. Requests are small JSON documents, so anything bigger than
+// maxRequestBody is rejected, and shutdown waits at most shutdownTimeout for
+// requests in flight.
+const (
+	maxRequestBody  = 1 << 20
+	shutdownTimeout = 10 * time.Second
+)
+
+// limitRequestBody caps request bodies at maxRequestBody bytes.
+func limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveUntilSignal serves on ln until SIGINT or SIGTERM arrives, or until
+// serve --stop asks on Windows. It then stops accepting connections and lets
+// requests in flight, including writes to the data file, finish before
+// returning.
+func serveUntilSignal(server *http.Server, ln net.Listener) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopRequested := stopRequests()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-errc:
+		fatal(err)
+	case <-ctx.Done():
+	case <-stopRequested:
+	}
+	// A second signal kills the process the usual way.
+	stop()
+
+	fmt.Println("Shutting down...")
+	notifySystemd("STOPPING=1")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutting down", "err", err)
+	}
+}
+
+// listenAddr combines --bind and --port. AUTHER_ADDR (host:port) is used
+// when neither flag was given.
+func listenAddr(fs *flag.FlagSet, bind string, port int) (string, error) {
+	if env := os.Getenv("AUTHER_ADDR"); env != "" && !flagsGiven(fs, "bind", "port") {
+		if _, _, err := net.SplitHostPort(env); err != nil {
+			return "", fmt.Errorf("invalid AUTHER_ADDR %q: %v", env, err)
+		}
+		return env, nil
+	}
+
+	if port < 0 || port > 65535 {
+		return "", fmt.Errorf("invalid port %d", port)
+	}
+	return net.JoinHostPort(bind, strconv.Itoa(port)), nil
+}
+
+// isLoopback reports whether addr only accepts connections from this
+// machine. An empty host listens on every interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// getTOTPsHTTP serves GET /totps: the entries, their codes with
+// ?codes=true, or a stream of their codes to EventSource clients.
+func getTOTPsHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case wantsEventStream(r):
+		streamAllCodesHTTP(w, r)
+	case r.URL.Query().Get("codes") == "true":
+		batchCodesHTTP(w, r)
+	default:
+		listEntriesHTTP(w, r)
 	}
 }
 
 // HTTP-specific functions
 
+// entryView is an entry as listed over HTTP, without its secret.
+type entryView struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type,omitempty"`
+	Issuer    string   `json:"issuer,omitempty"`
+	Account   string   `json:"account,omitempty"`
+	Algorithm string   `json:"algorithm"`
+	Digits    int      `json:"digits"`
+	Period    int64    `json:"period"`
+	Tags      []string `json:"tags,omitempty"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Pin       int      `json:"pin,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at,omitzero"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	Uses       int       `json:"uses,omitempty"`
+}
+
+func newEntryView(e TOTPEntry) entryView {
+	return entryView{
+		Name:       e.Name,
+		Type:       e.Type,
+		Issuer:     e.Issuer,
+		Account:    e.Account,
+		Algorithm:  e.CodeAlgorithm(),
+		Digits:     e.CodeDigits(),
+		Period:     e.CodePeriod(),
+		Tags:       e.Tags,
+		Aliases:    e.Aliases,
+		Pin:        e.Pin,
+		CreatedAt:  e.CreatedAt,
+		LastUsedAt: e.LastUsedAt,
+		Uses:       e.Uses,
+	}
+}
+
+// entryURL is the path of an entry's resource.
+func entryURL(name string) string {
+	return apiV1 + "/totps/" + url.PathEscape(name)
+}
+
 func listEntriesHTTP(w http.ResponseWriter, r *http.Request) {
-	data := loadData()
+	entries := filterByTag(scopeEntries(r, serverStore.List()), r.URL.Query().Get("tag"))
+
+	if r.URL.Query().Get("include_secrets") == "true" {
+		if !serverAuth {
+			writeJSONError(w, http.StatusForbidden, "include_secrets requires token authentication")
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
 
-	json.NewEncoder(w).Encode(data.Entries)
+	views := []entryView{}
+	for _, entry := range entries {
+		views = append(views, newEntryView(entry))
+	}
+	writeJSON(w, http.StatusOK, views)
 }
 
 func createEntryHTTP(w http.ResponseWriter, r *http.Request) {
 	var entry TOTPEntry
-	err := json.NewDecoder(r.Body).Decode(&entry)
-	if err != nil || entry.Name == "" || entry.Secret == "" {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+	if !decodeJSONBody(w, r, &entry) {
+		return
+	}
+	noteAudit(r).entry = entry.Name
+	if entry.Name == "" || entry.Secret == "" {
+		writeJSONError(w, http.StatusBadRequest, "name and secret are required")
+		return
+	}
+	if err := entry.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return
+	}
+
+	switch err := serverStore.Add(entry); {
+	case err == nil:
+	case errors.Is(err, auther.ErrExists):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		writeServerError(w, err)
 		return
 	}
 
-	createEntry(entry.Name, entry.Secret)
-	fmt.Fprintf(w, "TOTP entry '%s' created successfully.\n", entry.Name)
+	notifyWebhooks(webhookCreated, webhookEntry(entry))
+	w.Header().Set("Location", entryURL(entry.Name))
+	writeJSON(w, http.StatusCreated, newEntryView(entry))
 }
 
-func getCodeHTTP(w http.ResponseWriter, r *http.Request, name string) {
-	data := loadData()
+// decodeJSONBody decodes the request body into v. On failure it writes the
+// error response and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
 
-	for _, entry := range data.Entries {
-		if entry.Name == name {
-			// Generate the current TOTP code
-			code, err := totp.GenerateCode(entry.Secret, time.Now())
-			if err != nil {
-				http.Error(w, "Error generating TOTP code", http.StatusInternalServerError)
-				return
-			}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+	} else {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+	return false
+}
 
-			// Calculate time remaining in the current period
-			remaining := 30 - (time.Now().Unix() % 30)
+// writeJSON writes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
 
-			response := map[string]interface{}{
-				"code":       code,
-				"expires_in": remaining,
-			}
-			json.NewEncoder(w).Encode(response)
+// writeJSONError writes an error response such as
+// {"error": "not_found", "message": "no entry found with that name"}. The
+// error field is a stable code derived from the status; the message is meant
+// for people.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	writeJSON(w, status, map[string]string{"error": code, "message": message})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// writeServerError logs err and answers with a 500, so a bad data file or a
+// failed write only fails the request instead of stopping the server.
+func writeServerError(w http.ResponseWriter, err error) {
+	slog.Error(err.Error())
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
+
+func getCodeHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	entry, ok := serverStore.Get(name)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, auther.ErrNotFound.Error())
+		return
+	}
+	if !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return
+	}
+
+	q, err := parseCodeQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.peek {
+		noteAudit(r).detail = "peek"
+	}
+
+	result, err := generateCodes(entry, q)
+	if wait := q.freshWait(result.ExpiresIn); err == nil && wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		result, err = generateCodes(entry, q)
+	}
+	if err != nil {
+		writeServerError(w, fmt.Errorf("generating code for %s: %w", entry.Name, err))
+		return
+	}
+	if !q.peek && q.at.IsZero() && !serverReadOnly {
+		if err := serverStore.MarkUsed(entry.Name); err != nil && !errors.Is(err, auther.ErrNotFound) {
+			writeServerError(w, fmt.Errorf("recording the use of %s: %w", entry.Name, err))
 			return
 		}
 	}
 
-	http.Error(w, "No entry found with that name.", http.StatusNotFound)
+	response := map[string]interface{}{
+		"code":       result.Code,
+		"expires_in": result.ExpiresIn,
+		"next_code":  result.NextCode,
+	}
+	if result.ValidFrom != "" {
+		response["valid_from"] = result.ValidFrom
+		response["valid_until"] = result.ValidUntil
+	}
+	if result.Upcoming != nil {
+		response["upcoming"] = result.Upcoming
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
-func removeEntryHTTP(w http.ResponseWriter, r *http.Request, name string) {
-	data := loadData()
-
-	// Find the entry and remove it
-	found := false
-	newEntries := []TOTPEntry{}
-	for _, entry := range data.Entries {
-		if entry.Name != name {
-			newEntries = append(newEntries, entry)
-		} else {
-			found = true
+func renameEntryHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if body.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	noteAudit(r).detail = "to " + body.Name
+	if !changeInScope(w, r, name) {
+		return
+	}
+
+	switch err := serverStore.Rename(name, body.Name, false); {
+	case err == nil:
+	case errors.Is(err, auther.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, auther.ErrExists):
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		writeServerError(w, err)
+		return
+	}
+
+	entry, _ := serverStore.Get(body.Name)
+	if body.Name != name {
+		payload := webhookEntry(entry)
+		payload.PreviousName = name
+		notifyWebhooks(webhookUpdated, payload)
+	}
+	w.Header().Set("Location", entryURL(entry.Name))
+	writeJSON(w, http.StatusOK, newEntryView(entry))
+}
+
+// updateEntryHTTP changes the fields given in the body and leaves the rest of
+// the entry as it was. Renaming is left to PATCH.
+func updateEntryHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	var body struct {
+		Name      *string   `json:"name"`
+		Secret    *string   `json:"secret"`
+		Issuer    *string   `json:"issuer"`
+		Account   *string   `json:"account"`
+		Algorithm *string   `json:"algorithm"`
+		Digits    *int      `json:"digits"`
+		Period    *int      `json:"period"`
+		Tags      *[]string `json:"tags"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if body.Name != nil && *body.Name != name {
+		writeJSONError(w, http.StatusBadRequest, "PUT can't rename an entry; send PATCH "+entryURL(name)+` with {"name": "..."} instead`)
+		return
+	}
+	if !changeInScope(w, r, name) {
+		return
+	}
+	// Nor may a token limited to tags take the entry out of its reach.
+	if body.Tags != nil {
+		var retagged TOTPEntry
+		retagged.AddTags(*body.Tags)
+		if !inScope(r, retagged) {
+			writeOutOfScope(w, r)
+			return
 		}
 	}
 
-	if !found {
-		http.Error(w, "No entry found with that name.", http.StatusNotFound)
+	entry, err := serverStore.Edit(name, func(entry *TOTPEntry) {
+		if body.Secret != nil {
+			entry.Secret = *body.Secret
+		}
+		if body.Issuer != nil {
+			entry.Issuer = *body.Issuer
+		}
+		if body.Account != nil {
+			entry.Account = *body.Account
+		}
+		if body.Algorithm != nil {
+			entry.Algorithm = *body.Algorithm
+		}
+		if body.Digits != nil {
+			entry.Digits = *body.Digits
+		}
+		if body.Period != nil {
+			entry.Period = *body.Period
+		}
+		if body.Tags != nil {
+			entry.Tags = nil
+			entry.AddTags(*body.Tags)
+		}
+	})
+
+	var invalid auther.InvalidEntryError
+	switch {
+	case err == nil:
+	case errors.Is(err, auther.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.As(err, &invalid):
+		writeJSONError(w, http.StatusBadRequest, invalid.Err.Error())
+		return
+	default:
+		writeServerError(w, err)
 		return
 	}
 
-	// Save the updated entries back to the JSON file
-	data.Entries = newEntries
-	saveData(data)
+	notifyWebhooks(webhookUpdated, webhookEntry(entry))
+	writeJSON(w, http.StatusOK, newEntryView(entry))
+}
+
+// removeEntryHTTP moves the entry to the trash, or deletes it for good with
+// ?purge=true.
+func removeEntryHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	purge := r.URL.Query().Get("purge") == "true"
+	remove := serverStore.MoveToTrash
+	if purge {
+		remove = serverStore.Remove
+		noteAudit(r).detail = "purged"
+	}
+	if !changeInScope(w, r, name) {
+		return
+	}
+	entry, _ := serverStore.Get(name)
+	switch err := remove(name); err {
+	case nil:
+	case auther.ErrNotFound:
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	default:
+		writeServerError(w, err)
+		return
+	}
 
-	fmt.Fprintf(w, "Entry '%s' has been removed.\n", name)
+	payload := webhookEntry(entry)
+	if payload.Name == "" {
+		payload.Name = name
+	}
+	payload.Trashed = !purge
+	notifyWebhooks(webhookDeleted, payload)
+
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "deleted": true, "trashed": !purge})
 }
 
-func createEntry(name, secret string) {
-	data := loadData()
+// createEntry validates newEntry and adds it, through the server with
+// --remote. A taken name fails with an auther.ConflictError, or with
+// auther.ErrExists from a server.
+func createEntry(newEntry TOTPEntry) error {
+	if err := newEntry.Validate(); err != nil {
+		return auther.InvalidEntryError{Err: err}
+	}
+	return openEntryStore().Add(newEntry)
+}
 
-	for _, entry := range data.Entries {
-		if entry.Name == name {
-			fmt.Println("Entry with this name already exists.")
-			return
-		}
+// addEntry creates newEntry for create and add-uri and reports the outcome.
+func addEntry(newEntry TOTPEntry) {
+	var invalid auther.InvalidEntryError
+	switch err := createEntry(newEntry); {
+	case err == nil:
+		logAudit("create", newEntry.Name, auditOK)
+	case errors.As(err, &invalid):
+		logAudit("create", newEntry.Name, auditFailed)
+		reportErrorf("Invalid entry: %v", invalid.Err)
+		os.Exit(1)
+	case errors.Is(err, auther.ErrExists):
+		logAudit("create", newEntry.Name, auditFailed)
+		reportErrorf("%s", conflictMessage(err, newEntry.Name))
+		os.Exit(1)
+	default:
+		fatal(err)
 	}
 
-	data.Entries = append(data.Entries, TOTPEntry{Name: name, Secret: secret})
-	saveData(data)
+	if options.json {
+		printJSON(map[string]any{"name": newEntry.Name, "created": true})
+		return
+	}
 	fmt.Println("Entry created successfully!")
 }
 
-func createEntryInteractive() {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter name: ")
-	name, _ := reader.ReadString('\n')
+// conflictMessage describes the conflict err reports for name, naming the
+// entry that has the name if it is written differently.
+func conflictMessage(err error, name string) string {
+	var conflict auther.ConflictError
+	if errors.As(err, &conflict) && conflict.Alias {
+		return fmt.Sprintf("'%s' is an alias of the entry '%s'.", conflict.Name, conflict.Existing)
+	}
+	if errors.As(err, &conflict) && conflict.Existing != name {
+		return fmt.Sprintf("The name '%s' is taken by the entry '%s', as names are compared without regard to case.", name, conflict.Existing)
+	}
+	return fmt.Sprintf("An entry named '%s' already exists.", name)
+}
+
+// readSecretLine reads exactly one line from stdin, for --secret-stdin.
+func readSecretLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		if err == io.EOF {
+			return "", errors.New("no secret on stdin")
+		}
+		return "", fmt.Errorf("reading secret from stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readEntryInteractive() TOTPEntry {
+	promptf("Enter name: ")
+	name, _ := stdin.ReadString('\n')
 	name = strings.TrimSpace(name)
 
-	fmt.Print("Enter TOTP secret: ")
-	secret, _ := reader.ReadString('\n')
-	secret = strings.TrimSpace(secret)
+	// The secret isn't echoed, so it stays out of scrollback and recordings.
+	promptf("Enter TOTP secret: ")
+	secret, _ := readHiddenLine()
+
+	return TOTPEntry{Name: name, Secret: strings.TrimSpace(string(secret))}
+}
 
-	createEntry(name, secret)
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
 }
 
-func listEntries() {
-	data := loadData()
+// confirm asks a yes/no question on stderr and defaults to no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// listFilter picks the entries list shows: those with tag, if set, that are
+// pinned, if pinned is set, and whose name passes match, if set.
+type listFilter struct {
+	tag    string
+	pinned bool
+	match  func(name string) bool
+}
 
-	if len(data.Entries) == 0 {
+// listEntries prints the codes of the entries that pass filter and returns
+// them in the order printed.
+func listEntries(filter listFilter, long bool, sortBy string, format *template.Template) []codeResult {
+	var results []codeResult
+	if remoteAddress() != "" {
+		results = remoteCodes(filter.tag)
+	} else {
+		results = localCodes(filter.tag)
+	}
+	results = slices.DeleteFunc(results, func(r codeResult) bool {
+		return (filter.pinned && r.Pin == 0) || (filter.match != nil && !filter.match(r.Name))
+	})
+	sortResults(results, sortBy)
+
+	switch {
+	case options.json:
+		printJSON(results)
+	case format != nil:
+		for _, result := range results {
+			printFormatted(format, result)
+		}
+	case len(results) == 0:
 		fmt.Println("No entries found.")
-		return
+	case long:
+		printLongList(results)
+	default:
+		printCodeTable(results)
 	}
+	return results
+}
 
-	fmt.Println("Stored TOTP entries:")
-	for _, entry := range data.Entries {
-		// Generate the current TOTP code for each entry
-		code, err := totp.GenerateCode(entry.Secret, time.Now())
-		if err != nil {
-			log.Printf("Error generating TOTP code for %s: %v", entry.Name, err)
-			continue
+// printCodeTable prints list's table of codes. On a terminal the countdown
+// turns from green to yellow to red as the code runs out, and codes with
+// fewer than 5 seconds left are dimmed.
+func printCodeTable(results []codeResult) {
+	header := []string{"#", "NAME", "ISSUER", "CODE", "EXPIRES", "TAGS"}
+	rows := make([][]string, len(results))
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = len(h)
+	}
+	for i, result := range results {
+		issuer := result.Issuer
+		if result.Account != "" {
+			issuer = strings.TrimPrefix(issuer+": "+result.Account, ": ")
+		}
+		code := displayCode(result.Code)
+		if result.Error != "" {
+			code = "error"
+		}
+		entry := TOTPEntry{Tags: result.Tags}
+		rows[i] = []string{strconv.Itoa(i + 1), result.Name, issuer, code, "", strings.TrimSpace(tagLabel(entry))}
+		for j, cell := range rows[i] {
+			widths[j] = max(widths[j], utf8.RuneCountInString(cell))
+		}
+	}
+	widths[4] = max(widths[4], expiryBarWidth+5)
+
+	printRow := func(cells []string, styles []string) {
+		var sb strings.Builder
+		for j, cell := range cells {
+			if j > 0 {
+				sb.WriteString("  ")
+			}
+			if j < len(cells)-1 {
+				cell = padRight(cell, widths[j])
+			}
+			sb.WriteString(colorize(cell, styles[j]))
+		}
+		fmt.Println(strings.TrimRight(sb.String(), " "))
+	}
+
+	printRow(header, make([]string, len(header)))
+	for i, result := range results {
+		styles := make([]string, len(header))
+		if result.Error == "" {
+			rows[i][4] = expiryBar(result.ExpiresIn, result.Period)
+			styles[4] = expiryStyle(result.ExpiresIn)
+			if result.ExpiresIn < 5 {
+				styles[3] = styleDim
+			}
+		}
+		printRow(rows[i], styles)
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			slog.Error("generating a code", "entry", result.Name, "err", result.Error)
 		}
+	}
+}
 
-		// Calculate time remaining in the current period
-		remaining := 30 - (time.Now().Unix() % 30)
+const expiryBarWidth = 10
 
-		// Display the entry name, code, and time remaining
-		fmt.Printf(" - %s: %s (expires in %d seconds)\n", entry.Name, code, remaining)
+// expiryBar shows how much of a code's period is left, as a bar followed by
+// the seconds.
+func expiryBar(expiresIn, period int64) string {
+	if period <= 0 {
+		period = auther.DefaultPeriod
 	}
+	filled := int(min(max(expiresIn*expiryBarWidth/period, 0), expiryBarWidth))
+	return strings.Repeat("█", filled) + strings.Repeat("░", expiryBarWidth-filled) + fmt.Sprintf(" %3ds", expiresIn)
 }
 
-func removeEntry(name string) {
-	data := loadData()
+// expiryStyle colors a countdown by the seconds left.
+func expiryStyle(expiresIn int64) string {
+	switch {
+	case expiresIn <= 5:
+		return styleRed
+	case expiresIn <= 10:
+		return styleYellow
+	default:
+		return styleGreen
+	}
+}
 
-	// Find the entry and remove it
-	found := false
-	newEntries := []TOTPEntry{}
-	for _, entry := range data.Entries {
-		if entry.Name != name {
-			newEntries = append(newEntries, entry)
+// printLongList prints list --long: a table with when each entry was added
+// and last used.
+func printLongList(results []codeResult) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tNAME\tALIASES\tCODE\tEXPIRES\tADDED\tLAST USED\tTAGS")
+	for i, result := range results {
+		code, expires := displayCode(result.Code), fmt.Sprintf("%ds", result.ExpiresIn)
+		if result.Error != "" {
+			code, expires = "error", "-"
+		}
+		entry := TOTPEntry{Name: result.Name, Issuer: result.Issuer, Account: result.Account, Tags: result.Tags}
+		aliases := strings.Join(result.Aliases, ", ")
+		if aliases == "" {
+			aliases = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, entry.Name, describe(entry), aliases, code, expires,
+			formatStamp(result.CreatedAt, "unknown"), formatStamp(result.LastUsedAt, "never"), strings.TrimSpace(tagLabel(entry)))
+	}
+	tw.Flush()
+}
+
+// formatStamp formats an entry timestamp in local time, or returns zero for
+// one that was never recorded.
+func formatStamp(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// localCodes generates the current code of every entry in the data file with
+// the given tag, or all of them.
+func localCodes(tag string) []codeResult {
+	data := mustLoadData()
+
+	results := []codeResult{}
+	now := clockNow()
+	for _, entry := range filterByTag(data.Entries, tag) {
+		result := codeResult{Name: entry.Name, Issuer: entry.Issuer, Account: entry.Account, Tags: entry.Tags,
+			Aliases: entry.Aliases, Pin: entry.Pin, Period: entry.CodePeriod(), CreatedAt: entry.CreatedAt, LastUsedAt: entry.LastUsedAt}
+		if code, err := entry.Code(now); err != nil {
+			result.Error = err.Error()
 		} else {
-			found = true
+			result.Code, result.ExpiresIn = code, entry.ExpiresIn(now)
 		}
+		results = append(results, result)
 	}
+	return results
+}
 
-	if !found {
-		fmt.Printf("No entry found with the name: %s\n", name)
-		return
+// remoteCodes is localCodes for --remote, with the codes generated by the
+// server.
+func remoteCodes(tag string) []codeResult {
+	client := mustRemote()
+	entries, err := client.Entries(tag)
+	if err != nil {
+		fatal(err)
 	}
 
-	// Save the updated entries back to the JSON file
-	data.Entries = newEntries
-	saveData(data)
+	results := []codeResult{}
+	for _, entry := range entries {
+		result := codeResult{Name: entry.Name, Issuer: entry.Issuer, Account: entry.Account, Tags: entry.Tags,
+			Aliases: entry.Aliases, Pin: entry.Pin, Period: entry.CodePeriod(), CreatedAt: entry.CreatedAt, LastUsedAt: entry.LastUsedAt}
+		if codes, err := client.Codes(entry, codeQuery{peek: true}); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Code, result.ExpiresIn = codes.Code, codes.ExpiresIn
+		}
+		results = append(results, result)
+	}
+	return results
+}
 
-	fmt.Printf("Entry '%s' has been removed.\n", name)
+// refuseRemove exits when remove would have to ask for confirmation but
+// stdin isn't a terminal to answer it on.
+func refuseRemove() {
+	reportErrorf("Refusing to remove entries without confirmation because stdin is not a terminal. Use --yes to skip the prompt.")
+	os.Exit(1)
 }
 
-func getCode(name string) {
-	data := loadData()
+// removeResult is the JSON form of what remove did with one name.
+type removeResult struct {
+	Name    string `json:"name"`
+	Removed bool   `json:"removed"`
+	Trashed bool   `json:"trashed,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
 
-	for _, entry := range data.Entries {
-		if entry.Name == name {
-			// Generate the current TOTP code
-			currentTime := time.Now()
-			code, err := totp.GenerateCode(entry.Secret, currentTime)
-			if err != nil {
-				log.Fatalf("Error generating current TOTP code: %v", err)
-			}
+func removeCommand(args []string) {
+	fs := newFlagSet("remove", "remove [name...] | --glob pattern | --regex pattern [--yes] [--purge]")
+	var yes bool
+	fs.BoolVar(&yes, "yes", false, "remove without asking for confirmation")
+	fs.BoolVar(&yes, "f", false, "shorthand for --yes")
+	purge := fs.Bool("purge", false, "delete the entries for good instead of moving them to the trash")
+	glob, regex := matchFlags(fs)
+	names, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	match := mustNameMatcher(*glob, *regex)
+	if (len(names) == 0) == (match == nil) {
+		fmt.Fprintln(os.Stderr, "Usage: authinator remove [name...] | --glob pattern | --regex pattern [--yes] [--purge]")
+		os.Exit(2)
+	}
+	if match != nil {
+		removeMatching(match, yes, *purge)
+		return
+	}
+	if !yes && !isTerminal(os.Stdin) {
+		refuseRemove()
+	}
 
-			// Calculate time remaining in the current period
-			remaining := 30 - (currentTime.Unix() % 30)
-			fmt.Printf("Your current TOTP code is: %s (Time remaining: %d seconds)\n", code, remaining)
+	store := openEntryStore()
+	remove, done := store.MoveToTrash, "moved to the trash"
+	if *purge {
+		remove, done = store.Remove, "deleted for good"
+	}
 
-			// Generate the next TOTP code
-			nextTime := currentTime.Add(time.Duration(remaining) * time.Second)
-			nextCode, err := totp.GenerateCode(entry.Secret, nextTime)
-			if err != nil {
-				log.Fatalf("Error generating next TOTP code: %v", err)
-			}
-			fmt.Printf("After this, your next TOTP code will be: %s\n", nextCode)
+	var results []removeResult
 
-			// Copy the current code to clipboard
-			if err := clipboard.Write(clipboard.FmtText, []byte(code)); err != nil {
-				log.Printf("Failed to copy code to clipboard: %v", err)
-			} else {
-				fmt.Println("Current code copied to clipboard.")
+	missing := false
+	for _, name := range names {
+		if _, ok := store.Get(name); !ok {
+			logAudit("remove", name, auditNotFound)
+			results = append(results, removeResult{Name: name, Error: auther.ErrNotFound.Error()})
+			if !options.json {
+				fmt.Fprintf(os.Stderr, "No entry found with the name: %s\n", name)
 			}
-			return
+			missing = true
+			continue
+		}
+		if !yes && !confirm(fmt.Sprintf("Remove entry '%s'?", name)) {
+			results = append(results, removeResult{Name: name})
+			if !options.json {
+				fmt.Printf("Entry '%s' was kept.\n", name)
+			}
+			continue
+		}
+
+		if err := remove(name); err != nil {
+			fatal(err)
+		}
+		logRemoved(name, *purge)
+		results = append(results, removeResult{Name: name, Removed: true, Trashed: !*purge})
+		if !options.json {
+			fmt.Printf("Entry '%s' has been %s.\n", name, done)
 		}
 	}
 
-	fmt.Println("No entry found with that name.")
+	if options.json {
+		printJSON(results)
+	}
+	if missing {
+		os.Exit(1)
+	}
 }
 
-func loadData() TOTPData {
-	data := TOTPData{}
-	if _, err := os.Stat(dataFile); err == nil {
-		file, err := os.Open(dataFile)
-		if err != nil {
-			log.Fatalf("Error reading data file: %v", err)
+func renameCommand(args []string) {
+	fs := newFlagSet("rename", "rename [old] [new] [--force]")
+	force := fs.Bool("force", false, "replace an existing entry with the new name")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator rename [old] [new] [--force]")
+		os.Exit(2)
+	}
+
+	err = mustOpenStore().Rename(args[0], args[1], *force)
+	switch {
+	case err == nil:
+		logAuditDetail("rename", args[0], auditOK, "to "+args[1])
+	case errors.Is(err, auther.ErrNotFound):
+		logAudit("rename", args[0], auditNotFound)
+		reportErrorf("No entry found with the name: %s", args[0])
+		os.Exit(exitNotFound)
+	case errors.Is(err, auther.ErrExists):
+		logAuditDetail("rename", args[0], auditFailed, "to "+args[1])
+		var conflict auther.ConflictError
+		if errors.As(err, &conflict) && conflict.Alias {
+			reportErrorf("%s", conflictMessage(err, args[1]))
+		} else {
+			reportErrorf("%s Use --force to replace it.", conflictMessage(err, args[1]))
+		}
+		os.Exit(1)
+	default:
+		fatal(err)
+	}
+
+	fmt.Printf("Entry '%s' has been renamed to '%s'.\n", args[0], args[1])
+}
+
+// Exit statuses for looking up a code, so scripts can tell a missing entry
+// apart from one that can't produce a code, or a code that couldn't be
+// copied.
+const (
+	exitNotFound    = 1
+	exitCodeGen     = 2
+	exitNoClipboard = 3
+)
+
+// getCode prints the codes described by q for the entry matching name. When
+// several entries match, someone at a terminal gets to pick one.
+func getCode(name string, exact bool, out codeOutput, q codeQuery) {
+	quiet := out.quiet || out.format != nil
+	data := loadCodeData()
+	matches := resolveEntry(data, name, exact)
+	if len(matches) == 0 {
+		if quiet {
+			fmt.Fprintln(os.Stderr, "No entry found with that name.")
+		} else {
+			reportErrorf("No entry found with that name.")
+		}
+		os.Exit(exitNotFound)
+	}
+	entry := matches[0]
+	if len(matches) > 1 {
+		if quiet || options.json || !isTerminal(os.Stdin) {
+			printCandidates(name, matches)
+			os.Exit(exitNotFound)
 		}
-		defer file.Close()
+		fmt.Printf("'%s' matches several entries:\n", name)
+		entry = mustPickEntry(matches)
+	}
+	showCode(data, entry, out, q)
+}
+
+// loadCodeData loads the entries to look names up in, from the server with
+// --remote.
+func loadCodeData() TOTPData {
+	if remoteAddress() == "" {
+		return mustLoadData()
+	}
+	entries, err := mustRemote().Entries("")
+	if err != nil {
+		fatal(err)
+	}
+	return TOTPData{Entries: entries}
+}
+
+// showCode prints the codes described by q for entry, one of data's entries.
+func showCode(data TOTPData, entry TOTPEntry, out codeOutput, q codeQuery) {
+	result := mustFreshCodes(data, entry, q)
+
+	switch {
+	case out.format != nil:
+		result.Issuer, result.Account, result.Tags, result.Period = entry.Issuer, entry.Account, entry.Tags, entry.CodePeriod()
+		printFormatted(out.format, result)
+	case out.quiet:
+		fmt.Println(result.Code)
+		for _, u := range result.Upcoming {
+			fmt.Println(u.Code)
+		}
+	}
+	if out.format != nil || out.quiet {
+		if out.copy {
+			copyToClipboard(result.Code)
+		}
+		return
+	}
+
+	if options.json {
+		copyToClipboard(result.Code)
+		printJSON(result)
+		return
+	}
+
+	switch {
+	case !q.at.IsZero():
+		printCodeAt(result, q.at)
+	case result.Upcoming != nil:
+		fmt.Printf("Your current TOTP code is: %s (Time remaining: %d seconds)\n", displayCode(result.Code), result.ExpiresIn)
+	default:
+		fmt.Printf("Your current TOTP code is: %s (Time remaining: %d seconds)\n", displayCode(result.Code), result.ExpiresIn)
+		fmt.Printf("After this, your next TOTP code will be: %s\n", displayCode(result.NextCode))
+	}
+	printUpcoming(result.Upcoming)
+
+	// Copy the current code to clipboard
+	reportCopy(copyToClipboard(result.Code))
+}
 
-		content, err := io.ReadAll(file)
+// mustFreshCodes generates the codes described by q for entry, one of data's
+// entries, or has the server generate them with --remote. If the current
+// code expires sooner than q.minValidity, it waits for the next one. Current
+// codes count as a use of the entry.
+func mustFreshCodes(data TOTPData, entry TOTPEntry, q codeQuery) codeResult {
+	codes := func() codeResult {
+		if remoteAddress() != "" {
+			result, err := mustRemote().Codes(entry, q)
+			if err != nil {
+				fatal(err)
+			}
+			return result
+		}
+		result, err := generateCodes(entry, q)
 		if err != nil {
-			log.Fatalf("Error reading file content: %v", err)
+			fail(exitCodeGen, err)
 		}
+		return result
+	}
+	result := codes()
+	if wait := q.freshWait(result.ExpiresIn); wait > 0 {
+		fmt.Fprintf(os.Stderr, "Waiting %ds for a fresh code…\n", result.ExpiresIn)
+		time.Sleep(wait)
+		result = codes()
+	}
+	switch {
+	case remoteAddress() != "":
+	case q.at.IsZero():
+		markUsed(data, entry.Name)
+	default:
+		logAuditDetail("code", entry.Name, auditOK, "at "+q.at.Format(time.RFC3339))
+	}
+	return result
+}
 
-		if err := json.Unmarshal(content, &data); err != nil {
-			log.Fatalf("Error parsing data file: %v", err)
+// markUsed records that a code of each named entry was just requested. The
+// codes have already been generated, so failing to save only gets a warning.
+func markUsed(data TOTPData, names ...string) {
+	now := time.Now()
+	var used []string
+	for _, name := range names {
+		if data.MarkUsed(name, now) == nil {
+			used = append(used, name)
+			logAudit("code", name, auditOK)
 		}
 	}
-	return data
+	if len(used) == 0 {
+		return
+	}
+	if err := mustOpenBackend().Save(data); err != nil {
+		slog.Warn(fmt.Sprintf("couldn't record the use of %s", strings.Join(used, ", ")), "err", err)
+	}
 }
 
-func saveData(data TOTPData) {
-	file, err := json.MarshalIndent(data, "", "  ")
+// entryCodes generates the entry's code for the period containing t along
+// with the one that follows it.
+func entryCodes(entry TOTPEntry, t time.Time) (codeResult, error) {
+	code, err := entry.Code(t)
+	if err != nil {
+		return codeResult{}, fmt.Errorf("generating current TOTP code: %w", err)
+	}
+
+	// Calculate time remaining in the current period
+	remaining := entry.ExpiresIn(t)
+
+	nextCode, err := entry.Code(t.Add(time.Duration(remaining) * time.Second))
 	if err != nil {
-		log.Fatalf("Error saving data: %v", err)
+		return codeResult{}, fmt.Errorf("generating next TOTP code: %w", err)
 	}
-	err = os.WriteFile(dataFile, file, 0644)
+	return codeResult{Name: entry.Name, Code: code, ExpiresIn: remaining, NextCode: nextCode}, nil
+}
+
+// mustLoadData loads the data file for a CLI command, exiting if it can't be
+// read.
+func mustLoadData() TOTPData {
+	data, err := mustOpenBackend().Load()
 	if err != nil {
-		log.Fatalf("Error writing data file: %v", err)
+		fatal(err)
+	}
+	return data
+}
+
+// mustSaveData saves the data file for a CLI command, exiting if it can't be
+// written.
+func mustSaveData(data TOTPData) {
+	if err := mustOpenBackend().Save(data); err != nil {
+		fatal(err)
 	}
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"authinator/pkg/auther"
+)
+
+// failingSaves is a backend whose saves fail, like a full disk.
+type failingSaves struct {
+	auther.Backend
+}
+
+func (failingSaves) Save(auther.Vault) error {
+	return errors.New("no space left on device")
+}
+
+func TestServerSurvivesFailedSaves(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "github"})
+	store, err := auther.OpenBackend(failingSaves{auther.NewFileBackend(dataPath, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverStore = store
+
+	changes := []struct{ method, path, body string }{
+		{"POST", "/v1/totps", `{"name": "gitlab", "secret": "` + testSecret + `"}`},
+		{"PUT", "/v1/totps/github", `{"issuer": "GitHub"}`},
+		{"PATCH", "/v1/totps/github", `{"name": "hub"}`},
+		{"DELETE", "/v1/totps/github", ""},
+	}
+	for _, c := range changes {
+		w := request(h, c.method, c.path, testToken, c.body)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s %s: status %d, want 500: %s", c.method, c.path, w.Code, w.Body)
+		}
+		var body map[string]string
+		decodeBody(t, w, &body)
+		if body["error"] != "internal_server_error" || body["message"] == "" {
+			t.Errorf("%s %s: body %v", c.method, c.path, body)
+		}
+	}
+
+	// The entries are as they were, and still served.
+	w := request(h, "GET", "/v1/totps/github?peek=true", testToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET after failed saves: status %d: %s", w.Code, w.Body)
+	}
+	if entries := serverStore.List(); len(entries) != 1 || entries[0].Name != "github" || entries[0].Issuer != "" {
+		t.Errorf("entries after failed saves: %+v", entries)
+	}
+}
+
+func TestServerSurvivesBadDataFile(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "github"})
+	if err := os.WriteFile(dataPath, []byte(`{"entries": [`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := serverStore.Reload(); err == nil {
+		t.Error("reloading a corrupted data file succeeded")
+	}
+	w := httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz with a corrupted data file: status %d, want 503", w.Code)
+	}
+
+	// The entries loaded before are still served.
+	for _, path := range []string{"/v1/totps", "/v1/totps/github?peek=true"} {
+		if w := request(h, "GET", path, testToken, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	captureLog(t)
+	calls := 0
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("bad entry")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for _, want := range []int{http.StatusInternalServerError, http.StatusNoContent} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/totps", nil))
+		if w.Code != want {
+			t.Errorf("call %d: status %d, want %d", calls, w.Code, want)
+		}
+	}
+}
+
+func TestUpdateEntryHTTP(t *testing.T) {
+	tests := []struct {
+		name, path, body string
+		status           int
+	}{
+		{"issuer and digits", "/v1/totps/github", `{"issuer": "GitHub", "digits": 8, "tags": ["work"]}`, http.StatusOK},
+		{"secret", "/v1/totps/github", `{"secret": "` + importSecret + `"}`, http.StatusOK},
+		{"same name", "/v1/totps/github", `{"name": "github", "period": 60}`, http.StatusOK},
+		{"unknown name", "/v1/totps/missing", `{"issuer": "GitHub"}`, http.StatusNotFound},
+		{"invalid secret", "/v1/totps/github", `{"secret": "not base32!"}`, http.StatusBadRequest},
+		{"invalid digits", "/v1/totps/github", `{"digits": 12}`, http.StatusBadRequest},
+		{"invalid algorithm", "/v1/totps/github", `{"algorithm": "md5"}`, http.StatusBadRequest},
+		{"not JSON", "/v1/totps/github", `issuer=GitHub`, http.StatusBadRequest},
+		{"wrong type", "/v1/totps/github", `{"digits": "8"}`, http.StatusBadRequest},
+		{"rename", "/v1/totps/github", `{"name": "gitlab"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		h := newTestAPI(t, TOTPEntry{Name: "github"}, TOTPEntry{Name: "gitlab"})
+		w := request(h, "PUT", tt.path, testToken, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		entry, _ := serverStore.Get("github")
+		if tt.status != http.StatusOK {
+			if entry.Secret != testSecret || entry.Issuer != "" || entry.Digits != 0 || entry.Period != 0 {
+				t.Errorf("%s: the entry changed: %+v", tt.name, entry)
+			}
+			continue
+		}
+		var view map[string]any
+		decodeBody(t, w, &view)
+		if _, ok := view["secret"]; ok {
+			t.Errorf("%s: the response has the secret: %s", tt.name, w.Body)
+		}
+		if view["name"] != "github" {
+			t.Errorf("%s: response for %v", tt.name, view["name"])
+		}
+	}
+
+	h := newTestAPI(t, TOTPEntry{Name: "github"}, TOTPEntry{Name: "gitlab"})
+	request(h, "PUT", "/v1/totps/github", testToken, `{"issuer": "GitHub", "digits": 8, "tags": ["work"]}`)
+	if entry, _ := serverStore.Get("github"); entry.Issuer != "GitHub" || entry.Digits != 8 || !entry.HasTag("work") || entry.Secret != testSecret {
+		t.Errorf("after the update: %+v", entry)
+	}
+
+	// PUT points renames to PATCH, which refuses a name that is taken.
+	w := request(h, "PUT", "/v1/totps/github", testToken, `{"name": "gitlab"}`)
+	var resp struct{ Message string }
+	decodeBody(t, w, &resp)
+	if !strings.Contains(resp.Message, "PATCH /v1/totps/github") {
+		t.Errorf("PUT with another name: %q doesn't point to PATCH", resp.Message)
+	}
+	for _, name := range []string{"gitlab", "GitLab"} {
+		if w := request(h, "PATCH", "/v1/totps/github", testToken, `{"name": "`+name+`"}`); w.Code != http.StatusConflict {
+			t.Errorf("PATCH to %s: status %d, want 409: %s", name, w.Code, w.Body)
+		}
+	}
+	if _, ok := serverStore.Get("github"); !ok {
+		t.Error("github was renamed onto gitlab")
+	}
+}
+
+func TestListEntriesHTTPSecrets(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "github", Tags: []string{"work"}}, TOTPEntry{Name: "gitlab"})
+
+	for _, path := range []string{"/v1/totps", "/v1/totps?tag=work", "/v1/totps?include_secrets=false", "/v1/totps?include_secrets=1"} {
+		w := request(h, "GET", path, testToken, "")
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", path, w.Code, w.Body)
+			continue
+		}
+		var entries []map[string]any
+		decodeBody(t, w, &entries)
+		if len(entries) == 0 {
+			t.Errorf("GET %s: no entries", path)
+		}
+		for _, entry := range entries {
+			if _, ok := entry["secret"]; ok {
+				t.Errorf("GET %s: %v has its secret", path, entry["name"])
+			}
+		}
+		if strings.Contains(w.Body.String(), testSecret) {
+			t.Errorf("GET %s: the body holds a secret: %s", path, w.Body)
+		}
+	}
+
+	w := request(h, "GET", "/v1/totps?include_secrets=true", testToken, "")
+	var entries []map[string]any
+	decodeBody(t, w, &entries)
+	if len(entries) != 2 {
+		t.Fatalf("GET with include_secrets=true: %d entries", len(entries))
+	}
+	for _, entry := range entries {
+		if entry["secret"] != testSecret {
+			t.Errorf("GET with include_secrets=true: %v has secret %v", entry["name"], entry["secret"])
+		}
+	}
+
+	// Without token authentication, secrets are never sent.
+	serverAuth = false
+	if w := request(h, "GET", "/v1/totps?include_secrets=true", testToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("include_secrets=true without token authentication: status %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// matchFlags registers the --glob and --regex flags list and remove use to
+// pick entries by name.
+func matchFlags(fs *flag.FlagSet) (glob, regex *string) {
+	glob = fs.String("glob", "", "only entries whose name matches this pattern, such as 'legacy-*'")
+	regex = fs.String("regex", "", "only entries whose name matches this regular expression")
+	return glob, regex
+}
+
+// mustNameMatcher returns a test for entry names from --glob and --regex, or
+// nil if neither was given. It exits with status 2 if both were given or the
+// pattern is invalid.
+func mustNameMatcher(glob, regex string) func(name string) bool {
+	if glob != "" && regex != "" {
+		fmt.Fprintln(os.Stderr, "--glob and --regex can't be combined.")
+		os.Exit(2)
+	}
+	var re *regexp.Regexp
+	var err error
+	switch {
+	case glob != "":
+		re, err = globRegexp(glob)
+	case regex != "":
+		re, err = regexp.Compile(regex)
+	default:
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid pattern: %v\n", err)
+		os.Exit(2)
+	}
+	return re.MatchString
+}
+
+// globRegexp translates a shell-style glob into a regular expression that
+// matches whole names without regard to case, like name lookups. * matches
+// any run of characters, / included, ? any one character and [...] any of
+// those characters ([!...] any other); a backslash escapes the character
+// after it.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?i)^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 == len(glob) {
+				return nil, errors.New("glob ends with a lone backslash")
+			}
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in glob %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// removeMatching is remove with --glob or --regex: it lists the entries whose
+// name passes match and, once confirmed, removes them all at once, in a
+// single save of the data file.
+func removeMatching(match func(name string) bool, yes, purge bool) {
+	var names []string
+	for _, entry := range loadCodeData().Entries {
+		if match(entry.Name) {
+			names = append(names, entry.Name)
+		}
+	}
+	if len(names) == 0 {
+		if options.json {
+			printJSON([]removeResult{})
+			return
+		}
+		fmt.Println("No entries match the pattern; nothing was removed.")
+		return
+	}
+
+	if !options.json || !yes {
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s\n", name)
+		}
+	}
+	if !yes && !isTerminal(os.Stdin) {
+		refuseRemove()
+	}
+	if !yes && !confirm(fmt.Sprintf("Remove %s?", countEntries(len(names)))) {
+		fmt.Println("Nothing was removed.")
+		return
+	}
+
+	if remoteAddress() != "" {
+		store := openEntryStore()
+		remove := store.MoveToTrash
+		if purge {
+			remove = store.Remove
+		}
+		for _, name := range names {
+			if err := remove(name); err != nil {
+				fatal(err)
+			}
+		}
+	} else {
+		// Names are matched exactly, so of two names that only differ in
+		// case, only the one that matched is removed.
+		err := mustOpenStore().Update(func(v *TOTPData) error {
+			now := time.Now()
+			for _, name := range names {
+				i := exactIndex(*v, name)
+				if i < 0 {
+					continue
+				}
+				if !purge {
+					v.Trash = append(v.Trash, auther.TrashedEntry{Entry: v.Entries[i], DeletedAt: now})
+				}
+				v.Entries = slices.Delete(v.Entries, i, i+1)
+			}
+			v.ExpireTrash(now)
+			return nil
+		})
+		if err != nil {
+			fatal(err)
+		}
+	}
+	for _, name := range names {
+		logRemoved(name, purge)
+	}
+
+	if options.json {
+		results := make([]removeResult, len(names))
+		for i, name := range names {
+			results[i] = removeResult{Name: name, Removed: true, Trashed: !purge}
+		}
+		printJSON(results)
+		return
+	}
+	if purge {
+		fmt.Printf("Deleted %s for good.\n", countEntries(len(names)))
+	} else {
+		fmt.Printf("Moved %s to the trash.\n", countEntries(len(names)))
+	}
+}
+
+// countEntries puts a number of entries in words, such as "1 entry".
+func countEntries(n int) string {
+	if n == 1 {
+		return "1 entry"
+	}
+	return fmt.Sprintf("%d entries", n)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"time"
+)
+
+// statusRecorder remembers the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush passes flushes through for streaming responses.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Access log formats for --log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logRequests writes one access log line per request to out, as plain text
+// or as a JSON object. The access log is written whatever the log level;
+// with --verbose, more about each request is logged at debug level.
+func logRequests(out io.Writer, format string, next http.Handler) http.Handler {
+	logger := log.New(out, "", log.LstdFlags)
+	jsonLogger := slog.New(slog.NewJSONHandler(out, nil))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		slog.Debug("request", "method", r.Method, "path", r.URL.EscapedPath(), "proto", r.Proto,
+			"host", r.Host, "user_agent", r.UserAgent(), "content_length", r.ContentLength, "remote", r.RemoteAddr)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		duration := time.Since(start)
+
+		if format == logFormatJSON {
+			jsonLogger.Info("request",
+				"method", r.Method,
+				"path", r.URL.EscapedPath(),
+				"status", rec.status,
+				"duration_ms", float64(duration.Microseconds())/1000,
+				"remote", r.RemoteAddr)
+			return
+		}
+		logger.Printf("%s %s %d %s %s", r.Method, r.URL.EscapedPath(), rec.status, duration.Round(time.Microsecond), r.RemoteAddr)
+	})
+}
+
+// recoverPanics turns a panicking handler into a 500 response and logs the
+// stack, instead of dropping the connection without a trace.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			slog.Error("panic serving request", "method", r.Method, "path", r.URL.EscapedPath(),
+				"err", fmt.Sprint(err), "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				writeJSONError(rec, http.StatusInternalServerError, "internal error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// Methods and headers cross-origin callers may use with the API, and the
+// response headers their scripts may read.
+const (
+	corsMethods       = "GET, POST, PUT, PATCH, DELETE"
+	corsHeaders       = "Authorization, Content-Type"
+	corsExposeHeaders = "Location, Retry-After, Deprecation, Link"
+)
+
+// checkCORSOrigins validates --cors-origin values: "*" or an origin such as
+// https://dash.example.com, without a path.
+func checkCORSOrigins(origins []string) error {
+	for _, origin := range origins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid CORS origin %q: use scheme://host[:port], e.g. https://dash.example.com, or *", origin)
+		}
+	}
+	return nil
+}
+
+// allowCORS lets browser scripts from the given origins call the API. It
+// answers preflight requests itself, since they carry no API token. With no
+// origins it adds nothing at all.
+func allowCORS(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	allowed := map[string]bool{}
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+		switch {
+		case origin == "":
+			next.ServeHTTP(w, r)
+			return
+		case allowed["*"]:
+			h.Set("Access-Control-Allow-Origin", "*")
+		case allowed[origin]:
+			h.Set("Access-Control-Allow-Origin", origin)
+		case preflight:
+			writeJSONError(w, http.StatusForbidden, "origin not allowed")
+			return
+		default:
+			// The browser will withhold the response from the script.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", corsMethods)
+			h.Set("Access-Control-Allow-Headers", corsHeaders)
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
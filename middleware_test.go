@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAllowCORS(t *testing.T) {
+	const dash = "https://dash.example.com"
+	tests := []struct {
+		name      string
+		origins   []string
+		method    string
+		origin    string
+		preflight bool
+		status    int
+		allow     string // Access-Control-Allow-Origin
+		reached   bool   // whether the API handler ran
+	}{
+		{"preflight from an allowed origin", []string{dash}, "OPTIONS", dash, true, http.StatusNoContent, dash, false},
+		{"preflight from another origin", []string{dash}, "OPTIONS", "https://evil.example.com", true, http.StatusForbidden, "", false},
+		{"preflight with any origin allowed", []string{"*"}, "OPTIONS", "https://evil.example.com", true, http.StatusNoContent, "*", false},
+		{"request from an allowed origin", []string{dash}, "GET", dash, false, http.StatusOK, dash, true},
+		{"request from another origin", []string{dash}, "GET", "https://evil.example.com", false, http.StatusOK, "", true},
+		{"request without an origin", []string{dash}, "GET", "", false, http.StatusOK, "", true},
+		{"no origins allowed", nil, "GET", dash, false, http.StatusOK, "", true},
+	}
+	for _, tt := range tests {
+		reached := false
+		h := allowCORS(tt.origins, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+		r := newRequest(tt.method, "/v1/totps", "")
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.preflight {
+			r.Header.Set("Access-Control-Request-Method", "DELETE")
+			r.Header.Set("Access-Control-Request-Headers", "Authorization")
+		}
+		w := serve(h, r)
+		header := w.Header()
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := header.Get("Access-Control-Allow-Origin"); got != tt.allow {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.allow)
+		}
+		if reached != tt.reached {
+			t.Errorf("%s: handler ran: %v, want %v", tt.name, reached, tt.reached)
+		}
+		if tt.origins != nil && header.Get("Vary") != "Origin" {
+			t.Errorf("%s: Vary %q, want Origin", tt.name, header.Get("Vary"))
+		}
+
+		preflighted := tt.preflight && tt.allow != ""
+		want := map[string]string{
+			"Access-Control-Allow-Methods": "",
+			"Access-Control-Allow-Headers": "",
+			"Access-Control-Max-Age":       "",
+		}
+		if preflighted {
+			want = map[string]string{
+				"Access-Control-Allow-Methods": corsMethods,
+				"Access-Control-Allow-Headers": corsHeaders,
+				"Access-Control-Max-Age":       "600",
+			}
+		}
+		if !tt.preflight && tt.allow != "" {
+			want["Access-Control-Expose-Headers"] = corsExposeHeaders
+		}
+		for key, value := range want {
+			if got := header.Get(key); got != value {
+				t.Errorf("%s: %s %q, want %q", tt.name, key, got, value)
+			}
+		}
+	}
+}
+
+func TestCheckCORSOrigins(t *testing.T) {
+	for _, origin := range []string{"*", "https://dash.example.com", "http://localhost:8080"} {
+		if err := checkCORSOrigins([]string{origin}); err != nil {
+			t.Errorf("%s: %v", origin, err)
+		}
+	}
+	for _, origin := range []string{"dash.example.com", "ftp://dash.example.com", "https://dash.example.com/app", "https://", "https://dash.example.com?x=1"} {
+		if err := checkCORSOrigins([]string{origin}); err == nil {
+			t.Errorf("%s: no error", origin)
+		}
+	}
+}
+
+// captureLog sends what is logged through slog, at every level, to the
+// buffer it returns as JSON objects, until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old, oldLevel := slog.Default(), logLevel.Level()
+	t.Cleanup(func() {
+		slog.SetDefault(old)
+		logLevel.Set(oldLevel)
+	})
+	logLevel.Set(slog.LevelDebug)
+	setupLogging(&buf, true, false)
+	return &buf
+}
+
+func TestLogRequests(t *testing.T) {
+	logged := captureLog(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/totps/{name}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+		writeJSONError(w, http.StatusNotFound, "no such entry")
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/v1/totps/git%2Fhub", http.StatusNotFound},
+		{"/panic", http.StatusInternalServerError},
+		{"/ok", http.StatusOK},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		h := logRequests(&out, logFormatJSON, recoverPanics(mux))
+		r := newRequest("GET", tt.path, "")
+		r.RemoteAddr = "192.0.2.1:1234"
+		serve(h, r)
+
+		var line struct {
+			Level      string
+			Msg        string
+			Method     string
+			Path       string
+			Status     int
+			DurationMS *float64 `json:"duration_ms"`
+			Remote     string
+		}
+		if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+			t.Fatalf("%s: decoding %q: %v", tt.path, out.String(), err)
+		}
+		if line.Level != "INFO" || line.Msg != "request" || line.Method != "GET" || line.Path != tt.path ||
+			line.Status != tt.status || line.Remote != r.RemoteAddr {
+			t.Errorf("%s: logged %s", tt.path, out.Bytes())
+		}
+		if line.DurationMS == nil || *line.DurationMS < 0 {
+			t.Errorf("%s: no duration in %s", tt.path, out.Bytes())
+		}
+
+		out.Reset()
+		h = logRequests(&out, logFormatText, recoverPanics(mux))
+		serve(h, r)
+		fields := strings.Fields(out.String())
+		// date, time, method, path, status, duration, remote
+		if len(fields) != 7 || fields[2] != "GET" || fields[3] != tt.path || fields[4] != strconv.Itoa(tt.status) || fields[6] != r.RemoteAddr {
+			t.Errorf("%s: logged %q", tt.path, out.String())
+		} else if _, err := time.ParseDuration(fields[5]); err != nil {
+			t.Errorf("%s: duration %q: %v", tt.path, fields[5], err)
+		}
+	}
+	if !strings.Contains(logged.String(), `"msg":"panic serving request"`) || !strings.Contains(logged.String(), `"err":"boom"`) {
+		t.Errorf("the panic wasn't logged: %s", logged)
+	}
+}
+
+// TestLogRequestsDebug checks the details logRequests logs at debug level,
+// with --verbose.
+func TestLogRequestsDebug(t *testing.T) {
+	debug := captureLog(t)
+	h := logRequests(io.Discard, logFormatText, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := newRequest("POST", "/v1/totps", `{"name": "github"}`)
+	r.Header.Set("User-Agent", "test-agent")
+	serve(h, r)
+
+	var line map[string]any
+	if err := json.Unmarshal(debug.Bytes(), &line); err != nil {
+		t.Fatalf("decoding %q: %v", debug.String(), err)
+	}
+	want := map[string]any{"level": "DEBUG", "msg": "request", "method": "POST", "path": "/v1/totps", "user_agent": "test-agent", "content_length": float64(18)}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s: %v, want %v", key, line[key], value)
+		}
+	}
+}
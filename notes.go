@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// Notes and recovery codes are private, like secrets: list, search and the
+// API's entry views never show them, only these commands, full exports and
+// backups.
+
+// updateEntry applies fn to the named entry and saves it, unless fn fails;
+// its error is returned. It exits if there is no such entry or saving fails.
+func updateEntry(name string, fn func(entry *TOTPEntry) error) (TOTPEntry, error) {
+	var updated TOTPEntry
+	var fnErr error
+	err := mustOpenStore().Update(func(v *TOTPData) error {
+		i := v.Index(name)
+		if i < 0 {
+			return auther.ErrNotFound
+		}
+		if fnErr = fn(&v.Entries[i]); fnErr != nil {
+			return fnErr
+		}
+		updated = v.Entries[i]
+		return nil
+	})
+	switch {
+	case fnErr != nil:
+		return updated, fnErr
+	case errors.Is(err, auther.ErrNotFound):
+		reportErrorf("No entry found with the name: %s", name)
+		os.Exit(exitNotFound)
+	case err != nil:
+		fatal(err)
+	}
+	return updated, nil
+}
+
+// mustFindEntry returns the entry with exactly the given name, exiting if
+// there is none.
+func mustFindEntry(name string) TOTPEntry {
+	entry, ok := mustLoadData().Find(name)
+	if !ok {
+		reportErrorf("No entry found with the name: %s", name)
+		os.Exit(exitNotFound)
+	}
+	return entry
+}
+
+func noteCommand(args []string) {
+	fs := newFlagSet("note", "note [name] [--set text | --clear]")
+	set := fs.String("set", "", "replace the entry's note with this text")
+	clearNote := fs.Bool("clear", false, "remove the entry's note")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 || (*clearNote && flagsGiven(fs, "set")) {
+		fmt.Fprintln(os.Stderr, "Usage: authinator note [name] [--set text | --clear]")
+		os.Exit(2)
+	}
+	name := args[0]
+
+	if !flagsGiven(fs, "set", "clear") {
+		entry := mustFindEntry(name)
+		switch {
+		case options.json:
+			printJSON(map[string]any{"name": entry.Name, "notes": entry.Notes})
+		case entry.Notes == "":
+			fmt.Printf("Entry '%s' has no note.\n", entry.Name)
+		default:
+			fmt.Println(entry.Notes)
+		}
+		return
+	}
+
+	updateEntry(name, func(entry *TOTPEntry) error {
+		entry.Notes = *set
+		return nil
+	})
+	switch {
+	case options.json:
+		printJSON(map[string]any{"name": name, "notes": *set})
+	case *set == "":
+		fmt.Printf("The note of '%s' has been removed.\n", name)
+	default:
+		fmt.Printf("The note of '%s' has been saved.\n", name)
+	}
+}
+
+const recoveryUsage = "Usage: authinator recovery [name] add [code...] | recovery [name] list | recovery [name] use [code]"
+
+func recoveryCommand(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, recoveryUsage)
+		os.Exit(2)
+	}
+	name, action, codes := args[0], args[1], args[2:]
+
+	switch {
+	case action == "add" && len(codes) > 0:
+		var added int
+		entry, _ := updateEntry(name, func(entry *TOTPEntry) error {
+			added = entry.AddRecoveryCodes(codes...)
+			return nil
+		})
+		if options.json {
+			printJSON(map[string]any{"name": name, "added": added, "unused": entry.UnusedRecoveryCodes()})
+			return
+		}
+		fmt.Printf("Added %d recovery codes to '%s'; %d are unused.\n", added, name, entry.UnusedRecoveryCodes())
+		if skipped := len(codes) - added; skipped > 0 {
+			fmt.Printf("Skipped %d codes that were empty or already stored.\n", skipped)
+		}
+	case action == "list" && len(codes) == 0:
+		listRecoveryCodes(mustFindEntry(name))
+	case action == "use" && len(codes) == 1:
+		entry, err := updateEntry(name, func(entry *TOTPEntry) error {
+			return entry.UseRecoveryCode(codes[0], time.Now())
+		})
+		if err != nil {
+			reportErrorf("%s: %v", codes[0], err)
+			os.Exit(1)
+		}
+		if options.json {
+			printJSON(map[string]any{"name": name, "used": codes[0], "unused": entry.UnusedRecoveryCodes()})
+			return
+		}
+		fmt.Printf("Recovery code %s is now marked as used; %d unused codes are left for '%s'.\n", codes[0], entry.UnusedRecoveryCodes(), name)
+	default:
+		fmt.Fprintln(os.Stderr, recoveryUsage)
+		os.Exit(2)
+	}
+}
+
+func listRecoveryCodes(entry TOTPEntry) {
+	if options.json {
+		codes := entry.RecoveryCodes
+		if codes == nil {
+			codes = []auther.RecoveryCode{}
+		}
+		printJSON(map[string]any{"name": entry.Name, "recovery_codes": codes})
+		return
+	}
+	if len(entry.RecoveryCodes) == 0 {
+		fmt.Printf("Entry '%s' has no recovery codes.\n", entry.Name)
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODE\tUSED")
+	for _, c := range entry.RecoveryCodes {
+		fmt.Fprintf(tw, "%s\t%s\n", c.Code, formatStamp(c.UsedAt, "no"))
+	}
+	tw.Flush()
+}
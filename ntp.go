@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// defaultNTPServer is asked for the time by the clock checks.
+const defaultNTPServer = "pool.ntp.org"
+
+// ntpEpochOffset is the number of seconds from the NTP epoch, 1900, to the
+// Unix epoch.
+const ntpEpochOffset = 2208988800
+
+// queryClockOffset asks an NTP server for the time with a single SNTP
+// request (RFC 4330) and returns how far the server's clock is ahead of the
+// local one, so adding it to time.Now gives the server's time.
+func queryClockOffset(server string, timeout time.Duration) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // no leap second warning, version 4, client mode
+	t0 := time.Now()
+	putNTPTime(req[40:], t0)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	t3 := time.Now()
+	switch {
+	case err != nil:
+		return 0, err
+	case n < 48 || resp[0]&0x7 != 4:
+		return 0, errors.New("invalid NTP response")
+	case resp[1] == 0:
+		return 0, fmt.Errorf("the NTP server refused the request (%q)", resp[12:16])
+	case string(resp[24:32]) != string(req[40:48]):
+		return 0, errors.New("NTP response doesn't match the request")
+	}
+
+	// The server's receive and transmit times, against ours for sending the
+	// request and receiving the response.
+	t1, t2 := ntpTime(resp[32:]), ntpTime(resp[40:])
+	return (t1.Sub(t0) + t2.Sub(t3)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp. Seconds below 2^31 are taken to
+// be after the era rollover in 2036, as RFC 4330 suggests.
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b))
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	if secs < 1<<31 {
+		secs += 1 << 32
+	}
+	return time.Unix(secs-ntpEpochOffset, frac*1e9>>32)
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	secs := t.Unix() + ntpEpochOffset
+	frac := int64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint32(b, uint32(secs))
+	binary.BigEndian.PutUint32(b[4:], uint32(frac))
+}
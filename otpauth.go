@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+
+	"authinator/pkg/auther"
+)
+
+// describe returns the issuer and account for display after the entry name,
+// e.g. " [GitHub: me@example.com]", or "" when neither is set.
+func describe(e TOTPEntry) string {
+	switch {
+	case e.Issuer != "" && e.Account != "":
+		return " [" + e.Issuer + ": " + e.Account + "]"
+	case e.Issuer != "" || e.Account != "":
+		return " [" + e.Issuer + e.Account + "]"
+	default:
+		return ""
+	}
+}
+
+func addURI(uri, name string) {
+	entry, err := auther.ParseURI(uri)
+	if err != nil {
+		reportErrorf("Invalid otpauth URI: %v", err)
+		os.Exit(1)
+	}
+	if name != "" {
+		entry.Name = name
+	}
+	addEntry(entry)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// codeResult is the JSON form of a generated code.
+type codeResult struct {
+	Name      string   `json:"name,omitempty"`
+	Issuer    string   `json:"issuer,omitempty"`
+	Account   string   `json:"account,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Code      string   `json:"code,omitempty"`
+	ExpiresIn int64    `json:"expires_in,omitempty"`
+	NextCode  string   `json:"next_code,omitempty"`
+
+	// Period is only set by list and for --format.
+	Period int64 `json:"period,omitempty"`
+
+	// ValidFrom and ValidUntil are only set for codes generated for a time
+	// other than now.
+	ValidFrom  string `json:"valid_from,omitempty"`
+	ValidUntil string `json:"valid_until,omitempty"`
+
+	Upcoming []upcomingCode `json:"upcoming,omitempty"`
+
+	// Aliases, Pin, CreatedAt and LastUsedAt are only set by list.
+	Aliases    []string  `json:"aliases,omitempty"`
+	Pin        int       `json:"pin,omitempty"`
+	CreatedAt  time.Time `json:"created_at,omitzero"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// displayCode groups the digits of a code for people to read, as "123 456"
+// or "1234 5678". Codes of other lengths, and every code with --no-group, are
+// returned as they are. Only printed output is grouped; the clipboard,
+// --quiet and JSON get the code itself.
+func displayCode(code string) string {
+	if options.noGroup || (len(code) != 6 && len(code) != 8) {
+		return code
+	}
+	half := len(code) / 2
+	return code[:half] + " " + code[half:]
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("encoding JSON", "err", err)
+		os.Exit(1)
+	}
+}
+
+// reportErrorf prints an error message to stderr, keeping stdout for what
+// commands print as their result. With --json it is written as
+// {"error": "..."} and the process exits with status 1.
+func reportErrorf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if !options.json {
+		fmt.Fprintln(os.Stderr, msg)
+		return
+	}
+	json.NewEncoder(os.Stderr).Encode(map[string]string{"error": msg})
+	os.Exit(1)
+}
+
+// promptf writes an interactive prompt. Prompts move to stderr in JSON mode
+// so stdout stays machine-readable.
+func promptf(format string, args ...any) {
+	out := os.Stdout
+	if options.json {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, format, args...)
+}
+
+// fatal reports an error that stops a CLI command and exits with status 1.
+func fatal(err error) {
+	fail(1, err)
+}
+
+// fail reports err on stderr, as JSON in --json mode, and exits with status.
+func fail(status int, err error) {
+	if options.json {
+		json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+	} else {
+		slog.Error(err.Error())
+	}
+	os.Exit(status)
+}
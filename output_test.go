@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestMain runs authinator itself when a test starts the test binary with
+// AUTHER_TEST_CLI set, so that tests can see what a command writes to
+// stdout and stderr and the status it exits with.
+func TestMain(m *testing.M) {
+	if os.Getenv("AUTHER_TEST_CLI") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// cliResult is what a command run by runCLI wrote and exited with.
+type cliResult struct {
+	stdout, stderr string
+	status         int
+}
+
+// runCLI runs authinator with args and stdin in the config directory dir.
+func runCLI(t *testing.T, dir, stdin string, args ...string) cliResult {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "AUTHER_TEST_CLI=1", "HOME="+dir, "XDG_CONFIG_HOME="+dir,
+		"AUTHER_NO_NTP=1", "AUTHER_NO_CLIPBOARD=1", "AUTHER_DATA_FILE=", "AUTHER_BACKEND=", "AUTHER_REMOTE=", "NO_COLOR=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return cliResult{stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()}
+}
+
+// TestOutputStreams checks that what commands print as their result goes to
+// stdout and everything else, errors, usage and debug messages, to stderr.
+func TestOutputStreams(t *testing.T) {
+	dir := t.TempDir()
+	if r := runCLI(t, dir, testSecret+"\n", "create", "github", "--secret-stdin"); r.status != 0 {
+		t.Fatalf("creating github: %+v", r)
+	}
+
+	tests := []struct {
+		name   string
+		stdin  string
+		args   []string
+		status int
+		// stdout and stderr are what the streams contain, "" if they must
+		// be empty.
+		stdout, stderr string
+	}{
+		{"create", testSecret + "\n", []string{"create", "bank", "--secret-stdin"}, 0, "Entry created", ""},
+		{"invalid secret", "not base32!!\n", []string{"create", "gh", "--secret-stdin"}, 1, "", "Invalid entry"},
+		{"taken name", testSecret + "\n", []string{"create", "GitHub", "--secret-stdin"}, 1, "", "taken by the entry 'github'"},
+		{"taken name as JSON", testSecret + "\n", []string{"--json", "create", "github", "--secret-stdin"}, 1, "", `"error"`},
+		{"codes", "", []string{"get", "github"}, 0, "github", ""},
+		{"missing entry", "", []string{"get", "missing"}, 1, "", "No entry found"},
+		{"list", "", []string{"list"}, 0, "github", ""},
+		{"debug messages", "", []string{"--verbose", "list"}, 0, "github", "Debug:"},
+		{"rename to a taken name", "", []string{"rename", "bank", "github"}, 1, "", "Use --force"},
+		{"rename a missing entry", "", []string{"rename", "missing", "other"}, 1, "", "No entry found"},
+		{"usage", "", []string{"rename", "github"}, 2, "", "Usage: authinator rename"},
+		{"unknown import format", "", []string{"import", "palm-pilot", "file"}, 2, "", "Unknown import format"},
+		{"unreadable backup", "", []string{"import", "andotp", dir + "/missing.json"}, 1, "", "Error reading backup"},
+		{"invalid URI", "", []string{"add-uri", "otpauth://totp/x"}, 1, "", "Invalid otpauth URI"},
+	}
+	for _, tt := range tests {
+		r := runCLI(t, dir, tt.stdin, tt.args...)
+		if r.status != tt.status {
+			t.Errorf("%s: exit status %d, want %d (stdout %q, stderr %q)", tt.name, r.status, tt.status, r.stdout, r.stderr)
+		}
+		for _, stream := range []struct{ name, got, want string }{{"stdout", r.stdout, tt.stdout}, {"stderr", r.stderr, tt.stderr}} {
+			switch {
+			case stream.want == "" && stream.got != "":
+				t.Errorf("%s: %s should be empty, got %q", tt.name, stream.name, stream.got)
+			case !strings.Contains(stream.got, stream.want):
+				t.Errorf("%s: %s %q doesn't have %q", tt.name, stream.name, stream.got, stream.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// passwdCommand re-encrypts the data file under a new passphrase, with a new
+// salt, and then the backups and snapshots that were encrypted with the old
+// one. Each file is replaced atomically, so a crash leaves every file under
+// either the old passphrase or the new one, and readBackup still asks for the
+// passphrase of a backup the new key doesn't open.
+func passwdCommand(args []string) {
+	const usage = "passwd [--from-stdin]"
+	fs := newFlagSet("passwd", usage)
+	fromStdin := fs.Bool("from-stdin", false, "read the current passphrase and then the new one from stdin, one per line")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator "+usage)
+		os.Exit(2)
+	}
+
+	mustOpenBackend()
+	if dataFileBackend == nil {
+		fmt.Fprintf(os.Stderr, "The %s backend doesn't support encryption.\n", backendName())
+		os.Exit(1)
+	}
+	content, err := os.ReadFile(dataPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatal(err)
+	}
+	if !auther.IsEncrypted(content) {
+		fmt.Fprintln(os.Stderr, "The data file isn't encrypted with a passphrase; use authinator encrypt to encrypt it.")
+		os.Exit(1)
+	}
+
+	var old, next []byte
+	if *fromStdin {
+		old, next = readStdinLine(), readStdinLine()
+	} else if old, err = readPassword("Current passphrase: "); err != nil {
+		fatal(fmt.Errorf("reading passphrase: %w", err))
+	}
+
+	// The current passphrase is checked even if the agent has the key or a
+	// security key is enrolled.
+	dataFileBackend.CachedKey, dataFileBackend.FIDO2 = nil, nil
+	dataFileBackend.Passphrase = func() ([]byte, error) { return old, nil }
+	data, err := dataBackend.Load()
+	if errors.Is(err, auther.ErrWrongPassphrase) || errors.Is(err, auther.ErrDecryptionFailed) {
+		fmt.Fprintln(os.Stderr, "Wrong passphrase; nothing was changed.")
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	oldKey := dataFileBackend.Key()
+
+	if !*fromStdin {
+		if next, err = readPassword("New passphrase: "); err != nil {
+			fatal(fmt.Errorf("reading passphrase: %w", err))
+		}
+		if len(next) > 0 {
+			confirm, err := readPassword("Confirm new passphrase: ")
+			if err != nil {
+				fatal(fmt.Errorf("reading passphrase: %w", err))
+			}
+			if !bytes.Equal(next, confirm) {
+				fmt.Fprintln(os.Stderr, "Passphrases do not match; nothing was changed.")
+				os.Exit(1)
+			}
+		}
+	}
+	if len(next) == 0 {
+		fmt.Fprintln(os.Stderr, "Passphrase must not be empty; nothing was changed.")
+		os.Exit(1)
+	}
+
+	newKey, err := auther.NewKey(next)
+	if err != nil {
+		fatal(err)
+	}
+	dataFileBackend.SetKey(newKey)
+	mustSaveData(data)
+	// The previous version kept next to the data file is still under the
+	// old passphrase.
+	os.Remove(auther.BackupPath(dataPath))
+	fmt.Println("Passphrase changed.")
+
+	replaceAgentKey(oldKey, newKey)
+	enrolled := 0
+	for _, slot := range oldKey.Slots() {
+		if slot.Type == auther.SlotFIDO2 {
+			enrolled++
+		}
+	}
+	switch {
+	case enrolled == 1:
+		fmt.Println("The security key enrolled for the old key has to be enrolled again with authinator key enroll.")
+	case enrolled > 1:
+		fmt.Printf("The %d security keys enrolled for the old key have to be enrolled again with authinator key enroll.\n", enrolled)
+	}
+
+	rotated, others := rotateBackups(old, oldKey, newKey)
+	if rotated > 0 {
+		fmt.Printf("Re-encrypted %s with it.\n", countBackups(rotated))
+	}
+	switch {
+	case others == 1:
+		fmt.Println("1 backup encrypted with another passphrase was left as is.")
+	case others > 1:
+		fmt.Printf("%d backups encrypted with another passphrase were left as is.\n", others)
+	}
+}
+
+// rotateBackups re-encrypts with newKey the backups and snapshots that open
+// with oldKey or the passphrase it was derived from, old. It returns how many
+// it re-encrypted, and how many are encrypted with another passphrase.
+// Backups encrypted with age or GnuPG, or not at all, are left alone.
+func rotateBackups(old []byte, oldKey, newKey *auther.Key) (rotated, others int) {
+	var backups []backupFile
+	for _, prefix := range []string{backupPrefix, snapshotPrefix} {
+		list, err := listBackups(prefix)
+		if err != nil {
+			slog.Warn("couldn't list the backups", "err", err)
+			return rotated, others
+		}
+		backups = append(backups, list...)
+	}
+
+	for _, backup := range backups {
+		content, err := os.ReadFile(backup.Path)
+		if err != nil || !auther.IsEncrypted(content) {
+			continue
+		}
+		var v TOTPData
+		if bytes.Equal(auther.FileSalt(content), oldKey.Salt()) {
+			v, err = auther.DecodeWithKey(backup.Path, content, oldKey)
+		} else {
+			v, _, err = auther.Decode(backup.Path, content, func() ([]byte, error) { return old, nil })
+		}
+		if errors.Is(err, auther.ErrWrongPassphrase) || errors.Is(err, auther.ErrDecryptionFailed) {
+			others++
+			continue
+		}
+		if err == nil {
+			err = auther.WriteFileWithKey(backup.Path, v, newKey)
+		}
+		if err != nil {
+			slog.Warn(fmt.Sprintf("couldn't re-encrypt %s, which still uses the old passphrase", backup.Path), "err", err)
+			continue
+		}
+		os.Remove(auther.BackupPath(backup.Path))
+		rotated++
+	}
+	return rotated, others
+}
+
+// readStdinLine reads a line from stdin for --from-stdin, exiting if there
+// is none.
+func readStdinLine() []byte {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr, "Expected the current and the new passphrase on stdin, one per line.")
+		os.Exit(1)
+	}
+	return []byte(strings.TrimRight(line, "\r\n"))
+}
+
+// countBackups puts a number of backups in words, such as "1 backup".
+func countBackups(n int) string {
+	if n == 1 {
+		return "1 backup"
+	}
+	return fmt.Sprintf("%d backups", n)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"authinator/pkg/auther"
+)
+
+// dataPath is the resolved location of the data file for this invocation.
+var dataPath string
+
+// configDir returns the directory auther keeps its files in.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "auther"), nil
+}
+
+// resolveDataPath picks the data file location, migrating a legacy data file
+// into the config directory if needed.
+func resolveDataPath() (string, error) {
+	path, err := locateDataPath()
+	if err != nil {
+		return "", err
+	}
+	if options.file != "" || os.Getenv("AUTHER_DATA_FILE") != "" || backendName() == backendSQLite {
+		return path, nil
+	}
+
+	if err := migrateLegacyDataFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// locateDataPath returns the data file location without touching the
+// filesystem. The --file flag wins over AUTHER_DATA_FILE, which wins over the
+// per-user config directory.
+func locateDataPath() (string, error) {
+	if options.file != "" {
+		return options.file, nil
+	}
+	if env := os.Getenv("AUTHER_DATA_FILE"); env != "" {
+		return env, nil
+	}
+
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, defaultDataFile()), nil
+}
+
+// migrateLegacyDataFile moves a totp.json left in the working directory by
+// older versions to path, unless a vault already exists there.
+func migrateLegacyDataFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if _, err := os.Stat(dataFile); err != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(dataFile, path); err != nil {
+		// Rename fails across filesystems; fall back to copy and remove.
+		if err := auther.CopyFile(dataFile, path); err != nil {
+			return fmt.Errorf("migrating %s to %s: %v", dataFile, path, err)
+		}
+		if err := os.Remove(dataFile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Moved ./%s to %s\n", dataFile, path)
+	return nil
+}
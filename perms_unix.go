@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+
+	"authinator/pkg/auther"
+)
+
+// privateDir reports whether the directory described by info belongs to the
+// user running this process and only they can enter it.
+func privateDir(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid() && info.Mode().Perm() == 0700
+}
+
+// checkPermissions warns when the data file is accessible to other users, or
+// restricts it to its owner when --fix-permissions is given.
+func checkPermissions(path string) {
+	mode, open := tooOpen(path)
+	if !open {
+		return
+	}
+
+	if !options.fixPermissions {
+		slog.Warn(fmt.Sprintf("%s is accessible by other users (mode %04o). Run with --fix-permissions or chmod 600 it.", path, mode))
+		return
+	}
+	for _, p := range []string{path, auther.BackupPath(path)} {
+		if err := os.Chmod(p, mode&^0077); err != nil && !os.IsNotExist(err) {
+			slog.Error(fmt.Sprintf("fixing permissions of %s", p), "err", err)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Restricted %s to mode %04o.\n", path, mode&^0077)
+}
+
+// tooOpen reports whether users other than the owner can access path, along
+// with its permissions.
+func tooOpen(path string) (os.FileMode, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	mode := info.Mode().Perm()
+	return mode, mode&0077 != 0
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// checkPermissions is a no-op on Windows, where the data file is protected by
+// the ACLs of the user's profile directory rather than Unix mode bits.
+func checkPermissions(path string) {}
+
+// privateDir always reports true on Windows, where the temporary directory
+// is in the user's profile directory too.
+func privateDir(info os.FileInfo) bool {
+	return true
+}
+
+// tooOpen always reports false on Windows, for the same reason.
+func tooOpen(path string) (os.FileMode, bool) {
+	return 0, false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"authinator/pkg/auther"
+)
+
+// mustPickEntry lists entries with numbers, pinned ones first, and asks for
+// one, by number or by name. Pressing enter picks the most used pinned entry,
+// if any. It exits if nothing is chosen, so it must only be called when stdin
+// is a terminal.
+func mustPickEntry(entries []TOTPEntry) TOTPEntry {
+	entries = slices.Clone(entries)
+	auther.SortPinned(entries, func(e TOTPEntry) int { return e.Pin })
+	for i, entry := range entries {
+		mark := ""
+		if entry.Pinned() {
+			mark = " *"
+		}
+		promptf("%3d) %s%s%s\n", i+1, entry.Name, describe(entry), mark)
+	}
+	preferred := auther.MostUsedPinned(entries)
+
+	for {
+		if preferred >= 0 {
+			promptf("Select an entry [1-%d, enter for %d]: ", len(entries), preferred+1)
+		} else {
+			promptf("Select an entry [1-%d]: ", len(entries))
+		}
+		answer, err := stdin.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" && preferred >= 0 && err == nil {
+			return entries[preferred]
+		}
+		if answer == "" {
+			if err == io.EOF {
+				fmt.Fprintln(os.Stderr)
+			}
+			reportErrorf("No entry selected.")
+			os.Exit(exitNotFound)
+		}
+
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(entries) {
+			return entries[n-1]
+		}
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name, answer) {
+				return entry
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Enter a number from 1 to %d or one of the names above.\n", len(entries))
+	}
+}
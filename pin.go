@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"authinator/pkg/auther"
+)
+
+// pinCommand implements pin and unpin, which mark an entry as a favorite or
+// make it an ordinary entry again.
+func pinCommand(args []string, pin bool) {
+	command := "unpin"
+	if pin {
+		command = "pin"
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: authinator %s [name]\n", command)
+		os.Exit(2)
+	}
+
+	var name string
+	var changed bool
+	err := mustOpenStore().Update(func(v *TOTPData) error {
+		var err error
+		if pin {
+			changed, err = v.Pin(args[0])
+		} else {
+			changed, err = v.Unpin(args[0])
+		}
+		if err == nil {
+			name = v.Entries[v.Index(args[0])].Name
+		}
+		return err
+	})
+	switch {
+	case errors.Is(err, auther.ErrNotFound):
+		reportErrorf("No entry found with the name: %s", args[0])
+		os.Exit(exitNotFound)
+	case err != nil:
+		fatal(err)
+	}
+
+	if options.json {
+		printJSON(map[string]any{"name": name, "pinned": pin, "changed": changed})
+		return
+	}
+	switch {
+	case pin && changed:
+		fmt.Printf("Pinned '%s'.\n", name)
+	case pin:
+		fmt.Printf("'%s' is already pinned.\n", name)
+	case changed:
+		fmt.Printf("Unpinned '%s'.\n", name)
+	default:
+		fmt.Printf("'%s' isn't pinned.\n", name)
+	}
+}
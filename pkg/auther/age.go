@@ -0,0 +1,180 @@
+package auther
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// Data files can also be encrypted with age (https://age-encryption.org) to
+// one or more recipients instead of with a passphrase. The recipients are
+// kept inside the encrypted payload, next to the vault, so that the file can
+// be written back to the same recipients by whoever can decrypt it.
+const ageMagic = "age-encryption.org/v1\n"
+
+var (
+	// ErrAgeEncrypted is returned by Decode for a data file encrypted with
+	// age, which DecodeAge reads instead.
+	ErrAgeEncrypted = errors.New("the data file is encrypted with age")
+	// ErrNoAgeIdentity is returned for an age-encrypted data file that none
+	// of the identities given can decrypt.
+	ErrNoAgeIdentity = errors.New("no age identity can decrypt the data file")
+)
+
+// AgeIdentityFile holds the identities read from an age identity file or an
+// SSH private key.
+type AgeIdentityFile struct {
+	Path       string
+	Identities []age.Identity
+}
+
+// AgeIdentitiesFunc supplies the identities of an age-encrypted data file. It
+// is only called once the file turns out to be encrypted with age.
+type AgeIdentitiesFunc func() ([]AgeIdentityFile, error)
+
+// ageFile is the payload of an age-encrypted data file.
+type ageFile struct {
+	Vault
+	AgeRecipients []string `json:"age_recipients"`
+}
+
+// IsAgeEncrypted reports whether content is encrypted with age.
+func IsAgeEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(ageMagic))
+}
+
+// ReadAgeIdentityFile reads the identities in an age identity file, as
+// written by age-keygen, or the SSH private key at path. passphrase is
+// called for a passphrase-protected SSH key, but only once the key turns out
+// to be needed.
+func ReadAgeIdentityFile(path string, passphrase PassphraseFunc) (AgeIdentityFile, error) {
+	file := AgeIdentityFile{Path: path}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if !bytes.Contains(content, []byte("PRIVATE KEY-----")) {
+		if file.Identities, err = age.ParseIdentities(bytes.NewReader(content)); err != nil {
+			return file, fmt.Errorf("%s: %w", path, err)
+		}
+		return file, nil
+	}
+
+	identity, err := agessh.ParseIdentity(content)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && missing.PublicKey != nil {
+		identity, err = agessh.NewEncryptedSSHIdentity(missing.PublicKey, content, passphrase)
+	}
+	if err != nil {
+		return file, fmt.Errorf("%s: %w", path, err)
+	}
+	file.Identities = []age.Identity{identity}
+	return file, nil
+}
+
+// ParseAgeRecipients parses age recipients (age1...) and SSH public keys
+// (ssh-ed25519 or ssh-rsa, as in authorized_keys files).
+func ParseAgeRecipients(list []string) ([]age.Recipient, error) {
+	if len(list) == 0 {
+		return nil, errors.New("no age recipients given")
+	}
+	var recipients []age.Recipient
+	for _, s := range list {
+		var r age.Recipient
+		var err error
+		if strings.HasPrefix(s, "ssh-") {
+			r, err = agessh.ParseRecipient(s)
+		} else {
+			r, err = age.ParseX25519Recipient(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// DecodeAge decrypts with the identities supplied by identities and parses
+// the contents of the age-encrypted data file at path, like Decode. It also
+// returns the recipients the file was encrypted to, so it can be written
+// back the same way; they are nil for a file that was encrypted by another
+// program, such as the age command.
+func DecodeAge(path string, content []byte, identities AgeIdentitiesFunc) (Vault, []string, error) {
+	files, err := identities()
+	if err != nil {
+		return Vault{}, nil, fmt.Errorf("reading age identities: %w", err)
+	}
+	var all []age.Identity
+	var paths []string
+	for _, file := range files {
+		all = append(all, file.Identities...)
+		paths = append(paths, file.Path)
+	}
+	if len(all) == 0 {
+		return Vault{}, nil, fmt.Errorf("reading data file: %w (no identities given)", ErrNoAgeIdentity)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(content), all...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return Vault{}, nil, fmt.Errorf("reading data file: %w (tried %s)", ErrNoAgeIdentity, strings.Join(paths, ", "))
+	}
+	if err == nil {
+		content, err = io.ReadAll(r)
+	}
+	if err != nil {
+		return Vault{}, nil, fmt.Errorf("reading data file: %w", err)
+	}
+
+	var file ageFile
+	if err := parse(path, content, &file); err != nil {
+		return Vault{}, nil, err
+	}
+	return file.Vault, file.AgeRecipients, nil
+}
+
+// EncodeAge returns the contents of a data file holding v in the current
+// format, encrypted with age to recipients. DecodeAge reads it back.
+func EncodeAge(v Vault, recipients []string) ([]byte, error) {
+	parsed, err := ParseAgeRecipients(recipients)
+	if err != nil {
+		return nil, err
+	}
+	v.Version = SchemaVersion
+	plaintext, err := json.MarshalIndent(ageFile{Vault: v, AgeRecipients: recipients}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding data: %w", err)
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, parsed...)
+	if err == nil {
+		_, err = w.Write(plaintext)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encrypting data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteAgeFile saves v to path like WriteFile, but encrypted with age to
+// recipients.
+func WriteAgeFile(path string, v Vault, recipients []string) error {
+	file, err := EncodeAge(v, recipients)
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, file)
+}
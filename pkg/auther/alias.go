@@ -0,0 +1,73 @@
+package auther
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrAliasNotFound is returned for an alias no entry has.
+var ErrAliasNotFound = errors.New("no entry has that alias")
+
+// Owner returns the position of the entry that has name as its name or as
+// one of its aliases, ignoring case, and whether it was an alias. It
+// returns -1 if name is free.
+func (v Vault) Owner(name string) (i int, alias bool) {
+	if i := v.Index(name); i >= 0 {
+		return i, false
+	}
+	return v.AliasIndex(name), true
+}
+
+// AliasIndex returns the position of the entry with the given alias,
+// ignoring case, or -1.
+func (v Vault) AliasIndex(alias string) int {
+	return slices.IndexFunc(v.Entries, func(e Entry) bool { return e.HasAlias(alias) })
+}
+
+// HasAlias reports whether the entry has the given alias, ignoring case.
+func (e Entry) HasAlias(alias string) bool {
+	return slices.ContainsFunc(e.Aliases, func(a string) bool { return SameName(a, alias) })
+}
+
+// AddAlias gives the named entry another name to be looked up by, failing
+// with ErrNotFound if there is no such entry or a ConflictError if an entry
+// already has alias as its name or alias.
+func (v *Vault) AddAlias(name, alias string) error {
+	alias = strings.TrimSpace(alias)
+	if alias == "" {
+		return errors.New("alias must not be empty")
+	}
+	i := v.Index(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if j, isAlias := v.Owner(alias); j >= 0 {
+		return ConflictError{Name: alias, Existing: v.Entries[j].Name, Alias: isAlias}
+	}
+	v.Entries[i].Aliases = append(slices.Clone(v.Entries[i].Aliases), alias)
+	return nil
+}
+
+// RemoveAlias removes alias from the entry that has it and returns that
+// entry's name, failing with ErrAliasNotFound if no entry has it.
+func (v *Vault) RemoveAlias(alias string) (string, error) {
+	i := v.AliasIndex(alias)
+	if i < 0 {
+		return "", ErrAliasNotFound
+	}
+	v.Entries[i].Aliases = slices.DeleteFunc(slices.Clone(v.Entries[i].Aliases), func(a string) bool { return SameName(a, alias) })
+	return v.Entries[i].Name, nil
+}
+
+// checkNames fails with a ConflictError if the name or an alias of entry is
+// taken by an entry other than the one at position self, which is -1 for a
+// new entry.
+func (v Vault) checkNames(entry Entry, self int) error {
+	for _, name := range append([]string{entry.Name}, entry.Aliases...) {
+		if j, isAlias := v.Owner(name); j >= 0 && j != self {
+			return ConflictError{Name: name, Existing: v.Entries[j].Name, Alias: isAlias}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package auther
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Backend is where a Store keeps its vault. Save replaces everything stored
+// with v, and must either succeed completely or leave the stored vault as it
+// was.
+type Backend interface {
+	Load() (Vault, error)
+	Save(v Vault) error
+}
+
+// A Locker is a Backend that other processes may change too. Lock keeps them
+// from saving until unlock is called, and Stale reports whether one saved
+// since the vault was last loaded or saved here.
+type Locker interface {
+	Lock() (unlock func(), err error)
+	Stale() bool
+}
+
+// FileBackend keeps the vault in a JSON data file, optionally encrypted. It is
+// the default backend.
+type FileBackend struct {
+	Path string
+	// Passphrase is called when the file turns out to be encrypted.
+	Passphrase PassphraseFunc
+	// CachedKey, if set, is asked for the key of an encrypted file, given
+	// its salt, before Passphrase is called. It returns nil if it has none.
+	CachedKey func(salt []byte) *Key
+	// FIDO2, if set, opens a file with FIDO2 key slots with an enrolled
+	// authenticator before Passphrase is called. If that fails,
+	// FIDO2Fallback, if set, is told why.
+	FIDO2         *FIDO2
+	FIDO2Fallback func(err error)
+	// AgeIdentities is called when the file turns out to be encrypted with
+	// age.
+	AgeIdentities AgeIdentitiesFunc
+	// GPG decrypts the file when it turns out to be encrypted with GnuPG.
+	GPG *GPG
+
+	key           *Key
+	ageRecipients []string
+	gpgRecipients []string
+}
+
+// NewFileBackend returns a backend for the data file at path.
+func NewFileBackend(path string, passphrase PassphraseFunc) *FileBackend {
+	return &FileBackend{Path: path, Passphrase: passphrase}
+}
+
+// Load reads the data file as described for ReadFile, or for DecodeAge or
+// DecodeGPG if it is encrypted with age or GnuPG.
+func (b *FileBackend) Load() (Vault, error) {
+	if v, key, ok := b.loadWithoutPassphrase(); ok {
+		b.key, b.ageRecipients, b.gpgRecipients = key, nil, nil
+		return v, nil
+	}
+	v, key, err := ReadFile(b.Path, b.Passphrase)
+	age := errors.Is(err, ErrAgeEncrypted) && b.AgeIdentities != nil
+	gpg := errors.Is(err, ErrGPGEncrypted) && b.GPG != nil
+	if !age && !gpg {
+		if err != nil {
+			return v, err
+		}
+		b.key, b.ageRecipients, b.gpgRecipients = key, nil, nil
+		return v, nil
+	}
+
+	content, err := os.ReadFile(b.Path)
+	if err != nil {
+		return Vault{}, fmt.Errorf("reading data file: %w", err)
+	}
+	var recipients []string
+	if age {
+		v, recipients, err = DecodeAge(b.Path, content, b.AgeIdentities)
+	} else {
+		v, recipients, err = DecodeGPG(b.Path, content, b.GPG)
+	}
+	if err != nil {
+		return Vault{}, err
+	}
+	if recipients == nil {
+		return Vault{}, errors.New("reading data file: the encrypted data file doesn't record its recipients, so it couldn't be saved again")
+	}
+	b.key, b.ageRecipients, b.gpgRecipients = nil, nil, nil
+	if age {
+		b.ageRecipients = recipients
+	} else {
+		b.gpgRecipients = recipients
+	}
+	return v, nil
+}
+
+// loadWithoutPassphrase reads the data file with the key from CachedKey, if
+// there is one for it, or else with a FIDO2 authenticator, if it has slots
+// for any. Anything else that goes wrong is left for Load to run into and
+// report.
+func (b *FileBackend) loadWithoutPassphrase() (Vault, *Key, bool) {
+	content, err := os.ReadFile(b.Path)
+	if err != nil {
+		return Vault{}, nil, false
+	}
+	salt := FileSalt(content)
+	if salt == nil {
+		return Vault{}, nil, false
+	}
+	var key *Key
+	if b.CachedKey != nil {
+		key = b.CachedKey(salt)
+	}
+	if key == nil && b.FIDO2 != nil && hasFIDO2Slots(content) {
+		if key, err = b.FIDO2.Unlock(content); err != nil && b.FIDO2Fallback != nil {
+			b.FIDO2Fallback(err)
+		}
+	}
+	if key == nil {
+		return Vault{}, nil, false
+	}
+	v, err := DecodeWithKey(b.Path, content, key)
+	if err != nil {
+		return Vault{}, nil, false
+	}
+	return v, key, true
+}
+
+// Save writes the data file as described for WriteFile, encrypted the way it
+// was loaded: with the same key, or to the same age or GnuPG recipients.
+func (b *FileBackend) Save(v Vault) error {
+	switch {
+	case b.ageRecipients != nil:
+		return WriteAgeFile(b.Path, v, b.ageRecipients)
+	case b.gpgRecipients != nil:
+		return WriteGPGFile(b.Path, v, b.gpgRecipients, b.GPG)
+	}
+	return WriteFileWithKey(b.Path, v, b.key)
+}
+
+// SetKey changes the key the next Save encrypts with; nil saves the file as
+// plaintext.
+func (b *FileBackend) SetKey(key *Key) {
+	b.key, b.ageRecipients, b.gpgRecipients = key, nil, nil
+}
+
+// Key returns the key the file is saved with, or nil if it isn't encrypted
+// with a passphrase.
+func (b *FileBackend) Key() *Key {
+	return b.key
+}
+
+// SetAgeRecipients makes the next Save encrypt the file with age to
+// recipients instead.
+func (b *FileBackend) SetAgeRecipients(recipients []string) {
+	b.key, b.ageRecipients, b.gpgRecipients = nil, recipients, nil
+}
+
+// AgeRecipients returns the age recipients the file is saved for, or nil if
+// it isn't encrypted with age.
+func (b *FileBackend) AgeRecipients() []string {
+	return b.ageRecipients
+}
+
+// SetGPGRecipients makes the next Save encrypt the file with GnuPG to
+// recipients instead. b.GPG must be set.
+func (b *FileBackend) SetGPGRecipients(recipients []string) {
+	b.key, b.ageRecipients, b.gpgRecipients = nil, nil, recipients
+}
+
+// GPGRecipients returns the GnuPG recipients the file is saved for, or nil if
+// it isn't encrypted with GnuPG.
+func (b *FileBackend) GPGRecipients() []string {
+	return b.gpgRecipients
+}
+
+// Encrypted reports whether the file is saved encrypted.
+func (b *FileBackend) Encrypted() bool {
+	return b.key != nil || b.ageRecipients != nil || b.gpgRecipients != nil
+}
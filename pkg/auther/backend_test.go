@@ -0,0 +1,14 @@
+package auther_test
+
+import (
+	"testing"
+
+	"authinator/pkg/auther"
+	"authinator/pkg/auther/backendtest"
+)
+
+func TestFileBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T, path string) auther.Backend {
+		return auther.NewFileBackend(path, nil)
+	})
+}
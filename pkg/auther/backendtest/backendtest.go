@@ -0,0 +1,252 @@
+// Package backendtest tests implementations of auther.Backend, so that every
+// backend is held to what the Store expects of the file backend.
+package backendtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+// Open returns a backend keeping its vault at path, which doesn't exist
+// before the first call. Later calls with the same path must see what was
+// saved through the backends opened before.
+type Open func(t *testing.T, path string) auther.Backend
+
+// Run runs the tests every backend must pass as subtests of t.
+func Run(t *testing.T, open Open) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, open Open, path string)
+	}{
+		{"Empty", testEmpty},
+		{"RoundTrip", testRoundTrip},
+		{"StoreChanges", testStoreChanges},
+		{"ConcurrentChanges", testConcurrentChanges},
+		{"AddConflict", testAddConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open, filepath.Join(t.TempDir(), "data"))
+		})
+	}
+}
+
+func testEmpty(t *testing.T, open Open, path string) {
+	v, err := open(t, path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Entries) != 0 || len(v.Trash) != 0 {
+		t.Errorf("new backend: %+v", v)
+	}
+}
+
+func testRoundTrip(t *testing.T, open Open, path string) {
+	b := open(t, path)
+	created := time.Unix(1700000000, 0)
+	want := auther.Vault{
+		Version: auther.SchemaVersion,
+		Entries: []auther.Entry{
+			{Name: "github", Secret: testSecret},
+			{
+				Name: "bank", Secret: testSecret, Issuer: "Bank", Account: "alice@example.com",
+				Algorithm: "SHA256", Digits: 8, Period: 60, Tags: []string{"personal", "money"},
+				Aliases: []string{"b"}, Pin: 1, Uses: 3, CreatedAt: created, LastUsedAt: created.Add(time.Hour),
+				Notes:         "call first",
+				RecoveryCodes: []auther.RecoveryCode{{Code: "abcd-efgh"}, {Code: "ijkl-mnop", UsedAt: created}},
+			},
+			{Name: "steam", Secret: testSecret, Type: auther.TypeSteam},
+		},
+		Trash: []auther.TrashedEntry{
+			{Entry: auther.Entry{Name: "old", Secret: testSecret, Tags: []string{"work"}}, DeletedAt: created},
+		},
+	}
+	if err := b.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameVault(got, want) {
+		t.Errorf("loaded\n%+v\nwant\n%+v", got, want)
+	}
+
+	// The data outlives the backend.
+	if got, err := open(t, path).Load(); err != nil || !sameVault(got, want) {
+		t.Errorf("reopened: loaded %+v, %v", got, err)
+	}
+}
+
+// testStoreChanges makes every kind of change through a Store and checks
+// that a Store opened afterwards sees them.
+func testStoreChanges(t *testing.T, open Open, path string) {
+	s, err := auther.OpenBackend(open(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"github", "gitlab", "bank", "old"} {
+		if err := s.Add(auther.Entry{Name: name, Secret: testSecret}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	steps := []struct {
+		name string
+		err  error
+	}{
+		{"rename", s.Rename("gitlab", "GitLab", false)},
+		{"edit", func() error {
+			_, err := s.Edit("bank", func(e *auther.Entry) { e.Issuer, e.Digits, e.Tags = "Bank", 8, []string{"money"} })
+			return err
+		}()},
+		{"mark used", s.MarkUsed("github")},
+		{"trash", s.MoveToTrash("old")},
+		{"remove", s.Remove("github")},
+	}
+	for _, step := range steps {
+		if step.err != nil {
+			t.Fatalf("%s: %v", step.name, step.err)
+		}
+	}
+
+	reopened, err := auther.OpenBackend(open(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := entryNames(reopened.List()), []string{"GitLab", "bank"}; !slices.Equal(got, want) {
+		t.Errorf("entries: got %v, want %v", got, want)
+	}
+	if bank, _ := reopened.Get("bank"); bank.Issuer != "Bank" || bank.Digits != 8 || !bank.HasTag("money") {
+		t.Errorf("edited entry: %+v", bank)
+	}
+	if trash := reopened.Trashed(); len(trash) != 1 || trash[0].Name != "old" || trash[0].DeletedAt.IsZero() {
+		t.Errorf("trash: %+v", trash)
+	}
+}
+
+func testConcurrentChanges(t *testing.T, open Open, path string) {
+	s, err := auther.OpenBackend(open(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 40
+	for i := 0; i < n; i++ {
+		if err := s.Add(auther.Entry{Name: fmt.Sprintf("old%d", i), Secret: testSecret}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*n)
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			errs <- s.Add(auther.Entry{Name: fmt.Sprintf("new%d", i), Secret: testSecret})
+		}()
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				errs <- s.Remove(fmt.Sprintf("old%d", i))
+			} else {
+				errs <- s.MoveToTrash(fmt.Sprintf("old%d", i))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.List()
+			s.Get(fmt.Sprintf("old%d", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Every change was saved, none lost to another.
+	reopened, err := auther.OpenBackend(open(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := entryNames(reopened.List())
+	slices.Sort(names)
+	var want []string
+	for i := 0; i < n; i++ {
+		want = append(want, fmt.Sprintf("new%d", i))
+	}
+	slices.Sort(want)
+	if !slices.Equal(names, want) {
+		t.Errorf("entries: got %v, want %v", names, want)
+	}
+	if trashed := len(reopened.Trashed()); trashed != n/2 {
+		t.Errorf("%d entries in the trash, want %d", trashed, n/2)
+	}
+}
+
+func testAddConflict(t *testing.T, open Open, path string) {
+	s, err := auther.OpenBackend(open(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(auther.Entry{Name: "GitHub", Secret: testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	added := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			added <- s.Add(auther.Entry{Name: "dup", Secret: testSecret}) == nil
+		}()
+	}
+	wg.Wait()
+	close(added)
+	count := 0
+	for ok := range added {
+		if ok {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("dup was added %d times, want once", count)
+	}
+	if err := s.Add(auther.Entry{Name: "github", Secret: testSecret}); err == nil {
+		t.Error("adding github next to GitHub succeeded")
+	}
+}
+
+// sameVault reports whether a and b hold the same data. Times compare as
+// they are written, whatever their location.
+func sameVault(a, b auther.Vault) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		panic(err)
+	}
+	return bytes.Equal(ja, jb)
+}
+
+func entryNames(entries []auther.Entry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
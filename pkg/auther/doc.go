@@ -0,0 +1,23 @@
+// Package auther stores TOTP entries and generates their codes. It is the
+// library behind the authinator command and its HTTP server, and reads and
+// writes the same data file, encrypted or not.
+//
+// Open a data file, add an entry and get its current code:
+//
+//	store, err := auther.Open("totp.json", nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	entry := auther.Entry{Name: "github", Secret: "JBSWY3DPEHPK3PXP"}
+//	if err := entry.Validate(); err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := store.Add(entry); err != nil {
+//		log.Fatal(err)
+//	}
+//	code, err := store.Code("github", time.Now())
+//
+// Entries can also be read from otpauth:// URIs with ParseURI. A Store is
+// safe for concurrent use, and every change is written to disk before the
+// call returns.
+package auther
@@ -0,0 +1,308 @@
+package auther
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Entry is one TOTP account. Digits, Period and Algorithm are zero when the
+// entry uses the defaults. Type is empty for standard TOTP entries and
+// TypeSteam for Steam Guard. CreatedAt and LastUsedAt are zero for entries
+// added, or last used, before they were recorded, and Uses counts the codes
+// requested since. Aliases are other names the entry can be looked up by.
+// Pin is 0 for an ordinary entry; favorites are pinned with increasing Pin
+// and listed first in that order. Notes and RecoveryCodes are private to the
+// entry's owner, like Secret.
+type Entry struct {
+	Name      string   `json:"name"`
+	Secret    string   `json:"secret"`
+	Type      string   `json:"type,omitempty"`
+	Issuer    string   `json:"issuer,omitempty"`
+	Account   string   `json:"account,omitempty"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	Digits    int      `json:"digits,omitempty"`
+	Period    int      `json:"period,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Pin       int      `json:"pin,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at,omitzero"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	Uses       int       `json:"uses,omitempty"`
+
+	Notes         string         `json:"notes,omitempty"`
+	RecoveryCodes []RecoveryCode `json:"recovery_codes,omitempty"`
+
+	source SecretSource
+}
+
+// SecretSource supplies the secret of an entry that is kept outside the
+// vault, such as in the OS keyring.
+type SecretSource interface {
+	Secret() (string, error)
+}
+
+// ErrNoSecret is returned for an entry with neither a secret nor a
+// SecretSource.
+var ErrNoSecret = errors.New("entry has no secret")
+
+// Defaults used when an entry doesn't specify its own parameters, matching
+// what nearly every service (and Google Authenticator) assumes.
+const (
+	DefaultDigits    = 6
+	DefaultPeriod    = 30
+	DefaultAlgorithm = "SHA1"
+)
+
+// hashes are the HMAC hash functions of each algorithm.
+var hashes = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+// ParseAlgorithm normalizes an algorithm name such as "sha256" to the form
+// stored on entries.
+func ParseAlgorithm(name string) (string, error) {
+	name = strings.ToUpper(strings.ReplaceAll(name, "-", ""))
+	if _, ok := hashes[name]; !ok {
+		return "", fmt.Errorf("unsupported algorithm %q (use SHA1, SHA256 or SHA512)", name)
+	}
+	return name, nil
+}
+
+// CodeDigits returns the number of digits in the entry's codes, or of
+// characters for Steam Guard codes.
+func (e Entry) CodeDigits() int {
+	if e.IsSteam() {
+		return steamCodeLength
+	}
+	if e.Digits == 0 {
+		return DefaultDigits
+	}
+	return e.Digits
+}
+
+// CodePeriod returns how many seconds each of the entry's codes is valid for.
+func (e Entry) CodePeriod() int64 {
+	if e.Period == 0 {
+		return DefaultPeriod
+	}
+	return int64(e.Period)
+}
+
+// CodeAlgorithm returns the entry's HMAC algorithm.
+func (e Entry) CodeAlgorithm() string {
+	if e.Algorithm == "" {
+		return DefaultAlgorithm
+	}
+	return e.Algorithm
+}
+
+// SetSecretSource makes the entry look its secret up in src, so it can be
+// stored without one.
+func (e *Entry) SetSecretSource(src SecretSource) {
+	e.Secret = ""
+	e.source = src
+}
+
+// SecretSource returns where the entry's secret is looked up, or nil.
+func (e Entry) SecretSource() SecretSource {
+	return e.source
+}
+
+// SecretValue returns the entry's secret, looking it up in its SecretSource
+// if it has one and Secret is empty.
+func (e Entry) SecretValue() (string, error) {
+	switch {
+	case e.Secret != "":
+		return e.Secret, nil
+	case e.source != nil:
+		return e.source.Secret()
+	default:
+		return "", ErrNoSecret
+	}
+}
+
+// LoadSecret fills in Secret from the entry's SecretSource, for callers that
+// need the secret itself, such as exports.
+func (e *Entry) LoadSecret() error {
+	secret, err := e.SecretValue()
+	if err != nil {
+		return err
+	}
+	e.Secret = secret
+	return nil
+}
+
+// Code returns the entry's code for the period containing t. The decoded
+// key is wiped as soon as the code has been generated.
+func (e Entry) Code(t time.Time) (string, error) {
+	key, err := e.secretKey()
+	if err != nil {
+		return "", err
+	}
+	defer key.Wipe()
+	return key.code(e, uint64(t.Unix()/e.CodePeriod())), nil
+}
+
+// secretKey decodes the entry's secret into a Secret.
+func (e Entry) secretKey() (*Secret, error) {
+	secret, err := e.SecretValue()
+	if err != nil {
+		return nil, err
+	}
+	return NewSecret(secret)
+}
+
+// ExpiresIn returns how many seconds the code for t stays valid.
+func (e Entry) ExpiresIn(t time.Time) int64 {
+	return e.CodePeriod() - (t.Unix() % e.CodePeriod())
+}
+
+// NextPeriod returns when the code after the one for t starts.
+func (e Entry) NextPeriod(t time.Time) time.Time {
+	p := e.CodePeriod()
+	return time.Unix((t.Unix()/p+1)*p, 0)
+}
+
+// Verify reports whether code is the entry's code at t or within skew
+// periods either side of it. The comparison itself is constant-time.
+func (e Entry) Verify(code string, t time.Time, skew uint) (bool, error) {
+	if e.IsSteam() {
+		return false, ErrVerifyUnsupported
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != e.CodeDigits() {
+		return false, nil
+	}
+	key, err := e.secretKey()
+	if err != nil {
+		return false, err
+	}
+	defer key.Wipe()
+	return key.verify(e, code, t, skew), nil
+}
+
+// ValidateParams checks the entry's type and optional code parameters and
+// normalizes the algorithm name. Steam Guard entries can't change them.
+func (e *Entry) ValidateParams() error {
+	switch e.Type {
+	case "":
+	case TypeSteam:
+		if e.Digits != 0 || e.Period != 0 || e.Algorithm != "" {
+			return errors.New("Steam Guard entries always use 5-character codes every 30 seconds; leave out digits, period and algorithm")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported entry type %q", e.Type)
+	}
+	if e.Digits != 0 && (e.Digits < 6 || e.Digits > 8) {
+		return fmt.Errorf("invalid digits %d (must be between 6 and 8)", e.Digits)
+	}
+	if e.Period < 0 {
+		return fmt.Errorf("invalid period %d", e.Period)
+	}
+	if e.Algorithm != "" {
+		algorithm, err := ParseAlgorithm(e.Algorithm)
+		if err != nil {
+			return err
+		}
+		e.Algorithm = algorithm
+	}
+	return nil
+}
+
+// Validate normalizes the entry's secret and parameters, then generates a
+// code once to make sure the entry is usable before it is stored. A secret
+// from a SecretSource was checked when it was stored, so it isn't looked up.
+func (e *Entry) Validate() error {
+	e.Secret = NormalizeSecret(e.Secret)
+	if e.Secret == "" && e.source == nil {
+		return errors.New("secret must not be empty")
+	}
+	if err := e.ValidateParams(); err != nil {
+		return err
+	}
+	if e.Secret == "" {
+		return nil
+	}
+	if _, err := e.Code(time.Now()); err != nil {
+		return ErrInvalidSecret
+	}
+	return nil
+}
+
+// ErrInvalidSecret is returned by Validate for a secret that isn't base32.
+var ErrInvalidSecret = errors.New("secret is not valid base32 (it may only contain the letters A-Z and the digits 2-7)")
+
+// DecodeSecret decodes a base32 secret the same way code generation does,
+// tolerating whitespace, lowercase letters and missing padding.
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimSpace(secret))
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+	return base32.StdEncoding.DecodeString(secret)
+}
+
+// NormalizeSecret strips whitespace and padding and upper-cases the secret,
+// so "jbsw y3dp ehpk 3pxp" is stored as "JBSWY3DPEHPK3PXP".
+func NormalizeSecret(secret string) string {
+	secret = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, secret)
+	return strings.TrimRight(strings.ToUpper(secret), "=")
+}
+
+// HasTag reports whether the entry carries tag, ignoring case.
+func (e Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTags adds tags the entry doesn't already carry, ignoring case.
+func (e *Entry) AddTags(tags []string) {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !e.HasTag(tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+}
+
+// RemoveTags drops tags from the entry, ignoring case.
+func (e *Entry) RemoveTags(tags []string) {
+	kept := e.Tags[:0]
+	for _, t := range e.Tags {
+		drop := false
+		for _, tag := range tags {
+			if strings.EqualFold(t, tag) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			kept = append(kept, t)
+		}
+	}
+	e.Tags = kept
+	if len(e.Tags) == 0 {
+		e.Tags = nil
+	}
+}
@@ -0,0 +1,107 @@
+package auther
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the test vectors of RFC 6238,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+func TestCodeRFC6238(t *testing.T) {
+	e := Entry{Name: "rfc", Secret: rfc6238Secret, Digits: 8}
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+	for _, tt := range tests {
+		code, err := e.Code(time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d: got %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	now := time.Unix(1700000015, 0)
+	tests := []struct {
+		name  string
+		entry Entry
+	}{
+		{"defaults", Entry{Secret: testSecret}},
+		{"8 digits every 60s", Entry{Secret: testSecret, Digits: 8, Period: 60}},
+		{"SHA256", Entry{Secret: testSecret, Algorithm: "SHA256"}},
+	}
+	for _, tt := range tests {
+		period := time.Duration(tt.entry.CodePeriod()) * time.Second
+		codeAt := func(periods int) string {
+			code, err := tt.entry.Code(now.Add(time.Duration(periods) * period))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return code
+		}
+		cases := []struct {
+			periods int
+			skew    uint
+			valid   bool
+		}{
+			{0, 0, true},
+			{-1, 0, false},
+			{1, 0, false},
+			{0, 1, true},
+			{-1, 1, true},
+			{1, 1, true},
+			{-2, 1, false},
+			{2, 1, false},
+			{-2, 2, true},
+		}
+		for _, c := range cases {
+			code := codeAt(c.periods)
+			// Neighbouring codes can be the same by chance; such a
+			// case can't tell anything.
+			if c.periods != 0 && code == codeAt(0) {
+				continue
+			}
+			valid, err := tt.entry.Verify(code, now, c.skew)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid != c.valid {
+				t.Errorf("%s: code %+d periods away with skew %d: valid %v, want %v", tt.name, c.periods, c.skew, valid, c.valid)
+			}
+		}
+	}
+}
+
+func TestVerifyRejectsMalformedCodes(t *testing.T) {
+	e := Entry{Secret: testSecret}
+	now := time.Unix(1700000015, 0)
+	code, err := e.Code(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, given := range []string{"", code[:5], code + "0", "abcdef"} {
+		if valid, err := e.Verify(given, now, 1); valid || err != nil {
+			t.Errorf("%q: valid %v, error %v", given, valid, err)
+		}
+	}
+	if valid, _ := e.Verify(" "+code+" ", now, 0); !valid {
+		t.Errorf("%q with spaces around it isn't valid", code)
+	}
+	if _, err := (Entry{Type: TypeSteam, Secret: testSecret}).Verify("ABCDE", now, 1); err != ErrVerifyUnsupported {
+		t.Errorf("Steam Guard entry: error %v, want ErrVerifyUnsupported", err)
+	}
+}
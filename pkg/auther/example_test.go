@@ -0,0 +1,105 @@
+package auther_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// The secret of the RFC 6238 test vectors, "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func ExampleOpen() {
+	dir, err := os.MkdirTemp("", "auther")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The data file doesn't need to exist yet; it is written on the first
+	// change.
+	path := filepath.Join(dir, "totp.json")
+	store, err := auther.Open(path, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(store.List()), "entries")
+	if err := store.Add(auther.Entry{Name: "github", Secret: rfcSecret}); err != nil {
+		log.Fatal(err)
+	}
+
+	reopened, err := auther.Open(path, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, entry := range reopened.List() {
+		fmt.Println(entry.Name)
+	}
+	// Output:
+	// 0 entries
+	// github
+}
+
+func ExampleStore_Add() {
+	dir, err := os.MkdirTemp("", "auther")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := auther.Open(filepath.Join(dir, "totp.json"), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	entry := auther.Entry{Name: "GitHub", Secret: "jbsw y3dp ehpk 3pxp", Digits: 8}
+	if err := entry.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Add(entry); err != nil {
+		log.Fatal(err)
+	}
+	got, _ := store.Get("github")
+	fmt.Println(got.Name, got.Secret, got.CodeDigits())
+
+	// Names are unique without regard to case.
+	err = store.Add(auther.Entry{Name: "github", Secret: rfcSecret})
+	fmt.Println(errors.Is(err, auther.ErrExists), err)
+	// Output:
+	// GitHub JBSWY3DPEHPK3PXP 8
+	// true the name "github" is taken by the entry "GitHub", as names are compared without regard to case
+}
+
+func ExampleStore_Code() {
+	dir, err := os.MkdirTemp("", "auther")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := auther.Open(filepath.Join(dir, "totp.json"), nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Add(auther.Entry{Name: "rfc", Secret: rfcSecret, Digits: 8}); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, at := range []int64{59, 1111111109, 2000000000} {
+		code, err := store.Code("rfc", time.Unix(at, 0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(code)
+	}
+	_, err = store.Code("missing", time.Now())
+	fmt.Println(errors.Is(err, auther.ErrNotFound))
+	// Output:
+	// 94287082
+	// 07081804
+	// 69279037
+	// true
+}
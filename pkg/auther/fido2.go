@@ -0,0 +1,242 @@
+package auther
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// FIDO2 authenticators, such as YubiKeys, are used through the fido2-token,
+// fido2-cred and fido2-assert programs of libfido2, which talk CTAP2 to the
+// device and ask for its PIN on the terminal when it has one. Each enrolled
+// authenticator gets a credential of its own, which isn't stored on the
+// device, and its slot is wrapped with the output of the credential's
+// hmac-secret extension for a random salt, which takes a touch to get.
+
+// FIDO2RelyingParty is the relying party ID of the credentials authinator
+// creates.
+const FIDO2RelyingParty = "authinator"
+
+var (
+	// ErrFIDO2Missing is returned when the libfido2 programs can't be found.
+	ErrFIDO2Missing = errors.New("the libfido2 tools (fido2-token, fido2-cred and fido2-assert) aren't installed, or aren't on PATH")
+	// ErrNoAuthenticator is returned when no FIDO2 authenticator is
+	// plugged in.
+	ErrNoAuthenticator = errors.New("no FIDO2 authenticator is plugged in")
+	// ErrNotEnrolled is returned when none of the authenticators plugged in
+	// is enrolled for the data file.
+	ErrNotEnrolled = errors.New("none of the FIDO2 authenticators plugged in is enrolled for the data file")
+)
+
+// FIDO2 runs the libfido2 tools to enroll authenticators and unwrap keys
+// with them.
+type FIDO2 struct {
+	// Device is the authenticator to use, as listed by fido2-token -L; if
+	// empty, every one plugged in is tried.
+	Device string
+	// Touch, if set, is called before waiting for the authenticator to be
+	// touched, with its description.
+	Touch func(device string)
+}
+
+// run runs the libfido2 program name with args and input on stdin, returning
+// the lines it wrote to stdout, or its stderr as the error.
+func (f *FIDO2) run(input []string, name string, args ...string) ([]string, error) {
+	program, err := exec.LookPath(name)
+	if err != nil {
+		return nil, ErrFIDO2Missing
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, args...)
+	cmd.Stdin = strings.NewReader(strings.Join(input, "\n") + "\n")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			lines := strings.Split(msg, "\n")
+			return nil, fmt.Errorf("%s: %s", name, lines[len(lines)-1])
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, nil
+}
+
+// fido2Device is an authenticator as listed by fido2-token -L: its path, and
+// what it is.
+type fido2Device struct {
+	Path        string
+	Description string
+}
+
+// devices returns the authenticators to use.
+func (f *FIDO2) devices() ([]fido2Device, error) {
+	if f.Device != "" {
+		return []fido2Device{{Path: f.Device, Description: f.Device}}, nil
+	}
+	lines, err := f.run(nil, "fido2-token", "-L")
+	if err != nil {
+		return nil, err
+	}
+	// Lines look like "/dev/hidraw3: vendor=0x1050, product=0x0407
+	// (Yubico YubiKey OTP+FIDO+CCID)".
+	var devices []fido2Device
+	for _, line := range lines {
+		path, rest, ok := strings.Cut(line, ": ")
+		if !ok || path == "" {
+			continue
+		}
+		desc := path
+		if i := strings.LastIndex(rest, "("); i >= 0 && strings.HasSuffix(rest, ")") {
+			desc = rest[i+1:len(rest)-1] + " (" + path + ")"
+		}
+		devices = append(devices, fido2Device{Path: path, Description: desc})
+	}
+	if len(devices) == 0 {
+		return nil, ErrNoAuthenticator
+	}
+	return devices, nil
+}
+
+func randomBase64(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// hmacSecret gets the hmac-secret of credential for salt from the device,
+// which takes a touch.
+func (f *FIDO2) hmacSecret(device fido2Device, credential, salt []byte) ([]byte, error) {
+	cdh, err := randomBase64(32)
+	if err != nil {
+		return nil, err
+	}
+	if f.Touch != nil {
+		f.Touch(device.Description)
+	}
+	input := []string{cdh, FIDO2RelyingParty, base64.StdEncoding.EncodeToString(credential), base64.StdEncoding.EncodeToString(salt)}
+	lines, err := f.run(input, "fido2-assert", "-G", "-h", "-p", device.Path)
+	if err != nil {
+		return nil, err
+	}
+	// The hmac-secret comes last, after the client data hash, relying
+	// party, authenticator data and signature.
+	if len(lines) < 5 {
+		return nil, errors.New("fido2-assert: no hmac-secret in its output")
+	}
+	secret, err := base64.StdEncoding.DecodeString(lines[len(lines)-1])
+	if err != nil || len(secret) != keySize {
+		return nil, errors.New("fido2-assert: invalid hmac-secret in its output")
+	}
+	return secret, nil
+}
+
+// holds reports whether device can use credential, without waiting for a
+// touch.
+func (f *FIDO2) holds(device fido2Device, credential []byte) bool {
+	cdh, err := randomBase64(32)
+	if err != nil {
+		return false
+	}
+	input := []string{cdh, FIDO2RelyingParty, base64.StdEncoding.EncodeToString(credential)}
+	_, err = f.run(input, "fido2-assert", "-G", "-t", "up=false", device.Path)
+	return err == nil
+}
+
+// Enroll creates a credential with the hmac-secret extension on the
+// authenticator, which takes a touch, then a second touch to get its
+// hmac-secret, and returns key with a slot for it named name. See
+// Key.WithSlot for passphrase.
+func (f *FIDO2) Enroll(key *Key, passphrase []byte, name string) (*Key, error) {
+	devices, err := f.devices()
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) > 1 {
+		return nil, errors.New("more than one FIDO2 authenticator is plugged in; unplug the others or choose one with AUTHER_FIDO2_DEVICE")
+	}
+	device := devices[0]
+
+	cdh, err := randomBase64(32)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := randomBase64(32)
+	if err != nil {
+		return nil, err
+	}
+	if f.Touch != nil {
+		f.Touch(device.Description)
+	}
+	lines, err := f.run([]string{cdh, FIDO2RelyingParty, "authinator", userID}, "fido2-cred", "-M", "-h", device.Path)
+	if err != nil {
+		return nil, err
+	}
+	// The credential ID follows the client data hash, relying party,
+	// format and authenticator data.
+	if len(lines) < 5 {
+		return nil, errors.New("fido2-cred: no credential ID in its output")
+	}
+	credential, err := base64.StdEncoding.DecodeString(lines[4])
+	if err != nil || len(credential) == 0 {
+		return nil, errors.New("fido2-cred: invalid credential ID in its output")
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	secret, err := f.hmacSecret(device, credential, salt)
+	if err != nil {
+		return nil, err
+	}
+	slot := KeySlot{Type: SlotFIDO2, Name: name, Salt: salt, CredentialID: credential, RelyingParty: FIDO2RelyingParty}
+	return key.WithSlot(slot, secret, passphrase)
+}
+
+// Unlock opens the encrypted data file content with an enrolled
+// authenticator that is plugged in, and returns its key. It returns
+// ErrNoAuthenticator or ErrNotEnrolled if there is none to use.
+func (f *FIDO2) Unlock(content []byte) (*Key, error) {
+	if err := verifyChecksum(content); err != nil {
+		return nil, err
+	}
+	slots, err := FileSlots(content)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := f.devices()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		for _, slot := range slots {
+			if slot.Type != SlotFIDO2 || !f.holds(device, slot.CredentialID) {
+				continue
+			}
+			secret, err := f.hmacSecret(device, slot.CredentialID, slot.Salt)
+			if err != nil {
+				return nil, err
+			}
+			key, err := unwrapKey(slot, secret, FileSalt(content))
+			if err != nil {
+				return nil, fmt.Errorf("the slot of %s doesn't open with the authenticator's secret: %w", slot.Name, err)
+			}
+			if _, key, err = openSlots(content, key, slots); err != nil {
+				return nil, err
+			}
+			return key, nil
+		}
+	}
+	return nil, ErrNotEnrolled
+}
@@ -0,0 +1,543 @@
+package auther
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Encrypted data files are laid out as:
+//
+//	magic "AUTHER" | version (1 byte) | salt (16 bytes) | check (32 bytes) | nonce (12 bytes) | AES-256-GCM ciphertext | SHA-256 of all before (32 bytes)
+//
+// The version byte selects the layout and key derivation parameters so the
+// format can change later without breaking existing vaults. Version 1 files
+// have neither the check nor the checksum. The check is derived from the
+// passphrase along with the key, and the checksum covers the whole file, so
+// that a wrong passphrase can be told apart from a damaged file. Version 3
+// files, whose key is random and kept in key slots, have the slots between
+// the check and the nonce (see keyslot.go).
+const (
+	vaultMagic   = "AUTHER"
+	vaultVersion = 2
+	slotsVersion = 3
+
+	saltSize  = 16
+	keySize   = 32
+	checkSize = 32
+
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+// ErrDecryptionFailed is returned for a version 1 encrypted data file that
+// can't be opened with the passphrase given, which may be wrong or the file
+// damaged. Newer files fail with ErrWrongPassphrase or ErrCorrupted instead.
+var ErrDecryptionFailed = errors.New("decryption failed (wrong passphrase or corrupted file)")
+
+var (
+	// ErrWrongPassphrase is returned for an encrypted data file opened with
+	// the wrong passphrase.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrCorrupted is returned for an encrypted data file that was damaged
+	// or cut short.
+	ErrCorrupted = errors.New("the file is corrupted or incomplete")
+)
+
+// PassphraseFunc supplies the passphrase of an encrypted data file. It is
+// only called once the file turns out to be encrypted.
+type PassphraseFunc func() ([]byte, error)
+
+// IsEncrypted reports whether content is an encrypted data file.
+func IsEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(vaultMagic))
+}
+
+// A Key encrypts and decrypts data files. It is derived from a passphrase and
+// a salt, and the salt is stored in every file the key encrypts, so a key
+// that is kept, such as by the unlock agent, opens the data file again after
+// it has been saved with it. Each file still gets a fresh nonce.
+type Key struct {
+	salt  []byte
+	key   []byte
+	check []byte
+	// slots hold the key wrapped for each way of opening the file, if it
+	// is random rather than derived from the passphrase.
+	slots []KeySlot
+}
+
+// NewKey derives a key from passphrase with a new random salt.
+func NewKey(passphrase []byte) (*Key, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, check := deriveKey(passphrase, salt, vaultVersion)
+	return &Key{salt: salt, key: key, check: check}, nil
+}
+
+// Salt returns the salt k was derived with.
+func (k *Key) Salt() []byte {
+	return k.salt
+}
+
+// MarshalBinary returns k as bytes, so it can be handed to another process.
+// Key slots are left out; a key read back without them still opens the file
+// and saves it with the slots it has.
+func (k *Key) MarshalBinary() ([]byte, error) {
+	b := append([]byte{}, k.salt...)
+	b = append(b, k.key...)
+	return append(b, k.check...), nil
+}
+
+// UnmarshalBinary sets k from bytes returned by MarshalBinary.
+func (k *Key) UnmarshalBinary(b []byte) error {
+	if len(b) != saltSize+keySize+checkSize {
+		return errors.New("invalid key length")
+	}
+	b = append([]byte{}, b...)
+	k.salt, k.key, k.check, k.slots = b[:saltSize], b[saltSize:saltSize+keySize], b[saltSize+keySize:], nil
+	return nil
+}
+
+// Wipe overwrites the key, which can't be used afterwards.
+func (k *Key) Wipe() {
+	Wipe(k.key)
+	Wipe(k.check)
+}
+
+// FileSalt returns the salt of an encrypted data file, which tells which key
+// opens it, or nil if content isn't one in the current format.
+func FileSalt(content []byte) []byte {
+	offset := len(vaultMagic) + 1
+	if !IsEncrypted(content) || len(content) < offset+saltSize {
+		return nil
+	}
+	if version := content[offset-1]; version != vaultVersion && version != slotsVersion {
+		return nil
+	}
+	return content[offset : offset+saltSize]
+}
+
+// ReadFile reads the data file at path; a missing file reads as an empty
+// vault. For an encrypted file it calls passphrase, which may be nil for
+// callers that only handle plaintext files, and also returns the key derived
+// from it so the file can be written back the same way.
+func ReadFile(path string, passphrase PassphraseFunc) (Vault, *Key, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Vault{}, nil, nil
+	}
+	if err != nil {
+		return Vault{}, nil, fmt.Errorf("reading data file: %w", err)
+	}
+	return Decode(path, content, passphrase)
+}
+
+// Decode decrypts, if needed, and parses the contents of the data file at
+// path, as described for ReadFile. Files in an older format are upgraded in
+// memory; those in a newer one fail with a VersionError.
+func Decode(path string, content []byte, passphrase PassphraseFunc) (Vault, *Key, error) {
+	var v Vault
+	var key *Key
+	if IsAgeEncrypted(content) {
+		return v, nil, fmt.Errorf("reading data file: %w", ErrAgeEncrypted)
+	}
+	if IsGPGEncrypted(content) {
+		return v, nil, fmt.Errorf("reading data file: %w", ErrGPGEncrypted)
+	}
+	if IsEncrypted(content) {
+		if passphrase == nil {
+			return v, nil, errors.New("reading data file: the data file is encrypted")
+		}
+		p, err := passphrase()
+		if err != nil {
+			return v, nil, fmt.Errorf("reading passphrase: %w", err)
+		}
+		if content, key, err = decrypt(content, p); err != nil {
+			return v, nil, fmt.Errorf("reading data file: %w", err)
+		}
+		defer Wipe(content)
+	}
+
+	err := parse(path, content, &v)
+	return v, key, err
+}
+
+// DecodeWithKey decrypts the contents of the encrypted data file at path
+// with key and parses them, like Decode. It fails with ErrWrongPassphrase if
+// the file wasn't written with key.
+func DecodeWithKey(path string, content []byte, key *Key) (Vault, error) {
+	var v Vault
+	if !IsEncrypted(content) {
+		return v, errors.New("reading data file: the data file isn't encrypted with a passphrase")
+	}
+	salt := FileSalt(content)
+	if salt == nil {
+		// Version 1 files derive their key differently.
+		return v, fmt.Errorf("reading data file: %w", ErrWrongPassphrase)
+	}
+	if !bytes.Equal(salt, key.salt) {
+		return v, fmt.Errorf("reading data file: %w", ErrWrongPassphrase)
+	}
+	if key.slots == nil {
+		slots, err := FileSlots(content)
+		if err != nil {
+			return v, fmt.Errorf("reading data file: %w", err)
+		}
+		key.slots = slots
+	}
+	content, err := decryptWithKey(content, key.key, key.check)
+	if err != nil {
+		return v, fmt.Errorf("reading data file: %w", err)
+	}
+	defer Wipe(content)
+	err = parse(path, content, &v)
+	return v, err
+}
+
+// parse upgrades and unmarshals the plaintext content of the data file at
+// path into v, which is usually a *Vault.
+func parse(path string, content []byte, v any) error {
+	upgraded, err := upgrade(content)
+	if err == nil {
+		err = json.Unmarshal(upgraded, v)
+		// An upgraded copy holds the secrets too.
+		if len(content) > 0 && &upgraded[0] != &content[0] {
+			Wipe(upgraded)
+		}
+	}
+	var versionErr VersionError
+	if errors.As(err, &versionErr) {
+		return err
+	}
+	if err != nil {
+		if _, statErr := os.Stat(BackupPath(path)); statErr == nil {
+			return fmt.Errorf("parsing data file: %w (the previous version is saved as %s)", err, BackupPath(path))
+		}
+		return fmt.Errorf("parsing data file: %w", err)
+	}
+	return nil
+}
+
+// WriteFile saves v to path in the current format, encrypted with passphrase
+// unless it is nil. The file is replaced atomically and readable only by its
+// owner, and the previous version is kept at BackupPath(path).
+func WriteFile(path string, v Vault, passphrase []byte) error {
+	file, err := Encode(v, passphrase)
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, file)
+}
+
+// WriteFileWithKey saves v to path like WriteFile, but encrypted with key.
+func WriteFileWithKey(path string, v Vault, key *Key) error {
+	file, err := EncodeWithKey(v, key)
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, file)
+}
+
+// writeDataFile replaces the data file at path with content, as described
+// for WriteFile.
+func writeDataFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating data directory: %w", err)
+	}
+	if err := writeFileAtomic(path, content, 0600); err != nil {
+		return fmt.Errorf("writing data file: %w", err)
+	}
+	return nil
+}
+
+// Encode returns the contents of a data file holding v in the current
+// format, encrypted with passphrase unless it is nil. Decode reads it back.
+func Encode(v Vault, passphrase []byte) ([]byte, error) {
+	var key *Key
+	if passphrase != nil {
+		var err error
+		if key, err = NewKey(passphrase); err != nil {
+			return nil, fmt.Errorf("encrypting data: %w", err)
+		}
+	}
+	return EncodeWithKey(v, key)
+}
+
+// EncodeWithKey is Encode with a key in place of the passphrase.
+func EncodeWithKey(v Vault, key *Key) ([]byte, error) {
+	v.Version = SchemaVersion
+	file, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding data: %w", err)
+	}
+	if key != nil {
+		plaintext := file
+		file, err = encrypt(plaintext, key)
+		Wipe(plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting data: %w", err)
+		}
+	}
+	return file, nil
+}
+
+// deriveKey returns the encryption key for passphrase and salt, and the check
+// stored alongside it that tells whether a passphrase is the right one.
+// Version 1 files have no check, and their key is derived on its own.
+func deriveKey(passphrase, salt []byte, version byte) (key, check []byte) {
+	if version == 1 {
+		return argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, keySize), nil
+	}
+	derived := argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, keySize+checkSize)
+	return derived[:keySize], derived[keySize:]
+}
+
+func encrypt(plaintext []byte, key *Key) ([]byte, error) {
+	gcm, err := newGCM(key.key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(vaultMagic), vaultVersion)
+	header = append(header, key.salt...)
+	header = append(header, key.check...)
+	if key.slots != nil {
+		header[len(vaultMagic)] = slotsVersion
+		if header, err = appendSlots(header, key.slots); err != nil {
+			return nil, err
+		}
+	}
+	header = append(header, nonce...)
+
+	file := gcm.Seal(header, nonce, plaintext, header)
+	sum := sha256.Sum256(file)
+	return append(file, sum[:]...), nil
+}
+
+// decrypt decrypts content with passphrase, and returns the key it derived
+// to go with the plaintext. For a version 1 file, that is a key for the
+// current version with the same salt, which the file is written back with.
+func decrypt(content, passphrase []byte) ([]byte, *Key, error) {
+	offset := len(vaultMagic)
+	if len(content) < offset+1 {
+		return nil, nil, ErrCorrupted
+	}
+	version := content[offset]
+	if version != 1 && version != vaultVersion && version != slotsVersion {
+		return nil, nil, fmt.Errorf("unsupported data file version %d", version)
+	}
+	offset++
+	if version == slotsVersion {
+		return decryptSlots(content, passphrase)
+	}
+
+	if version == 1 {
+		// Version 1 files can't tell a wrong passphrase from a damaged
+		// file.
+		if len(content) < offset+saltSize {
+			return nil, nil, ErrDecryptionFailed
+		}
+		salt := content[offset : offset+saltSize]
+		key, _ := deriveKey(passphrase, salt, version)
+		plaintext, err := open(content, offset+saltSize, key, ErrDecryptionFailed)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, check := deriveKey(passphrase, salt, vaultVersion)
+		return plaintext, &Key{salt: append([]byte{}, salt...), key: key, check: check}, nil
+	}
+
+	if len(content) < offset+saltSize {
+		return nil, nil, ErrCorrupted
+	}
+	salt := append([]byte{}, content[offset:offset+saltSize]...)
+	key, check := deriveKey(passphrase, salt, version)
+	plaintext, err := decryptWithKey(content, key, check)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, &Key{salt: salt, key: key, check: check}, nil
+}
+
+// decryptWithKey decrypts content, a file in the current format, with key and
+// the check that goes with it.
+func decryptWithKey(content, key, check []byte) ([]byte, error) {
+	if err := verifyChecksum(content); err != nil {
+		return nil, err
+	}
+	content = content[:len(content)-sha256.Size]
+
+	offset := len(vaultMagic) + 1 + saltSize
+	if len(content) < offset+checkSize {
+		return nil, ErrCorrupted
+	}
+	if subtle.ConstantTimeCompare(check, content[offset:offset+checkSize]) != 1 {
+		return nil, ErrWrongPassphrase
+	}
+	offset += checkSize
+	if content[len(vaultMagic)] == slotsVersion {
+		n, err := slotsLength(content, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset += 2 + n
+	}
+	return open(content, offset, key, ErrCorrupted)
+}
+
+// verifyChecksum checks the SHA-256 at the end of a file in the current
+// format.
+func verifyChecksum(content []byte) error {
+	if len(content) < len(vaultMagic)+1+sha256.Size {
+		return ErrCorrupted
+	}
+	sum := sha256.Sum256(content[:len(content)-sha256.Size])
+	if !bytes.Equal(sum[:], content[len(content)-sha256.Size:]) {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// open decrypts the AES-256-GCM ciphertext in content that follows the nonce
+// at offset, returning failed if that doesn't work.
+func open(content []byte, offset int, key []byte, failed error) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < offset+gcm.NonceSize() {
+		return nil, failed
+	}
+	nonce := content[offset : offset+gcm.NonceSize()]
+	header := content[:offset+gcm.NonceSize()]
+
+	plaintext, err := gcm.Open(nil, nonce, content[len(header):], header)
+	if err != nil {
+		return nil, failed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// BackupPath is where WriteFile keeps the previous version of path.
+func BackupPath(path string) string {
+	return path + ".bak"
+}
+
+// writeFileAtomic replaces path with content so that a crash or a full disk
+// never leaves a half-written file behind: the content goes to a temporary
+// file in the same directory, is synced, and is then renamed over path. An
+// existing file keeps its mode, and its previous version is kept at
+// BackupPath(path).
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := backupFile(path); err != nil {
+		return fmt.Errorf("backing up %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable. Directories can't be synced on every
+	// platform, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupFile replaces BackupPath(path) with the current contents of path, if
+// there are any. A hard link is enough because path is only ever replaced by
+// rename, never rewritten in place.
+func backupFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	backup := BackupPath(path)
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+	return CopyFile(path, backup)
+}
+
+// CopyFile copies src to dst, which must not exist yet, with the same
+// permissions.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,29 @@
+package auther
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+)
+
+// Sizes of the secrets GenerateSecret makes, in bits. RFC 4226 requires at
+// least 128 and recommends 160.
+const (
+	MinSecretBits     = 128
+	MaxSecretBits     = 512
+	DefaultSecretBits = 160
+)
+
+// GenerateSecret returns a new random secret of the given number of bits,
+// base32-encoded without padding. bits must be a multiple of 8 between
+// MinSecretBits and MaxSecretBits.
+func GenerateSecret(bits int) (string, error) {
+	if bits%8 != 0 || bits < MinSecretBits || bits > MaxSecretBits {
+		return "", fmt.Errorf("invalid secret size %d bits (must be a multiple of 8 between %d and %d)", bits, MinSecretBits, MaxSecretBits)
+	}
+	key := make([]byte, bits/8)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generating secret: %w", err)
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key), nil
+}
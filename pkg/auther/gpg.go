@@ -0,0 +1,211 @@
+package auther
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Data files can also be encrypted with GnuPG, by running the gpg program,
+// so that the keys and the gpg-agent already set up for it (hardware keys
+// included) protect the vault. The file is ASCII-armored, and like with age,
+// the recipients are kept inside the encrypted payload so every save encrypts
+// to the same keys.
+const gpgArmorHeader = "-----BEGIN PGP MESSAGE-----"
+
+var (
+	// ErrGPGEncrypted is returned by Decode for a data file encrypted with
+	// GnuPG, which DecodeGPG reads instead.
+	ErrGPGEncrypted = errors.New("the data file is encrypted with GnuPG")
+	// ErrGPGMissing is returned when the gpg program can't be found.
+	ErrGPGMissing = errors.New("gpg isn't installed, or isn't on PATH")
+	// ErrGPGNoSecretKey is returned for a file none of whose recipients'
+	// secret keys is in the keyring.
+	ErrGPGNoSecretKey = errors.New("none of the secret keys the file is encrypted to is available")
+	// ErrGPGKeyLocked is returned when gpg has the secret key but couldn't
+	// use it, because its passphrase couldn't be asked for or was wrong, or a
+	// hardware key wasn't present.
+	ErrGPGKeyLocked = errors.New("gpg couldn't unlock the secret key")
+)
+
+// GPG runs gpg to encrypt and decrypt data files.
+type GPG struct {
+	// Program is the gpg binary; if empty, gpg and then gpg2 are looked for
+	// on PATH.
+	Program string
+	// NonInteractive makes gpg fail with ErrGPGKeyLocked rather than ask
+	// for a passphrase, so decryption only works with a key the agent has
+	// already unlocked.
+	NonInteractive bool
+}
+
+// gpgFile is the payload of a GnuPG-encrypted data file.
+type gpgFile struct {
+	Vault
+	GPGRecipients []string `json:"gpg_recipients"`
+}
+
+// IsGPGEncrypted reports whether content is an OpenPGP message, armored or
+// binary.
+func IsGPGEncrypted(content []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte(gpgArmorHeader)) {
+		return true
+	}
+	// The first packet of a binary message is a public-key encrypted session
+	// key: tag 1 in the old format, which starts with 0x84 or 0x85, or in
+	// the new one, 0xc1.
+	return len(content) > 0 && (content[0] == 0x84 || content[0] == 0x85 || content[0] == 0xc1)
+}
+
+// program returns the path of the gpg binary.
+func (g *GPG) program() (string, error) {
+	if g.Program != "" {
+		if path, err := exec.LookPath(g.Program); err == nil {
+			return path, nil
+		}
+		return "", fmt.Errorf("%w (looked for %s)", ErrGPGMissing, g.Program)
+	}
+	for _, name := range []string{"gpg", "gpg2"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w (looked for gpg and gpg2)", ErrGPGMissing)
+}
+
+// run runs gpg with args and input on stdin, returning what it wrote to
+// stdout, or its stderr as the error.
+func (g *GPG) run(input []byte, args ...string) ([]byte, string, error) {
+	program, err := g.program()
+	if err != nil {
+		return nil, "", err
+	}
+	args = append([]string{"--batch", "--no-tty"}, args...)
+	if g.NonInteractive {
+		args = append([]string{"--pinentry-mode", "error"}, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	return stdout.Bytes(), stderr.String(), err
+}
+
+var (
+	gpgKeyLocked = regexp.MustCompile(`public key decryption failed: (.*)`)
+	gpgKeyID     = regexp.MustCompile(`encrypted with .*ID ([0-9A-F]+)`)
+)
+
+// Decrypt decrypts an OpenPGP message through gpg and its agent.
+func (g *GPG) Decrypt(ciphertext []byte) ([]byte, error) {
+	plaintext, stderr, err := g.run(ciphertext, "--decrypt")
+	if err == nil {
+		return plaintext, nil
+	}
+	if errors.Is(err, ErrGPGMissing) {
+		return nil, err
+	}
+	if m := gpgKeyLocked.FindStringSubmatch(stderr); m != nil {
+		return nil, fmt.Errorf("%w (%s)", ErrGPGKeyLocked, m[1])
+	}
+	if strings.Contains(stderr, "No secret key") {
+		var ids []string
+		for _, m := range gpgKeyID.FindAllStringSubmatch(stderr, -1) {
+			ids = append(ids, m[1])
+		}
+		if len(ids) == 0 {
+			return nil, ErrGPGNoSecretKey
+		}
+		return nil, fmt.Errorf("%w (it is encrypted to %s)", ErrGPGNoSecretKey, strings.Join(ids, ", "))
+	}
+	return nil, gpgError(stderr, err)
+}
+
+// Encrypt encrypts plaintext through gpg to recipients, which are key IDs,
+// fingerprints or user IDs gpg can find in its keyring. The result is
+// ASCII-armored.
+func (g *GPG) Encrypt(plaintext []byte, recipients []string) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no GnuPG recipients given")
+	}
+	args := []string{"--armor", "--encrypt"}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+	ciphertext, stderr, err := g.run(plaintext, args...)
+	if err != nil {
+		if errors.Is(err, ErrGPGMissing) {
+			return nil, err
+		}
+		return nil, gpgError(stderr, err)
+	}
+	return ciphertext, nil
+}
+
+// CheckRecipients checks that gpg can encrypt to recipients.
+func (g *GPG) CheckRecipients(recipients []string) error {
+	_, err := g.Encrypt([]byte("{}"), recipients)
+	return err
+}
+
+// gpgError turns the output of a failed gpg run into an error, using the line
+// about a recipient that was skipped, if there is one, or else the last line,
+// which usually says what went wrong.
+func gpgError(stderr string, err error) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for _, line := range lines {
+		if strings.Contains(line, "skipped: ") {
+			return errors.New(strings.TrimSpace(line))
+		}
+	}
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return errors.New(last)
+	}
+	return fmt.Errorf("gpg: %w", err)
+}
+
+// DecodeGPG decrypts with gpg and parses the contents of the GnuPG-encrypted
+// data file at path, like Decode. It also returns the recipients the file
+// was encrypted to, so it can be written back the same way; they are nil for
+// a file that was encrypted by hand with gpg.
+func DecodeGPG(path string, content []byte, gpg *GPG) (Vault, []string, error) {
+	content, err := gpg.Decrypt(content)
+	if err != nil {
+		return Vault{}, nil, fmt.Errorf("reading data file: %w", err)
+	}
+	var file gpgFile
+	if err := parse(path, content, &file); err != nil {
+		return Vault{}, nil, err
+	}
+	return file.Vault, file.GPGRecipients, nil
+}
+
+// EncodeGPG returns the contents of a data file holding v in the current
+// format, encrypted with gpg to recipients. DecodeGPG reads it back.
+func EncodeGPG(v Vault, recipients []string, gpg *GPG) ([]byte, error) {
+	v.Version = SchemaVersion
+	plaintext, err := json.MarshalIndent(gpgFile{Vault: v, GPGRecipients: recipients}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding data: %w", err)
+	}
+	file, err := gpg.Encrypt(plaintext, recipients)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting data: %w", err)
+	}
+	return file, nil
+}
+
+// WriteGPGFile saves v to path like WriteFile, but encrypted with gpg to
+// recipients.
+func WriteGPGFile(path string, v Vault, recipients []string, gpg *GPG) error {
+	file, err := EncodeGPG(v, recipients, gpg)
+	if err != nil {
+		return err
+	}
+	return writeDataFile(path, file)
+}
@@ -0,0 +1,179 @@
+// Package keyring keeps the secrets of an auther vault in the OS keyring:
+// the macOS Keychain, Windows Credential Manager, or the freedesktop Secret
+// Service on Linux. Everything else about the entries stays in the JSON data
+// file.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+
+	"authinator/pkg/auther"
+)
+
+// DefaultService is the keyring service entries are stored under, with the
+// entry name as the user.
+const DefaultService = "authinator"
+
+// Backend is an auther.Backend that stores secrets in the OS keyring and the
+// rest of each entry in a data file. Secrets are only fetched when a code is
+// generated.
+type Backend struct {
+	file    *auther.FileBackend
+	service string
+
+	// stored are the keys of the entries whose secrets are in the keyring.
+	stored map[string]bool
+}
+
+// New returns a backend for the entries in the data file handled by file.
+func New(file *auther.FileBackend, service string) *Backend {
+	return &Backend{file: file, service: service, stored: map[string]bool{}}
+}
+
+// item is the SecretSource of an entry whose secret is in the keyring. Its
+// key is the name the secret is stored under, which only differs from the
+// entry's name while a rename hasn't been saved yet.
+type item struct {
+	backend *Backend
+	mu      sync.Mutex
+	key     string
+}
+
+func (it *item) Secret() (string, error) {
+	it.mu.Lock()
+	key := it.key
+	it.mu.Unlock()
+
+	secret, err := keyring.Get(it.backend.service, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("the secret of %q is missing from the keyring", key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading the keyring: %w", err)
+	}
+	return secret, nil
+}
+
+func (it *item) storedAs() string {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.key
+}
+
+func (it *item) moveTo(key string) {
+	it.mu.Lock()
+	it.key = key
+	it.mu.Unlock()
+}
+
+// trashKey is the name the secret of a trashed entry is stored under, which
+// keeps it apart from a live entry, or another trashed one, of the same name.
+func trashKey(t auther.TrashedEntry) string {
+	return fmt.Sprintf("trash:%d:%s", t.DeletedAt.UnixNano(), t.Name)
+}
+
+// slot is an entry of the vault, live or trashed, with the name its secret
+// belongs under in the keyring.
+type slot struct {
+	key   string
+	entry *auther.Entry
+}
+
+func slots(v *auther.Vault) []slot {
+	s := make([]slot, 0, len(v.Entries)+len(v.Trash))
+	for i := range v.Entries {
+		s = append(s, slot{key: v.Entries[i].Name, entry: &v.Entries[i]})
+	}
+	for i := range v.Trash {
+		s = append(s, slot{key: trashKey(v.Trash[i]), entry: &v.Trash[i].Entry})
+	}
+	return s
+}
+
+// Load reads the data file. Entries without a secret get it from the
+// keyring; secrets still in the file are moved to the keyring by the next
+// Save.
+func (b *Backend) Load() (auther.Vault, error) {
+	v, err := b.file.Load()
+	if err != nil {
+		return v, err
+	}
+	b.stored = map[string]bool{}
+	for _, s := range slots(&v) {
+		if s.entry.Secret == "" {
+			s.entry.SetSecretSource(&item{backend: b, key: s.key})
+			b.stored[s.key] = true
+		}
+	}
+	return v, nil
+}
+
+// Save stores new and changed secrets in the keyring, writes everything else
+// to the data file, and then deletes the keyring items of entries that are
+// gone. Moving an entry to or from the trash moves its secret to a new key.
+func (b *Backend) Save(v auther.Vault) error {
+	// Secrets have to be read before anything is written, as a renamed
+	// entry's secret is still stored under its old name.
+	secrets := map[string]string{}
+	moved := map[*item]string{}
+	for _, s := range slots(&v) {
+		e := s.entry
+		if e.Secret != "" {
+			secrets[s.key] = e.Secret
+			continue
+		}
+		it, ok := e.SecretSource().(*item)
+		if ok && it.backend == b && it.storedAs() == s.key {
+			continue
+		}
+		secret, err := e.SecretValue()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		secrets[s.key] = secret
+		if ok {
+			moved[it] = s.key
+		}
+	}
+
+	for key, secret := range secrets {
+		if err := keyring.Set(b.service, key, secret); err != nil {
+			return fmt.Errorf("writing the secret of %q to the keyring: %w", key, err)
+		}
+	}
+
+	scrubbed := auther.Vault{
+		Entries: make([]auther.Entry, len(v.Entries)),
+		Trash:   make([]auther.TrashedEntry, len(v.Trash)),
+	}
+	copy(scrubbed.Entries, v.Entries)
+	copy(scrubbed.Trash, v.Trash)
+	for _, s := range slots(&scrubbed) {
+		s.entry.Secret = ""
+	}
+	if err := b.file.Save(scrubbed); err != nil {
+		return err
+	}
+	for it, key := range moved {
+		it.moveTo(key)
+	}
+
+	keys := map[string]bool{}
+	for _, s := range slots(&v) {
+		keys[s.key] = true
+	}
+	for key := range b.stored {
+		if keys[key] {
+			continue
+		}
+		if err := keyring.Delete(b.service, key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("deleting the secret of %q from the keyring: %w", key, err)
+		}
+	}
+	b.stored = keys
+	return nil
+}
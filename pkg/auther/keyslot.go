@@ -0,0 +1,261 @@
+package auther
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// A data file can also be encrypted with a random key that is kept in the
+// file wrapped (encrypted) several times over, once in each of its key slots:
+// one with a key derived from the passphrase, which always stays as a
+// fallback, and one for each FIDO2 authenticator enrolled, with the key its
+// hmac-secret extension returns. These are version 3 files, laid out like
+// version 2 ones with the slots, as a length (2 bytes) and JSON, between the
+// check and the nonce. The slots are part of the header, which the
+// ciphertext authenticates.
+
+// Key slot types.
+const (
+	SlotPassphrase = "passphrase"
+	SlotFIDO2      = "fido2"
+)
+
+// ErrNoSlot is returned when a key slot to remove doesn't exist.
+var ErrNoSlot = errors.New("no such key slot")
+
+// A KeySlot holds the key of a data file wrapped with a key of its own.
+type KeySlot struct {
+	Type string `json:"type"`
+	// Name tells enrolled authenticators apart.
+	Name string `json:"name,omitempty"`
+	// Salt is the argon2id salt of a passphrase slot, or the hmac-secret
+	// salt of a FIDO2 one.
+	Salt []byte `json:"salt"`
+	// CredentialID is the FIDO2 credential the authenticator created for
+	// the slot.
+	CredentialID []byte `json:"credential_id,omitempty"`
+	// RelyingParty is the FIDO2 relying party ID of the credential.
+	RelyingParty string `json:"rp_id,omitempty"`
+	// Wrapped is the nonce followed by the key and check, encrypted with
+	// AES-256-GCM.
+	Wrapped []byte `json:"wrapped"`
+}
+
+// Slots returns the key slots of k, or nil if k is derived from a
+// passphrase.
+func (k *Key) Slots() []KeySlot {
+	return k.slots
+}
+
+// HasPassphrase reports whether passphrase opens files encrypted with k.
+func (k *Key) HasPassphrase(passphrase []byte) bool {
+	if k.slots == nil {
+		_, check := deriveKey(passphrase, k.salt, vaultVersion)
+		return subtle.ConstantTimeCompare(check, k.check) == 1
+	}
+	for _, slot := range k.slots {
+		if slot.Type == SlotPassphrase {
+			_, err := unwrapKey(slot, passphraseWrapKey(passphrase, slot.Salt), k.salt)
+			return err == nil
+		}
+	}
+	return false
+}
+
+// WithSlot returns a copy of k with slot added, wrapped with wrap. A key
+// derived from a passphrase is first replaced with a random one, kept in a
+// passphrase slot for passphrase, which must be the one it was derived from.
+func (k *Key) WithSlot(slot KeySlot, wrap, passphrase []byte) (*Key, error) {
+	next := *k
+	if k.slots == nil {
+		if !k.HasPassphrase(passphrase) {
+			return nil, ErrWrongPassphrase
+		}
+		random, err := newRandomKey()
+		if err != nil {
+			return nil, err
+		}
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		fallback := KeySlot{Type: SlotPassphrase, Salt: salt}
+		if fallback.Wrapped, err = wrapKey(random, passphraseWrapKey(passphrase, salt)); err != nil {
+			return nil, err
+		}
+		next = *random
+		next.slots = []KeySlot{fallback}
+	}
+
+	var err error
+	if slot.Wrapped, err = wrapKey(&next, wrap); err != nil {
+		return nil, err
+	}
+	next.slots = append(append([]KeySlot{}, next.slots...), slot)
+	return &next, nil
+}
+
+// WithoutSlot returns a copy of k without the FIDO2 slot named name.
+func (k *Key) WithoutSlot(name string) (*Key, error) {
+	next := *k
+	next.slots = nil
+	found := false
+	for _, slot := range k.slots {
+		if slot.Type == SlotFIDO2 && slot.Name == name {
+			found = true
+			continue
+		}
+		next.slots = append(next.slots, slot)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrNoSlot, name)
+	}
+	return &next, nil
+}
+
+// newRandomKey returns a key that isn't derived from anything, to be kept in
+// key slots.
+func newRandomKey() (*Key, error) {
+	b := make([]byte, saltSize+keySize+checkSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	var k Key
+	err := k.UnmarshalBinary(b)
+	return &k, err
+}
+
+func passphraseWrapKey(passphrase, salt []byte) []byte {
+	return argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, keySize)
+}
+
+// wrapKey encrypts the key and check of k with wrap. The salt of k, which
+// identifies it, is authenticated along with them.
+func wrapKey(k *Key, wrap []byte) ([]byte, error) {
+	gcm, err := newGCM(wrap)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, append(append([]byte{}, k.key...), k.check...), k.salt), nil
+}
+
+// unwrapKey decrypts the key in slot with wrap, returning ErrWrongPassphrase
+// if wrap isn't the slot's key.
+func unwrapKey(slot KeySlot, wrap, salt []byte) (*Key, error) {
+	gcm, err := newGCM(wrap)
+	if err != nil {
+		return nil, err
+	}
+	if len(slot.Wrapped) < gcm.NonceSize() {
+		return nil, ErrCorrupted
+	}
+	nonce := slot.Wrapped[:gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, slot.Wrapped[gcm.NonceSize():], salt)
+	if err != nil || len(plain) != keySize+checkSize {
+		return nil, ErrWrongPassphrase
+	}
+	return &Key{salt: append([]byte{}, salt...), key: plain[:keySize], check: plain[keySize:]}, nil
+}
+
+// appendSlots appends the length and JSON of slots to header.
+func appendSlots(header []byte, slots []KeySlot) ([]byte, error) {
+	b, err := json.Marshal(slots)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0xffff {
+		return nil, errors.New("too many key slots")
+	}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(b)))
+	return append(header, b...), nil
+}
+
+// slotsLength returns the length of the slots JSON of a version 3 file,
+// which starts at offset.
+func slotsLength(content []byte, offset int) (int, error) {
+	if len(content) < offset+2 {
+		return 0, ErrCorrupted
+	}
+	n := int(binary.BigEndian.Uint16(content[offset:]))
+	if len(content) < offset+2+n {
+		return 0, ErrCorrupted
+	}
+	return n, nil
+}
+
+// FileSlots returns the key slots of an encrypted data file, or nil if its
+// key is derived from the passphrase.
+func FileSlots(content []byte) ([]KeySlot, error) {
+	offset := len(vaultMagic) + 1 + saltSize + checkSize
+	if !IsEncrypted(content) || len(content) <= len(vaultMagic) || content[len(vaultMagic)] != slotsVersion {
+		return nil, nil
+	}
+	n, err := slotsLength(content, offset)
+	if err != nil {
+		return nil, err
+	}
+	var slots []KeySlot
+	if err := json.Unmarshal(content[offset+2:offset+2+n], &slots); err != nil {
+		return nil, ErrCorrupted
+	}
+	if slots == nil {
+		slots = []KeySlot{}
+	}
+	return slots, nil
+}
+
+// hasFIDO2Slots reports whether content is an encrypted data file with a
+// FIDO2 key slot.
+func hasFIDO2Slots(content []byte) bool {
+	slots, _ := FileSlots(content)
+	for _, slot := range slots {
+		if slot.Type == SlotFIDO2 {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptSlots decrypts a version 3 file with the key in its passphrase
+// slot.
+func decryptSlots(content, passphrase []byte) ([]byte, *Key, error) {
+	if err := verifyChecksum(content); err != nil {
+		return nil, nil, err
+	}
+	slots, err := FileSlots(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, slot := range slots {
+		if slot.Type != SlotPassphrase {
+			continue
+		}
+		key, err := unwrapKey(slot, passphraseWrapKey(passphrase, slot.Salt), FileSalt(content))
+		if err != nil {
+			return nil, nil, err
+		}
+		return openSlots(content, key, slots)
+	}
+	return nil, nil, errors.New("the data file has no passphrase slot")
+}
+
+// openSlots decrypts a version 3 file with key, unwrapped from one of its
+// slots.
+func openSlots(content []byte, key *Key, slots []KeySlot) ([]byte, *Key, error) {
+	key.slots = slots
+	plaintext, err := decryptWithKey(content, key.key, key.check)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, key, nil
+}
@@ -0,0 +1,83 @@
+package auther
+
+import (
+	"slices"
+	"time"
+)
+
+// Pinned reports whether the entry is a favorite.
+func (e Entry) Pinned() bool {
+	return e.Pin > 0
+}
+
+// Pin marks the named entry as a favorite, after those already pinned, and
+// reports whether it wasn't one yet. It fails with ErrNotFound if there is
+// no such entry.
+func (v *Vault) Pin(name string) (bool, error) {
+	i := v.Index(name)
+	if i < 0 {
+		return false, ErrNotFound
+	}
+	if v.Entries[i].Pinned() {
+		return false, nil
+	}
+	v.Entries[i].Pin = v.LastPin() + 1
+	return true, nil
+}
+
+// Unpin makes the named entry an ordinary one again and reports whether it
+// was pinned. It fails with ErrNotFound if there is no such entry.
+func (v *Vault) Unpin(name string) (bool, error) {
+	i := v.Index(name)
+	if i < 0 {
+		return false, ErrNotFound
+	}
+	pinned := v.Entries[i].Pinned()
+	v.Entries[i].Pin = 0
+	return pinned, nil
+}
+
+// LastPin returns the highest Pin of any entry, or 0 if none is pinned.
+// Entries pinned elsewhere, such as imported ones, follow the pinned entries
+// of v when their Pin is offset by it.
+func (v Vault) LastPin() int {
+	last := 0
+	for _, entry := range v.Entries {
+		last = max(last, entry.Pin)
+	}
+	return last
+}
+
+// SortPinned moves pinned entries to the front in the order they were
+// pinned, leaving the others in the order they were in.
+func SortPinned[E any](entries []E, pin func(E) int) {
+	slices.SortStableFunc(entries, func(a, b E) int {
+		pa, pb := pin(a), pin(b)
+		switch {
+		case pa > 0 && pb > 0:
+			return pa - pb
+		case pa > 0:
+			return -1
+		case pb > 0:
+			return 1
+		}
+		return 0
+	})
+}
+
+// MostUsedPinned returns the position of the pinned entry whose codes were
+// requested most often, preferring the most recently used on a tie, or -1 if
+// none is pinned.
+func MostUsedPinned(entries []Entry) int {
+	best := -1
+	var bestUsed time.Time
+	for i, entry := range entries {
+		if !entry.Pinned() {
+			continue
+		}
+		if best < 0 || entry.Uses > entries[best].Uses || (entry.Uses == entries[best].Uses && entry.LastUsedAt.After(bestUsed)) {
+			best, bestUsed = i, entry.LastUsedAt
+		}
+	}
+	return best
+}
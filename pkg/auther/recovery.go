@@ -0,0 +1,81 @@
+package auther
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RecoveryCode is a one-time code a service hands out for when the
+// authenticator is lost. UsedAt is zero until the code has been used.
+type RecoveryCode struct {
+	Code   string    `json:"code"`
+	UsedAt time.Time `json:"used_at,omitzero"`
+}
+
+// Errors returned by UseRecoveryCode.
+var (
+	ErrRecoveryCodeUnknown = errors.New("no such recovery code")
+	ErrRecoveryCodeUsed    = errors.New("the recovery code has already been used")
+)
+
+// normalizeRecoveryCode returns the form codes are compared in: services
+// print them in groups, so spaces and dashes don't count, and neither does
+// case.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// AddRecoveryCodes stores the given codes on the entry as written, skipping
+// empty ones and those it already has, and returns how many it added.
+// Copies of the entry made before are left alone.
+func (e *Entry) AddRecoveryCodes(codes ...string) int {
+	e.RecoveryCodes = slices.Clone(e.RecoveryCodes)
+	seen := map[string]bool{}
+	for _, c := range e.RecoveryCodes {
+		seen[normalizeRecoveryCode(c.Code)] = true
+	}
+	added := 0
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		key := normalizeRecoveryCode(code)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		e.RecoveryCodes = append(e.RecoveryCodes, RecoveryCode{Code: code})
+		added++
+	}
+	return added
+}
+
+// UseRecoveryCode marks code as used at now, failing with
+// ErrRecoveryCodeUnknown or ErrRecoveryCodeUsed.
+func (e *Entry) UseRecoveryCode(code string, now time.Time) error {
+	e.RecoveryCodes = slices.Clone(e.RecoveryCodes)
+	key := normalizeRecoveryCode(code)
+	for i := range e.RecoveryCodes {
+		if normalizeRecoveryCode(e.RecoveryCodes[i].Code) != key {
+			continue
+		}
+		if !e.RecoveryCodes[i].UsedAt.IsZero() {
+			return ErrRecoveryCodeUsed
+		}
+		e.RecoveryCodes[i].UsedAt = now
+		return nil
+	}
+	return ErrRecoveryCodeUnknown
+}
+
+// UnusedRecoveryCodes returns how many of the entry's recovery codes haven't
+// been used yet.
+func (e Entry) UnusedRecoveryCodes() int {
+	n := 0
+	for _, c := range e.RecoveryCodes {
+		if c.UsedAt.IsZero() {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package auther
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the data file format written by this
+// package. Files without a version field predate versioning and count as
+// version 0.
+//
+// The history of the format:
+//
+//	0: {"entries": [...]}, with any later optional fields such as tags or
+//	   the trash, but algorithm names as they were typed, e.g. "sha256".
+//	1: adds "version"; algorithm names are always upper case.
+const SchemaVersion = 1
+
+// migrations[i] upgrades a decoded data file from version i to i+1. They
+// work on the generic JSON rather than on Vault so that they keep working
+// after fields they touch have changed or gone.
+var migrations = []func(doc map[string]any) error{
+	migrateV0,
+}
+
+// VersionError is returned for a data file written by a newer version of
+// authinator than this one, which it leaves untouched.
+type VersionError struct {
+	Version int
+}
+
+func (e VersionError) Error() string {
+	return fmt.Sprintf("the data file uses format version %d, but this version of authinator only understands up to version %d; "+
+		"upgrade authinator to open it (the file has not been changed)", e.Version, SchemaVersion)
+}
+
+// upgrade returns the JSON of a data file upgraded to SchemaVersion. Nothing
+// is written back; the upgraded form is only saved with the next change.
+func upgrade(content []byte) ([]byte, error) {
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(content, &head); err != nil {
+		return nil, err
+	}
+	switch {
+	case head.Version > SchemaVersion:
+		return nil, VersionError{head.Version}
+	case head.Version < 0:
+		return nil, fmt.Errorf("invalid format version %d", head.Version)
+	case head.Version == SchemaVersion:
+		return content, nil
+	}
+
+	// Numbers are kept as written, so large or precise values survive.
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	// A file holding just null has always read as an empty vault.
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	for version := head.Version; version < SchemaVersion; version++ {
+		if err := migrations[version](doc); err != nil {
+			return nil, fmt.Errorf("upgrading from format version %d: %w", version, err)
+		}
+		doc["version"] = version + 1
+	}
+	return json.Marshal(doc)
+}
+
+// entryObjects returns the JSON objects of every entry in doc, trashed ones
+// included.
+func entryObjects(doc map[string]any) []map[string]any {
+	var objects []map[string]any
+	for _, key := range []string{"entries", "trash"} {
+		list, _ := doc[key].([]any)
+		for _, item := range list {
+			if object, ok := item.(map[string]any); ok {
+				objects = append(objects, object)
+			}
+		}
+	}
+	return objects
+}
+
+// migrateV0 spells algorithm names the way Validate does, as files written
+// by hand could hold "sha256", which generated no codes. Names it doesn't
+// know are left for Validate to report.
+func migrateV0(doc map[string]any) error {
+	for _, entry := range entryObjects(doc) {
+		name, _ := entry["algorithm"].(string)
+		if algorithm, err := ParseAlgorithm(name); err == nil {
+			entry["algorithm"] = algorithm
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package auther
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeV0(t *testing.T) {
+	content, err := os.ReadFile("testdata/v0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded, err := upgrade(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Vault
+	if err := json.Unmarshal(upgraded, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != SchemaVersion {
+		t.Errorf("version %d, want %d", v.Version, SchemaVersion)
+	}
+	want := map[string]string{"github": "", "bank": "SHA256", "vpn": "SHA512", "odd": "md5"}
+	for _, e := range v.Entries {
+		if e.Algorithm != want[e.Name] {
+			t.Errorf("%s: algorithm %q, want %q", e.Name, e.Algorithm, want[e.Name])
+		}
+	}
+	if len(v.Entries) != len(want) {
+		t.Errorf("%d entries, want %d", len(v.Entries), len(want))
+	}
+	if len(v.Trash) != 1 || v.Trash[0].Algorithm != "SHA1" || v.Trash[0].DeletedAt.IsZero() {
+		t.Errorf("trash: %+v", v.Trash)
+	}
+	if bank := v.Entries[1]; bank.Digits != 8 || len(bank.Tags) != 1 {
+		t.Errorf("bank lost fields: %+v", bank)
+	}
+}
+
+func TestUpgradeVersions(t *testing.T) {
+	current, err := os.ReadFile("testdata/v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := os.ReadFile("testdata/v99.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded, err := upgrade(current)
+	if err != nil || !bytes.Equal(upgraded, current) {
+		t.Errorf("current version: got %s, %v; want it as it is", upgraded, err)
+	}
+
+	_, err = upgrade(newer)
+	var versionErr VersionError
+	if !errors.As(err, &versionErr) || versionErr.Version != 99 {
+		t.Errorf("newer version: error %v, want a VersionError for 99", err)
+	}
+
+	for _, content := range []string{`{"version": -1}`, `{"version": "1"}`, `[]`, `{`} {
+		if _, err := upgrade([]byte(content)); err == nil || errors.As(err, &versionErr) {
+			t.Errorf("%s: error %v", content, err)
+		}
+	}
+}
+
+func TestUpgradeNull(t *testing.T) {
+	content, err := os.ReadFile("testdata/null.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded, err := upgrade(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Vault
+	if err := json.Unmarshal(upgraded, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != SchemaVersion || len(v.Entries) != 0 {
+		t.Errorf("null upgraded to %s", upgraded)
+	}
+
+	s, err := Open(copyTestdata(t, "null.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := s.List(); len(entries) != 0 {
+		t.Errorf("entries of a null file: %+v", entries)
+	}
+	if _, err := s.Reload(); err != nil {
+		t.Errorf("reloading a null file: %v", err)
+	}
+}
+
+// TestOpenLeavesOlderFileAlone opens a version 0 file, which is upgraded in
+// memory but only written in the current format with the next change.
+func TestOpenLeavesOlderFileAlone(t *testing.T) {
+	path := copyTestdata(t, "v0.json")
+	before, _ := os.ReadFile(path)
+
+	s, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := s.Get("bank"); !ok || e.Algorithm != "SHA256" {
+		t.Errorf("bank: %+v, %v", e, ok)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+		t.Error("opening the file changed it")
+	}
+
+	if err := s.Add(Entry{Name: "new", Secret: testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := ReadFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != SchemaVersion || v.Entries[1].Algorithm != "SHA256" || len(v.Entries) != 5 {
+		t.Errorf("saved: version %d, entries %+v", v.Version, v.Entries)
+	}
+}
+
+func TestOpenNewerFile(t *testing.T) {
+	path := copyTestdata(t, "v99.json")
+	before, _ := os.ReadFile(path)
+
+	_, err := Open(path, nil)
+	var versionErr VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("error %v, want a VersionError", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+		t.Error("the file was changed")
+	}
+	if _, err := os.Stat(BackupPath(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a backup was written: %v", err)
+	}
+}
+
+// copyTestdata copies a file of testdata to a temporary directory and
+// returns its path there.
+func copyTestdata(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,147 @@
+package auther
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// A Secret is the decoded key of an entry, kept only while a code is
+// generated or checked. Its bytes live in memory of their own, locked so
+// they aren't written to swap where the platform allows it (see
+// allocSecret), and Wipe overwrites them, so the key doesn't linger in the
+// process, and in its core dumps, after it has been used. The base32 form
+// in Entry.Secret is a Go string and can't be wiped; it is kept as read
+// from the data file and never copied into other buffers.
+type Secret struct {
+	b       []byte
+	mapping []byte
+}
+
+// NewSecret decodes a base32 secret the way DecodeSecret does, into a
+// Secret that must be wiped with Wipe once it has been used.
+func NewSecret(secret string) (*Secret, error) {
+	secret = strings.TrimSpace(secret)
+	s := &Secret{}
+	s.b, s.mapping = allocSecret(len(secret))
+	copy(s.b, secret)
+	n, ok := decodeBase32(s.b)
+	if !ok {
+		s.Wipe()
+		return nil, ErrInvalidSecret
+	}
+	clear(s.b[n:])
+	s.b = s.b[:n]
+	return s, nil
+}
+
+// decodeBase32 decodes the base32 in b in place and returns the length of
+// the result. Unlike encoding/base32, which copies what it decodes, it keeps
+// the key out of buffers that aren't wiped. Letters may be in either case
+// and the padding may be left out.
+func decodeBase32(b []byte) (int, bool) {
+	end := len(b)
+	for end > 0 && b[end-1] == '=' {
+		end--
+	}
+	var acc uint64
+	bits, chars, n := 0, 0, 0
+	for _, c := range b[:end] {
+		var v byte
+		switch {
+		case 'A' <= c && c <= 'Z':
+			v = c - 'A'
+		case 'a' <= c && c <= 'z':
+			v = c - 'a'
+		case '2' <= c && c <= '7':
+			v = c - '2' + 26
+		case c == '\r' || c == '\n':
+			continue
+		default:
+			return 0, false
+		}
+		acc = acc<<5 | uint64(v)
+		bits += 5
+		chars++
+		if bits >= 8 {
+			bits -= 8
+			b[n] = byte(acc >> bits)
+			n++
+		}
+	}
+	// A last group of 1, 3 or 6 characters doesn't encode whole bytes.
+	switch chars % 8 {
+	case 1, 3, 6:
+		return 0, false
+	}
+	return n, true
+}
+
+// Bytes returns the key, which is only valid until Wipe is called.
+func (s *Secret) Bytes() []byte {
+	return s.b
+}
+
+// Wipe overwrites the key and releases its memory.
+func (s *Secret) Wipe() {
+	if s.b != nil {
+		freeSecret(s.b, s.mapping)
+		s.b, s.mapping = nil, nil
+	}
+}
+
+// Wipe overwrites b, which held a secret such as a passphrase or a decrypted
+// data file, with zeroes.
+func Wipe(b []byte) {
+	clear(b)
+}
+
+// hotp returns the HOTP value (RFC 4226) of the key for counter, before it
+// is reduced to digits. The HMAC state derived from the key is left to the
+// garbage collector.
+func (s *Secret) hotp(algorithm string, counter uint64) uint32 {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(hashes[algorithm], s.b)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	defer Wipe(sum)
+
+	offset := sum[len(sum)-1] & 0xf
+	return binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+}
+
+// code returns the code of entry e, whose key s is, for counter.
+func (s *Secret) code(e Entry, counter uint64) string {
+	value := s.hotp(e.CodeAlgorithm(), counter)
+	if e.IsSteam() {
+		return steamCode(value)
+	}
+	digits := e.CodeDigits()
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	code := []byte(strings.Repeat("0", digits))
+	for i, v := digits-1, value%mod; v > 0; i, v = i-1, v/10 {
+		code[i] = byte('0' + v%10)
+	}
+	return string(code)
+}
+
+// verify reports whether code is the code of entry e, whose key s is, for
+// one of the periods from skew before t to skew after it, comparing each
+// in constant time.
+func (s *Secret) verify(e Entry, code string, t time.Time, skew uint) bool {
+	counter := uint64(t.Unix() / e.CodePeriod())
+	valid := 0
+	for i := -int64(skew); i <= int64(skew); i++ {
+		if int64(counter)+i < 0 {
+			continue
+		}
+		valid |= subtle.ConstantTimeCompare([]byte(s.code(e, uint64(int64(counter)+i))), []byte(code))
+	}
+	return valid == 1
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package auther
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocSecret returns n bytes for a key, in pages of their own mapped
+// outside the Go heap, so the garbage collector never copies them, and
+// locked into memory so they aren't swapped out. The lock is best effort:
+// it fails quietly past RLIMIT_MEMLOCK. mapping is the memory to pass to
+// freeSecret, or nil if it had to come from the heap after all.
+func allocSecret(n int) (b, mapping []byte) {
+	page := os.Getpagesize()
+	size := max((n+page-1)/page*page, page)
+	mapping, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, n), nil
+	}
+	unix.Mlock(mapping)
+	return mapping[:n], mapping
+}
+
+// freeSecret wipes and releases memory from allocSecret.
+func freeSecret(b, mapping []byte) {
+	clear(b)
+	if mapping != nil {
+		clear(mapping)
+		unix.Munmap(mapping)
+	}
+}
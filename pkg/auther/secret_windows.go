@@ -0,0 +1,14 @@
+//go:build windows
+
+package auther
+
+// On Windows keys are kept on the Go heap, which can't be locked into
+// memory, and are only wiped.
+
+func allocSecret(n int) (b, mapping []byte) {
+	return make([]byte, n), nil
+}
+
+func freeSecret(b, mapping []byte) {
+	clear(b)
+}
@@ -0,0 +1,304 @@
+// Package sqlite keeps an auther vault in an SQLite database, one row per
+// entry. It needs cgo.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"authinator/pkg/auther"
+)
+
+// schema keeps the entries in list order; tags, aliases and recovery codes are JSON
+// arrays and times are unix seconds, 0 if unknown. Trashed entries have the same columns plus
+// the time they were removed at.
+const schema = `
+CREATE TABLE IF NOT EXISTS entries (
+	position     INTEGER NOT NULL,
+	name         TEXT NOT NULL,
+	secret       TEXT NOT NULL,
+	type         TEXT NOT NULL DEFAULT '',
+	issuer       TEXT NOT NULL DEFAULT '',
+	account      TEXT NOT NULL DEFAULT '',
+	algorithm    TEXT NOT NULL DEFAULT '',
+	digits       INTEGER NOT NULL DEFAULT 0,
+	period       INTEGER NOT NULL DEFAULT 0,
+	tags         TEXT NOT NULL DEFAULT '',
+	created_at   INTEGER NOT NULL DEFAULT 0,
+	last_used_at INTEGER NOT NULL DEFAULT 0,
+	notes        TEXT NOT NULL DEFAULT '',
+	recovery     TEXT NOT NULL DEFAULT '',
+	aliases      TEXT NOT NULL DEFAULT '',
+	pin          INTEGER NOT NULL DEFAULT 0,
+	uses         INTEGER NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX IF NOT EXISTS entries_name ON entries (name);
+CREATE TABLE IF NOT EXISTS trash (
+	position     INTEGER NOT NULL,
+	name         TEXT NOT NULL,
+	secret       TEXT NOT NULL,
+	type         TEXT NOT NULL DEFAULT '',
+	issuer       TEXT NOT NULL DEFAULT '',
+	account      TEXT NOT NULL DEFAULT '',
+	algorithm    TEXT NOT NULL DEFAULT '',
+	digits       INTEGER NOT NULL DEFAULT 0,
+	period       INTEGER NOT NULL DEFAULT 0,
+	tags         TEXT NOT NULL DEFAULT '',
+	created_at   INTEGER NOT NULL DEFAULT 0,
+	last_used_at INTEGER NOT NULL DEFAULT 0,
+	notes        TEXT NOT NULL DEFAULT '',
+	recovery     TEXT NOT NULL DEFAULT '',
+	aliases      TEXT NOT NULL DEFAULT '',
+	pin          INTEGER NOT NULL DEFAULT 0,
+	uses         INTEGER NOT NULL DEFAULT 0,
+	deleted_at   INTEGER NOT NULL
+);
+`
+
+// columns are the entry columns shared by both tables.
+const columns = `name, secret, type, issuer, account, algorithm, digits, period, tags, created_at, last_used_at, notes, recovery, aliases, pin, uses`
+
+// addedColumns are the columns added since the first release of each table,
+// which older databases get on open.
+var addedColumns = []struct{ table, name, definition string }{
+	{"entries", "type", `TEXT NOT NULL DEFAULT ''`},
+	{"entries", "created_at", `INTEGER NOT NULL DEFAULT 0`},
+	{"entries", "last_used_at", `INTEGER NOT NULL DEFAULT 0`},
+	{"trash", "created_at", `INTEGER NOT NULL DEFAULT 0`},
+	{"trash", "last_used_at", `INTEGER NOT NULL DEFAULT 0`},
+	{"entries", "notes", `TEXT NOT NULL DEFAULT ''`},
+	{"entries", "recovery", `TEXT NOT NULL DEFAULT ''`},
+	{"trash", "notes", `TEXT NOT NULL DEFAULT ''`},
+	{"trash", "recovery", `TEXT NOT NULL DEFAULT ''`},
+	{"entries", "aliases", `TEXT NOT NULL DEFAULT ''`},
+	{"trash", "aliases", `TEXT NOT NULL DEFAULT ''`},
+	{"entries", "pin", `INTEGER NOT NULL DEFAULT 0`},
+	{"entries", "uses", `INTEGER NOT NULL DEFAULT 0`},
+	{"trash", "pin", `INTEGER NOT NULL DEFAULT 0`},
+	{"trash", "uses", `INTEGER NOT NULL DEFAULT 0`},
+}
+
+// Backend is an auther.Backend backed by an SQLite database.
+type Backend struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it readable only by its owner if
+// it doesn't exist yet.
+func Open(path string) (*Backend, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+	// SQLite would create the file with the umask's permissions, and gives
+	// its journal the same mode as the database.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	f.Close()
+
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	for _, c := range addedColumns {
+		if err := addColumn(db, c.table, c.name, c.definition); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("upgrading database: %w", err)
+		}
+	}
+	return &Backend{db: db}, nil
+}
+
+// addColumn adds a column to a table created before it existed.
+func addColumn(db *sql.DB, table, name, definition string) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, name).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + name + ` ` + definition)
+	return err
+}
+
+// Close closes the database.
+func (b *Backend) Close() error {
+	return b.db.Close()
+}
+
+// Load reads every entry, and the trash.
+func (b *Backend) Load() (auther.Vault, error) {
+	v := auther.Vault{Version: auther.SchemaVersion}
+	rows, err := b.db.Query(`SELECT ` + columns + ` FROM entries ORDER BY position`)
+	if err != nil {
+		return v, fmt.Errorf("reading database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e auther.Entry
+		if err := scanEntry(rows, &e); err != nil {
+			return v, err
+		}
+		v.Entries = append(v.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return v, fmt.Errorf("reading database: %w", err)
+	}
+
+	trash, err := b.db.Query(`SELECT ` + columns + `, deleted_at FROM trash ORDER BY position`)
+	if err != nil {
+		return v, fmt.Errorf("reading database: %w", err)
+	}
+	defer trash.Close()
+
+	for trash.Next() {
+		var t auther.TrashedEntry
+		var deleted int64
+		if err := scanEntry(trash, &t.Entry, &deleted); err != nil {
+			return v, err
+		}
+		t.DeletedAt = time.Unix(deleted, 0)
+		v.Trash = append(v.Trash, t)
+	}
+	if err := trash.Err(); err != nil {
+		return v, fmt.Errorf("reading database: %w", err)
+	}
+	return v, nil
+}
+
+// scanEntry reads the entry columns of a row into e, and any columns after
+// them into extra.
+func scanEntry(rows *sql.Rows, e *auther.Entry, extra ...any) error {
+	var tags, recovery, aliases string
+	var created, lastUsed int64
+	dest := append([]any{&e.Name, &e.Secret, &e.Type, &e.Issuer, &e.Account, &e.Algorithm, &e.Digits, &e.Period, &tags, &created, &lastUsed, &e.Notes, &recovery, &aliases, &e.Pin, &e.Uses}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return fmt.Errorf("reading database: %w", err)
+	}
+	e.CreatedAt, e.LastUsedAt = fromUnix(created), fromUnix(lastUsed)
+	if tags != "" {
+		if err := json.Unmarshal([]byte(tags), &e.Tags); err != nil {
+			return fmt.Errorf("reading tags of %q: %w", e.Name, err)
+		}
+	}
+	if recovery != "" {
+		if err := json.Unmarshal([]byte(recovery), &e.RecoveryCodes); err != nil {
+			return fmt.Errorf("reading recovery codes of %q: %w", e.Name, err)
+		}
+	}
+	if aliases != "" {
+		if err := json.Unmarshal([]byte(aliases), &e.Aliases); err != nil {
+			return fmt.Errorf("reading aliases of %q: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// entryValues returns the values of the entry columns for e.
+func entryValues(e auther.Entry) ([]any, error) {
+	tags, err := jsonColumn(e.Tags, len(e.Tags))
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := jsonColumn(e.RecoveryCodes, len(e.RecoveryCodes))
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := jsonColumn(e.Aliases, len(e.Aliases))
+	if err != nil {
+		return nil, err
+	}
+	return []any{e.Name, e.Secret, e.Type, e.Issuer, e.Account, e.Algorithm, e.Digits, e.Period, tags,
+		toUnix(e.CreatedAt), toUnix(e.LastUsedAt), e.Notes, recovery, aliases, e.Pin, e.Uses}, nil
+}
+
+// jsonColumn encodes a list of n items for a TEXT column, which is empty for
+// an empty list.
+func jsonColumn(v any, n int) (string, error) {
+	if n == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encoding data: %w", err)
+	}
+	return string(b), nil
+}
+
+// toUnix and fromUnix store zero times as 0.
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// Save replaces the stored entries and trash with v in a single transaction,
+// so an import either lands completely or not at all.
+func (b *Backend) Save(v auther.Vault) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("writing database: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM entries; DELETE FROM trash`); err != nil {
+		return fmt.Errorf("writing database: %w", err)
+	}
+	insert, err := tx.Prepare(`INSERT INTO entries (position, ` + columns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("writing database: %w", err)
+	}
+	defer insert.Close()
+
+	for i, e := range v.Entries {
+		values, err := entryValues(e)
+		if err != nil {
+			return err
+		}
+		if _, err := insert.Exec(append([]any{i}, values...)...); err != nil {
+			return fmt.Errorf("writing entry %q: %w", e.Name, err)
+		}
+	}
+
+	insertTrash, err := tx.Prepare(`INSERT INTO trash (position, ` + columns + `, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("writing database: %w", err)
+	}
+	defer insertTrash.Close()
+
+	for i, t := range v.Trash {
+		values, err := entryValues(t.Entry)
+		if err != nil {
+			return err
+		}
+		if _, err := insertTrash.Exec(append(append([]any{i}, values...), t.DeletedAt.Unix())...); err != nil {
+			return fmt.Errorf("writing trashed entry %q: %w", t.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("writing database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"authinator/pkg/auther"
+	"authinator/pkg/auther/backendtest"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+func openTest(t *testing.T) *Backend {
+	t.Helper()
+	b, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T, path string) auther.Backend {
+		b, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { b.Close() })
+		return b
+	})
+}
+
+func TestUniqueNames(t *testing.T) {
+	b := openTest(t)
+	before := auther.Vault{Version: auther.SchemaVersion, Entries: []auther.Entry{{Name: "github", Secret: testSecret}}}
+	if err := b.Save(before); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second "gitlab" breaks the unique index, so nothing of the save
+	// lands: the entries before it are rolled back with it.
+	import_ := auther.Vault{Version: auther.SchemaVersion, Entries: []auther.Entry{
+		{Name: "gitlab", Secret: testSecret},
+		{Name: "bank", Secret: testSecret},
+		{Name: "gitlab", Secret: testSecret},
+	}}
+	if err := b.Save(import_); err == nil {
+		t.Fatal("saving two entries named gitlab succeeded")
+	}
+	got, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, before) {
+		t.Errorf("after a failed save: %+v, want %+v", got.Entries, before.Entries)
+	}
+}
+
+func TestStoreRollsBackFailedImport(t *testing.T) {
+	b := openTest(t)
+	s, err := auther.OpenBackend(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(auther.Entry{Name: "github", Secret: testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Update(func(v *auther.Vault) error {
+		v.Entries = append(v.Entries, auther.Entry{Name: "bank", Secret: testSecret}, auther.Entry{Name: "bank", Secret: testSecret})
+		return nil
+	})
+	if err == nil {
+		t.Fatal("import with a name twice succeeded")
+	}
+	if names := entryNames(s.List()); !reflect.DeepEqual(names, []string{"github"}) {
+		t.Errorf("store has %v after the failed import", names)
+	}
+	v, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := entryNames(v.Entries); !reflect.DeepEqual(names, []string{"github"}) {
+		t.Errorf("database has %v after the failed import", names)
+	}
+}
+
+// TestUpgrade opens a database from the first release, which lacks the
+// columns added since, and keeps its entries.
+func TestUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+CREATE TABLE entries (
+	position  INTEGER NOT NULL,
+	name      TEXT NOT NULL,
+	secret    TEXT NOT NULL,
+	issuer    TEXT NOT NULL DEFAULT '',
+	account   TEXT NOT NULL DEFAULT '',
+	algorithm TEXT NOT NULL DEFAULT '',
+	digits    INTEGER NOT NULL DEFAULT 0,
+	period    INTEGER NOT NULL DEFAULT 0,
+	tags      TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE trash (
+	position   INTEGER NOT NULL,
+	name       TEXT NOT NULL,
+	secret     TEXT NOT NULL,
+	type       TEXT NOT NULL DEFAULT '',
+	issuer     TEXT NOT NULL DEFAULT '',
+	account    TEXT NOT NULL DEFAULT '',
+	algorithm  TEXT NOT NULL DEFAULT '',
+	digits     INTEGER NOT NULL DEFAULT 0,
+	period     INTEGER NOT NULL DEFAULT 0,
+	tags       TEXT NOT NULL DEFAULT '',
+	deleted_at INTEGER NOT NULL
+);
+INSERT INTO entries (position, name, secret, digits, tags) VALUES (0, 'github', 'JBSWY3DPEHPK3PXP', 8, '["work"]');
+`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	v, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []auther.Entry{{Name: "github", Secret: testSecret, Digits: 8, Tags: []string{"work"}}}
+	if !reflect.DeepEqual(v.Entries, want) {
+		t.Errorf("upgraded: %+v, want %+v", v.Entries, want)
+	}
+	v.Entries[0].Notes = "kept"
+	if err := b.Save(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func entryNames(entries []auther.Entry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
@@ -0,0 +1,35 @@
+package auther
+
+import (
+	"errors"
+	"strings"
+)
+
+// TypeSteam is the Type of entries that generate Steam Guard codes: five
+// characters from steamAlphabet every 30 seconds, derived from an HMAC-SHA1
+// of the time like a regular TOTP code.
+const TypeSteam = "steam"
+
+const (
+	steamAlphabet   = "23456789BCDFGHJKMNPQRTVWXY"
+	steamCodeLength = 5
+)
+
+// ErrVerifyUnsupported is returned by Verify for entries whose codes can't be
+// verified, such as Steam Guard entries.
+var ErrVerifyUnsupported = errors.New("Steam Guard codes can't be verified")
+
+// IsSteam reports whether the entry generates Steam Guard codes.
+func (e Entry) IsSteam() bool {
+	return e.Type == TypeSteam
+}
+
+// steamCode spells the HOTP value of a Steam Guard code in steamAlphabet.
+func steamCode(value uint32) string {
+	var code strings.Builder
+	for i := 0; i < steamCodeLength; i++ {
+		code.WriteByte(steamAlphabet[value%uint32(len(steamAlphabet))])
+		value /= uint32(len(steamAlphabet))
+	}
+	return code.String()
+}
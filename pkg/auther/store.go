@@ -0,0 +1,256 @@
+package auther
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// InvalidEntryError reports an edited entry that failed Validate.
+type InvalidEntryError struct {
+	Err error
+}
+
+func (e InvalidEntryError) Error() string {
+	return "invalid entry: " + e.Err.Error()
+}
+
+func (e InvalidEntryError) Unwrap() error {
+	return e.Err
+}
+
+// Store holds the entries of one backend and serializes access to them.
+// Changes are saved before the lock is released, so concurrent callers can't
+// overwrite each other's work. A Store is safe for concurrent use.
+type Store struct {
+	mu      sync.RWMutex
+	backend Backend
+	vault   Vault
+	changed chan struct{}
+}
+
+// Open reads the JSON data file at path, which doesn't need to exist yet. The
+// passphrase function is only called if the file is encrypted, and the file
+// stays encrypted with that passphrase when the store saves it.
+func Open(path string, passphrase PassphraseFunc) (*Store, error) {
+	return OpenBackend(NewFileBackend(path, passphrase))
+}
+
+// OpenBackend loads the vault kept by b.
+func OpenBackend(b Backend) (*Store, error) {
+	v, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{backend: b, vault: v, changed: make(chan struct{})}, nil
+}
+
+// List returns a copy of every entry.
+func (s *Store) List() []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Entry{}, s.vault.Entries...)
+}
+
+// Trashed returns a copy of the entries in the trash.
+func (s *Store) Trashed() []TrashedEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]TrashedEntry{}, s.vault.Trash...)
+}
+
+// ExpireTrash purges the trashed entries removed more than TrashExpiry before
+// now, saving only if there are any, and returns how many it purged.
+func (s *Store) ExpireTrash(now time.Time) (int, error) {
+	s.mu.RLock()
+	v := Vault{Trash: append([]TrashedEntry{}, s.vault.Trash...)}
+	s.mu.RUnlock()
+	if v.ExpireTrash(now) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	err := s.Update(func(v *Vault) error {
+		n = v.ExpireTrash(now)
+		return nil
+	})
+	return n, err
+}
+
+// Get returns the entry with the given name, ignoring case.
+func (s *Store) Get(name string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.vault.Find(name)
+}
+
+// Code returns the named entry's code for the period containing at.
+func (s *Store) Code(name string, at time.Time) (string, error) {
+	entry, ok := s.Get(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return entry.Code(at)
+}
+
+// Add adds an entry, failing with a ConflictError if its name is taken. The entry
+// should already have been checked with Validate.
+func (s *Store) Add(entry Entry) error {
+	return s.Update(func(v *Vault) error {
+		return v.Add(entry)
+	})
+}
+
+// Remove deletes the named entry for good, failing with ErrNotFound if there
+// is none.
+func (s *Store) Remove(name string) error {
+	return s.Update(func(v *Vault) error {
+		return v.Remove(name)
+	})
+}
+
+// MoveToTrash moves the named entry to the trash, failing with ErrNotFound if
+// there is none.
+func (s *Store) MoveToTrash(name string) error {
+	return s.Update(func(v *Vault) error {
+		return v.MoveToTrash(name, time.Now())
+	})
+}
+
+// MarkUsed records that a code of the named entry was just requested,
+// failing with ErrNotFound if there is none.
+func (s *Store) MarkUsed(name string) error {
+	return s.Update(func(v *Vault) error {
+		return v.MarkUsed(name, time.Now())
+	})
+}
+
+// Rename renames an entry as described for Vault.Rename.
+func (s *Store) Rename(oldName, newName string, force bool) error {
+	return s.Update(func(v *Vault) error {
+		return v.Rename(oldName, newName, force)
+	})
+}
+
+// Edit applies fn to the named entry and saves the result if it passes
+// Validate. It fails with ErrNotFound or an InvalidEntryError.
+func (s *Store) Edit(name string, fn func(entry *Entry)) (Entry, error) {
+	var edited Entry
+	err := s.Update(func(v *Vault) error {
+		i := v.Index(name)
+		if i < 0 {
+			return ErrNotFound
+		}
+
+		entry := v.Entries[i]
+		entry.Tags = append([]string(nil), entry.Tags...)
+		fn(&entry)
+		if err := entry.Validate(); err != nil {
+			return InvalidEntryError{err}
+		}
+		v.Entries[i] = entry
+		edited = entry
+		return nil
+	})
+	return edited, err
+}
+
+// Update applies fn to a copy of the vault and saves the result. If fn or the
+// save fails, the store is left as it was. If the backend is a Locker, it
+// stays locked meanwhile, and a vault another process saved since is loaded
+// first, so fn changes that rather than saving over it.
+func (s *Store) Update(fn func(v *Vault) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.backend.(Locker); ok {
+		unlock, err := l.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if l.Stale() {
+			v, err := s.backend.Load()
+			if err != nil {
+				return err
+			}
+			s.vault = v
+			close(s.changed)
+			s.changed = make(chan struct{})
+		}
+	}
+
+	v := s.vault
+	v.Entries = append([]Entry{}, s.vault.Entries...)
+	v.Trash = append([]TrashedEntry(nil), s.vault.Trash...)
+	if err := fn(&v); err != nil {
+		return err
+	}
+	if err := s.backend.Save(v); err != nil {
+		return err
+	}
+	s.vault = v
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return nil
+}
+
+// Changed returns a channel that is closed the next time the entries change.
+func (s *Store) Changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+// Reload loads the vault from the backend again, after something other than
+// the store changed it, and reports whether it differs from the vault the
+// store had. Calls in progress finish with the old vault first, and later
+// ones see the new one. If loading fails, or finds no entries where the
+// store has some, as when the data file was removed, the store keeps the
+// vault it had.
+func (s *Store) Reload() (changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.backend.Load()
+	if err != nil {
+		return false, err
+	}
+	if len(v.Entries) == 0 && len(s.vault.Entries) > 0 {
+		return false, errors.New("the stored entries have disappeared")
+	}
+	if sameVault(v, s.vault) {
+		return false, nil
+	}
+	s.vault = v
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return true, nil
+}
+
+// sameVault reports whether a and b would be saved the same way.
+func sameVault(a, b Vault) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// Check loads the vault back from the backend and reports whether it can
+// still be read. Finding no entries at all is only fine if the store is
+// empty too, as that is how a new vault starts out.
+func (s *Store) Check() error {
+	// Loading can change the backend's own state, so this is a write.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.backend.Load()
+	if err != nil {
+		return err
+	}
+	if len(v.Entries) == 0 && len(s.vault.Entries) > 0 {
+		return errors.New("the stored entries have disappeared")
+	}
+	return nil
+}
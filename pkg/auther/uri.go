@@ -0,0 +1,140 @@
+package auther
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// IsURI reports whether s looks like an otpauth:// URI.
+func IsURI(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), "otpauth://")
+}
+
+// ParseURI converts a Key URI as described at
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format into an
+// entry, keeping the issuer and code parameters it carries. URIs with the
+// issuer Steam, an encoder=steam parameter or the otpauth://steam/ form used
+// by some apps become Steam Guard entries.
+func ParseURI(raw string) (Entry, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return Entry{}, err
+	}
+	if !strings.EqualFold(u.Scheme, "otpauth") {
+		return Entry{}, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if !strings.EqualFold(u.Host, "totp") && !strings.EqualFold(u.Host, TypeSteam) {
+		return Entry{}, fmt.Errorf("unsupported OTP type %q (only totp is supported)", u.Host)
+	}
+
+	// u.Path is already percent-decoded, so "ACME%3Aalice" arrives as "ACME:alice".
+	label := strings.TrimPrefix(u.Path, "/")
+	var issuer, account string
+	if i := strings.Index(label, ":"); i >= 0 {
+		issuer, account = strings.TrimSpace(label[:i]), strings.TrimSpace(label[i+1:])
+	} else {
+		account = strings.TrimSpace(label)
+	}
+
+	q := u.Query()
+	if v := q.Get("issuer"); v != "" {
+		issuer = v
+	}
+
+	entry := Entry{
+		Name:    DefaultName(issuer, account),
+		Secret:  q.Get("secret"),
+		Issuer:  issuer,
+		Account: account,
+	}
+	if entry.Secret == "" {
+		return Entry{}, errors.New("missing secret parameter")
+	}
+	if entry.Name == "" {
+		return Entry{}, errors.New("missing label")
+	}
+
+	// Steam URIs often carry digits=5, which doesn't apply to Steam's
+	// alphabet, so the code parameters are ignored.
+	if strings.EqualFold(u.Host, TypeSteam) || strings.EqualFold(issuer, "Steam") || strings.EqualFold(q.Get("encoder"), TypeSteam) {
+		entry.Type = TypeSteam
+		return entry, nil
+	}
+
+	if v := q.Get("algorithm"); v != "" {
+		if entry.Algorithm, err = ParseAlgorithm(v); err != nil {
+			return Entry{}, err
+		}
+	}
+	if v := q.Get("digits"); v != "" {
+		if entry.Digits, err = strconv.Atoi(v); err != nil || entry.Digits < 6 || entry.Digits > 8 {
+			return Entry{}, fmt.Errorf("invalid digits %q", v)
+		}
+	}
+	if v := q.Get("period"); v != "" {
+		if entry.Period, err = strconv.Atoi(v); err != nil || entry.Period <= 0 {
+			return Entry{}, fmt.Errorf("invalid period %q", v)
+		}
+	}
+
+	return entry, nil
+}
+
+// DefaultName builds the default name for an imported entry.
+func DefaultName(issuer, account string) string {
+	switch {
+	case issuer == "":
+		return account
+	case account == "":
+		return issuer
+	default:
+		return issuer + " - " + account
+	}
+}
+
+// URI is the inverse of ParseURI. Parameters that are
+// left at their defaults are omitted to keep the URI short. Steam Guard
+// entries get the issuer Steam if they have none, and encoder=steam.
+func (e Entry) URI() string {
+	issuer := e.Issuer
+	if e.IsSteam() && issuer == "" {
+		issuer = "Steam"
+	}
+	label := e.Account
+	if label == "" {
+		label = e.Name
+	}
+	if issuer != "" {
+		label = issuer + ":" + label
+	}
+
+	q := url.Values{}
+	q.Set("secret", e.Secret)
+	if issuer != "" {
+		q.Set("issuer", issuer)
+	}
+	if e.IsSteam() {
+		q.Set("encoder", TypeSteam)
+	}
+	if e.Algorithm != "" {
+		q.Set("algorithm", e.Algorithm)
+	}
+	if e.Digits != 0 {
+		q.Set("digits", strconv.Itoa(e.Digits))
+	}
+	if e.Period != 0 {
+		q.Set("period", strconv.Itoa(e.Period))
+	}
+
+	u := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + label,
+		// Authenticator apps expect %20 rather than + for spaces.
+		RawQuery: strings.ReplaceAll(q.Encode(), "+", "%20"),
+	}
+	return u.String()
+}
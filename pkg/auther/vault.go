@@ -0,0 +1,211 @@
+package auther
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Vault is the contents of a data file. Removed entries stay in Trash until
+// they expire or the trash is emptied. Version is the format of the data
+// file, which is SchemaVersion for any vault a backend has loaded.
+type Vault struct {
+	Version int            `json:"version"`
+	Entries []Entry        `json:"entries"`
+	Trash   []TrashedEntry `json:"trash,omitempty"`
+}
+
+// TrashedEntry is a removed entry kept in the trash.
+type TrashedEntry struct {
+	Entry
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// TrashExpiry is how long removed entries stay in the trash.
+const TrashExpiry = 30 * 24 * time.Hour
+
+var (
+	// ErrNotFound is returned for a name no entry has.
+	ErrNotFound = errors.New("no entry found with that name")
+	// ErrExists is returned when a name is already taken.
+	ErrExists = errors.New("an entry with that name already exists")
+)
+
+// ConflictError is returned when a name is already taken by the entry called
+// Existing, which may differ from Name in case, or is one of its aliases if
+// Alias is set. It matches ErrExists with errors.Is.
+type ConflictError struct {
+	Name     string
+	Existing string
+	Alias    bool
+}
+
+func (e ConflictError) Error() string {
+	if e.Alias {
+		return fmt.Sprintf("%q is an alias of the entry %q", e.Name, e.Existing)
+	}
+	if e.Name == e.Existing {
+		return fmt.Sprintf("an entry named %q already exists", e.Name)
+	}
+	return fmt.Sprintf("the name %q is taken by the entry %q, as names are compared without regard to case", e.Name, e.Existing)
+}
+
+func (e ConflictError) Is(target error) bool {
+	return target == ErrExists
+}
+
+// SameName reports whether two entry names refer to the same entry. Names
+// are compared without regard to case, but keep the case they were given in.
+func SameName(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// Find returns the entry with the given name, ignoring case.
+func (v Vault) Find(name string) (Entry, bool) {
+	if i := v.Index(name); i >= 0 {
+		return v.Entries[i], true
+	}
+	return Entry{}, false
+}
+
+// Index returns the position of the entry with the given name, ignoring case,
+// or -1.
+func (v Vault) Index(name string) int {
+	for i, entry := range v.Entries {
+		if SameName(entry.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add appends an entry, failing with a ConflictError if its name or one of
+// its aliases is taken by another entry's name or alias. An entry without a
+// CreatedAt is stamped with the current time.
+func (v *Vault) Add(entry Entry) error {
+	if err := v.checkNames(entry, -1); err != nil {
+		return err
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	v.Entries = append(v.Entries, entry)
+	return nil
+}
+
+// MarkUsed records now as the last time a code of the named entry was
+// requested and counts the use, failing with ErrNotFound if there is none.
+func (v *Vault) MarkUsed(name string, now time.Time) error {
+	i := v.Index(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+	v.Entries[i].LastUsedAt = now
+	v.Entries[i].Uses++
+	return nil
+}
+
+// Remove deletes the named entry for good, failing with ErrNotFound if there
+// is none. MoveToTrash moves it to the trash instead.
+func (v *Vault) Remove(name string) error {
+	i := v.Index(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+	v.Entries = append(v.Entries[:i], v.Entries[i+1:]...)
+	return nil
+}
+
+// Rename renames an entry in place; the new name may differ only in case, or
+// be one of the entry's aliases, which it then replaces. An existing entry
+// called newName is only replaced when force is set; otherwise, or if
+// newName is another entry's alias, Rename fails with a ConflictError.
+func (v *Vault) Rename(oldName, newName string, force bool) error {
+	if newName == "" {
+		return errors.New("new name must not be empty")
+	}
+	i := v.Index(oldName)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if oldName == newName {
+		return nil
+	}
+
+	switch j, isAlias := v.Owner(newName); {
+	case j == i && isAlias:
+		v.Entries[i].Aliases = slices.DeleteFunc(slices.Clone(v.Entries[i].Aliases), func(a string) bool { return SameName(a, newName) })
+	case j >= 0 && j != i:
+		if isAlias || !force {
+			return ConflictError{Name: newName, Existing: v.Entries[j].Name, Alias: isAlias}
+		}
+		v.Entries = append(v.Entries[:j], v.Entries[j+1:]...)
+		if j < i {
+			i--
+		}
+	}
+	v.Entries[i].Name = newName
+	return nil
+}
+
+// MoveToTrash moves the named entry to the trash, failing with ErrNotFound if
+// there is none, and drops trashed entries that have expired by now.
+func (v *Vault) MoveToTrash(name string, now time.Time) error {
+	i := v.Index(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+	v.Trash = append(v.Trash, TrashedEntry{Entry: v.Entries[i], DeletedAt: now})
+	v.Entries = append(v.Entries[:i], v.Entries[i+1:]...)
+	v.ExpireTrash(now)
+	return nil
+}
+
+// TrashIndex returns the position in the trash of the most recently removed
+// entry with the given name, ignoring case, or -1.
+func (v Vault) TrashIndex(name string) int {
+	for i := len(v.Trash) - 1; i >= 0; i-- {
+		if SameName(v.Trash[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Untrash moves the most recently removed entry called name back out of the
+// trash as newName, failing with ErrNotFound if the trash has no such entry
+// or a ConflictError if newName is taken. Aliases that other entries have
+// taken since are dropped.
+func (v *Vault) Untrash(name, newName string) error {
+	i := v.TrashIndex(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+	entry := v.Trash[i].Entry
+	entry.Name = newName
+	entry.Aliases = slices.DeleteFunc(slices.Clone(entry.Aliases), func(a string) bool {
+		j, _ := v.Owner(a)
+		return j >= 0 || SameName(a, newName)
+	})
+	if err := v.Add(entry); err != nil {
+		return err
+	}
+	v.Trash = append(v.Trash[:i], v.Trash[i+1:]...)
+	return nil
+}
+
+// ExpireTrash drops trashed entries removed more than TrashExpiry before now
+// and returns how many it dropped.
+func (v *Vault) ExpireTrash(now time.Time) int {
+	kept := v.Trash[:0]
+	for _, t := range v.Trash {
+		if now.Sub(t.DeletedAt) < TrashExpiry {
+			kept = append(kept, t)
+		}
+	}
+	n := len(v.Trash) - len(kept)
+	v.Trash = kept
+	return n
+}
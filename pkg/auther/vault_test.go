@@ -0,0 +1,78 @@
+package auther
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestVaultRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		force    bool
+		err      error
+		want     []string
+	}{
+		{"free name", "GitHub", "hub", false, nil, []string{"hub", "gitlab", "Work VPN"}},
+		{"any case of the old name", "github", "hub", false, nil, []string{"hub", "gitlab", "Work VPN"}},
+		{"same name", "GitHub", "GitHub", false, nil, []string{"GitHub", "gitlab", "Work VPN"}},
+		{"case only", "GitHub", "github", false, nil, []string{"github", "gitlab", "Work VPN"}},
+		{"case only with force", "GitHub", "GITHUB", true, nil, []string{"GITHUB", "gitlab", "Work VPN"}},
+		{"own alias", "GitHub", "gh", false, nil, []string{"gh", "gitlab", "Work VPN"}},
+		{"taken", "GitHub", "gitlab", false, ErrExists, nil},
+		{"taken in another case", "GitHub", "GitLab", false, ErrExists, nil},
+		{"taken with force", "GitHub", "gitlab", true, nil, []string{"gitlab", "Work VPN"}},
+		{"another entry's alias", "GitHub", "vpn", false, ErrExists, nil},
+		{"another entry's alias with force", "GitHub", "vpn", true, ErrExists, nil},
+		{"not found", "missing", "hub", false, ErrNotFound, nil},
+		{"not found with force", "missing", "gitlab", true, ErrNotFound, nil},
+	}
+	for _, tt := range tests {
+		v := Vault{Entries: []Entry{
+			{Name: "GitHub", Secret: testSecret, Aliases: []string{"gh"}},
+			{Name: "gitlab", Secret: testSecret},
+			{Name: "Work VPN", Secret: testSecret, Aliases: []string{"vpn"}},
+		}}
+		before := entryNames(v)
+
+		err := v.Rename(tt.old, tt.new, tt.force)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		want := tt.want
+		if tt.err != nil {
+			want = before
+		}
+		if got := entryNames(v); !slices.Equal(got, want) {
+			t.Errorf("%s: entries %q, want %q", tt.name, got, want)
+		}
+	}
+
+	// Renaming to its own alias drops the alias.
+	v := Vault{Entries: []Entry{{Name: "GitHub", Secret: testSecret, Aliases: []string{"gh", "octo"}}}}
+	if err := v.Rename("GitHub", "GH", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.Entries[0].Aliases; !slices.Equal(got, []string{"octo"}) {
+		t.Errorf("aliases after renaming to one: %q", got)
+	}
+
+	var conflict ConflictError
+	err := (&Vault{Entries: []Entry{{Name: "a"}, {Name: "b", Aliases: []string{"bee"}}}}).Rename("a", "bee", false)
+	if !errors.As(err, &conflict) || conflict.Existing != "b" || !conflict.Alias {
+		t.Errorf("renaming onto an alias: %#v", err)
+	}
+	if err := (&Vault{Entries: []Entry{{Name: "a"}}}).Rename("a", "", true); err == nil {
+		t.Error("renaming to an empty name succeeded")
+	}
+}
+
+func entryNames(v Vault) []string {
+	var names []string
+	for _, e := range v.Entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+
+	"authinator/pkg/auther"
+)
+
+// Sizes GET /totps/{name}/qr.png accepts, in pixels.
+const (
+	defaultQRSize = 256
+	maxQRSize     = 2048
+)
+
+func qrCommand(args []string) {
+	fs := newFlagSet("qr", "qr [name] [flags]")
+	pngPath := fs.String("png", "", "write a PNG image to this file instead of printing to the terminal")
+	size := fs.Int("size", defaultQRSize, "width and height of the PNG image in pixels")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator qr [name] [--png file]")
+		os.Exit(2)
+	}
+
+	data := mustLoadData()
+	entry, ok := data.Find(args[0])
+	if !ok {
+		reportErrorf("No entry found with that name.")
+		os.Exit(exitNotFound)
+	}
+	if err := entry.LoadSecret(); err != nil {
+		fatal(err)
+	}
+	if _, err := auther.DecodeSecret(entry.Secret); err != nil {
+		reportErrorf("Entry '%s' has an invalid base32 secret.", entry.Name)
+		os.Exit(1)
+	}
+
+	code, err := qr.Encode(entry.URI(), qr.M, qr.Auto)
+	if err != nil {
+		fatal(fmt.Errorf("encoding QR code: %w", err))
+	}
+
+	if *pngPath == "" {
+		renderQR(os.Stdout, code)
+		return
+	}
+
+	scaled, err := barcode.Scale(code, *size, *size)
+	if err != nil {
+		fatal(fmt.Errorf("scaling QR code: %w", err))
+	}
+	file, err := os.OpenFile(*pngPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		fatal(fmt.Errorf("creating image file: %w", err))
+	}
+	defer file.Close()
+	if err := png.Encode(file, scaled); err != nil {
+		fatal(fmt.Errorf("writing image file: %w", err))
+	}
+	fmt.Printf("QR code written to %s\n", *pngPath)
+}
+
+// renderQR draws the code with half-block characters, two modules per
+// character cell. Colors are set explicitly so the code scans on both light
+// and dark terminal themes.
+func renderQR(w io.Writer, code barcode.Barcode) {
+	const quiet = 2
+	bounds := code.Bounds()
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		if x < 0 || y < 0 || x >= bounds.Dx() || y >= bounds.Dy() {
+			return false
+		}
+		r, _, _, _ := code.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+		return r == 0
+	}
+	color := func(d bool) int {
+		if d {
+			return 0
+		}
+		return 7
+	}
+
+	width, height := bounds.Dx()+2*quiet, bounds.Dy()+2*quiet
+	var sb strings.Builder
+	for y := 0; y < height; y += 2 {
+		for x := 0; x < width; x++ {
+			fmt.Fprintf(&sb, "\x1b[3%dm\x1b[4%dm▀", color(dark(x, y)), color(dark(x, y+1)))
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	io.WriteString(w, sb.String())
+}
+
+// secretEntryHTTP looks up the entry of a request that returns its secret,
+// as GET /totps/{name}/qr.png and /uri do, with the secret filled in. If it
+// can't, it writes the error response and returns false. Like
+// ?include_secrets=true, these requests are refused without authentication,
+// and their responses must never be cached.
+func secretEntryHTTP(w http.ResponseWriter, r *http.Request, name string) (TOTPEntry, bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !serverAuth {
+		writeJSONError(w, http.StatusForbidden, "the secret of an entry requires token authentication")
+		return TOTPEntry{}, false
+	}
+	entry, ok := serverStore.Get(name)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, auther.ErrNotFound.Error())
+		return TOTPEntry{}, false
+	}
+	if !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return TOTPEntry{}, false
+	}
+	if err := entry.LoadSecret(); err != nil {
+		writeServerError(w, fmt.Errorf("reading the secret of %s: %w", entry.Name, err))
+		return TOTPEntry{}, false
+	}
+	if _, err := auther.DecodeSecret(entry.Secret); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("the entry %s has an invalid base32 secret", entry.Name))
+		return TOTPEntry{}, false
+	}
+	return entry, true
+}
+
+// entryURIHTTP serves GET /totps/{name}/uri: the entry's otpauth:// URI, as
+// plain text.
+func entryURIHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	noteAudit(r).detail = "uri"
+	entry, ok := secretEntryHTTP(w, r, name)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, entry.URI()+"\n")
+}
+
+// entryQRHTTP serves GET /totps/{name}/qr.png: a PNG image of the QR code of
+// the entry's otpauth:// URI, ?size= pixels wide and high.
+func entryQRHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	noteAudit(r).detail = "qr"
+	size := defaultQRSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxQRSize {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("size must be a number of pixels from 1 to %d", maxQRSize))
+			return
+		}
+		size = n
+	}
+	entry, ok := secretEntryHTTP(w, r, name)
+	if !ok {
+		return
+	}
+
+	code, err := qr.Encode(entry.URI(), qr.M, qr.Auto)
+	if err != nil {
+		writeServerError(w, fmt.Errorf("encoding QR code: %w", err))
+		return
+	}
+	scaled, err := barcode.Scale(code, size, size)
+	if err != nil {
+		// The size is smaller than the code has modules.
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("size %d is too small for this QR code, which needs at least %d pixels", size, code.Bounds().Dx()))
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, scaled); err != nil {
+		slog.Debug("writing QR code", "err", err)
+	}
+}
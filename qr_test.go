@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecretEntryScope(t *testing.T) {
+	h := newTestAPI(t,
+		TOTPEntry{Name: "build", Tags: []string{"ci"}},
+		TOTPEntry{Name: "bank", Tags: []string{"personal"}},
+		TOTPEntry{Name: "untagged"},
+	)
+	// token create refuses admin tokens with tags, but tokens.json may be
+	// edited by hand.
+	scoped := addTestToken(t, "ci", roleAdmin, "ci")
+
+	tests := []struct {
+		token, path string
+		status      int
+	}{
+		{scoped, "/v1/totps/build/uri", http.StatusOK},
+		{scoped, "/v1/totps/build/qr.png", http.StatusOK},
+		{scoped, "/v1/totps/bank/uri", http.StatusForbidden},
+		{scoped, "/v1/totps/bank/qr.png", http.StatusForbidden},
+		{scoped, "/v1/totps/untagged/uri", http.StatusForbidden},
+		{scoped, "/v1/totps/untagged/qr.png", http.StatusForbidden},
+		{testToken, "/v1/totps/bank/uri", http.StatusOK},
+		{testToken, "/v1/totps/untagged/qr.png", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := request(h, "GET", tt.path, tt.token, "")
+		if w.Code != tt.status {
+			t.Errorf("GET %s with %s: status %d, want %d", tt.path, tt.token, w.Code, tt.status)
+		}
+		if w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), testSecret) {
+			t.Errorf("GET %s with %s: the refusal has the secret in it", tt.path, tt.token)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("GET %s: Cache-Control %q, want no-store", tt.path, got)
+		}
+	}
+}
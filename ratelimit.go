@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default API requests allowed per client per minute, by route class. Reads
+// allow for the web UI fetching each entry's code once per period.
+const (
+	defaultReadRate   = 120
+	defaultWriteRate  = 30
+	defaultVerifyRate = 10
+)
+
+// rateLimits holds one limiter per route class. A nil limiter doesn't limit.
+type rateLimits struct {
+	read, write, verify *rateLimiter
+	trustProxy          bool
+}
+
+// limitRate rejects API requests from clients that exceed their rate with
+// 429 and a Retry-After header. Health checks and the web UI's files aren't
+// limited.
+func limitRate(limits rateLimits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := limits.forRoute(r)
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, wait := limiter.allow(clientIP(r, limits.trustProxy), time.Now())
+		if !allowed {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded; try again in %d seconds", seconds))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forRoute picks the limiter for a request's route class.
+func (l rateLimits) forRoute(r *http.Request) *rateLimiter {
+	route, _ := matchedRoute(r)
+	switch {
+	case route.action == "verify":
+		return l.verify
+	case r.Method == "GET" || r.Method == "HEAD":
+		return l.read
+	default:
+		return l.write
+	}
+}
+
+// clientIP returns the address a request came from. Behind a reverse proxy
+// (--trust-proxy) that is the last address the proxy added to
+// X-Forwarded-For; otherwise the header is ignored, as clients can forge it.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter is a token bucket per client: each holds up to burst tokens,
+// refilled at rate per second, and a request takes one.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter allows perMinute requests per client per minute, all of
+// which may come at once. It returns nil, which doesn't limit, for zero.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// allow takes a token from key's bucket at now. If the bucket is empty it
+// returns false and how long until a token is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets have refilled, at most once a minute,
+// so a long-running server doesn't keep an entry for every address it has
+// ever seen.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
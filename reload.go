@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// serve keeps its entries in memory. When another program, such as the CLI,
+// changes the data file, SIGHUP has serve load it again, and so does every
+// change with --watch. Requests in flight finish with the entries they
+// started with. Changes made through the API are made on top of whatever is
+// saved at the time, reloaded or not, see lock.go.
+
+// watchDebounce is how long the data file has to stay quiet before a change
+// is loaded, as saving it takes more than one write.
+const watchDebounce = 200 * time.Millisecond
+
+// reloadStore loads the data file into the server again, saying why in the
+// log. The server keeps serving the entries it had if the file can't be
+// read.
+func reloadStore(reason string) {
+	changed, err := serverStore.Reload()
+	switch {
+	case err != nil:
+		slog.Error("couldn't reload the data file; still serving the entries loaded before", "reason", reason, "err", err)
+	case changed:
+		slog.Info("reloaded the data file", "reason", reason, "entries", len(serverStore.List()))
+	default:
+		slog.Info("the data file hasn't changed", "reason", reason)
+	}
+}
+
+// reloadOnSIGHUP reloads the data file every time serve gets SIGHUP, as from
+// systemctl reload.
+func reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadStore("SIGHUP")
+		}
+	}()
+}
+
+// watchDataFile reloads the data file whenever another program changes it.
+// The directory is watched rather than the file, as saving replaces the file
+// with a new one.
+func watchDataFile() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(dataPath)
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return err
+	}
+	slog.Debug("watching the data file", "file", path)
+
+	reload := time.AfterFunc(time.Hour, func() {
+		// The server's own saves change the file too, but leave it as it
+		// last saw it.
+		if !dataBackend.Stale() {
+			return
+		}
+		slog.Info("another program changed the data file", "file", path)
+		reloadStore("file changed")
+	})
+	reload.Stop()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if event.Name == path || event.Name == path+"-wal" {
+					reload.Reset(watchDebounce)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("watching the data file", "err", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// remoteTimeout bounds each request to the server in remote mode.
+const remoteTimeout = 15 * time.Second
+
+// remoteAddress returns the server to use instead of the local data file:
+// --remote, then AUTHER_REMOTE. It is empty when working locally.
+func remoteAddress() string {
+	if options.remote != "" {
+		return options.remote
+	}
+	return os.Getenv("AUTHER_REMOTE")
+}
+
+// localOnlyCommands don't work with --remote yet. Everything else either
+// talks to the server or doesn't touch the entries.
+var localOnlyCommands = map[string]bool{
+	"edit":    true,
+	"rename":  true,
+	"tags":    true,
+	"search":  true,
+	"verify":  true,
+	"export":  true,
+	"import":  true,
+	"qr":      true,
+	"encrypt": true,
+	"unlock":  true,
+	"lock":    true,
+	"passwd":  true,
+	"key":     true,
+	"audit":   true,
+
+	"migrate-to-keyring": true,
+	"backup":             true,
+	"restore":            true,
+	"undo":               true,
+	"trash":              true,
+	"note":               true,
+	"recovery":           true,
+	"tui":                true,
+	"generate":           true,
+	"doctor":             true,
+	"dedupe":             true,
+	"alias":              true,
+	"pin":                true,
+	"unpin":              true,
+}
+
+// remoteClient calls the HTTP API of a running authinator serve.
+type remoteClient struct {
+	address string
+	base    string
+	token   string
+	client  *http.Client
+}
+
+var remote *remoteClient
+
+// mustRemote returns the client for --remote, exiting if it is misconfigured.
+func mustRemote() *remoteClient {
+	if remote == nil {
+		c, err := newRemoteClient(remoteAddress())
+		if err != nil {
+			fatal(err)
+		}
+		remote = c
+	}
+	return remote
+}
+
+// newRemoteClient accepts an http:// or https:// URL, or unix:/path for a
+// server listening on a unix socket.
+func newRemoteClient(address string) (*remoteClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &remoteClient{address: address, client: &http.Client{Transport: transport, Timeout: remoteTimeout}}
+
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		c.base = "http://localhost"
+	} else {
+		u, err := url.Parse(address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid remote %q: use http://host:port, https://host:port or unix:/path/to/socket", address)
+		}
+		c.base = strings.TrimRight(address, "/")
+	}
+
+	tlsConfig, err := remoteTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if c.token, err = clientToken(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// remoteTLSConfig applies --remote-ca, --remote-fingerprint and
+// --remote-insecure. A pinned fingerprint replaces the usual chain
+// verification, for servers using --tls-self-signed.
+func remoteTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if options.remoteCA != "" {
+		pem, err := os.ReadFile(options.remoteCA)
+		if err != nil {
+			return nil, fmt.Errorf("reading --remote-ca: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", options.remoteCA)
+		}
+	}
+	if options.remoteFingerprint != "" {
+		want := strings.ToUpper(strings.ReplaceAll(options.remoteFingerprint, ":", ""))
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			got := certFingerprint(tls.Certificate{Certificate: rawCerts})
+			if strings.ReplaceAll(got, ":", "") != want {
+				return fmt.Errorf("server certificate fingerprint %s doesn't match --remote-fingerprint", got)
+			}
+			return nil
+		}
+	}
+	if options.remoteInsecure {
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// clientToken returns the API token to send: AUTHER_TOKEN, or the token a
+// server on this machine saved in the config directory. It is empty if
+// neither exists, for servers running with --no-auth.
+func clientToken() (string, error) {
+	if env := os.Getenv("AUTHER_TOKEN"); env != "" {
+		return env, nil
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	token, err := readSavedToken(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return token, err
+}
+
+// do sends a request to the API and decodes the JSON response into out. It
+// turns failures into errors that say what to do about them, and returns
+// auther.ErrNotFound and auther.ErrExists for 404 and 409.
+func (c *remoteClient) do(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		slog.Debug("remote request failed", "method", method, "url", req.URL.Redacted(), "err", err)
+		return c.connectionError(err)
+	}
+	defer resp.Body.Close()
+	slog.Debug("remote request", "method", method, "url", req.URL.Redacted(), "status", resp.StatusCode, "took", time.Since(start))
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			if c.token == "" {
+				return fmt.Errorf("%s requires an API token; set AUTHER_TOKEN to the token printed by authinator serve", c.address)
+			}
+			return fmt.Errorf("%s rejected the API token; check AUTHER_TOKEN", c.address)
+		case http.StatusNotFound:
+			return auther.ErrNotFound
+		case http.StatusConflict:
+			return auther.ErrExists
+		case http.StatusForbidden:
+			if apiErr.Error == "read_only" {
+				return fmt.Errorf("%s: server is read-only; it doesn't accept changes", c.address)
+			}
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return fmt.Errorf("%s: %s", c.address, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("reading response from %s: %w", c.address, err)
+	}
+	return nil
+}
+
+func (c *remoteClient) connectionError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var certErr *tls.CertificateVerificationError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ENOENT):
+		return fmt.Errorf("can't connect to %s: is authinator serve running there?", c.address)
+	case errors.As(err, &certErr):
+		return fmt.Errorf("can't verify the certificate of %s: %v (use --remote-ca or --remote-fingerprint for a private or self-signed certificate)", c.address, certErr.Err)
+	default:
+		return fmt.Errorf("can't reach %s: %w", c.address, err)
+	}
+}
+
+// Entries returns the server's entries with the given tag, or all of them,
+// without their secrets.
+func (c *remoteClient) Entries(tag string) ([]TOTPEntry, error) {
+	path := apiV1 + "/totps"
+	if tag != "" {
+		path += "?tag=" + url.QueryEscape(tag)
+	}
+	var views []entryView
+	if err := c.do("GET", path, nil, &views); err != nil {
+		return nil, err
+	}
+	entries := make([]TOTPEntry, len(views))
+	for i, v := range views {
+		entries[i] = TOTPEntry{Name: v.Name, Issuer: v.Issuer, Account: v.Account, Algorithm: v.Algorithm, Digits: v.Digits, Period: int(v.Period), Tags: v.Tags,
+			Aliases: v.Aliases, Pin: v.Pin, CreatedAt: v.CreatedAt, LastUsedAt: v.LastUsedAt, Uses: v.Uses}
+	}
+	return entries, nil
+}
+
+// BatchCodes returns the current codes of the named entries as generated by
+// the server, in the form batchCodes returns them.
+func (c *remoteClient) BatchCodes(names []string) ([]codeResult, error) {
+	v := url.Values{"names": {strings.Join(names, ",")}, "codes": {"true"}}
+	var results []codeResult
+	if err := c.do("GET", apiV1+"/totps?"+v.Encode(), nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Codes returns the codes described by q as generated by the server.
+func (c *remoteClient) Codes(entry TOTPEntry, q codeQuery) (codeResult, error) {
+	path := entryURL(entry.Name)
+	if v := q.values(); len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+	var resp struct {
+		Code       string         `json:"code"`
+		ExpiresIn  int64          `json:"expires_in"`
+		NextCode   string         `json:"next_code"`
+		ValidFrom  string         `json:"valid_from"`
+		ValidUntil string         `json:"valid_until"`
+		Upcoming   []upcomingCode `json:"upcoming"`
+	}
+	if err := c.do("GET", path, nil, &resp); err != nil {
+		return codeResult{}, err
+	}
+	return codeResult{
+		Name:       entry.Name,
+		Code:       resp.Code,
+		ExpiresIn:  resp.ExpiresIn,
+		NextCode:   resp.NextCode,
+		ValidFrom:  resp.ValidFrom,
+		ValidUntil: resp.ValidUntil,
+		Upcoming:   resp.Upcoming,
+	}, nil
+}
+
+// Get, Add, MoveToTrash and Remove make remoteClient an entryStore. Get exits on
+// errors other than a missing entry, as only CLI commands use it.
+func (c *remoteClient) Get(name string) (TOTPEntry, bool) {
+	_, err := c.Codes(TOTPEntry{Name: name}, codeQuery{peek: true})
+	if errors.Is(err, auther.ErrNotFound) {
+		return TOTPEntry{}, false
+	}
+	if err != nil {
+		fatal(err)
+	}
+	return TOTPEntry{Name: name}, true
+}
+
+func (c *remoteClient) Add(entry TOTPEntry) error {
+	return c.do("POST", apiV1+"/totps", entry, nil)
+}
+
+func (c *remoteClient) MoveToTrash(name string) error {
+	return c.do("DELETE", entryURL(name), nil, nil)
+}
+
+func (c *remoteClient) Remove(name string) error {
+	return c.do("DELETE", entryURL(name)+"?purge=true", nil, nil)
+}
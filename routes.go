@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The API is versioned: its routes live under /v1, and a later version gets
+// a prefix and a route table of its own. The same routes are also served at
+// their paths from before versioning, such as /totps/{name}, as deprecated
+// aliases that say so in a Deprecation header, unless serve is started with
+// --legacy-routes=false.
+
+const apiV1 = "/v1"
+
+// legacyDeprecation is when the unversioned paths were deprecated, as their
+// Deprecation header (RFC 9745) gives it.
+var legacyDeprecation = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// apiRoute is a route of the API: the method and path pattern it answers,
+// below the version prefix and as http.ServeMux takes them, what it does as
+// the audit log names it, and its handler.
+type apiRoute struct {
+	method, path string
+	action       string
+	handler      http.Handler
+}
+
+// v1Routes are the routes of /v1. GET /totps lists the entries, but with
+// ?codes=true, ?include_secrets=true or as an event stream it does more, see
+// auditAction.
+func v1Routes() []apiRoute {
+	return []apiRoute{
+		{"GET", "/totps", "list", http.HandlerFunc(getTOTPsHTTP)},
+		{"POST", "/totps", "create", http.HandlerFunc(createEntryHTTP)},
+		{"POST", "/totps/generate", "create", http.HandlerFunc(generateEntryHTTP)},
+		{"POST", "/totps/batch", "import", http.HandlerFunc(batchCreateHTTP)},
+		{"GET", "/totps/{name}", "code", entryHandler(getCodeHTTP)},
+		{"PUT", "/totps/{name}", "edit", entryHandler(updateEntryHTTP)},
+		{"PATCH", "/totps/{name}", "rename", entryHandler(renameEntryHTTP)},
+		{"DELETE", "/totps/{name}", "remove", entryHandler(removeEntryHTTP)},
+		{"POST", "/totps/{name}/verify", "verify", entryHandler(verifyCodeHTTP)},
+		{"GET", "/totps/{name}/stream", "stream", entryHandler(streamCodeHTTP)},
+		{"GET", "/totps/{name}/qr.png", "export", entryHandler(entryQRHTTP)},
+		{"GET", "/totps/{name}/uri", "export", entryHandler(entryURIHTTP)},
+	}
+}
+
+// entryHandler adapts a handler of one entry to a route with {name} in its
+// path. The name arrives unescaped, so it may hold a "/" sent as %2F.
+func entryHandler(h func(http.ResponseWriter, *http.Request, string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, r.PathValue("name"))
+	})
+}
+
+type routeKey struct{}
+
+// matchedRoute returns the route the API mux matched r with.
+func matchedRoute(r *http.Request) (apiRoute, bool) {
+	route, ok := r.Context().Value(routeKey{}).(apiRoute)
+	return route, ok
+}
+
+// apiMux registers routes on mux for their method, each behind middleware,
+// which finds the route with matchedRoute. Requests below a prefix that no
+// route takes go through the middleware too, without a route, and get a JSON
+// error like every other error of the API: 405 with the methods the path
+// has, or 400 for a path it doesn't know.
+type apiMux struct {
+	mux        *http.ServeMux
+	middleware func(http.Handler) http.Handler
+}
+
+// register serves routes under prefix. wrap, if not nil, goes around
+// everything registered, the errors for requests no route takes included.
+func (m apiMux) register(prefix string, routes []apiRoute, wrap func(http.Handler) http.Handler) {
+	if wrap == nil {
+		wrap = func(h http.Handler) http.Handler { return h }
+	}
+	for _, route := range routes {
+		next := m.middleware(route.handler)
+		m.mux.Handle(route.method+" "+prefix+route.path, wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)))
+		})))
+	}
+	for _, pattern := range []string{prefix + "/totps", prefix + "/totps/"} {
+		m.mux.Handle(pattern, wrap(m.middleware(m.notRouted(prefix, pattern))))
+	}
+}
+
+// notRouted answers the requests that reach pattern, the catch-all of the
+// entries, because no route takes them.
+func (m apiMux) notRouted(prefix, pattern string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range strings.Split(corsMethods, ", ") {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if _, p := m.mux.Handler(probe); p != pattern {
+				allowed = append(allowed, method)
+			}
+		}
+		switch {
+		case len(allowed) > 0:
+			methodNotAllowed(w, strings.Join(allowed, ", "))
+		case r.URL.Path == prefix+"/totps/":
+			writeJSONError(w, http.StatusBadRequest, "entry name is missing")
+		default:
+			writeJSONError(w, http.StatusBadRequest, "unknown path; a '/' in an entry name must be encoded as %2F")
+		}
+	})
+}
+
+// deprecatedRoute marks the responses of an unversioned path as deprecated,
+// pointing to the same path under /v1.
+func deprecatedRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecation.Unix()))
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, apiV1+r.URL.EscapedPath()))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unknownAPIPath answers paths under a version prefix that the version
+// doesn't have, rather than leaving them to the web UI.
+func unknownAPIPath(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "unknown API path")
+}
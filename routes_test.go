@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"authinator/pkg/auther"
+)
+
+// TestEntryNameRouting requests the URI of entries with names that need
+// escaping in a path, and paths that name no entry.
+func TestEntryNameRouting(t *testing.T) {
+	h := newTestAPI(t,
+		TOTPEntry{Name: "github"},
+		TOTPEntry{Name: "AWS / prod"},
+		TOTPEntry{Name: "café"},
+		TOTPEntry{Name: "銀行"},
+		TOTPEntry{Name: "a+b"},
+		TOTPEntry{Name: "100% sure?"},
+	)
+	tests := []struct {
+		path   string
+		status int
+		name   string // of the entry whose URI is returned
+	}{
+		{"/v1/totps/github/uri", http.StatusOK, "github"},
+		{"/v1/totps/GitHub/uri", http.StatusOK, "github"},
+		{"/v1/totps/AWS%20%2F%20prod/uri", http.StatusOK, "AWS / prod"},
+		{"/v1/totps/AWS%20%2f%20prod/uri", http.StatusOK, "AWS / prod"},
+		{"/v1/totps/caf%C3%A9/uri", http.StatusOK, "café"},
+		{"/v1/totps/café/uri", http.StatusOK, "café"},
+		{"/v1/totps/%E9%8A%80%E8%A1%8C/uri", http.StatusOK, "銀行"},
+		{"/v1/totps/a+b/uri", http.StatusOK, "a+b"},
+		{"/v1/totps/a%2Bb/uri", http.StatusOK, "a+b"},
+		{"/v1/totps/100%25%20sure%3F/uri", http.StatusOK, "100% sure?"},
+
+		{"/v1/totps/AWS%20/%20prod/uri", http.StatusBadRequest, ""},
+		{"/v1/totps/AWS%20/%20prod", http.StatusBadRequest, ""},
+		{"/v1/totps/", http.StatusBadRequest, ""},
+		{"/v1/totps/github/", http.StatusBadRequest, ""},
+		{"/v1/totps/caf%C3/uri", http.StatusNotFound, ""},
+		{"/v1/totps/missing/uri", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := request(h, "GET", tt.path, testToken, "")
+		if w.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d: %s", tt.path, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			var resp struct{ Error string }
+			decodeBody(t, w, &resp)
+			if resp.Error == "" {
+				t.Errorf("GET %s: no JSON error in %s", tt.path, w.Body)
+			}
+			continue
+		}
+		entry, err := auther.ParseURI(w.Body.String())
+		if err != nil {
+			t.Errorf("GET %s: %v", tt.path, err)
+		} else if entry.Name != tt.name {
+			t.Errorf("GET %s: the URI of %q, want %q", tt.path, entry.Name, tt.name)
+		}
+	}
+
+	// The name of a change comes from the path the same way.
+	if w := request(h, "DELETE", "/v1/totps/AWS%20%2F%20prod", testToken, ""); w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d: %s", w.Code, w.Body)
+	}
+	if _, ok := serverStore.Get("AWS / prod"); ok {
+		t.Error("AWS / prod wasn't removed")
+	}
+}
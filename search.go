@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// matchesQuery reports whether query appears in the entry's name, aliases,
+// issuer or account, ignoring case.
+func matchesQuery(e TOTPEntry, query string) bool {
+	query = strings.ToLower(query)
+	for _, field := range append([]string{e.Name, e.Issuer, e.Account}, e.Aliases...) {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveEntry finds the entries a lookup could refer to. Matching is tried
+// in order of strictness and the first tier with any hits wins: the name or
+// an alias, ignoring case, a substring of name, alias, issuer or account,
+// and finally names or aliases within a couple of typos. With exact set only
+// the first tier is tried.
+func resolveEntry(data TOTPData, query string, exact bool) []TOTPEntry {
+	if i, _ := data.Owner(query); i >= 0 || exact {
+		if i >= 0 {
+			return []TOTPEntry{data.Entries[i]}
+		}
+		return nil
+	}
+
+	tiers := []func(TOTPEntry) bool{
+		func(e TOTPEntry) bool { return matchesQuery(e, query) },
+		func(e TOTPEntry) bool {
+			for _, name := range append([]string{e.Name}, e.Aliases...) {
+				if editDistance(strings.ToLower(name), strings.ToLower(query)) <= maxTypos(query) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	for _, match := range tiers {
+		var matches []TOTPEntry
+		for _, entry := range data.Entries {
+			if match(entry) {
+				matches = append(matches, entry)
+			}
+		}
+		if len(matches) > 0 {
+			return matches
+		}
+	}
+	return nil
+}
+
+// maxTypos scales the allowed edit distance with the query length so short
+// queries don't match everything.
+func maxTypos(query string) int {
+	switch n := len(query); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b: the Levenshtein distance, with swapping two adjacent characters counted
+// as a single edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func searchCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator search [query]")
+		os.Exit(2)
+	}
+
+	data := mustLoadData()
+
+	found := false
+	for _, entry := range data.Entries {
+		if matchesQuery(entry, args[0]) {
+			fmt.Printf(" - %s%s%s\n", entry.Name, describe(entry), tagLabel(entry))
+			found = true
+		}
+	}
+	if !found {
+		fmt.Fprintln(os.Stderr, "No matching entries found.")
+		os.Exit(1)
+	}
+}
+
+// printCandidates lists the entries an ambiguous lookup matched.
+func printCandidates(query string, matches []TOTPEntry) {
+	if options.json {
+		names := []string{}
+		for _, entry := range matches {
+			names = append(names, entry.Name)
+		}
+		json.NewEncoder(os.Stderr).Encode(map[string]any{
+			"error":      fmt.Sprintf("'%s' matches several entries", query),
+			"candidates": names,
+		})
+		return
+	}
+
+	fmt.Printf("'%s' matches several entries:\n", query)
+	for _, entry := range matches {
+		fmt.Printf(" - %s%s\n", entry.Name, describe(entry))
+	}
+}
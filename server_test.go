@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"authinator/pkg/auther"
+)
+
+// testSecret is the secret of the entries the API tests make.
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+// testToken is the serve token of newTestAPI.
+const testToken = "serve-token"
+
+// newTestAPI sets serve up as it runs, with a data file in a temporary
+// directory holding entries, and returns its routes under /v1 behind the
+// serve token testToken, with the health checks beside them. --read-only
+// applies if serverReadOnly is set first.
+func newTestAPI(t *testing.T, entries ...TOTPEntry) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AUTHER_NO_NTP", "1")
+	t.Setenv("AUTHER_NO_CLIPBOARD", "1")
+
+	oldPath, oldStore, oldAuth := dataPath, serverStore, serverAuth
+	t.Cleanup(func() {
+		dataPath, serverStore, serverAuth = oldPath, oldStore, oldAuth
+		serverReadOnly = false
+		serverTokens.stamp, serverTokens.tokens = "", nil
+	})
+	serverTokens.stamp, serverTokens.tokens = "", nil
+	verifyLimiter = newAttemptLimiter(verifyAttempts, verifyWindow)
+
+	dataPath = filepath.Join(dir, "data.json")
+	store, err := auther.Open(dataPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Secret == "" {
+			e.Secret = testSecret
+		}
+		if err := store.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serverStore, serverAuth = store, true
+
+	auth := &apiAuth{token: testToken}
+	readOnly := serverReadOnly
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", handleHealthz)
+	root.HandleFunc("/readyz", handleReadyz)
+	api := apiMux{mux: root, middleware: func(h http.Handler) http.Handler {
+		if readOnly {
+			h = rejectWrites(h)
+		}
+		return auditRequests(false, requireAuth(auth, h))
+	}}
+	api.register(apiV1, v1Routes(), nil)
+	return root
+}
+
+// addTestToken saves a named token for the API of newTestAPI and returns it.
+func addTestToken(t *testing.T, name, role string, tags ...string) string {
+	t.Helper()
+	tokens, err := loadAPITokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := name + "-token"
+	tokens = append(tokens, apiToken{Name: name, Role: role, Tags: tags, Hash: hashToken(token)})
+	if err := saveAPITokens(tokens); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// request sends method path to h with token, if not empty, and body, if not
+// empty, as JSON.
+func request(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	r := newRequest(method, path, body)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return serve(h, r)
+}
+
+// newRequest returns a request for method path with body, if not empty, as
+// JSON.
+func newRequest(method, path, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	return r
+}
+
+// serve has h answer r.
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeBody decodes the JSON body of w into v.
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// Automatic snapshots are backups named auto-<timestamp>.json, written
+// before a save removes or changes entries. Only the newest maxSnapshots are
+// kept.
+const (
+	snapshotPrefix = "auto-"
+	maxSnapshots   = 10
+)
+
+// snapshotBackend wraps the data backend so that every save that removes or
+// changes an entry, whichever command or request makes it, first snapshots
+// the entries as they were for undo. It also locks the data file against
+// other processes while saving, see lock.go.
+type snapshotBackend struct {
+	auther.Backend
+
+	// last is the vault as it was last loaded or saved.
+	last   TOTPData
+	loaded bool
+
+	// disabled turns snapshots off, for undo.
+	disabled bool
+
+	// disk is how the data file looked when it was last loaded or saved,
+	// to tell when another program has changed it since. serve's file
+	// watcher reads it too, hence diskMu.
+	diskMu sync.Mutex
+	disk   string
+
+	// lockFile is the lock file while this process holds the lock, which
+	// it has taken locks times.
+	lockMu   sync.Mutex
+	locks    int
+	lockFile *os.File
+}
+
+// dataFileStamp sums up the size and modification time of the data file,
+// and of the write-ahead log of a SQLite data file, which takes writes
+// before the file itself does. It is empty if neither exists.
+func dataFileStamp() string {
+	var stamp string
+	for _, path := range []string{dataPath, dataPath + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			stamp += fmt.Sprintf("%s:%d:%d;", filepath.Base(path), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return stamp
+}
+
+// Stale reports whether the data file has changed since it was last loaded
+// or saved, so by some other program.
+func (b *snapshotBackend) Stale() bool {
+	b.diskMu.Lock()
+	defer b.diskMu.Unlock()
+	return dataFileStamp() != b.disk
+}
+
+func (b *snapshotBackend) recordDisk(stamp string) {
+	b.diskMu.Lock()
+	defer b.diskMu.Unlock()
+	b.disk = stamp
+}
+
+func (b *snapshotBackend) Load() (TOTPData, error) {
+	// Taken before reading, so a save by another process while reading
+	// makes the entries stale rather than going unnoticed.
+	stamp := dataFileStamp()
+	start := time.Now()
+	v, err := b.Backend.Load()
+	if err != nil {
+		return v, err
+	}
+	slog.Debug("loaded entries", "entries", len(v.Entries), "took", time.Since(start))
+	b.recordDisk(stamp)
+	b.last, b.loaded = cloneVault(v), true
+	return v, nil
+}
+
+func (b *snapshotBackend) Save(v TOTPData) error {
+	unlock, err := b.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// A store loads what another process saved before changing it; a
+	// command that loaded the entries itself has to start over.
+	if b.loaded && b.Stale() {
+		return errDataFileChanged
+	}
+
+	if b.loaded && !b.disabled && dropsEntries(b.last, v) {
+		path, err := writeSnapshot(b.last)
+		if err != nil {
+			return fmt.Errorf("saving a snapshot before changing entries: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Saved the previous entries to %s; authinator undo restores them.\n", path)
+	}
+	start := time.Now()
+	if err := b.Backend.Save(v); err != nil {
+		return err
+	}
+	b.recordDisk(dataFileStamp())
+	slog.Debug("saved entries", "entries", len(v.Entries), "took", time.Since(start))
+	b.last, b.loaded = cloneVault(v), true
+	return nil
+}
+
+// cloneVault copies v deeply enough that changes callers make to their copy
+// don't show up in it.
+func cloneVault(v TOTPData) TOTPData {
+	entries := make([]TOTPEntry, len(v.Entries))
+	for i, entry := range v.Entries {
+		entry.Tags = slices.Clone(entry.Tags)
+		entry.Aliases = slices.Clone(entry.Aliases)
+		entry.RecoveryCodes = slices.Clone(entry.RecoveryCodes)
+		entries[i] = entry
+	}
+	trash := make([]auther.TrashedEntry, len(v.Trash))
+	for i, t := range v.Trash {
+		t.Tags = slices.Clone(t.Tags)
+		t.Aliases = slices.Clone(t.Aliases)
+		t.RecoveryCodes = slices.Clone(t.RecoveryCodes)
+		trash[i] = t
+	}
+	return TOTPData{Version: v.Version, Entries: entries, Trash: trash}
+}
+
+// dropsEntries reports whether saving next over prev loses an entry, either
+// by removing or renaming it or by changing it, or purges one from the trash.
+// Moving an entry to or from the trash loses nothing.
+func dropsEntries(prev, next TOTPData) bool {
+	for _, old := range prev.Entries {
+		entry, ok := next.Find(old.Name)
+		if ok && sameEntry(old, entry) {
+			continue
+		}
+		if !slices.ContainsFunc(next.Trash, func(t auther.TrashedEntry) bool { return t.Name == old.Name && sameEntry(old, t.Entry) }) {
+			return true
+		}
+	}
+
+	type trashed struct {
+		name string
+		at   int64
+	}
+	kept := map[trashed]bool{}
+	for _, t := range next.Trash {
+		kept[trashed{t.Name, t.DeletedAt.UnixNano()}] = true
+	}
+	for _, old := range prev.Trash {
+		if kept[trashed{old.Name, old.DeletedAt.UnixNano()}] {
+			continue
+		}
+		if !slices.ContainsFunc(next.Entries, func(e TOTPEntry) bool { return sameEntry(old.Entry, e) }) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameEntry(a, b TOTPEntry) bool {
+	return a.Secret == b.Secret && a.Type == b.Type && a.Issuer == b.Issuer && a.Account == b.Account &&
+		a.Algorithm == b.Algorithm && a.Digits == b.Digits && a.Period == b.Period && slices.Equal(a.Tags, b.Tags) &&
+		slices.Equal(a.Aliases, b.Aliases) && a.Notes == b.Notes && slices.EqualFunc(a.RecoveryCodes, b.RecoveryCodes, sameRecoveryCode)
+}
+
+func sameRecoveryCode(a, b auther.RecoveryCode) bool {
+	return a.Code == b.Code && a.UsedAt.Equal(b.UsedAt)
+}
+
+// writeSnapshot saves v, secrets included, as an automatic snapshot and
+// prunes the old ones.
+func writeSnapshot(v TOTPData) (string, error) {
+	v = cloneVault(v)
+	if err := loadVaultSecrets(v); err != nil {
+		return "", err
+	}
+	path, err := writeBackup(snapshotPrefix, v, dataKey())
+	if err != nil {
+		return "", err
+	}
+	if _, err := pruneBackups(snapshotPrefix, maxSnapshots); err != nil {
+		return "", fmt.Errorf("removing old snapshots: %w", err)
+	}
+	return path, nil
+}
+
+// undoCommand restores the newest automatic snapshot and removes it, so
+// running it again goes back one more change.
+func undoCommand(args []string) {
+	fs := newFlagSet("undo", "undo [--yes]")
+	yes := fs.Bool("yes", false, "undo without asking for confirmation")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator undo [--yes]")
+		os.Exit(2)
+	}
+	if !*yes && !isTerminal(os.Stdin) {
+		reportErrorf("Refusing to undo without confirmation because stdin is not a terminal. Use --yes to skip the prompt.")
+		os.Exit(1)
+	}
+
+	snapshots, err := listBackups(snapshotPrefix)
+	if err != nil {
+		fatal(err)
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("Nothing to undo.")
+		return
+	}
+	latest := snapshots[len(snapshots)-1]
+
+	current := mustLoadData()
+	restored, err := readBackup(latest.Path)
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", latest.Path, err))
+	}
+
+	question := fmt.Sprintf("Go back to the %d entries saved at %s, replacing the %d current entries?",
+		len(restored.Entries), latest.Created.Local().Format("2006-01-02 15:04:05"), len(current.Entries))
+	if !*yes && !confirm(question) {
+		fmt.Println("Nothing was changed.")
+		return
+	}
+
+	dataBackend.disabled = true
+	mustSaveData(restored)
+	if err := os.Remove(latest.Path); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Restored %d entries from %s\n", len(restored.Entries), filepath.Base(latest.Path))
+}
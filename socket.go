@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// listenUnix listens on a unix domain socket at path that only the current
+// user can connect to. A socket left behind by a server that died is removed
+// first; the listener removes the socket again when it is closed.
+func listenUnix(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	return listenPrivate(path)
+}
+
+// removeStaleSocket deletes the socket at path unless a server is still
+// listening on it. It refuses to delete anything that isn't a socket.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.New("another server is already listening on it")
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate listens on a new unix domain socket at path, created with
+// mode 0600 rather than changed to it afterwards, so no other user can
+// connect in between. The umask is the whole process's, so it is only
+// narrowed for as long as the socket takes to create.
+func listenPrivate(path string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnixPrivate(t *testing.T) {
+	// Socket paths are limited to about a hundred bytes, which t.TempDir
+	// can exceed.
+	dir, err := os.MkdirTemp("", "auther")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "serve.sock")
+
+	// Even with a umask that lets everyone in.
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("socket mode %04o, want 0600", mode)
+	}
+	if mask := syscall.Umask(0); mask != 0 {
+		t.Errorf("umask %04o after listening, want it restored", mask)
+	}
+}
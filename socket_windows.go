@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// listenPrivate listens on a new unix domain socket at path. On Windows the
+// socket is protected by the ACLs of the directory it is in rather than
+// Unix mode bits.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
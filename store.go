@@ -0,0 +1,41 @@
+package main
+
+import "authinator/pkg/auther"
+
+// entryStore is what create and remove need from wherever entries are kept:
+// the local data file, or a server with --remote.
+type entryStore interface {
+	Get(name string) (TOTPEntry, bool)
+	Add(entry TOTPEntry) error
+	MoveToTrash(name string) error
+	Remove(name string) error
+}
+
+// openEntryStore opens the store CLI commands should change.
+func openEntryStore() entryStore {
+	if remoteAddress() != "" {
+		return mustRemote()
+	}
+	return mustOpenStore()
+}
+
+// openStore opens the data file with the selected backend, prompting for its
+// passphrase if it is encrypted. serve keeps a single store for its lifetime;
+// CLI commands open one per invocation.
+func openStore() (*auther.Store, error) {
+	b, err := openBackend()
+	if err != nil {
+		return nil, err
+	}
+	return auther.OpenBackend(b)
+}
+
+// mustOpenStore opens the data file for a CLI command, exiting if it can't be
+// read.
+func mustOpenStore() *auther.Store {
+	s, err := openStore()
+	if err != nil {
+		fatal(err)
+	}
+	return s
+}
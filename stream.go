@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// stopStreams is closed when serve starts shutting down, so open event
+// streams end instead of holding up the shutdown.
+var stopStreams = make(chan struct{})
+
+func endStreams() {
+	close(stopStreams)
+}
+
+// streamCode is the payload of a code event.
+type streamCode struct {
+	Name      string `json:"name"`
+	Code      string `json:"code"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// wantsEventStream reports whether the client asked for server-sent events,
+// as EventSource does.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// eventStream writes server-sent events to one client.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// startEventStream sends the headers for an event stream. Streams outlive the
+// server's read and write timeouts, so those are lifted for this connection.
+func startEventStream(w http.ResponseWriter) *eventStream {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+	return &eventStream{w: w, rc: rc}
+}
+
+func (s *eventStream) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// streamCodeHTTP serves GET /totps/{name}/stream: a "code" event now and
+// every time the code rolls over or the entry is edited, and a final
+// "deleted" event if the entry is removed. An entry edited out of the scope
+// of the request's token ends the stream with an "error" event.
+func streamCodeHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	if entry, ok := serverStore.Get(name); !ok {
+		writeJSONError(w, http.StatusNotFound, auther.ErrNotFound.Error())
+		return
+	} else if !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return
+	}
+
+	stream := startEventStream(w)
+	var last streamCode
+	rolledOver := true
+	for {
+		changed := serverStore.Changed()
+		entry, ok := serverStore.Get(name)
+		if !ok {
+			stream.send("deleted", map[string]string{"name": name})
+			return
+		}
+		if !inScope(r, entry) {
+			stream.send("error", map[string]string{"message": outOfScopeMessage(r)})
+			return
+		}
+
+		now := clockNow()
+		code, err := entry.Code(now)
+		if err != nil {
+			stream.send("error", map[string]string{"message": err.Error()})
+			return
+		}
+		current := streamCode{Name: name, Code: code, ExpiresIn: entry.ExpiresIn(now)}
+		if rolledOver || current.Code != last.Code {
+			if stream.send("code", current) != nil {
+				return
+			}
+			last = current
+		}
+
+		rolledOver, ok = waitForStream(r, entry.NextPeriod(now), changed)
+		if !ok {
+			return
+		}
+	}
+}
+
+// streamAllCodesHTTP serves GET /totps to EventSource clients: a "codes"
+// event holding every entry's code (limited by ?tag= and the scope of the
+// request's token) now, whenever any of them rolls over, and whenever
+// entries change.
+func streamAllCodesHTTP(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get("tag")
+	stream := startEventStream(w)
+	for {
+		changed := serverStore.Changed()
+		entries := filterByTag(scopeEntries(r, serverStore.List()), tag)
+
+		now := clockNow()
+		codes := []streamCode{}
+		var next time.Time
+		for _, entry := range entries {
+			code, err := entry.Code(now)
+			if err != nil {
+				continue
+			}
+			codes = append(codes, streamCode{Name: entry.Name, Code: code, ExpiresIn: entry.ExpiresIn(now)})
+			if n := entry.NextPeriod(now); next.IsZero() || n.Before(next) {
+				next = n
+			}
+		}
+		if stream.send("codes", codes) != nil {
+			return
+		}
+
+		// With no entries next is zero: nothing rolls over until a change.
+		if _, ok := waitForStream(r, next, changed); !ok {
+			return
+		}
+	}
+}
+
+// waitForStream blocks until deadline passes, the entries change, the client
+// goes away or serve shuts down. It reports whether the deadline passed and
+// whether the stream should carry on. A zero deadline never passes.
+func waitForStream(r *http.Request, deadline time.Time, changed <-chan struct{}) (expired, ok bool) {
+	var tick <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		tick = timer.C
+	}
+	select {
+	case <-tick:
+		return true, true
+	case <-changed:
+		return false, true
+	case <-r.Context().Done():
+		return false, false
+	case <-stopStreams:
+		return false, false
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serve works with systemd in three ways. serve --install-systemd writes a
+// unit that runs it with the flags given, for the user's service manager or
+// the system's. Under systemd, serve says when it is ready to take requests
+// and pings the watchdog while it can still serve them (sd_notify), so a hung
+// server is restarted. And it takes over a socket systemd opened for it
+// (socket activation) instead of listening itself.
+
+// Systemd unit scopes for serve --systemd-scope.
+const (
+	systemdUser   = "user"
+	systemdSystem = "system"
+)
+
+const (
+	systemdUnit = "authinator.service"
+
+	// systemdWatchdog is the WatchdogSec of installed units: a server that
+	// hasn't pinged for this long is restarted.
+	systemdWatchdog = 30 * time.Second
+)
+
+// systemdService is what goes into an installed unit.
+type systemdService struct {
+	scope       string
+	user        string // system scope only
+	exec        []string
+	environment []string
+	writable    []string
+}
+
+// installSystemdUnit writes a unit that runs serve with args, which are the
+// serve flags given without --install-systemd and --systemd-scope, and says
+// how to start it. logFile and socket are the --log-file and --socket flags,
+// whose directories the server has to be able to write to.
+func installSystemdUnit(scope string, args []string, logFile, socket string) error {
+	if runtime.GOOS != "linux" {
+		return errors.New("systemd units can only be installed on Linux")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	svc := systemdService{scope: scope, exec: append([]string{exe, "serve"}, args...)}
+	var config, cache, unitDir string
+	switch scope {
+	case systemdUser:
+		if config, err = configDir(); err != nil {
+			return err
+		}
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		cache = filepath.Join(userCache, "auther")
+		userConfig, err := os.UserConfigDir()
+		if err != nil {
+			return err
+		}
+		unitDir = filepath.Join(userConfig, "systemd", "user")
+		if env := os.Getenv("XDG_CONFIG_HOME"); env != "" {
+			svc.environment = append(svc.environment, "XDG_CONFIG_HOME="+env)
+		}
+		// For the PID file. The runtime directory of a system unit is in
+		// its private /tmp.
+		if env := os.Getenv("XDG_RUNTIME_DIR"); env != "" {
+			svc.writable = append(svc.writable, env)
+		}
+	case systemdSystem:
+		// Under sudo the server still runs as the user who ran it, with
+		// their data file, rather than as root.
+		u, err := user.Current()
+		if err != nil {
+			return err
+		}
+		if name := os.Getenv("SUDO_USER"); name != "" {
+			if u, err = user.Lookup(name); err != nil {
+				return err
+			}
+		}
+		svc.user = u.Username
+		config = filepath.Join(u.HomeDir, ".config", "auther")
+		cache = filepath.Join(u.HomeDir, ".cache", "auther")
+		unitDir = "/etc/systemd/system"
+	default:
+		return fmt.Errorf("unknown --systemd-scope %q. Use user or system", scope)
+	}
+
+	// The data file is pinned, so the service uses the one serve would use
+	// now, whatever the environment of the service manager.
+	data := filepath.Join(config, defaultDataFile())
+	if options.file != "" || os.Getenv("AUTHER_DATA_FILE") != "" || scope == systemdUser {
+		if data, err = filepath.Abs(dataPath); err != nil {
+			return err
+		}
+	}
+	svc.environment = append(svc.environment, "AUTHER_DATA_FILE="+data)
+	if backend := backendName(); backend != backendJSON {
+		svc.environment = append(svc.environment, "AUTHER_BACKEND="+backend)
+	}
+	if env := os.Getenv("AUTHER_CONFIG"); env != "" {
+		path, err := filepath.Abs(env)
+		if err != nil {
+			return err
+		}
+		svc.environment = append(svc.environment, "AUTHER_CONFIG="+path)
+	}
+
+	svc.writable = append(svc.writable, filepath.Dir(data), config, cache)
+	for _, path := range []string{logFile, socket} {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		svc.writable = append(svc.writable, filepath.Dir(abs))
+	}
+
+	unitPath := filepath.Join(unitDir, systemdUnit)
+	if err := os.MkdirAll(unitDir, 0755); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(unitPath)
+	if err := os.WriteFile(unitPath, []byte(svc.unit()), 0644); err != nil {
+		if errors.Is(err, os.ErrPermission) && scope == systemdSystem {
+			return fmt.Errorf("%w; installing a system unit takes root, for example with sudo", err)
+		}
+		return err
+	}
+
+	if statErr == nil {
+		fmt.Printf("Updated %s\n", unitPath)
+	} else {
+		fmt.Printf("Wrote %s\n", unitPath)
+	}
+	systemctl := "systemctl"
+	if scope == systemdUser {
+		systemctl += " --user"
+	} else if svc.user == "root" {
+		fmt.Fprintln(os.Stderr, "The server will run as root. Install the unit with sudo from your own account to run it as you.")
+	}
+	fmt.Println("Start it, and at every boot or login from now on, with:")
+	fmt.Printf("  %s daemon-reload\n  %s enable --now %s\n", systemctl, systemctl, systemdUnit)
+	if scope == systemdUser {
+		fmt.Println("To keep it running while you are logged out, run: loginctl enable-linger")
+	}
+	return nil
+}
+
+// unit returns the unit file of s. The server only gets to write to the
+// directories it uses, and can't gain privileges.
+func (s systemdService) unit() string {
+	var b strings.Builder
+	w := func(format string, args ...any) {
+		fmt.Fprintf(&b, format+"\n", args...)
+	}
+	w("# Written by authinator serve --install-systemd; run it again to update this file.")
+	w("[Unit]")
+	w("Description=authinator TOTP server")
+	w("Documentation=https://github.com/%s", releaseRepo)
+	if s.scope == systemdSystem {
+		w("Wants=network-online.target")
+		w("After=network-online.target")
+	}
+	w("")
+	w("[Service]")
+	w("Type=notify")
+	w("NotifyAccess=main")
+	quoted := make([]string, len(s.exec))
+	for i, arg := range s.exec {
+		quoted[i] = systemdQuote(strings.ReplaceAll(arg, "$", "$$"))
+	}
+	w("ExecStart=%s", strings.Join(quoted, " "))
+	w("ExecReload=/bin/kill -HUP $MAINPID")
+	for _, env := range s.environment {
+		w("Environment=%s", systemdQuote(env))
+	}
+	if s.user != "" {
+		w("User=%s", s.user)
+	}
+	w("Restart=on-failure")
+	w("RestartSec=5s")
+	w("WatchdogSec=%d", int(systemdWatchdog.Seconds()))
+	// Requests in flight and queued webhooks each get shutdownTimeout.
+	w("TimeoutStopSec=%d", int(2*shutdownTimeout.Seconds()+5))
+	w("UMask=0077")
+	w("")
+	w("NoNewPrivileges=yes")
+	w("PrivateTmp=yes")
+	w("ProtectSystem=strict")
+	if s.scope == systemdSystem {
+		w("ProtectHome=read-only")
+	}
+	for _, dir := range s.writable {
+		// The leading - keeps a directory that doesn't exist yet from
+		// failing the unit.
+		w("ReadWritePaths=%s", systemdQuote("-"+dir))
+	}
+	w("ProtectKernelTunables=yes")
+	w("ProtectKernelModules=yes")
+	w("ProtectControlGroups=yes")
+	w("RestrictSUIDSGID=yes")
+	w("RestrictRealtime=yes")
+	w("LockPersonality=yes")
+	w("")
+	w("[Install]")
+	if s.scope == systemdSystem {
+		w("WantedBy=multi-user.target")
+	} else {
+		w("WantedBy=default.target")
+	}
+	return b.String()
+}
+
+// systemdQuote quotes s for a unit file if it has spaces or quotes in it,
+// and escapes the % of specifiers.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// withoutFlags returns args without the flags in names and their values.
+// Boolean flags are in bools, as they take no separate value.
+func withoutFlags(args []string, bools, names []string) []string {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(rest, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+		case slices.Contains(bools, name):
+			continue
+		case slices.Contains(names, name):
+			if !hasValue {
+				i++
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest
+}
+
+// notifySystemd sends state, such as READY=1, to the service manager that
+// started serve, if it asked for it with NOTIFY_SOCKET (sd_notify).
+func notifySystemd(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("couldn't notify systemd", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("couldn't notify systemd", "err", err)
+	}
+}
+
+// startWatchdog pings the systemd watchdog at half the interval it asked
+// for in WATCHDOG_USEC. Each ping first takes the entries from the store, so
+// a server stuck holding its lock stops pinging and is restarted.
+func startWatchdog() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	slog.Debug("pinging the systemd watchdog", "every", interval)
+	go func() {
+		for range time.Tick(interval) {
+			serverStore.List()
+			notifySystemd("WATCHDOG=1")
+		}
+	}()
+}
+
+// systemdListener returns the socket systemd passed to serve for socket
+// activation (LISTEN_FDS), or nil if it didn't pass one.
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	// The variables are meant for this process only, not for the programs
+	// it runs, such as a clipboard helper.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || n == 0 {
+		return nil, nil
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, but serve listens on one", n)
+	}
+	// Passed sockets start at file descriptor 3.
+	f := os.NewFile(3, "systemd socket")
+	defer f.Close()
+	return net.FileListener(f)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// tagLabel returns the entry's tags for display, e.g. " #work #github".
+func tagLabel(e TOTPEntry) string {
+	var sb strings.Builder
+	for _, tag := range e.Tags {
+		sb.WriteString(" #" + tag)
+	}
+	return sb.String()
+}
+
+// filterByTag returns the entries carrying tag, or all entries if tag is empty.
+func filterByTag(entries []TOTPEntry, tag string) []TOTPEntry {
+	if tag == "" {
+		return entries
+	}
+	filtered := []TOTPEntry{}
+	for _, entry := range entries {
+		if entry.HasTag(tag) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// listTags prints every tag in use with the number of entries carrying it.
+// Tags that differ only in case are counted together under the first
+// spelling seen.
+func listTags() {
+	data := mustLoadData()
+
+	counts := map[string]int{}
+	spelling := map[string]string{}
+	for _, entry := range data.Entries {
+		for _, tag := range entry.Tags {
+			key := strings.ToLower(tag)
+			if _, ok := spelling[key]; !ok {
+				spelling[key] = tag
+			}
+			counts[key]++
+		}
+	}
+
+	if len(counts) == 0 {
+		fmt.Println("No tags found.")
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%d\n", spelling[key], counts[key])
+	}
+	tw.Flush()
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Besides the token of serve, which may do anything, the API takes named
+// tokens made with token create, each with a role that limits what it may
+// do, and optionally with tags, which limit it to the entries carrying one
+// of them. They are kept in tokens.json in the config directory, hashed, so
+// the file doesn't give them away.
+
+// API token roles, from the one allowed the least to the one allowed
+// everything: getting and verifying codes of entries known by name, also
+// listing the entries, and also changing them or exporting their secrets.
+const (
+	roleCodes = "codes-only"
+	roleRead  = "read"
+	roleAdmin = "admin"
+)
+
+var tokenRoles = []string{roleCodes, roleRead, roleAdmin}
+
+const (
+	tokensFile = "tokens.json"
+	tokenUsage = "Usage: authinator token create --name name [--role admin|read|codes-only] [--tag tag]... | token list | token revoke name"
+)
+
+// apiToken is a named token as tokens.json keeps it. Tokens are random, so
+// their SHA-256 hash can't be turned back into them. A token with tags may
+// only use the entries carrying one of them; one without may use any.
+type apiToken struct {
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	Tags    []string  `json:"tags,omitempty"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// roleAllows reports whether a token with role may do what needs the role
+// needed.
+func roleAllows(role, needed string) bool {
+	return slices.Index(tokenRoles, role) >= slices.Index(tokenRoles, needed)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokensPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, tokensFile), nil
+}
+
+// loadAPITokens reads the named tokens. There are none until the first one
+// is created.
+func loadAPITokens() ([]apiToken, error) {
+	path, err := tokensPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var tokens []apiToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+func saveAPITokens(tokens []apiToken) error {
+	path, err := tokensPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// serverTokens caches the named tokens for serve, which reads tokens.json
+// again once it changes, so tokens created or revoked while it runs take
+// effect right away.
+var serverTokens struct {
+	mu     sync.Mutex
+	stamp  string
+	tokens []apiToken
+}
+
+// findAPIToken returns the named token given is, if any. Every hash is
+// compared in constant time.
+func findAPIToken(given string) (apiToken, bool) {
+	serverTokens.mu.Lock()
+	defer serverTokens.mu.Unlock()
+
+	path, err := tokensPath()
+	if err != nil {
+		return apiToken{}, false
+	}
+	var stamp string
+	if info, err := os.Stat(path); err == nil {
+		stamp = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+	}
+	if stamp != serverTokens.stamp {
+		tokens, err := loadAPITokens()
+		if err != nil {
+			slog.Error("couldn't read the named API tokens; only the serve token is accepted", "err", err)
+		}
+		serverTokens.stamp, serverTokens.tokens = stamp, tokens
+	}
+
+	hash := []byte(hashToken(given))
+	var found apiToken
+	ok := false
+	for _, t := range serverTokens.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+type tokenKey struct{}
+
+// requestToken returns the named token r was authenticated with, if it was
+// one limited to tags, as requireAuth records it.
+func requestToken(r *http.Request) (apiToken, bool) {
+	t, ok := r.Context().Value(tokenKey{}).(apiToken)
+	return t, ok
+}
+
+// inScope reports whether the token of r may use entry. Entries without tags
+// are only for tokens that aren't limited to tags.
+func inScope(r *http.Request, entry TOTPEntry) bool {
+	t, ok := requestToken(r)
+	return !ok || slices.ContainsFunc(t.Tags, entry.HasTag)
+}
+
+// scopeEntries returns the entries the token of r may use.
+func scopeEntries(r *http.Request, entries []TOTPEntry) []TOTPEntry {
+	if _, ok := requestToken(r); !ok {
+		return entries
+	}
+	scoped := []TOTPEntry{}
+	for _, entry := range entries {
+		if inScope(r, entry) {
+			scoped = append(scoped, entry)
+		}
+	}
+	return scoped
+}
+
+// outOfScopeMessage says why the token of r may not use an entry.
+func outOfScopeMessage(r *http.Request) string {
+	t, _ := requestToken(r)
+	return fmt.Sprintf("the token %s may only use entries tagged %s", t.Name, strings.Join(t.Tags, ", "))
+}
+
+// changeInScope checks, before a request changes the entry name, that the
+// token of r may use it. If not, it answers 403 Forbidden and returns false.
+// An entry that doesn't exist is left for the handler to answer.
+func changeInScope(w http.ResponseWriter, r *http.Request, name string) bool {
+	if _, ok := requestToken(r); !ok {
+		return true
+	}
+	if entry, ok := serverStore.Get(name); ok && !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return false
+	}
+	return true
+}
+
+// writeOutOfScope answers a request for an entry its token may not use with
+// 403 Forbidden.
+func writeOutOfScope(w http.ResponseWriter, r *http.Request) {
+	noteAudit(r).outcome = auditForbidden
+	writeJSONError(w, http.StatusForbidden, outOfScopeMessage(r))
+}
+
+// tokenCommand creates, lists and revokes named API tokens.
+func tokenCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "create":
+		createToken(args[1:])
+	case "list":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, tokenUsage)
+			os.Exit(2)
+		}
+		listTokens()
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, tokenUsage)
+			os.Exit(2)
+		}
+		revokeToken(args[1])
+	default:
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		os.Exit(2)
+	}
+}
+
+// createToken makes a named token and prints it, the only time it is shown.
+func createToken(args []string) {
+	fs := newFlagSet("token create", "token create --name name [--role admin|read|codes-only] [--tag tag]...")
+	name := fs.String("name", "", "name of the token, such as what uses it")
+	role := fs.String("role", roleRead, "what the token may do: admin, read or codes-only")
+	var tags stringList
+	fs.Var(&tags, "tag", "only allow the entries with this tag (repeatable)")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	*name = strings.TrimSpace(*name)
+	if len(rest) != 0 || *name == "" {
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		os.Exit(2)
+	}
+	if !slices.Contains(tokenRoles, *role) {
+		fmt.Fprintf(os.Stderr, "Unknown role %q. Use admin, read or codes-only.\n", *role)
+		os.Exit(2)
+	}
+	var scope []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.ContainsFunc(scope, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			scope = append(scope, tag)
+		}
+	}
+	if len(scope) > 0 && *role == roleAdmin {
+		fmt.Fprintln(os.Stderr, "An admin token can't be limited to tags; use --role read or codes-only.")
+		os.Exit(2)
+	}
+
+	tokens, err := loadAPITokens()
+	if err != nil {
+		fatal(err)
+	}
+	if slices.ContainsFunc(tokens, func(t apiToken) bool { return t.Name == *name }) {
+		fatal(fmt.Errorf("a token named %q already exists; revoke it first or choose another name", *name))
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		fatal(err)
+	}
+	token := hex.EncodeToString(b)
+	tokens = append(tokens, apiToken{Name: *name, Role: *role, Tags: scope, Hash: hashToken(token), Created: time.Now().UTC()})
+	if err := saveAPITokens(tokens); err != nil {
+		fatal(fmt.Errorf("saving the token: %w", err))
+	}
+
+	if options.json {
+		out := map[string]any{"name": *name, "role": *role, "token": token}
+		if len(scope) > 0 {
+			out["tags"] = scope
+		}
+		printJSON(out)
+		return
+	}
+	if len(scope) > 0 {
+		fmt.Printf("Created the %s token %s, for entries tagged %s:\n%s\n", *role, *name, strings.Join(scope, ", "), token)
+	} else {
+		fmt.Printf("Created the %s token %s:\n%s\n", *role, *name, token)
+	}
+	fmt.Println("It isn't shown again. Send it as 'Authorization: Bearer <token>'.")
+}
+
+// tokenView is a named token as token list --json shows it, without its
+// hash.
+type tokenView struct {
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func listTokens() {
+	tokens, err := loadAPITokens()
+	if err != nil {
+		fatal(err)
+	}
+	if options.json {
+		views := []tokenView{}
+		for _, t := range tokens {
+			views = append(views, tokenView{Name: t.Name, Role: t.Role, Tags: t.Tags, Created: t.Created})
+		}
+		printJSON(views)
+		return
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No named tokens. Create one with authinator token create --name name.")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tROLE\tENTRIES\tCREATED")
+	for _, t := range tokens {
+		entries := "all"
+		if len(t.Tags) > 0 {
+			entries = "tagged " + strings.Join(t.Tags, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, t.Role, entries, t.Created.Local().Format("2006-01-02 15:04:05"))
+	}
+	tw.Flush()
+}
+
+func revokeToken(name string) {
+	tokens, err := loadAPITokens()
+	if err != nil {
+		fatal(err)
+	}
+	i := slices.IndexFunc(tokens, func(t apiToken) bool { return t.Name == name })
+	if i < 0 {
+		fatal(fmt.Errorf("no token named %q", name))
+	}
+	if err := saveAPITokens(slices.Delete(tokens, i, i+1)); err != nil {
+		fatal(fmt.Errorf("saving the tokens: %w", err))
+	}
+	fmt.Printf("Revoked the token %s.\n", name)
+}
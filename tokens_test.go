@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func scopeTestAPI(t *testing.T) http.Handler {
+	t.Helper()
+	return newTestAPI(t,
+		TOTPEntry{Name: "build", Tags: []string{"ci"}},
+		TOTPEntry{Name: "deploy", Tags: []string{"CI", "prod"}},
+		TOTPEntry{Name: "bank", Tags: []string{"personal"}},
+		TOTPEntry{Name: "untagged"},
+	)
+}
+
+func TestScopeListsOnlyTaggedEntries(t *testing.T) {
+	h := scopeTestAPI(t)
+	tests := []struct {
+		token string
+		want  []string
+	}{
+		{addTestToken(t, "ci", roleRead, "ci"), []string{"build", "deploy"}},
+		{addTestToken(t, "personal", roleRead, "personal", "other"), []string{"bank"}},
+		{addTestToken(t, "all", roleRead), []string{"build", "deploy", "bank", "untagged"}},
+		{testToken, []string{"build", "deploy", "bank", "untagged"}},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{"/v1/totps", "/v1/totps?codes=true"} {
+			w := request(h, "GET", path, tt.token, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s with %s: status %d: %s", path, tt.token, w.Code, w.Body)
+			}
+			var listed []struct{ Name string }
+			decodeBody(t, w, &listed)
+			var names []string
+			for _, e := range listed {
+				names = append(names, e.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("GET %s with %s: got %v, want %v", path, tt.token, names, tt.want)
+			}
+		}
+	}
+}
+
+func TestScopeNamedCodes(t *testing.T) {
+	h := scopeTestAPI(t)
+	token := addTestToken(t, "ci", roleCodes, "ci")
+	w := request(h, "GET", "/v1/totps?codes=true&names=build,bank,untagged", token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var results []struct{ Name, Code, Error string }
+	decodeBody(t, w, &results)
+	for _, res := range results {
+		if found := res.Error == ""; found != (res.Name == "build") {
+			t.Errorf("%s: code %q, error %q", res.Name, res.Code, res.Error)
+		}
+	}
+}
+
+func TestScopeDirectAccess(t *testing.T) {
+	h := scopeTestAPI(t)
+	codes := addTestToken(t, "codes", roleCodes, "ci")
+	read := addTestToken(t, "read", roleRead, "ci")
+	tests := []struct {
+		token, method, path, body string
+		status                    int
+	}{
+		{codes, "GET", "/v1/totps/build?peek=true", "", http.StatusOK},
+		{codes, "GET", "/v1/totps/DEPLOY?peek=true", "", http.StatusOK},
+		{codes, "GET", "/v1/totps/bank?peek=true", "", http.StatusForbidden},
+		{codes, "GET", "/v1/totps/untagged?peek=true", "", http.StatusForbidden},
+		{codes, "GET", "/v1/totps/missing", "", http.StatusNotFound},
+		{read, "GET", "/v1/totps/bank?peek=true", "", http.StatusForbidden},
+		{codes, "POST", "/v1/totps/build/verify", `{"code": "000000"}`, http.StatusOK},
+		{codes, "POST", "/v1/totps/bank/verify", `{"code": "000000"}`, http.StatusForbidden},
+		{codes, "POST", "/v1/totps/untagged/verify", `{"code": "000000"}`, http.StatusForbidden},
+		{testToken, "GET", "/v1/totps/bank?peek=true", "", http.StatusOK},
+		{testToken, "POST", "/v1/totps/untagged/verify", `{"code": "000000"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := request(h, tt.method, tt.path, tt.token, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s %s with %s: status %d, want %d: %s", tt.method, tt.path, tt.token, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestScopeChanges(t *testing.T) {
+	// token create refuses admin tokens with tags, but tokens.json may be
+	// edited by hand.
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"PUT", "/v1/totps/build", `{"issuer": "CI"}`, http.StatusOK},
+		{"PUT", "/v1/totps/bank", `{"issuer": "Bank"}`, http.StatusForbidden},
+		{"PUT", "/v1/totps/untagged", `{"issuer": "None"}`, http.StatusForbidden},
+		{"PUT", "/v1/totps/build", `{"tags": ["personal"]}`, http.StatusForbidden},
+		{"PATCH", "/v1/totps/build", `{"name": "builder"}`, http.StatusOK},
+		{"PATCH", "/v1/totps/bank", `{"name": "mine"}`, http.StatusForbidden},
+		{"DELETE", "/v1/totps/build", "", http.StatusOK},
+		{"DELETE", "/v1/totps/bank", "", http.StatusForbidden},
+		{"DELETE", "/v1/totps/untagged?purge=true", "", http.StatusForbidden},
+		{"POST", "/v1/totps", `{"name": "runner", "secret": "` + testSecret + `", "tags": ["ci"]}`, http.StatusCreated},
+		{"POST", "/v1/totps", `{"name": "other", "secret": "` + testSecret + `"}`, http.StatusForbidden},
+		{"POST", "/v1/totps/generate", `{"name": "runner", "tags": ["ci"]}`, http.StatusCreated},
+		{"POST", "/v1/totps/generate", `{"name": "other", "tags": ["personal"]}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		h := scopeTestAPI(t)
+		token := addTestToken(t, "ci", roleAdmin, "ci")
+		w := request(h, tt.method, tt.path, token, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s %s %s: status %d, want %d: %s", tt.method, tt.path, tt.body, w.Code, tt.status, w.Body)
+		}
+		if w.Code == http.StatusForbidden {
+			for _, name := range []string{"build", "bank", "untagged"} {
+				if entry, ok := serverStore.Get(name); !ok || entry.Issuer != "" {
+					t.Errorf("%s %s %s: %s was changed", tt.method, tt.path, tt.body, name)
+				}
+			}
+		}
+	}
+}
+
+func TestScopeBatch(t *testing.T) {
+	h := scopeTestAPI(t)
+	token := addTestToken(t, "ci", roleAdmin, "ci")
+	body := `{"on_conflict": "overwrite", "entries": [
+		{"name": "runner", "secret": "` + testSecret + `", "tags": ["ci"]},
+		{"name": "loose", "secret": "` + testSecret + `"},
+		{"name": "BANK", "secret": "` + testSecret + `", "tags": ["ci"]}]}`
+	w := request(h, "POST", "/v1/totps/batch", token, body)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Results []batchResult
+	}
+	decodeBody(t, w, &resp)
+	want := []string{batchCreated, batchError, batchError}
+	for i, res := range resp.Results {
+		if res.Status != want[i] {
+			t.Errorf("%s: status %s (%s), want %s", res.Name, res.Status, res.Reason, want[i])
+		}
+	}
+	if _, ok := serverStore.Get("loose"); ok {
+		t.Error("the untagged entry was created")
+	}
+	if bank, _ := serverStore.Get("bank"); !bank.HasTag("personal") {
+		t.Errorf("bank was overwritten: %+v", bank)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+const trashUsage = "Usage: authinator trash list | trash restore [name] [--as new-name] | trash empty [--yes]"
+
+// trashCommand lists, restores and purges the entries remove moved to the
+// trash. Entries removed more than 30 days ago are purged first.
+func trashCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, trashUsage)
+		os.Exit(2)
+	}
+
+	store := mustOpenStore()
+	expired, err := store.ExpireTrash(time.Now())
+	if err != nil {
+		fatal(err)
+	}
+	if expired > 0 && !options.json {
+		fmt.Fprintf(os.Stderr, "Purged %d entries that were in the trash for more than 30 days.\n", expired)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, trashUsage)
+			os.Exit(2)
+		}
+		listTrash(store)
+	case "restore":
+		restoreFromTrash(store, args[1:])
+	case "empty":
+		emptyTrash(store, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, trashUsage)
+		os.Exit(2)
+	}
+}
+
+// trashView is an entry in the trash as trash list --json shows it.
+type trashView struct {
+	Name      string    `json:"name"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func listTrash(store *auther.Store) {
+	trash := store.Trashed()
+	if options.json {
+		views := []trashView{}
+		for _, t := range trash {
+			views = append(views, trashView{Name: t.Name, Issuer: t.Issuer, Account: t.Account,
+				DeletedAt: t.DeletedAt, ExpiresAt: t.DeletedAt.Add(auther.TrashExpiry)})
+		}
+		printJSON(views)
+		return
+	}
+	if len(trash) == 0 {
+		fmt.Println("The trash is empty.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tISSUER\tDELETED\tPURGED AFTER")
+	for _, t := range trash {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, t.Issuer,
+			t.DeletedAt.Local().Format("2006-01-02 15:04:05"), t.DeletedAt.Add(auther.TrashExpiry).Local().Format("2006-01-02"))
+	}
+	tw.Flush()
+}
+
+// restoreFromTrash brings back the most recently removed entry with the given
+// name. If an entry of that name exists again, it is restored under a new
+// name, which --as chooses.
+func restoreFromTrash(store *auther.Store, args []string) {
+	fs := newFlagSet("trash restore", "trash restore [name] [--as new-name]")
+	as := fs.String("as", "", "restore the entry under this name")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, trashUsage)
+		os.Exit(2)
+	}
+	name := args[0]
+
+	newName := name
+	err = store.Update(func(v *TOTPData) error {
+		switch {
+		case *as != "":
+			newName = *as
+		case v.Index(name) >= 0:
+			newName = uniqueName(*v, name)
+		}
+		return v.Untrash(name, newName)
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, auther.ErrNotFound):
+		reportErrorf("No entry named '%s' in the trash.", name)
+		os.Exit(1)
+	case errors.Is(err, auther.ErrExists):
+		reportErrorf("%s", conflictMessage(err, newName))
+		os.Exit(1)
+	default:
+		fatal(err)
+	}
+
+	if options.json {
+		printJSON(map[string]any{"name": name, "restored_as": newName})
+		return
+	}
+	if newName != name {
+		fmt.Printf("Entry '%s' has been restored as '%s'.\n", name, newName)
+	} else {
+		fmt.Printf("Entry '%s' has been restored.\n", name)
+	}
+}
+
+func emptyTrash(store *auther.Store, args []string) {
+	fs := newFlagSet("trash empty", "trash empty [--yes]")
+	yes := fs.Bool("yes", false, "empty the trash without asking for confirmation")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, trashUsage)
+		os.Exit(2)
+	}
+
+	n := len(store.Trashed())
+	if n == 0 {
+		if options.json {
+			printJSON(map[string]any{"purged": 0})
+		} else {
+			fmt.Println("The trash is already empty.")
+		}
+		return
+	}
+	if !*yes && !isTerminal(os.Stdin) {
+		reportErrorf("Refusing to empty the trash without confirmation because stdin is not a terminal. Use --yes to skip the prompt.")
+		os.Exit(1)
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete the %d entries in the trash for good?", n)) {
+		fmt.Println("The trash was kept.")
+		return
+	}
+
+	if err := store.Update(func(v *TOTPData) error {
+		v.Trash = nil
+		return nil
+	}); err != nil {
+		fatal(err)
+	}
+	if options.json {
+		printJSON(map[string]any{"purged": n})
+		return
+	}
+	fmt.Printf("Deleted %d entries for good.\n", n)
+}
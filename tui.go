@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"authinator/pkg/auther"
+	"golang.org/x/term"
+)
+
+// The tui command is a full-screen view of the entries with live codes. It
+// draws with plain ANSI escapes on a terminal in raw mode, so it needs no
+// library beyond golang.org/x/term.
+
+// What the keys currently do.
+const (
+	tuiBrowse = iota
+	tuiFilter
+	tuiConfirmRemove
+	tuiAddName
+	tuiAddSecret
+)
+
+const tuiHelp = "enter copy  / filter  a add  d remove  q quit"
+
+// tuiCode is a generated code and the end of the period it belongs to.
+type tuiCode struct {
+	code  string
+	err   error
+	until time.Time
+}
+
+type tui struct {
+	store *auther.Store
+	out   *bufio.Writer
+
+	entries  []TOTPEntry // the entries matching filter, sorted by name
+	codes    map[string]tuiCode
+	selected int
+	offset   int // index of the first entry on screen
+
+	mode    int
+	filter  string
+	input   string // the text typed in tuiAddName and tuiAddSecret
+	newName string
+	status  string
+}
+
+func tuiCommand(args []string) {
+	fs := newFlagSet("tui", "tui")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator tui")
+		os.Exit(2)
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		reportErrorf("The tui command needs a terminal. Use list or [name] in scripts.")
+		os.Exit(1)
+	}
+
+	// The store is opened first, as it may have to ask for a passphrase.
+	t := &tui{store: mustOpenStore(), out: bufio.NewWriter(os.Stdout), codes: map[string]tuiCode{}}
+	// Check the clock now, so a warning about it is left on the terminal
+	// rather than drawn over.
+	clockNow()
+	logAuditDetail("list", "", auditOK, "tui")
+	if err := t.run(); err != nil {
+		fatal(err)
+	}
+}
+
+// run takes over the terminal until the user quits. The terminal is restored
+// however run returns, panics included, since deferred calls still run while
+// a panic unwinds.
+func (t *tui) run() error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		t.out.Flush()
+		term.Restore(fd, state)
+	}()
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	t.applyFilter()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || !t.handleKey(key) {
+				return nil
+			}
+		case <-signals:
+			return nil
+		case <-timer.C:
+			// Codes are only generated when their period is over; in
+			// between, the timer just moves the countdowns on by a second.
+			now := clockNow()
+			t.refreshCodes(now)
+			timer.Reset(now.Truncate(time.Second).Add(time.Second).Sub(now))
+		}
+		t.draw(clockNow())
+	}
+}
+
+// refreshCodes generates codes for the entries on the list whose code is
+// missing or belongs to a period that has ended.
+func (t *tui) refreshCodes(now time.Time) {
+	for _, entry := range t.entries {
+		if c, ok := t.codes[entry.Name]; ok && now.Before(c.until) {
+			continue
+		}
+		code, err := entry.Code(now)
+		t.codes[entry.Name] = tuiCode{code: code, err: err, until: entry.NextPeriod(now)}
+	}
+}
+
+// applyFilter rebuilds the list from the store after the filter or the
+// entries changed, keeping the selection on screen.
+func (t *tui) applyFilter() {
+	t.entries = t.entries[:0]
+	for _, entry := range t.store.List() {
+		if t.filter == "" || matchesQuery(entry, t.filter) {
+			t.entries = append(t.entries, entry)
+		}
+	}
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		return strings.ToLower(t.entries[i].Name) < strings.ToLower(t.entries[j].Name)
+	})
+	auther.SortPinned(t.entries, func(e TOTPEntry) int { return e.Pin })
+	t.selected = min(t.selected, max(len(t.entries)-1, 0))
+	t.refreshCodes(clockNow())
+}
+
+// current returns the highlighted entry.
+func (t *tui) current() (TOTPEntry, bool) {
+	if t.selected >= len(t.entries) {
+		return TOTPEntry{}, false
+	}
+	return t.entries[t.selected], true
+}
+
+// handleKey acts on a key press and reports whether to carry on.
+func (t *tui) handleKey(key string) bool {
+	if key == "ctrl-c" {
+		return false
+	}
+
+	switch t.mode {
+	case tuiBrowse:
+		t.status = ""
+		switch key {
+		case "q":
+			return false
+		case "up", "k":
+			t.selected = max(t.selected-1, 0)
+		case "down", "j":
+			t.selected = min(t.selected+1, max(len(t.entries)-1, 0))
+		case "home", "g":
+			t.selected = 0
+		case "end", "G":
+			t.selected = max(len(t.entries)-1, 0)
+		case "enter":
+			t.copySelected()
+		case "/":
+			t.mode = tuiFilter
+		case "esc":
+			t.filter = ""
+			t.applyFilter()
+		case "a":
+			t.mode, t.input = tuiAddName, ""
+		case "d":
+			if _, ok := t.current(); ok {
+				t.mode = tuiConfirmRemove
+			}
+		}
+	case tuiFilter:
+		switch key {
+		case "enter", "up", "down":
+			t.mode = tuiBrowse
+		case "esc":
+			t.mode, t.filter = tuiBrowse, ""
+		case "backspace":
+			t.filter = dropLastRune(t.filter)
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				t.filter += key
+			}
+		}
+		t.selected = 0
+		t.applyFilter()
+	case tuiConfirmRemove:
+		t.mode = tuiBrowse
+		if key == "y" || key == "Y" {
+			t.removeSelected()
+		}
+	case tuiAddName, tuiAddSecret:
+		switch key {
+		case "esc":
+			t.mode, t.status = tuiBrowse, "Nothing was added."
+		case "backspace":
+			t.input = dropLastRune(t.input)
+		case "enter":
+			t.submitInput()
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				t.input += key
+			}
+		}
+	}
+	return true
+}
+
+// submitInput moves on from the name to the secret of a new entry, and adds
+// the entry once both are in.
+func (t *tui) submitInput() {
+	input := strings.TrimSpace(t.input)
+	t.input = ""
+	if t.mode == tuiAddName {
+		if input == "" {
+			t.mode, t.status = tuiBrowse, "Nothing was added."
+			return
+		}
+		t.mode, t.newName = tuiAddSecret, input
+		return
+	}
+
+	t.mode = tuiBrowse
+	entry := TOTPEntry{Name: t.newName, Secret: input}
+	if err := entry.Validate(); err != nil {
+		t.status = fmt.Sprintf("Invalid entry: %v", err)
+		return
+	}
+	switch err := t.store.Add(entry); {
+	case err == nil:
+		t.status = fmt.Sprintf("Added '%s'.", entry.Name)
+	case errors.Is(err, auther.ErrExists):
+		t.status = conflictMessage(err, entry.Name)
+		return
+	default:
+		t.status = fmt.Sprintf("Could not add '%s': %v", entry.Name, err)
+		return
+	}
+	delete(t.codes, entry.Name)
+	t.applyFilter()
+	for i, e := range t.entries {
+		if e.Name == entry.Name {
+			t.selected = i
+		}
+	}
+}
+
+func (t *tui) removeSelected() {
+	entry, _ := t.current()
+	if err := t.store.MoveToTrash(entry.Name); err != nil {
+		t.status = fmt.Sprintf("Could not remove '%s': %v", entry.Name, err)
+		return
+	}
+	delete(t.codes, entry.Name)
+	t.applyFilter()
+	t.status = fmt.Sprintf("Moved '%s' to the trash.", entry.Name)
+}
+
+func (t *tui) copySelected() {
+	entry, ok := t.current()
+	if !ok {
+		return
+	}
+	c := t.codes[entry.Name]
+	if c.err != nil {
+		t.status = fmt.Sprintf("No code for '%s': %v", entry.Name, c.err)
+		return
+	}
+
+	how, err := copyToClipboard(c.code)
+	switch {
+	case err == errClipboardDisabled:
+		t.status = "Copying codes to the clipboard is turned off."
+		return
+	case err != nil:
+		t.status = "Clipboard not available, so the code was not copied."
+		return
+	case how == copiedOSC52:
+		t.status = fmt.Sprintf("Code of '%s' sent to your terminal clipboard.", entry.Name)
+	case options.noClear || options.clipboardTimeout <= 0:
+		t.status = fmt.Sprintf("Code of '%s' copied to clipboard.", entry.Name)
+	default:
+		t.status = fmt.Sprintf("Code of '%s' copied to clipboard (cleared in %d seconds).", entry.Name, options.clipboardTimeout)
+	}
+	logAudit("code", entry.Name, auditOK)
+	if err := t.store.MarkUsed(entry.Name); err != nil {
+		t.status = fmt.Sprintf("Code copied, but recording its use failed: %v", err)
+	}
+}
+
+// draw repaints the whole screen. Rows are overwritten in place rather than
+// cleared first, so the screen doesn't flicker.
+func (t *tui) draw(now time.Time) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 3 {
+		width, height = 80, 24
+	}
+	rows := height - 2
+
+	if t.selected < t.offset {
+		t.offset = t.selected
+	}
+	if t.selected >= t.offset+rows {
+		t.offset = t.selected - rows + 1
+	}
+	t.offset = max(min(t.offset, len(t.entries)-rows), 0)
+
+	nameWidth := 4
+	for _, entry := range t.entries {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(entry.Name))
+	}
+	nameWidth = min(nameWidth, width/3)
+
+	t.out.WriteString("\x1b[H")
+	header := fmt.Sprintf("authinator  entries: %d", len(t.entries))
+	if t.filter != "" || t.mode == tuiFilter {
+		header += fmt.Sprintf("  filter: %s", t.filter)
+	}
+	t.line("\x1b[1m", header, width)
+
+	for row := 0; row < rows; row++ {
+		i := t.offset + row
+		switch {
+		case i < len(t.entries):
+			style := ""
+			if i == t.selected {
+				style = "\x1b[7m"
+			}
+			t.line(style, t.entryLine(t.entries[i], now, nameWidth), width)
+		case i == 0:
+			t.line("", "  No entries. Press a to add one.", width)
+		default:
+			t.line("", "", width)
+		}
+	}
+
+	var footer string
+	switch t.mode {
+	case tuiFilter:
+		footer = "/" + t.filter
+	case tuiConfirmRemove:
+		entry, _ := t.current()
+		footer = fmt.Sprintf("Move '%s' to the trash? [y/N]", entry.Name)
+	case tuiAddName:
+		footer = "Name: " + t.input
+	case tuiAddSecret:
+		// The secret isn't echoed, like at the create prompt.
+		footer = fmt.Sprintf("Secret for '%s': %s", t.newName, strings.Repeat("*", utf8.RuneCountInString(t.input)))
+	case tuiBrowse:
+		footer = t.status
+		if footer == "" {
+			footer = tuiHelp
+		}
+	}
+	t.out.WriteString("\x1b[2m")
+	t.out.WriteString(truncate(footer, width))
+	t.out.WriteString("\x1b[0m\x1b[K")
+	t.out.Flush()
+}
+
+// line writes one row of the screen.
+func (t *tui) line(style, text string, width int) {
+	t.out.WriteString(style)
+	t.out.WriteString(truncate(text, width))
+	t.out.WriteString("\x1b[0m\x1b[K\r\n")
+}
+
+// entryLine is the row of an entry: a star if it is pinned, its name, code,
+// a bar showing how much of the code's period is left and who the entry is
+// for.
+func (t *tui) entryLine(entry TOTPEntry, now time.Time, nameWidth int) string {
+	mark := " "
+	if entry.Pinned() {
+		mark = "*"
+	}
+	name := truncate(entry.Name, nameWidth)
+	name += strings.Repeat(" ", nameWidth-utf8.RuneCountInString(name))
+
+	c := t.codes[entry.Name]
+	if c.err != nil {
+		return fmt.Sprintf("%s %s  error: %v", mark, name, c.err)
+	}
+
+	const barWidth = 20
+	left := int64(c.until.Sub(now).Round(time.Second) / time.Second)
+	left = max(min(left, entry.CodePeriod()), 0)
+	filled := int(left * barWidth / entry.CodePeriod())
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+
+	code := displayCode(c.code)
+	line := fmt.Sprintf("%s %s  %-9s  %s %3ds", mark, name, code, bar, left)
+	if who := strings.TrimSpace(entry.Issuer + " " + entry.Account); who != "" {
+		line += "  " + who
+	}
+	return line
+}
+
+// truncate shortens s to at most width characters.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max(width, 0)])
+}
+
+func dropLastRune(s string) string {
+	_, size := utf8.DecodeLastRuneInString(s)
+	return s[:len(s)-size]
+}
+
+// tuiKeySequences are the escape sequences terminals send for the keys the
+// tui understands, in both of their common forms.
+var tuiKeySequences = []struct {
+	seq, key string
+}{
+	{"\x1b[A", "up"}, {"\x1bOA", "up"},
+	{"\x1b[B", "down"}, {"\x1bOB", "down"},
+	{"\x1b[H", "home"}, {"\x1bOH", "home"}, {"\x1b[1~", "home"},
+	{"\x1b[F", "end"}, {"\x1bOF", "end"}, {"\x1b[4~", "end"},
+}
+
+// readKeys sends the keys typed on r to keys, closing it when r fails.
+func readKeys(r *os.File, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// parseKeys splits what one read from the terminal returned into keys: a
+// name such as "up" or "enter" for special keys, the character otherwise.
+// An escape on its own is the Esc key; other sequences are ignored.
+func parseKeys(b []byte) []string {
+	var keys []string
+next:
+	for len(b) > 0 {
+		for _, s := range tuiKeySequences {
+			if bytes.HasPrefix(b, []byte(s.seq)) {
+				keys = append(keys, s.key)
+				b = b[len(s.seq):]
+				continue next
+			}
+		}
+
+		switch c := b[0]; {
+		case c == 0x1b && len(b) > 1 && (b[1] == '[' || b[1] == 'O'):
+			// An unknown sequence runs up to its final byte.
+			end := 2
+			for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+				end++
+			}
+			b = b[min(end+1, len(b)):]
+			continue
+		case c == 0x1b:
+			keys = append(keys, "esc")
+		case c == '\r' || c == '\n':
+			keys = append(keys, "enter")
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, "backspace")
+		case c == 0x03:
+			keys = append(keys, "ctrl-c")
+		case c >= 0x20:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
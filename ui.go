@@ -0,0 +1,44 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// webFiles holds the single-page UI that serve offers at /. It is plain
+// HTML, CSS and JavaScript talking to the JSON API, so it needs no build step.
+//
+//go:embed web
+var webFiles embed.FS
+
+// webUI serves the embedded UI. The files themselves hold no secrets, so they
+// are served without a token; the page asks for one when the API wants it.
+func webUI() http.Handler {
+	root, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServer(http.FS(root))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			methodNotAllowed(w, "GET, HEAD")
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if name != "" {
+			if _, err := fs.Stat(root, name); err != nil {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+		}
+
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		files.ServeHTTP(w, r)
+	})
+}
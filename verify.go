@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+// defaultVerifySkew accepts the codes of one period either side of now, to
+// allow for clock drift and for codes typed just before they rolled over.
+const defaultVerifySkew = 1
+
+// Verification attempts allowed per entry over HTTP, to blunt brute force.
+const (
+	verifyAttempts = 5
+	verifyWindow   = 30 * time.Second
+)
+
+func verifyCommand(args []string) {
+	fs := newFlagSet("verify", "verify [name] [code] [--skew n]")
+	skew := fs.Uint("skew", defaultVerifySkew, "also accept codes from this many periods before and after now")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator verify [name] [code] [--skew n]")
+		os.Exit(2)
+	}
+
+	entry, ok := mustLoadData().Find(args[0])
+	if !ok {
+		logAudit("verify", args[0], auditNotFound)
+		reportErrorf("No entry found with the name: %s", args[0])
+		os.Exit(exitNotFound)
+	}
+	if entry.IsSteam() {
+		fmt.Fprintf(os.Stderr, "%s is a Steam Guard entry; Steam Guard codes can only be checked by Steam.\n", entry.Name)
+		os.Exit(2)
+	}
+
+	valid, err := entry.Verify(args[1], clockNow(), *skew)
+	if err != nil {
+		logAudit("verify", entry.Name, auditFailed)
+		fail(exitCodeGen, err)
+	}
+	if valid {
+		logAudit("verify", entry.Name, auditValid)
+	} else {
+		logAudit("verify", entry.Name, auditInvalid)
+	}
+
+	switch {
+	case options.json:
+		printJSON(map[string]any{"name": entry.Name, "valid": valid})
+	case valid:
+		fmt.Println("Code is valid.")
+	default:
+		fmt.Println("Code is not valid.")
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// serverVerifySkew is the skew serve applies to POST /totps/{name}/verify.
+var serverVerifySkew uint = defaultVerifySkew
+
+var verifyLimiter = newAttemptLimiter(verifyAttempts, verifyWindow)
+
+func verifyCodeHTTP(w http.ResponseWriter, r *http.Request, name string) {
+	entry, ok := serverStore.Get(name)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, auther.ErrNotFound.Error())
+		return
+	}
+	if !inScope(r, entry) {
+		writeOutOfScope(w, r)
+		return
+	}
+
+	// The limit is per entry, however its name is written.
+	now := time.Now()
+	if allowed, wait := verifyLimiter.allow(entry.Name, now); !allowed {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("too many verification attempts; try again in %d seconds", seconds))
+		return
+	}
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if body.Code == "" {
+		writeJSONError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	valid, err := entry.Verify(body.Code, clockNow(), serverVerifySkew)
+	if errors.Is(err, auther.ErrVerifyUnsupported) {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		writeServerError(w, fmt.Errorf("verifying code for %s: %w", name, err))
+		return
+	}
+	noteAudit(r).outcome = auditInvalid
+	if valid {
+		noteAudit(r).outcome = auditValid
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": valid})
+}
+
+// attemptLimiter allows a fixed number of attempts per key within a sliding
+// window.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	attempts map[string][]time.Time
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{limit: limit, window: window, attempts: map[string][]time.Time{}}
+}
+
+// allow records an attempt for key at now and reports whether it is within
+// the limit. If it isn't, the attempt is not recorded and allow returns how
+// long until the next one will be accepted.
+func (l *attemptLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var recent []time.Time
+	for _, t := range l.attempts[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.attempts[key] = recent
+		return false, recent[0].Add(l.window).Sub(now)
+	}
+	l.attempts[key] = append(recent, now)
+	return true, 0
+}
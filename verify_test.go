@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"authinator/pkg/auther"
+)
+
+func TestVerifyLimitIgnoresNameCase(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "GitHub"})
+	names := []string{"GitHub", "github", "GITHUB", "gitHub", "GiThUb", "gItHuB"}
+	for i, name := range names {
+		w := request(h, "POST", "/v1/totps/"+name+"/verify", testToken, `{"code": "000000"}`)
+		want := http.StatusOK
+		if i >= verifyAttempts {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Errorf("attempt %d, as %s: status %d, want %d: %s", i+1, name, w.Code, want, w.Body)
+		}
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	l := newAttemptLimiter(verifyAttempts, verifyWindow)
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < verifyAttempts; i++ {
+		if ok, _ := l.allow("github", start.Add(time.Duration(i)*time.Second)); !ok {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+	ok, wait := l.allow("github", start.Add(10*time.Second))
+	if ok || wait != verifyWindow-10*time.Second {
+		t.Errorf("attempt over the limit: allowed %v, wait %s, want %s", ok, wait, verifyWindow-10*time.Second)
+	}
+	if ok, _ := l.allow("gitlab", start.Add(10*time.Second)); !ok {
+		t.Error("another entry's attempt was refused")
+	}
+	// The first attempt leaves the window, making room for one more.
+	if ok, _ := l.allow("github", start.Add(verifyWindow)); !ok {
+		t.Error("attempt after the window refused")
+	}
+	if ok, _ := l.allow("github", start.Add(verifyWindow)); ok {
+		t.Error("second attempt after the window allowed")
+	}
+}
+
+func TestVerifyHTTP(t *testing.T) {
+	h := newTestAPI(t, TOTPEntry{Name: "github"}, TOTPEntry{Name: "steam", Type: auther.TypeSteam})
+	entry, _ := serverStore.Get("github")
+	now := time.Now()
+	period := time.Duration(entry.CodePeriod()) * time.Second
+	code := func(at time.Time) string {
+		c, err := entry.Code(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name, body string
+		status     int
+		valid      bool
+	}{
+		{"current", `{"code": "` + code(now) + `"}`, http.StatusOK, true},
+		{"previous", `{"code": "` + code(now.Add(-period)) + `"}`, http.StatusOK, true},
+		{"next", `{"code": "` + code(now.Add(period)) + `"}`, http.StatusOK, true},
+		{"missing", `{}`, http.StatusBadRequest, false},
+		{"not JSON", `code=123456`, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		verifyLimiter = newAttemptLimiter(verifyAttempts, verifyWindow)
+		w := request(h, "POST", "/v1/totps/github/verify", testToken, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var body struct{ Valid bool }
+		decodeBody(t, w, &body)
+		if body.Valid != tt.valid {
+			t.Errorf("%s: valid %v, want %v", tt.name, body.Valid, tt.valid)
+		}
+	}
+
+	// Two periods off is outside the default skew, unless the codes happen
+	// to be the same.
+	if far := code(now.Add(2 * period)); far != code(now) && far != code(now.Add(period)) {
+		w := request(h, "POST", "/v1/totps/github/verify", testToken, `{"code": "`+far+`"}`)
+		var body struct{ Valid bool }
+		decodeBody(t, w, &body)
+		if body.Valid {
+			t.Error("a code two periods ahead is valid")
+		}
+	}
+
+	if w := request(h, "POST", "/v1/totps/steam/verify", testToken, `{"code": "ABCDE"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Steam Guard entry: status %d, want 422", w.Code)
+	}
+	if w := request(h, "POST", "/v1/totps/missing/verify", testToken, `{"code": "123456"}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing entry: status %d, want 404", w.Code)
+	}
+	if w := request(h, "GET", "/v1/totps/github/verify", testToken, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", w.Code)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Build metadata, set when building a release:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to what the Go toolchain recorded: the
+// module version for go install, and the commit and its time when built
+// from a git checkout.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// releaseRepo is the GitHub repository version --check looks for releases
+// in. Nothing is ever sent there unless --check asks for it.
+const (
+	releaseRepo         = "teamcoltra/authinator"
+	releaseCheckTimeout = 10 * time.Second
+)
+
+// buildInfo describes the running binary, as version prints it.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+
+	// Set by version --check.
+	LatestVersion   string `json:"latest_version,omitempty"`
+	LatestURL       string `json:"latest_url,omitempty"`
+	UpdateAvailable *bool  `json:"update_available,omitempty"`
+}
+
+// currentBuild returns the build metadata of the running binary.
+func currentBuild() buildInfo {
+	b := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		// Builds from a checkout get a pseudo-version such as
+		// v0.0.0-20240501120000-abcdef123456+dirty, which says less than
+		// the commit below does.
+		v := info.Main.Version
+		if b.Version == "" && v != "(devel)" && !strings.HasPrefix(v, "v0.0.0-") && !strings.HasSuffix(v, "+dirty") {
+			b.Version = v
+		}
+		modified := false
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if b.Commit == "" {
+					b.Commit = s.Value
+					if len(b.Commit) > 12 {
+						b.Commit = b.Commit[:12]
+					}
+				}
+			case "vcs.time":
+				if b.BuildDate == "" {
+					b.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && b.Commit != "" {
+			b.Commit += "-dirty"
+		}
+	}
+	if b.Version == "" {
+		b.Version = "dev"
+	}
+	b.Version = strings.TrimPrefix(b.Version, "v")
+	return b
+}
+
+// userAgent is sent with every HTTP request authinator makes, such as to a
+// --remote server or a webhook receiver.
+func userAgent() string {
+	return fmt.Sprintf("authinator/%s (+https://github.com/%s)", currentBuild().Version, releaseRepo)
+}
+
+// versionCommand prints the version and build metadata: version [--check].
+func versionCommand(args []string) {
+	fs := newFlagSet("version", "version [--check]")
+	check := fs.Bool("check", false, "ask GitHub whether a newer release exists")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		os.Exit(2)
+	}
+	if len(rest) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: authinator version [--check]")
+		os.Exit(2)
+	}
+
+	b := currentBuild()
+	if *check {
+		latest, url, err := latestRelease()
+		if err != nil {
+			fatal(fmt.Errorf("checking for a newer release: %w", err))
+		}
+		b.LatestVersion, b.LatestURL = latest, url
+		if c, ok := compareVersions(latest, b.Version); ok {
+			newer := c > 0
+			b.UpdateAvailable = &newer
+		}
+	}
+	if options.json {
+		printJSON(b)
+		return
+	}
+
+	fmt.Printf("authinator %s\n", b.Version)
+	if b.Commit != "" {
+		fmt.Printf("commit  %s\n", b.Commit)
+	}
+	if b.BuildDate != "" {
+		fmt.Printf("built   %s\n", b.BuildDate)
+	}
+	fmt.Printf("go      %s %s\n", b.GoVersion, b.Platform)
+	if !*check {
+		return
+	}
+	switch {
+	case b.UpdateAvailable == nil:
+		fmt.Printf("\nThe latest release is %s, which can't be compared with this %s build: %s\n", b.LatestVersion, b.Version, b.LatestURL)
+	case *b.UpdateAvailable:
+		fmt.Printf("\nA newer release is available: %s\n%s\n", b.LatestVersion, b.LatestURL)
+	default:
+		fmt.Printf("\nThis is the latest release (%s).\n", b.LatestVersion)
+	}
+}
+
+// latestRelease asks the GitHub API for the latest release of releaseRepo,
+// returning its version, without the leading v, and its web page.
+func latestRelease() (latest, url string, err error) {
+	req, err := http.NewRequest("GET", "https://api.github.com/repos/"+releaseRepo+"/releases/latest", nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", userAgent())
+
+	client := &http.Client{Timeout: releaseCheckTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", "", errors.New("no releases have been published yet")
+	case resp.StatusCode != http.StatusOK:
+		return "", "", fmt.Errorf("GitHub answered %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", "", fmt.Errorf("reading GitHub's answer: %w", err)
+	}
+	if release.TagName == "" {
+		return "", "", errors.New("GitHub's answer has no release tag")
+	}
+	return strings.TrimPrefix(release.TagName, "v"), release.HTMLURL, nil
+}
+
+// compareVersions compares two semantic versions such as 1.4.0 or
+// 1.5.0-rc.1, with or without a leading v, returning -1, 0 or 1 like
+// strings.Compare. Build metadata after a + is ignored. ok is false if
+// either isn't a semantic version, as for a dev build.
+func compareVersions(a, b string) (int, bool) {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := range va.core {
+		if c := cmp.Compare(va.core[i], vb.core[i]); c != 0 {
+			return c, true
+		}
+	}
+	// A pre-release comes before the release itself.
+	switch {
+	case va.pre == nil && vb.pre == nil:
+		return 0, true
+	case va.pre == nil:
+		return 1, true
+	case vb.pre == nil:
+		return -1, true
+	}
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		if c := comparePrerelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c, true
+		}
+	}
+	return cmp.Compare(len(va.pre), len(vb.pre)), true
+}
+
+type semver struct {
+	core [3]int
+	pre  []string
+}
+
+func parseVersion(s string) (semver, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, hasPre := strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	var v semver
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		if pre == "" {
+			return semver{}, false
+		}
+		v.pre = strings.Split(pre, ".")
+	}
+	return v, true
+}
+
+// comparePrerelease compares pre-release identifiers: numbers by value and
+// before words, words alphabetically.
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,257 @@
+"use strict";
+
+// The API token lives in sessionStorage, so it is asked for once per tab and
+// forgotten when the tab closes.
+const tokenKey = "authinator-token";
+
+const entriesList = document.getElementById("entries");
+const emptyNote = document.getElementById("empty");
+const statusLine = document.getElementById("status");
+const template = document.getElementById("entry-template");
+const addForm = document.getElementById("add-form");
+const forgetButton = document.getElementById("forget-token");
+
+// Rows on the page, keyed by entry name.
+let rows = new Map();
+
+function showStatus(message, isError) {
+  statusLine.textContent = message || "";
+  statusLine.className = isError ? "error" : "";
+}
+
+function entryPath(name) {
+  return "/v1/totps/" + encodeURIComponent(name);
+}
+
+async function api(method, path, body) {
+  const headers = {};
+  const token = sessionStorage.getItem(tokenKey);
+  if (token) {
+    headers["Authorization"] = "Bearer " + token;
+  }
+  const init = { method, headers };
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    init.body = JSON.stringify(body);
+  }
+
+  const res = await fetch(path, init);
+  if (res.status === 401) {
+    // Another request may already have asked for a new token.
+    if (sessionStorage.getItem(tokenKey) !== token) {
+      return api(method, path, body);
+    }
+    const entered = window.prompt(token
+      ? "The API token was rejected. Enter the token printed by authinator serve:"
+      : "Enter the API token printed by authinator serve:");
+    if (!entered) {
+      throw new Error("An API token is required.");
+    }
+    sessionStorage.setItem(tokenKey, entered.trim());
+    forgetButton.hidden = false;
+    return api(method, path, body);
+  }
+
+  const data = await res.json().catch(() => null);
+  if (!res.ok) {
+    throw new Error((data && data.message) || res.statusText);
+  }
+  return data;
+}
+
+function describe(entry) {
+  if (entry.issuer && entry.account) {
+    return entry.issuer + ": " + entry.account;
+  }
+  return entry.issuer || entry.account || "";
+}
+
+function addRow(entry) {
+  const node = template.content.firstElementChild.cloneNode(true);
+  node.querySelector(".name").textContent = entry.name;
+  node.querySelector(".detail").textContent = describe(entry);
+
+  const row = {
+    entry,
+    node,
+    code: node.querySelector(".code"),
+    fill: node.querySelector(".fill"),
+    expiresAt: 0,
+    timer: 0,
+  };
+  row.code.addEventListener("click", () => copyCode(row));
+  node.querySelector(".delete").addEventListener("click", () => deleteEntry(row));
+
+  rows.set(entry.name, row);
+  entriesList.appendChild(node);
+  refreshCode(row);
+}
+
+// refreshCode fetches the current code and schedules the next fetch for when
+// it expires, using the expires_in the server reports.
+async function refreshCode(row) {
+  clearTimeout(row.timer);
+  try {
+    const result = await api("GET", entryPath(row.entry.name) + "?peek=true");
+    row.code.textContent = result.code;
+    row.expiresAt = Date.now() + result.expires_in * 1000;
+    row.timer = setTimeout(() => refreshCode(row), result.expires_in * 1000 + 250);
+  } catch (err) {
+    row.code.textContent = "------";
+    showStatus(row.entry.name + ": " + err.message, true);
+  }
+}
+
+// drawBars updates the countdown bars locally; it doesn't contact the server.
+function drawBars() {
+  const now = Date.now();
+  for (const row of rows.values()) {
+    const period = (row.entry.period || 30) * 1000;
+    const left = Math.max(0, row.expiresAt - now);
+    row.fill.style.width = Math.min(100, (left / period) * 100) + "%";
+    row.fill.classList.toggle("expiring", left < 5000);
+  }
+  requestAnimationFrame(drawBars);
+}
+
+async function copyCode(row) {
+  try {
+    await navigator.clipboard.writeText(row.code.textContent);
+    showStatus("Copied the code for " + row.entry.name + ".");
+  } catch (err) {
+    showStatus("Couldn't copy to the clipboard: " + err.message, true);
+  }
+}
+
+async function deleteEntry(row) {
+  if (!window.confirm("Move " + row.entry.name + " to the trash?")) {
+    return;
+  }
+  try {
+    await api("DELETE", entryPath(row.entry.name));
+    clearTimeout(row.timer);
+    row.node.remove();
+    rows.delete(row.entry.name);
+    emptyNote.hidden = rows.size > 0;
+    showStatus("Moved " + row.entry.name + " to the trash.");
+  } catch (err) {
+    showStatus(err.message, true);
+  }
+}
+
+async function loadEntries() {
+  try {
+    const entries = await api("GET", "/v1/totps");
+    for (const row of rows.values()) {
+      clearTimeout(row.timer);
+    }
+    rows = new Map();
+    entriesList.replaceChildren();
+    entries.sort((a, b) => a.name.localeCompare(b.name));
+    entries.forEach(addRow);
+    emptyNote.hidden = entries.length > 0;
+  } catch (err) {
+    showStatus(err.message, true);
+  }
+}
+
+// entryName matches the name authinator gives entries added from a URI.
+function entryName(issuer, account) {
+  if (!issuer) {
+    return account;
+  }
+  if (!account) {
+    return issuer;
+  }
+  return issuer + " - " + account;
+}
+
+// parseURI reads an otpauth://totp/ Key URI into an entry.
+function parseURI(raw) {
+  let url;
+  try {
+    url = new URL(raw.trim());
+  } catch (err) {
+    throw new Error("That isn't a valid URI.");
+  }
+  if (url.protocol.toLowerCase() !== "otpauth:") {
+    throw new Error("Only otpauth:// URIs are supported.");
+  }
+  if (url.host.toLowerCase() !== "totp") {
+    throw new Error("Only TOTP URIs are supported.");
+  }
+
+  const label = decodeURIComponent(url.pathname.replace(/^\//, ""));
+  let issuer = "";
+  let account = label.trim();
+  const colon = label.indexOf(":");
+  if (colon >= 0) {
+    issuer = label.slice(0, colon).trim();
+    account = label.slice(colon + 1).trim();
+  }
+  const params = url.searchParams;
+  issuer = params.get("issuer") || issuer;
+
+  const entry = {
+    name: entryName(issuer, account),
+    secret: params.get("secret") || "",
+    issuer,
+    account,
+  };
+  if (params.get("algorithm")) {
+    entry.algorithm = params.get("algorithm").toUpperCase();
+  }
+  if (params.get("digits")) {
+    entry.digits = Number(params.get("digits"));
+  }
+  if (params.get("period")) {
+    entry.period = Number(params.get("period"));
+  }
+  return entry;
+}
+
+async function addEntry(event) {
+  event.preventDefault();
+  const form = new FormData(addForm);
+  const field = (key) => (form.get(key) || "").trim();
+
+  let entry = {};
+  try {
+    if (field("uri")) {
+      entry = parseURI(field("uri"));
+    }
+  } catch (err) {
+    showStatus(err.message, true);
+    return;
+  }
+  for (const key of ["name", "secret", "issuer", "account", "algorithm"]) {
+    if (field(key)) {
+      entry[key] = field(key);
+    }
+  }
+  for (const key of ["digits", "period"]) {
+    if (field(key)) {
+      entry[key] = Number(field(key));
+    }
+  }
+
+  try {
+    const created = await api("POST", "/v1/totps", entry);
+    addForm.reset();
+    showStatus("Added " + created.name + ".");
+    await loadEntries();
+  } catch (err) {
+    showStatus(err.message, true);
+  }
+}
+
+forgetButton.hidden = !sessionStorage.getItem(tokenKey);
+forgetButton.addEventListener("click", () => {
+  sessionStorage.removeItem(tokenKey);
+  forgetButton.hidden = true;
+  showStatus("Forgot the API token.");
+});
+addForm.addEventListener("submit", addEntry);
+
+loadEntries();
+requestAnimationFrame(drawBars);
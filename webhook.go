@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Webhook events, sent when an entry is created, changed or renamed, or
+// removed through the API.
+const (
+	webhookCreated = "entry.created"
+	webhookUpdated = "entry.updated"
+	webhookDeleted = "entry.deleted"
+)
+
+// Webhook deliveries time out after webhookTimeout and are tried up to
+// webhookAttempts times, waiting webhookBackoff before the second attempt and
+// twice as long before each one after it. At most webhookQueue deliveries
+// wait for each URL; beyond that new ones are dropped and logged.
+const (
+	webhookSecretFile = "webhook-secret"
+	webhookTimeout    = 10 * time.Second
+	webhookAttempts   = 4
+	webhookBackoff    = 2 * time.Second
+	webhookQueue      = 100
+)
+
+// webhookPayload is the JSON body of a webhook. It never has the secret of
+// the entry. PreviousName is set when the entry was renamed, and Trashed when
+// a deleted entry was moved to the trash rather than deleted for good.
+type webhookPayload struct {
+	Event        string    `json:"event"`
+	Time         time.Time `json:"time"`
+	Name         string    `json:"name"`
+	Issuer       string    `json:"issuer,omitempty"`
+	PreviousName string    `json:"previous_name,omitempty"`
+	Trashed      bool      `json:"trashed,omitempty"`
+}
+
+// webhookDelivery is a payload on its way to one URL. Its id is sent on every
+// attempt, so receivers can drop repeats.
+type webhookDelivery struct {
+	id    string
+	event string
+	body  []byte
+}
+
+// webhook delivers the events it was set up for to one URL, in order, one at
+// a time.
+type webhook struct {
+	url    string
+	events []string // nil for every event
+	queue  chan webhookDelivery
+}
+
+func (h *webhook) wants(event string) bool {
+	if h.events == nil {
+		return true
+	}
+	for _, e := range h.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhooks are the webhooks of serve, nil when there are none.
+var webhooks *webhookSender
+
+type webhookSender struct {
+	hooks  []*webhook
+	secret []byte
+	client *http.Client
+	done   sync.WaitGroup
+}
+
+// checkWebhookURL makes sure rawURL is an absolute http or https URL.
+func checkWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: use an http or https URL such as https://hooks.example/auther", rawURL)
+	}
+	return nil
+}
+
+// webhookSecret returns the secret webhook payloads are signed with: the
+// --webhook-secret flag, then AUTHER_WEBHOOK_SECRET, then the secret saved in
+// the config directory, which is generated the first time; generated is then
+// true.
+func webhookSecret(flagValue string) (secret string, generated bool, err error) {
+	if flagValue != "" {
+		return flagValue, false, nil
+	}
+	if env := os.Getenv("AUTHER_WEBHOOK_SECRET"); env != "" {
+		return env, false, nil
+	}
+	return savedSecret(webhookSecretFile)
+}
+
+// startWebhooks starts delivering webhooks, signed with secret: every event
+// to urls, and the events in byEvent to the URLs listed for them. Each URL
+// gets a single webhook, so its events arrive in order.
+func startWebhooks(urls []string, byEvent map[string][]string, secret string) {
+	s := &webhookSender{
+		secret: []byte(secret),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+	hooks := map[string]*webhook{}
+	add := func(u string, events []string) {
+		h, ok := hooks[u]
+		switch {
+		case !ok:
+			h = &webhook{url: u, events: events, queue: make(chan webhookDelivery, webhookQueue)}
+			hooks[u] = h
+			s.hooks = append(s.hooks, h)
+		case h.events != nil && events == nil:
+			h.events = nil
+		case h.events != nil:
+			h.events = append(h.events, events...)
+		}
+	}
+	for _, u := range urls {
+		add(u, nil)
+	}
+	for _, event := range []string{webhookCreated, webhookUpdated, webhookDeleted} {
+		for _, u := range byEvent[event] {
+			add(u, []string{event})
+		}
+	}
+	for _, h := range s.hooks {
+		s.done.Add(1)
+		go s.deliver(h)
+	}
+	webhooks = s
+}
+
+// notifyWebhooks queues event for every webhook that wants it. It never
+// blocks, so a slow or unreachable receiver can't hold up the request that
+// made the change.
+func notifyWebhooks(event string, payload webhookPayload) {
+	if webhooks == nil {
+		return
+	}
+	payload.Event = event
+	payload.Time = time.Now().UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("encoding a webhook payload", "err", err)
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	delivery := webhookDelivery{id: hex.EncodeToString(id), event: event, body: body}
+
+	for _, h := range webhooks.hooks {
+		if !h.wants(event) {
+			continue
+		}
+		select {
+		case h.queue <- delivery:
+		default:
+			slog.Warn(fmt.Sprintf("dropped a webhook: %d deliveries are already waiting", webhookQueue),
+				"event", event, "entry", payload.Name, "url", h.url)
+		}
+	}
+}
+
+// stopWebhooks waits until the deliveries already queued are done, or until
+// ctx is done, whichever comes first.
+func stopWebhooks(ctx context.Context) {
+	if webhooks == nil {
+		return
+	}
+	for _, h := range webhooks.hooks {
+		close(h.queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		webhooks.done.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("gave up on webhooks still being delivered")
+	}
+}
+
+// deliver sends the deliveries queued for h until its queue is closed.
+func (s *webhookSender) deliver(h *webhook) {
+	defer s.done.Done()
+	for d := range h.queue {
+		wait := webhookBackoff
+		for attempt := 1; ; attempt++ {
+			retry, err := s.post(h.url, d)
+			if err == nil {
+				break
+			}
+			if !retry || attempt == webhookAttempts {
+				if attempt > 1 {
+					err = fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+				}
+				slog.Error("webhook failed", "event", d.event, "url", h.url, "err", err)
+				break
+			}
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+}
+
+// post makes one attempt at delivering d to target. The body is signed with
+// HMAC-SHA256 in the X-Auther-Signature header, as "sha256=" and the
+// signature in hex. Failures that may pass, such as a network error, a 5xx
+// or a 429, are worth retrying; a receiver rejecting the request isn't.
+func (s *webhookSender) post(target string, d webhookDelivery) (retry bool, err error) {
+	req, err := http.NewRequest("POST", target, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(d.body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("X-Auther-Event", d.event)
+	req.Header.Set("X-Auther-Delivery", d.id)
+	req.Header.Set("X-Auther-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		slog.Debug("webhook attempt failed", "event", d.event, "url", target, "delivery", d.id, "err", err)
+		return true, err
+	}
+	resp.Body.Close()
+	slog.Debug("webhook sent", "event", d.event, "url", target, "delivery", d.id, "status", resp.StatusCode, "took", time.Since(start))
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("receiver answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+}
+
+// webhookEntry is the part of a payload that describes entry.
+func webhookEntry(entry TOTPEntry) webhookPayload {
+	return webhookPayload{Name: entry.Name, Issuer: entry.Issuer}
+}